@@ -0,0 +1,318 @@
+package goredis
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Blocking Commands for Redis Clone
+
+A blocking command like BLPOP waits for a key to get data instead of
+replying with a null. Every such command needs the same machinery: the
+client has to be parked with the keys it waits on, woken up when one of
+them is written, in the order clients started waiting, answered if its
+timeout passes first, and forgotten if it disconnects. This file is that
+machinery, shared by all of them; a command only says which keys it
+waits on, how long, and how to serve itself from one key.
+
+Key concepts:
+- Blocking: The command first runs like its non-blocking twin, trying its
+  keys in order; if none can serve it, the client is parked and gets no
+  reply for now
+- Waiting Clients: A parked client runs nothing else; commands it sends
+  meanwhile wait in its inbox and run, in order, once it's served or
+  times out (see schedule.go). Its reader keeps reading, so QUIT and
+  disconnects are still noticed
+- Wakeups: A storage hook marks keys clients wait on as ready when they're
+  written; after each command the server loop retries the clients waiting
+  on ready keys, first come first served, until a key runs dry
+- Timeouts: One timer, set to the earliest deadline, fires on the server
+  loop; clients past their deadline get a null array, like Redis
+- Disconnects: A client that disconnects while parked is removed, with
+  the commands it queued; QUIT drops the wait too
+- Extending: BLPOP and BRPOP use it today; BLMOVE or BZPOPMIN would
+  implement blockingCommand the same way. Streams (XREAD BLOCK) and
+  replicas to wait for (WAIT) don't exist in this server yet
+*/
+
+/*
+blockingCommand is implemented by commands that wait for data on keys
+
+dispatch runs them through executeBlocking instead of Execute, which
+stays the non-blocking version.
+*/
+type blockingCommand interface {
+	Command
+
+	// blockingKeys returns the keys the command waits on, in the order they're tried
+	blockingKeys() [][]byte
+
+	// blockTimeout returns how long the command waits, 0 to wait forever
+	blockTimeout() time.Duration
+
+	// serve tries to run the command on one key, served false if the key can't serve it yet
+	serve(storage *Storage, key []byte) (reply []byte, served bool, err error)
+}
+
+/*
+blockedClient is a client parked by a blocking command
+*/
+type blockedClient struct {
+	req      *Request        // the blocking command, for its reply and change data capture
+	cmd      blockingCommand // req.cmd
+	keys     []string        // the keys the client waits on
+	deadline time.Time       // when the client times out, zero to wait forever
+}
+
+/*
+blockingState tracks the parked clients of a server
+
+Only the server loop changes it. waiters is also read by the storage hook,
+which may run on the active expire goroutine, so the loop changes it under
+mu; the loop itself reads it without locking. mu must never be held while
+calling into the storage, since the hook runs under the storage lock.
+*/
+type blockingState struct {
+	clients map[*Peer]*blockedClient // parked clients by connection
+	timer   *time.Timer              // fires at the earliest deadline, stopped without one
+	hooked  bool                     // the storage hook is registered
+
+	mu      sync.Mutex
+	waiters map[string][]*blockedClient // clients waiting on each key, in the order they blocked
+	ready   []string                    // keys written since the last wakeup, in the order they were
+	marked  map[string]bool             // the keys in ready
+	waiting atomic.Int64                // len(clients), so the hook skips the lock when nobody waits
+}
+
+/*
+newBlockingState returns an empty state, with its timer stopped
+*/
+func newBlockingState() *blockingState {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return &blockingState{
+		clients: make(map[*Peer]*blockedClient),
+		timer:   timer,
+		waiters: make(map[string][]*blockedClient),
+		marked:  make(map[string]bool),
+	}
+}
+
+/*
+keyWritten is the storage hook marking keys clients wait on as ready
+*/
+func (b *blockingState) keyWritten(event HookEvent, keyStr string) {
+	if event != HookWrite || b.waiting.Load() == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.waiters[keyStr]; ok && !b.marked[keyStr] {
+		b.marked[keyStr] = true
+		b.ready = append(b.ready, keyStr)
+	}
+}
+
+/*
+takeReady returns the keys marked ready, and clears them
+*/
+func (b *blockingState) takeReady() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ready := b.ready
+	b.ready = nil
+	clear(b.marked)
+	return ready
+}
+
+/*
+isBlocked reports whether a client is parked
+*/
+func (b *blockingState) isBlocked(peer *Peer) bool {
+	_, ok := b.clients[peer]
+	return ok
+}
+
+/*
+executeBlocking runs a blocking command: right away if one of its keys can
+serve it, else by parking the client
+
+A client is parked only when it has a connection to answer later on;
+without one the command replies like on timeout, as Redis does in
+transactions and scripts.
+*/
+func (s *Server) executeBlocking(cmd blockingCommand, req *Request) ([]byte, error) {
+	for _, key := range cmd.blockingKeys() {
+		reply, served, err := cmd.serve(s.storage, key)
+		if err != nil || served {
+			return reply, err
+		}
+	}
+	if req.peer == nil {
+		return respNullArrayFor(req.protocol()), nil
+	}
+
+	s.block(req, cmd)
+	req.blocked = true
+	return nil, nil
+}
+
+/*
+block parks the client that sent req
+*/
+func (s *Server) block(req *Request, cmd blockingCommand) {
+	b := s.blocking
+	if !b.hooked {
+		// Servers that never block don't pay for the hook on every write
+		s.storage.RegisterHook(b.keyWritten)
+		b.hooked = true
+	}
+
+	client := &blockedClient{req: req, cmd: cmd}
+	if timeout := cmd.blockTimeout(); timeout > 0 {
+		client.deadline = time.Now().Add(timeout)
+	}
+	for _, key := range cmd.blockingKeys() {
+		if !slices.Contains(client.keys, string(key)) {
+			client.keys = append(client.keys, string(key))
+		}
+	}
+
+	b.mu.Lock()
+	for _, key := range client.keys {
+		b.waiters[key] = append(b.waiters[key], client)
+	}
+	b.mu.Unlock()
+
+	b.clients[req.peer] = client
+	b.waiting.Store(int64(len(b.clients)))
+	s.resetBlockTimer()
+
+	// Its reader reads on, so QUIT and disconnects are noticed
+	s.scheduler.park(req.peer)
+}
+
+/*
+unblock removes a parked client from every key it waits on
+*/
+func (s *Server) unblock(client *blockedClient) {
+	b := s.blocking
+	b.mu.Lock()
+	for _, key := range client.keys {
+		waiters := slices.DeleteFunc(b.waiters[key], func(c *blockedClient) bool { return c == client })
+		if len(waiters) == 0 {
+			delete(b.waiters, key)
+		} else {
+			b.waiters[key] = waiters
+		}
+	}
+	b.mu.Unlock()
+
+	delete(b.clients, client.req.peer)
+	b.waiting.Store(int64(len(b.clients)))
+	s.resetBlockTimer()
+
+	// Commands the client sent meanwhile get their turn again
+	s.scheduler.resume(client.req.peer)
+}
+
+/*
+resetBlockTimer sets the timer to the earliest deadline of the parked clients
+*/
+func (s *Server) resetBlockTimer() {
+	b := s.blocking
+	var earliest time.Time
+	for _, client := range b.clients {
+		if !client.deadline.IsZero() && (earliest.IsZero() || client.deadline.Before(earliest)) {
+			earliest = client.deadline
+		}
+	}
+
+	b.timer.Stop()
+	if !earliest.IsZero() {
+		b.timer.Reset(time.Until(earliest))
+	}
+}
+
+/*
+serveBlocked wakes the clients waiting on keys written since the last call
+
+Called by the server loop after every command. Each ready key serves its
+clients in the order they blocked, as long as it can.
+*/
+func (s *Server) serveBlocked() {
+	for _, keyStr := range s.blocking.takeReady() {
+		s.serveKey(keyStr)
+	}
+}
+
+/*
+serveKey serves the clients waiting on one key, first come first served
+*/
+func (s *Server) serveKey(keyStr string) {
+	for {
+		waiters := s.blocking.waiters[keyStr]
+		if len(waiters) == 0 {
+			return
+		}
+		client := waiters[0]
+
+		// A key that can't serve (emptied again, or now of another type) keeps its clients waiting
+		reply, served, err := client.cmd.serve(s.storage, []byte(keyStr))
+		if err != nil || !served {
+			return
+		}
+
+		s.unblock(client)
+		s.emitChanges(client.req)
+		client.req.peer.Send(reply)
+	}
+}
+
+/*
+expireBlocked answers the parked clients whose deadline passed
+
+Called by the server loop when the timer fires.
+*/
+func (s *Server) expireBlocked() {
+	now := time.Now()
+	var expired []*blockedClient
+	for _, client := range s.blocking.clients {
+		if !client.deadline.IsZero() && !client.deadline.After(now) {
+			expired = append(expired, client)
+		}
+	}
+	slices.SortFunc(expired, func(a, b *blockedClient) int { return a.deadline.Compare(b.deadline) })
+
+	for _, client := range expired {
+		s.unblock(client)
+		client.req.peer.Send(respNullArrayFor(client.req.protocol()))
+	}
+	s.resetBlockTimer()
+}
+
+/*
+removeBlocked forgets a parked client, without replying: it disconnected
+or sent QUIT
+*/
+func (s *Server) removeBlocked(peer *Peer) {
+	if client, ok := s.blocking.clients[peer]; ok {
+		s.unblock(client)
+	}
+}
+
+/*
+respNullArrayFor returns the null array for the protocol version
+RESP2: *-1\r\n, RESP3: _\r\n
+*/
+func respNullArrayFor(protocol int) []byte {
+	if protocol >= 3 {
+		return respNull3
+	}
+	return respNullArray
+}
@@ -0,0 +1,88 @@
+package goredis_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+waitBlocked waits until the server has n clients parked by blocking commands
+*/
+func waitBlocked(t *testing.T, client *testClient, n int) {
+	t.Helper()
+
+	want := "blocked_clients:" + strconv.Itoa(n) + "\r\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(client.do("INFO", "clients"), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients never blocked", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBlockingServesClientsInOrder(t *testing.T) {
+	server := startServer(t, nil)
+	first, second, writer := dial(t, server), dial(t, server), dial(t, server)
+
+	first.send("BLPOP", "queue", "0")
+	waitBlocked(t, writer, 1)
+	second.send("BRPOP", "other", "queue", "0")
+	waitBlocked(t, writer, 2)
+
+	// One element serves only the client that blocked first
+	writer.expect(":1\r\n", "RPUSH", "queue", "a")
+	if got := first.read(); got != "*2\r\n$5\r\nqueue\r\n$1\r\na\r\n" {
+		t.Errorf("first client: got %q, want the first element", got)
+	}
+	waitBlocked(t, writer, 1)
+
+	writer.expect(":2\r\n", "RPUSH", "queue", "b", "c")
+	if got := second.read(); got != "*2\r\n$5\r\nqueue\r\n$1\r\nc\r\n" {
+		t.Errorf("second client: got %q, want the tail of the list", got)
+	}
+	writer.expect("*1\r\n$1\r\nb\r\n", "LRANGE", "queue", "0", "-1")
+	waitBlocked(t, writer, 0)
+}
+
+func TestBlockingTimeout(t *testing.T) {
+	server := startServer(t, nil)
+
+	tests := []struct {
+		name     string
+		protocol string
+		want     string
+	}{
+		{"RESP2", "2", "*-1\r\n"},
+		{"RESP3", "3", "_\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dial(t, server)
+			client.do("HELLO", tt.protocol)
+
+			start := time.Now()
+			client.expect(tt.want, "BLPOP", "missing", "0.05")
+			if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+				t.Errorf("timed out after %v, want at least 50ms", elapsed)
+			}
+			client.expect(":0\r\n", "EXISTS", "missing")
+		})
+	}
+}
+
+func TestBlockingClientDisconnects(t *testing.T) {
+	server := startServer(t, nil)
+	gone, writer := dial(t, server), dial(t, server)
+
+	gone.send("BLPOP", "queue", "0")
+	waitBlocked(t, writer, 1)
+	gone.conn.Close()
+	waitBlocked(t, writer, 0)
+
+	// The element stays in the list instead of going to the closed connection
+	writer.expect(":1\r\n", "RPUSH", "queue", "a")
+	writer.expect(":1\r\n", "LLEN", "queue")
+}
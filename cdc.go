@@ -0,0 +1,234 @@
+package goredis
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+/*
+Change Data Capture for Redis Clone
+
+This file lets code embedding the server observe every write it applies,
+for example to mirror the keyspace into a database, a search index or
+another cache. Handlers registered with Server.OnChange receive one Change
+per key a write command touched, carrying the key's type and a copy of its
+new value.
+
+Key concepts:
+- Command Level: Changes are emitted after a write command ran without
+  error, so they follow the order in which commands were applied
+- Full Values: Each change carries the whole new value of the key, not a
+  diff, so a consumer can always apply it on its own
+- Deletes and Flushes: A key a command left missing (DEL, popping the last
+  element, ...) is reported as a delete; FLUSHALL is a single flush
+- No-op Writes: A write that turned out to change nothing (SREM of a
+  missing member) still reports the key's current state
+*/
+
+/*
+ChangeKind says what happened to a key
+*/
+type ChangeKind int
+
+const (
+	ChangeWrite  ChangeKind = iota // the key holds a new value
+	ChangeDelete                   // the key doesn't exist anymore
+	ChangeFlush                    // every key was removed (FLUSHALL)
+)
+
+/*
+Change describes the effect of a write command on one key
+
+Value holds a copy of the new value, shaped by Type:
+  - TypeString: []byte
+  - TypeList: [][]byte, head first
+  - TypeSet: []string, in no particular order
+  - TypeHash: map[string][]byte
+  - TypeZSet: []ScoredMember, lowest score first
+
+For deletes and flushes Type is TypeNone and Value is nil; a flush has no key.
+*/
+type Change struct {
+	Kind     ChangeKind
+	Command  string    // the command that made the change, upper-case (e.g. "LPUSH")
+	Key      string    // the key that changed
+	Type     ValueType // the type of the new value
+	Value    any       // a copy of the new value
+	ExpireAt time.Time // when the key expires, zero if it has no TTL
+}
+
+/*
+ScoredMember is a sorted set member with its score, as reported in changes
+*/
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+/*
+OnChange registers a handler that receives every change applied by write commands
+
+Handlers run on the server loop goroutine, right after the command that
+caused the change, so they see changes in the exact order they happened.
+That also means a slow handler delays every client: heavy work should be
+handed off, for example through a buffered channel. Handlers must not call
+back into the server.
+
+OnChange must be called before Start.
+*/
+func (s *Server) OnChange(handler func(Change)) {
+	s.changeHandlers = append(s.changeHandlers, handler)
+}
+
+/*
+writeCommand is implemented by commands that modify keys
+
+writtenKeys returns every key the command may have changed.
+*/
+type writeCommand interface {
+	writtenKeys() [][]byte
+}
+
+func (c SetCommand) writtenKeys() [][]byte        { return [][]byte{c.key} }
+func (c DelCommand) writtenKeys() [][]byte        { return c.keys }
+func (c AppendCommand) writtenKeys() [][]byte     { return [][]byte{c.key} }
+func (c SetRangeCommand) writtenKeys() [][]byte   { return [][]byte{c.key} }
+func (c IncrCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c DecrCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c IncrByCommand) writtenKeys() [][]byte     { return [][]byte{c.key} }
+func (c DecrByCommand) writtenKeys() [][]byte     { return [][]byte{c.key} }
+func (c MSetCommand) writtenKeys() [][]byte       { return c.commandKeys() }
+func (c PushCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c PopCommand) writtenKeys() [][]byte        { return [][]byte{c.key} }
+func (c LInsertCommand) writtenKeys() [][]byte    { return [][]byte{c.key} }
+func (c LSetCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c LRemCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c LTrimCommand) writtenKeys() [][]byte      { return [][]byte{c.key} }
+func (c SAddCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c SRemCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c SMoveCommand) writtenKeys() [][]byte      { return [][]byte{c.source, c.destination} }
+func (c SPopCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c SetOpStoreCommand) writtenKeys() [][]byte { return [][]byte{c.destination} }
+func (c HSetCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c HSetNXCommand) writtenKeys() [][]byte     { return [][]byte{c.key} }
+func (c HDelCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c HIncrByCommand) writtenKeys() [][]byte    { return [][]byte{c.key} }
+func (c HExpireCommand) writtenKeys() [][]byte    { return [][]byte{c.key} }
+func (c HPersistCommand) writtenKeys() [][]byte   { return [][]byte{c.key} }
+func (c ZAddCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c ZIncrByCommand) writtenKeys() [][]byte    { return [][]byte{c.key} }
+func (c ZRemCommand) writtenKeys() [][]byte       { return [][]byte{c.key} }
+func (c GetSetCommand) writtenKeys() [][]byte     { return [][]byte{c.key} }
+func (c ImportCommand) writtenKeys() [][]byte     { return c.commandKeys() }
+
+// A blocking pop reports every list it waited on; those it didn't pop from are no-op writes
+func (c BlockingPopCommand) writtenKeys() [][]byte { return c.keys }
+
+/*
+emitChanges reports the effects of a successfully executed request to the change handlers
+*/
+func (s *Server) emitChanges(req *Request) {
+	if len(s.changeHandlers) == 0 {
+		return
+	}
+
+	command := req.Name()
+	if _, ok := req.cmd.(FlushAllCommand); ok {
+		s.publishChange(Change{Kind: ChangeFlush, Command: command, Type: TypeNone})
+		return
+	}
+
+	wc, ok := req.cmd.(writeCommand)
+	if !ok {
+		return
+	}
+	for _, key := range wc.writtenKeys() {
+		change := Change{Kind: ChangeDelete, Command: command, Key: string(key), Type: TypeNone}
+		if valueType, value, expireAt, exists := s.storage.Snapshot(key); exists {
+			change.Kind = ChangeWrite
+			change.Type = valueType
+			change.Value = value
+			change.ExpireAt = expireAt
+		}
+		s.publishChange(change)
+	}
+}
+
+/*
+publishChange calls every change handler with change
+*/
+func (s *Server) publishChange(change Change) {
+	for _, handler := range s.changeHandlers {
+		handler(change)
+	}
+}
+
+/*
+Snapshot returns a copy of the value at key, in the shapes documented on Change
+
+The copy shares no memory with the storage, so it stays valid and
+unchanged whatever happens to the key afterwards.
+
+Returns: The value type, the copied value, the expiry time (zero without
+a TTL), and false if the key doesn't exist
+*/
+func (s *Storage) Snapshot(key []byte) (ValueType, any, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return TypeNone, nil, time.Time{}, false
+	}
+	return e.valueType(), e.copyValue(), e.expireTime(), true
+}
+
+/*
+expireTime returns when the entry expires, zero if it has no TTL
+*/
+func (e *entry) expireTime() time.Time {
+	if e.expireAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, e.expireAt)
+}
+
+/*
+copyValue returns a copy of the entry's value, in the shapes documented on Change
+
+Must be called with at least the read lock held.
+*/
+func (e *entry) copyValue() any {
+	var value any
+	switch v := e.value.(type) {
+	case []byte, int64, *compressedString, *sparseString:
+		value = slices.Clone(e.stringBytes())
+	case *listValue:
+		items := make([][]byte, len(v.items))
+		for i, item := range v.items {
+			items[i] = slices.Clone(item)
+		}
+		value = items
+	case *setValue:
+		value = slices.Clone(v.members)
+	case *hashValue:
+		fields := maps.Clone(v.fields)
+		now := time.Now().UnixNano()
+		for field, fieldValue := range fields {
+			if v.fieldExpired(field, now) {
+				delete(fields, field)
+				continue
+			}
+			fields[field] = slices.Clone(fieldValue)
+		}
+		value = fields
+	case *zsetValue:
+		members := make([]ScoredMember, 0, v.len())
+		for n := v.sorted.first(); n != nil; n = n.next() {
+			members = append(members, ScoredMember{Member: n.item.member, Score: n.item.score})
+		}
+		value = members
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package goredis_test
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+changeRecorder collects the changes a server reports
+*/
+type changeRecorder struct {
+	mu      sync.Mutex
+	changes []goredis.Change
+}
+
+func (r *changeRecorder) record(change goredis.Change) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, change)
+}
+
+/*
+take returns the changes recorded so far and forgets them
+
+Handlers run right after their command on the server loop, so once a
+client has the reply to a later command, its earlier changes are in.
+*/
+func (r *changeRecorder) take() []goredis.Change {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changes := r.changes
+	r.changes = nil
+	return changes
+}
+
+func TestOnChange(t *testing.T) {
+	var recorder changeRecorder
+	server := startServer(t, func(server *goredis.Server) {
+		server.OnChange(recorder.record)
+	})
+	client := dial(t, server)
+
+	tests := []struct {
+		name string
+		args []string
+		want []goredis.Change
+	}{
+		{"string", []string{"SET", "name", "John"}, []goredis.Change{
+			{Kind: goredis.ChangeWrite, Command: "SET", Key: "name", Type: goredis.TypeString, Value: []byte("John")},
+		}},
+		{"list", []string{"RPUSH", "list", "a", "b"}, []goredis.Change{
+			{Kind: goredis.ChangeWrite, Command: "RPUSH", Key: "list", Type: goredis.TypeList, Value: [][]byte{[]byte("a"), []byte("b")}},
+		}},
+		{"hash", []string{"HSET", "user", "name", "Ann"}, []goredis.Change{
+			{Kind: goredis.ChangeWrite, Command: "HSET", Key: "user", Type: goredis.TypeHash, Value: map[string][]byte{"name": []byte("Ann")}},
+		}},
+		{"sorted set", []string{"ZADD", "board", "2", "bob", "1", "amy"}, []goredis.Change{
+			{Kind: goredis.ChangeWrite, Command: "ZADD", Key: "board", Type: goredis.TypeZSet, Value: []goredis.ScoredMember{{Member: "amy", Score: 1}, {Member: "bob", Score: 2}}},
+		}},
+		{"several keys", []string{"MSET", "a", "1", "b", "2"}, []goredis.Change{
+			{Kind: goredis.ChangeWrite, Command: "MSET", Key: "a", Type: goredis.TypeString, Value: []byte("1")},
+			{Kind: goredis.ChangeWrite, Command: "MSET", Key: "b", Type: goredis.TypeString, Value: []byte("2")},
+		}},
+		{"custom command", []string{"UPPERSET", "shout", "hey"}, []goredis.Change{
+			{Kind: goredis.ChangeWrite, Command: "UPPERSET", Key: "shout", Type: goredis.TypeString, Value: []byte("HEY")},
+		}},
+		{"popped empty", []string{"LPOP", "list", "2"}, []goredis.Change{
+			{Kind: goredis.ChangeDelete, Command: "LPOP", Key: "list", Type: goredis.TypeNone},
+		}},
+		{"delete", []string{"DEL", "name"}, []goredis.Change{
+			{Kind: goredis.ChangeDelete, Command: "DEL", Key: "name", Type: goredis.TypeNone},
+		}},
+		{"read", []string{"GET", "a"}, nil},
+		{"failed write", []string{"LPUSH", "a", "x"}, nil},
+		{"flush", []string{"FLUSHALL"}, []goredis.Change{
+			{Kind: goredis.ChangeFlush, Command: "FLUSHALL", Type: goredis.TypeNone},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.do(tt.args...)
+			client.do("PING")
+
+			// The keys of one command may be reported in any order
+			got := recorder.take()
+			slices.SortStableFunc(got, func(a, b goredis.Change) int { return strings.Compare(a.Key, b.Key) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes of %v:\n got  %+v\n want %+v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnChangeReportsExpiry(t *testing.T) {
+	var recorder changeRecorder
+	server := startServer(t, func(server *goredis.Server) {
+		server.OnChange(recorder.record)
+	})
+	client := dial(t, server)
+
+	before := time.Now()
+	client.expect("+OK\r\n", "SET", "session", "token", "EX", "100")
+	client.do("PING")
+
+	changes := recorder.take()
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1: %+v", len(changes), changes)
+	}
+	if expireAt := changes[0].ExpireAt; expireAt.Before(before.Add(99*time.Second)) || expireAt.After(time.Now().Add(100*time.Second)) {
+		t.Errorf("ExpireAt is %v, want about 100s from %v", expireAt, before)
+	}
+}
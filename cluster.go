@@ -0,0 +1,145 @@
+package goredis
+
+import "bytes"
+
+/*
+Cluster Key Slots for Redis Clone
+
+Redis Cluster splits the keyspace into 16384 hash slots and every key
+belongs to exactly one of them. A multi-key command only works in a
+cluster when all of its keys live in the same slot, since different slots
+may be served by different nodes.
+
+This server always serves every slot itself, but when started with
+-clusterEnabled it enforces the same rule as a cluster node, so code that
+is tested against it doesn't break once it meets a real cluster.
+
+Key concepts:
+- Key Slot: CRC16 (XMODEM) of the key, modulo 16384
+- Hash Tags: If the key contains "{...}" with at least one character
+  between the braces, only that part is hashed, so "user:{42}:name" and
+  "user:{42}:email" share a slot
+- CROSSSLOT: Multi-key commands whose keys map to different slots fail
+*/
+
+/*
+clusterSlots is the number of hash slots in a Redis Cluster
+*/
+const clusterSlots = 16384
+
+/*
+crc16Table is the lookup table for CRC16-CCITT (XMODEM), polynomial 0x1021
+*/
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+/*
+crc16 computes the CRC16 variant Redis Cluster uses for key slots
+*/
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+/*
+keyHashSlot returns the cluster slot of key, honoring hash tags
+
+Only the first "{" counts, and only if a "}" follows it with something in
+between; "{}" or an unclosed "{" means the whole key is hashed.
+
+Examples:
+  - keyHashSlot("foo") -> 12182
+  - keyHashSlot("{user1000}.following") == keyHashSlot("{user1000}.followers")
+  - keyHashSlot("foo{}{bar}") hashes the whole key
+*/
+func keyHashSlot(key []byte) int {
+	if start := bytes.IndexByte(key, '{'); start >= 0 {
+		if end := bytes.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+/*
+multiKeyCommand is implemented by commands that work on more than one key
+
+The keys are what cluster mode checks for CROSSSLOT.
+*/
+type multiKeyCommand interface {
+	commandKeys() [][]byte
+}
+
+func (c DelCommand) commandKeys() [][]byte    { return c.keys }
+func (c ExistsCommand) commandKeys() [][]byte { return c.keys }
+func (c MGetCommand) commandKeys() [][]byte   { return c.keys }
+func (c SetOpCommand) commandKeys() [][]byte  { return c.keys }
+
+func (c BlockingPopCommand) commandKeys() [][]byte { return c.keys }
+
+func (c MSetCommand) commandKeys() [][]byte {
+	keys := make([][]byte, 0, len(c.pairs))
+	for key := range c.pairs {
+		keys = append(keys, []byte(key))
+	}
+	return keys
+}
+
+func (c SMoveCommand) commandKeys() [][]byte {
+	return [][]byte{c.source, c.destination}
+}
+
+func (c SetOpStoreCommand) commandKeys() [][]byte {
+	return append([][]byte{c.destination}, c.keys...)
+}
+
+func (c SSubscribeCommand) commandKeys() [][]byte { return c.channels }
+
+func (c ImportCommand) commandKeys() [][]byte {
+	keys := make([][]byte, len(c.records))
+	for i, r := range c.records {
+		keys[i] = r.Key
+	}
+	return keys
+}
+
+/*
+checkSlots rejects a multi-key command whose keys span several slots
+
+It only applies in cluster mode; a standalone server accepts any keys.
+
+Returns: errCrossSlot if the keys don't all hash to the same slot
+*/
+func (s *Server) checkSlots(cmd Command) error {
+	if !s.ClusterEnabled {
+		return nil
+	}
+	mk, ok := cmd.(multiKeyCommand)
+	if !ok {
+		return nil
+	}
+
+	keys := mk.commandKeys()
+	for i := 1; i < len(keys); i++ {
+		if keyHashSlot(keys[i]) != keyHashSlot(keys[0]) {
+			return errCrossSlot
+		}
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Benchmark Tool for Redis Clone
+
+This program is a small redis-benchmark equivalent. It opens a number of
+concurrent client connections, fires a configurable mix of commands at the
+server and reports throughput together with latency percentiles.
+
+Key concepts:
+- Clients: Each client is a goroutine with its own TCP connection
+- Pipelining: Clients can send several commands before reading the replies
+- Key Space: Keys are picked at random from key:0 ... key:<keyspace-1>
+- Command Mix: A weighted list of commands, e.g. "set:1,get:3"
+
+Example:
+  goredis-bench -c 50 -n 100000 -P 16 -r 10000 -t set:1,get:3
+*/
+
+/*
+benchConfig holds the benchmark settings parsed from the command line
+*/
+type benchConfig struct {
+	address   string
+	clients   int
+	requests  int
+	pipeline  int
+	keyspace  int
+	dataSize  int
+	commands  []weightedCommand
+	totalRank int
+}
+
+/*
+weightedCommand is a single entry of the command mix
+
+The weight decides how often this command is picked compared to the others.
+With "set:1,get:3" roughly one out of four commands is a SET.
+*/
+type weightedCommand struct {
+	name   string
+	weight int
+}
+
+/*
+benchResult collects the measurements of a single client goroutine
+
+Every client records into its own result so no locking is needed while
+the benchmark runs. The results are merged once all clients are done.
+*/
+type benchResult struct {
+	latencies []time.Duration
+	perCmd    map[string]int
+	errors    int
+}
+
+func main() {
+	address := flag.String("address", "127.0.0.1:5555", "address of the Redis server")
+	clients := flag.Int("c", 50, "number of parallel connections")
+	requests := flag.Int("n", 100000, "total number of requests")
+	pipeline := flag.Int("P", 1, "number of requests pipelined per round trip")
+	keyspace := flag.Int("r", 10000, "number of distinct keys to use")
+	dataSize := flag.Int("d", 3, "size in bytes of SET/APPEND values")
+	mix := flag.String("t", "set,get", "comma separated command mix, optionally weighted (e.g. set:1,get:3)")
+	flag.Parse()
+
+	commands, totalRank, err := parseCommandMix(*mix)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *clients < 1 || *requests < 1 || *pipeline < 1 || *keyspace < 1 || *dataSize < 0 {
+		log.Fatal("-c, -n, -P and -r must be positive and -d must not be negative")
+	}
+
+	cfg := benchConfig{
+		address:   *address,
+		clients:   *clients,
+		requests:  *requests,
+		pipeline:  *pipeline,
+		keyspace:  *keyspace,
+		dataSize:  *dataSize,
+		commands:  commands,
+		totalRank: totalRank,
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/*
+parseCommandMix parses the -t flag into a weighted command list
+
+Format: name[:weight],name[:weight],...
+Commands without a weight get weight 1. Unknown commands are rejected
+up front so typos don't silently skew the benchmark.
+*/
+func parseCommandMix(mix string) ([]weightedCommand, int, error) {
+	var commands []weightedCommand
+	total := 0
+
+	for _, part := range strings.Split(mix, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weightStr, hasWeight := strings.Cut(part, ":")
+		name = strings.ToLower(name)
+		if _, ok := commandBuilders[name]; !ok {
+			return nil, 0, fmt.Errorf("unsupported command %q in mix", name)
+		}
+
+		weight := 1
+		if hasWeight {
+			w, err := strconv.Atoi(weightStr)
+			if err != nil || w < 1 {
+				return nil, 0, fmt.Errorf("invalid weight %q for %s", weightStr, name)
+			}
+			weight = w
+		}
+
+		commands = append(commands, weightedCommand{name: name, weight: weight})
+		total += weight
+	}
+
+	if len(commands) == 0 {
+		return nil, 0, fmt.Errorf("empty command mix")
+	}
+
+	return commands, total, nil
+}
+
+/*
+commandBuilders maps a benchmark command name to a function producing its arguments
+
+Each builder receives a random number generator, a random key and the value
+payload, and returns the full argument list (command name included).
+*/
+var commandBuilders = map[string]func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte{
+	"ping": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		return [][]byte{[]byte("PING")}
+	},
+	"set": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		return [][]byte{[]byte("SET"), []byte(key), value}
+	},
+	"get": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		return [][]byte{[]byte("GET"), []byte(key)}
+	},
+	"del": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		return [][]byte{[]byte("DEL"), []byte(key)}
+	},
+	"exists": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		return [][]byte{[]byte("EXISTS"), []byte(key)}
+	},
+	"incr": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		return [][]byte{[]byte("INCR"), []byte("counter:" + key)}
+	},
+	"append": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		return [][]byte{[]byte("APPEND"), []byte(key), value}
+	},
+	"mset": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		args := [][]byte{[]byte("MSET")}
+		for i := 0; i < 10; i++ {
+			args = append(args, []byte(randomKey(rng, keyspace)), value)
+		}
+		return args
+	},
+	"mget": func(rng *rand.Rand, key string, value []byte, keyspace int) [][]byte {
+		args := [][]byte{[]byte("MGET")}
+		for i := 0; i < 10; i++ {
+			args = append(args, []byte(randomKey(rng, keyspace)))
+		}
+		return args
+	},
+}
+
+/*
+run executes the benchmark and prints the report
+
+Requests are handed out through a shared atomic counter so the total
+number of requests is exact regardless of how fast each client is.
+*/
+func run(cfg benchConfig) error {
+	var remaining atomic.Int64
+	remaining.Store(int64(cfg.requests))
+
+	results := make([]*benchResult, cfg.clients)
+	errCh := make(chan error, cfg.clients)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for i := 0; i < cfg.clients; i++ {
+		conn, err := net.Dial("tcp", cfg.address)
+		if err != nil {
+			return fmt.Errorf("connect to %s: %w", cfg.address, err)
+		}
+
+		results[i] = &benchResult{perCmd: make(map[string]int)}
+		wg.Add(1)
+		go func(conn net.Conn, result *benchResult, seed int64) {
+			defer wg.Done()
+			defer conn.Close()
+			if err := runClient(cfg, conn, result, &remaining, seed); err != nil {
+				errCh <- err
+			}
+		}(conn, results[i], time.Now().UnixNano()+int64(i))
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(errCh)
+
+	if err := <-errCh; err != nil {
+		return err
+	}
+
+	report(cfg, results, elapsed)
+	return nil
+}
+
+/*
+runClient is the body of one benchmark client
+
+It repeatedly claims a batch of up to -P requests, writes them all,
+flushes, and then reads back the same number of replies. The latency of
+a request is the round trip time of the batch it was sent in, which is
+how redis-benchmark accounts for pipelined requests too.
+*/
+func runClient(cfg benchConfig, conn net.Conn, result *benchResult, remaining *atomic.Int64, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	value := []byte(strings.Repeat("x", cfg.dataSize))
+
+	for {
+		batch := int64(cfg.pipeline)
+		left := remaining.Add(-batch)
+		if left+batch <= 0 {
+			return nil
+		}
+		if left < 0 {
+			batch += left
+		}
+
+		batchStart := time.Now()
+		for i := int64(0); i < batch; i++ {
+			name := pickCommand(rng, cfg)
+			args := commandBuilders[name](rng, randomKey(rng, cfg.keyspace), value, cfg.keyspace)
+			writeCommand(writer, args)
+			result.perCmd[name]++
+		}
+		if err := writer.Flush(); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+
+		for i := int64(0); i < batch; i++ {
+			isError, err := readReply(reader)
+			if err != nil {
+				return fmt.Errorf("read: %w", err)
+			}
+			if isError {
+				result.errors++
+			}
+		}
+
+		latency := time.Since(batchStart)
+		for i := int64(0); i < batch; i++ {
+			result.latencies = append(result.latencies, latency)
+		}
+	}
+}
+
+/*
+pickCommand selects a command from the mix according to the weights
+*/
+func pickCommand(rng *rand.Rand, cfg benchConfig) string {
+	n := rng.Intn(cfg.totalRank)
+	for _, c := range cfg.commands {
+		if n < c.weight {
+			return c.name
+		}
+		n -= c.weight
+	}
+	return cfg.commands[len(cfg.commands)-1].name
+}
+
+/*
+randomKey returns a random key from the configured key space
+*/
+func randomKey(rng *rand.Rand, keyspace int) string {
+	return "key:" + strconv.Itoa(rng.Intn(keyspace))
+}
+
+/*
+writeCommand writes a command as a RESP array of bulk strings
+
+Format: *<argc>\r\n followed by $<len>\r\n<arg>\r\n for every argument
+*/
+func writeCommand(w *bufio.Writer, args [][]byte) {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.Write(arg)
+		w.WriteString("\r\n")
+	}
+}
+
+/*
+readReply reads and discards one complete RESP reply
+
+Aggregate types (arrays and maps) are read recursively so the reader
+always ends up at the start of the next reply.
+
+Returns: whether the reply was an error reply, and any read error
+*/
+func readReply(r *bufio.Reader) (bool, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return false, fmt.Errorf("empty reply line")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return false, nil
+	case '-':
+		return true, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return false, fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return false, nil
+		}
+		_, err = r.Discard(n + 2)
+		return false, err
+	case '*', '%':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return false, fmt.Errorf("invalid aggregate length %q", line)
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			if _, err := readReply(r); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected reply type %q", line[0])
+	}
+}
+
+/*
+report merges the client results and prints the summary
+
+Output includes the total throughput, latency percentiles across all
+requests and a per-command breakdown of how many requests were sent.
+*/
+func report(cfg benchConfig, results []*benchResult, elapsed time.Duration) {
+	var latencies []time.Duration
+	perCmd := make(map[string]int)
+	errors := 0
+
+	for _, r := range results {
+		latencies = append(latencies, r.latencies...)
+		for name, count := range r.perCmd {
+			perCmd[name] += count
+		}
+		errors += r.errors
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Fprintf(os.Stdout, "====== goredis-bench ======\n")
+	fmt.Fprintf(os.Stdout, "  %d requests completed in %.2f seconds\n", len(latencies), elapsed.Seconds())
+	fmt.Fprintf(os.Stdout, "  %d parallel clients, pipeline %d, keyspace %d, %d bytes payload\n",
+		cfg.clients, cfg.pipeline, cfg.keyspace, cfg.dataSize)
+	fmt.Fprintf(os.Stdout, "  %d error replies\n\n", errors)
+
+	fmt.Fprintf(os.Stdout, "throughput: %.2f requests per second\n\n", float64(len(latencies))/elapsed.Seconds())
+
+	fmt.Fprintf(os.Stdout, "latency (msec):\n")
+	for _, p := range []float64{50, 95, 99, 99.9, 100} {
+		fmt.Fprintf(os.Stdout, "  p%-5v %.3f\n", p, percentile(latencies, p).Seconds()*1000)
+	}
+
+	names := make([]string, 0, len(perCmd))
+	for name := range perCmd {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stdout, "\ncommand mix:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stdout, "  %-8s %d\n", strings.ToUpper(name), perCmd[name])
+	}
+}
+
+/*
+percentile returns the p-th percentile of a sorted latency slice
+
+Uses the nearest-rank method; p=100 returns the maximum.
+*/
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p / 100 * float64(len(sorted)))
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
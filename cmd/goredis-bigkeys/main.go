@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Big Key Analyzer for Redis Clone
+
+This program is a redis-cli --bigkeys / --memkeys equivalent. It walks the
+keyspace of a running server with SCAN and reports, for every type, how
+many keys there are, how much memory they use and which keys are the
+largest, to find the keys eating the memory.
+
+Key concepts:
+- Incremental: Keys are fetched with SCAN a batch at a time, so the server
+  keeps serving other clients; -i pauses between batches to go easier on
+  a busy server
+- Pipelined: For every batch, TYPE and MEMORY USAGE are sent in one round
+  trip, then the length command of each key's type in another
+- Estimated Sizes: Memory is what MEMORY USAGE estimates; collections are
+  extrapolated from -samples elements (0 reads them all)
+- Consistent: SCAN returns every key present for the whole walk; keys
+  deleted meanwhile are skipped
+
+Example:
+  goredis-bigkeys -address 127.0.0.1:5555 -top 5 -samples 0
+*/
+
+/*
+analyzerConfig holds the settings parsed from the command line
+*/
+type analyzerConfig struct {
+	address  string
+	count    int
+	samples  int
+	top      int
+	interval time.Duration
+}
+
+/*
+keyTypes lists the value types in report order, with the command giving a
+key's length and the unit of that length
+*/
+var keyTypes = []struct {
+	name    string
+	command string
+	unit    string
+}{
+	{"string", "STRLEN", "bytes"},
+	{"list", "LLEN", "items"},
+	{"set", "SCARD", "members"},
+	{"hash", "HLEN", "fields"},
+	{"zset", "ZCARD", "members"},
+}
+
+/*
+keyInfo describes one scanned key
+*/
+type keyInfo struct {
+	name   string
+	memory int64 // estimated bytes, from MEMORY USAGE
+	length int64 // bytes, items, members or fields
+}
+
+/*
+typeStats accumulates what was found for one type
+*/
+type typeStats struct {
+	keys    int
+	memory  int64
+	length  int64
+	biggest []keyInfo // the largest keys by memory, at most top
+}
+
+/*
+add records a key, keeping the top largest keys
+*/
+func (t *typeStats) add(key keyInfo, top int) {
+	t.keys++
+	t.memory += key.memory
+	t.length += key.length
+
+	i := sort.Search(len(t.biggest), func(i int) bool { return t.biggest[i].memory < key.memory })
+	if i >= top {
+		return
+	}
+	t.biggest = append(t.biggest, keyInfo{})
+	copy(t.biggest[i+1:], t.biggest[i:])
+	t.biggest[i] = key
+	if len(t.biggest) > top {
+		t.biggest = t.biggest[:top]
+	}
+}
+
+func main() {
+	address := flag.String("address", "127.0.0.1:5555", "address of the Redis server")
+	count := flag.Int("count", 100, "keys asked for per SCAN call")
+	samples := flag.Int("samples", 5, "collection elements MEMORY USAGE samples (0 for all)")
+	top := flag.Int("top", 3, "largest keys reported per type")
+	interval := flag.Duration("i", 0, "pause between SCAN batches, e.g. 10ms")
+	flag.Parse()
+
+	if *count < 1 || *samples < 0 || *top < 1 {
+		log.Fatal("-count and -top must be positive, -samples at least 0")
+	}
+
+	cfg := analyzerConfig{
+		address:  *address,
+		count:    *count,
+		samples:  *samples,
+		top:      *top,
+		interval: *interval,
+	}
+	if err := run(cfg, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/*
+run scans the whole keyspace and writes the report to out
+*/
+func run(cfg analyzerConfig, out io.Writer) error {
+	conn, err := net.Dial("tcp", cfg.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := &client{reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+	stats := make(map[string]*typeStats)
+	start := time.Now()
+	scanned := 0
+
+	cursor := "0"
+	for {
+		reply, err := client.do("SCAN", cursor, "COUNT", strconv.Itoa(cfg.count))
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+		cursor, _ = page[0].(string)
+		keys, _ := page[1].([]any)
+
+		infos, err := inspectKeys(client, keys, cfg.samples)
+		if err != nil {
+			return err
+		}
+		for typeName, key := range infos {
+			for _, info := range key {
+				if stats[typeName] == nil {
+					stats[typeName] = &typeStats{}
+				}
+				stats[typeName].add(info, cfg.top)
+				scanned++
+			}
+		}
+
+		if cursor == "0" {
+			break
+		}
+		time.Sleep(cfg.interval)
+	}
+
+	report(out, stats, scanned, time.Since(start))
+	return nil
+}
+
+/*
+inspectKeys gets the type, memory and length of a batch of keys
+
+Returns: The keys found, by type; keys deleted since SCAN returned them
+are left out
+*/
+func inspectKeys(c *client, keys []any, samples int) (map[string][]keyInfo, error) {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if name, ok := key.(string); ok {
+			names = append(names, name)
+		}
+	}
+
+	// One round trip for the types and sizes
+	for _, name := range names {
+		c.send("TYPE", name)
+		c.send("MEMORY", "USAGE", name, "SAMPLES", strconv.Itoa(samples))
+	}
+	types := make([]string, len(names))
+	memory := make([]int64, len(names))
+	for i := range names {
+		typeReply, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		memoryReply, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		types[i], _ = typeReply.(string)
+		memory[i], _ = integerOf(memoryReply)
+	}
+
+	// And one for the lengths, whose command depends on the type
+	sent := make([]int, 0, len(names))
+	for i, name := range names {
+		for _, t := range keyTypes {
+			if t.name == types[i] {
+				c.send(t.command, name)
+				sent = append(sent, i)
+			}
+		}
+	}
+	found := make(map[string][]keyInfo)
+	for _, i := range sent {
+		reply, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		length, ok := integerOf(reply)
+		if !ok {
+			// Deleted or replaced by another type in the meantime
+			continue
+		}
+		found[types[i]] = append(found[types[i]], keyInfo{name: names[i], memory: memory[i], length: length})
+	}
+	return found, nil
+}
+
+/*
+integerOf reads an integer reply, also accepting one sent as a bulk string
+*/
+func integerOf(reply any) (int64, bool) {
+	switch v := reply.(type) {
+	case int64:
+		return v, true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+/*
+report prints the summary: totals per type, then the biggest keys of each
+*/
+func report(out io.Writer, stats map[string]*typeStats, scanned int, elapsed time.Duration) {
+	fmt.Fprintf(out, "Scanned %d keys in %s\n", scanned, elapsed.Round(time.Millisecond))
+
+	for _, t := range keyTypes {
+		s := stats[t.name]
+		if s == nil {
+			continue
+		}
+
+		fmt.Fprintf(out, "\n%s: %d keys, %s in memory, %d %s in total\n",
+			t.name, s.keys, formatBytes(s.memory), s.length, t.unit)
+		for _, key := range s.biggest {
+			fmt.Fprintf(out, "  %-40s %10s %12d %s\n", strconv.Quote(key.name), formatBytes(key.memory), key.length, t.unit)
+		}
+	}
+}
+
+/*
+formatBytes renders a byte count with a binary unit, e.g. 1.5 MB
+*/
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + units[unit]
+}
+
+/*
+client is a minimal pipelining RESP client
+*/
+type client struct {
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+/*
+send buffers a command, written as a RESP array of bulk strings
+*/
+func (c *client) send(args ...string) {
+	c.writer.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		c.writer.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+}
+
+/*
+receive flushes the buffered commands and reads one reply
+
+Returns: The reply as a string, int64, []any, error or nil; error replies
+are returned as values, the error result is for connection problems
+*/
+func (c *client) receive() (any, error) {
+	if c.writer.Buffered() > 0 {
+		if err := c.writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return readValue(c.reader)
+}
+
+/*
+do sends one command and returns its reply, failing on error replies
+*/
+func (c *client) do(args ...string) (any, error) {
+	c.send(args...)
+	reply, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(error); ok {
+		return nil, fmt.Errorf("%s: %w", strings.Join(args, " "), replyErr)
+	}
+	return reply, nil
+}
+
+/*
+readValue reads one RESP reply and decodes it
+*/
+func readValue(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return errors.New(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", line[0])
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+Keyspace Exporter for Redis Clone
+
+This program streams the dataset of a running server to JSON lines or CSV,
+for analytics and ad-hoc backups that other tools can read. It reads the
+keyspace with EXPORT and writes every key with its type, TTL and value.
+
+Key concepts:
+- Incremental: Keys are fetched with EXPORT a batch at a time and written
+  as they come, so neither the server nor the exporter holds the whole
+  dataset; -i pauses between batches to go easier on a busy server
+- Point in Time: EXPORT reads a snapshot of the keyspace taken by its
+  first call, so the output is the dataset as of that instant, whatever
+  other clients write meanwhile; TTLs are the milliseconds left when the
+  key was read, and keys whose TTL passes during the export are left out
+- One Round Trip per Batch: Each EXPORT reply holds whole keys, with
+  their type, TTL and value
+- JSON Lines: One object per key: {"key", "type", "ttl", "value"}, where
+  value is a string (string), an array of strings (list, set), an object
+  (hash) or an array of {"member", "score"} (zset); ttl is left out for
+  keys without one. Records holding bytes that aren't valid UTF-8 have
+  "encoding": "base64" and every key, field, member and value of the
+  record base64 encoded, so binary data survives the trip
+- CSV: One row per element: key, type, ttl, field, value; field is the
+  list index, hash field or zset member (empty for strings and sets),
+  value the element, field value or score; ttl is -1 for keys without one
+
+Example:
+  goredis-export -address 127.0.0.1:5555 -format csv -match 'user:*' -o users.csv
+*/
+
+/*
+exportConfig holds the settings parsed from the command line
+*/
+type exportConfig struct {
+	address  string
+	format   string
+	match    string
+	count    int
+	interval time.Duration
+}
+
+/*
+record is one exported key
+
+Elements are kept as read: the string value, the list or set elements, or
+the flat field/value (hash) and member/score (zset) pairs.
+*/
+type record struct {
+	key      string
+	keyType  string
+	ttl      int64 // milliseconds left, -1 without a TTL
+	elements []string
+}
+
+/*
+recordWriter writes records in one of the output formats
+*/
+type recordWriter interface {
+	write(r record) error
+	flush() error
+}
+
+func main() {
+	address := flag.String("address", "127.0.0.1:5555", "address of the Redis server")
+	format := flag.String("format", "json", "output format: json (JSON lines) or csv")
+	match := flag.String("match", "*", "only export keys matching this glob pattern")
+	count := flag.Int("count", 100, "keys asked for per EXPORT call")
+	output := flag.String("o", "-", "output file, - for standard output")
+	interval := flag.Duration("i", 0, "pause between EXPORT batches, e.g. 10ms")
+	flag.Parse()
+
+	if *count < 1 {
+		log.Fatal("-count must be positive")
+	}
+	if *format != "json" && *format != "csv" {
+		log.Fatalf("unknown format %q, want json or csv", *format)
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	cfg := exportConfig{
+		address:  *address,
+		format:   *format,
+		match:    *match,
+		count:    *count,
+		interval: *interval,
+	}
+	start := time.Now()
+	exported, err := run(cfg, out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("exported %d keys in %s", exported, time.Since(start).Round(time.Millisecond))
+}
+
+/*
+run exports the keyspace and writes every key to out
+
+Returns: The number of keys exported
+*/
+func run(cfg exportConfig, out io.Writer) (int, error) {
+	conn, err := net.Dial("tcp", cfg.address)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	buffered := bufio.NewWriter(out)
+	var writer recordWriter
+	if cfg.format == "csv" {
+		writer = newCSVWriter(buffered)
+	} else {
+		writer = &jsonWriter{encoder: json.NewEncoder(buffered)}
+	}
+
+	client := &client{reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+	exported := 0
+
+	cursor := "0"
+	for {
+		reply, err := client.do("EXPORT", cursor, "MATCH", cfg.match, "COUNT", strconv.Itoa(cfg.count))
+		if err != nil {
+			return exported, err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return exported, fmt.Errorf("unexpected EXPORT reply %v", reply)
+		}
+		cursor, _ = page[0].(string)
+		items, _ := page[1].([]any)
+
+		for _, item := range items {
+			r, err := parseRecord(item)
+			if err != nil {
+				return exported, err
+			}
+			if err := writer.write(r); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+
+		if cursor == "0" {
+			break
+		}
+		time.Sleep(cfg.interval)
+	}
+
+	if err := writer.flush(); err != nil {
+		return exported, err
+	}
+	return exported, buffered.Flush()
+}
+
+/*
+parseRecord decodes one record of an EXPORT reply: type, key, TTL and elements
+*/
+func parseRecord(item any) (record, error) {
+	fields, ok := item.([]any)
+	if !ok || len(fields) != 4 {
+		return record{}, fmt.Errorf("unexpected EXPORT record %v", item)
+	}
+	keyType, _ := fields[0].(string)
+	key, _ := fields[1].(string)
+	ttl, ok := fields[2].(int64)
+	elements, _ := fields[3].([]any)
+	if !ok || len(elements) == 0 {
+		return record{}, fmt.Errorf("unexpected EXPORT record %v", item)
+	}
+
+	r := record{key: key, keyType: keyType, ttl: ttl, elements: make([]string, len(elements))}
+	for i, element := range elements {
+		r.elements[i], _ = element.(string)
+	}
+	return r, nil
+}
+
+/*
+jsonWriter writes records as JSON lines
+*/
+type jsonWriter struct {
+	encoder *json.Encoder
+}
+
+/*
+jsonRecord is the JSON form of a record
+*/
+type jsonRecord struct {
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	TTL      *int64 `json:"ttl,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Value    any    `json:"value"`
+}
+
+/*
+jsonMember is a sorted set member with its score
+*/
+type jsonMember struct {
+	Member string `json:"member"`
+	Score  any    `json:"score"` // a number, or "inf" / "-inf"
+}
+
+func (w *jsonWriter) write(r record) error {
+	// JSON strings are UTF-8, other bytes would be replaced
+	text := func(s string) string { return s }
+	out := jsonRecord{Type: r.keyType}
+	if !utf8.ValidString(r.key) || !allValidUTF8(r.elements) {
+		text = func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+		out.Encoding = "base64"
+	}
+	out.Key = text(r.key)
+	if r.ttl >= 0 {
+		out.TTL = &r.ttl
+	}
+
+	switch r.keyType {
+	case "string":
+		out.Value = text(r.elements[0])
+	case "list", "set":
+		values := make([]string, len(r.elements))
+		for i, element := range r.elements {
+			values[i] = text(element)
+		}
+		out.Value = values
+	case "hash":
+		fields := make(map[string]string, len(r.elements)/2)
+		for i := 0; i+1 < len(r.elements); i += 2 {
+			fields[text(r.elements[i])] = text(r.elements[i+1])
+		}
+		out.Value = fields
+	case "zset":
+		members := make([]jsonMember, 0, len(r.elements)/2)
+		for i := 0; i+1 < len(r.elements); i += 2 {
+			members = append(members, jsonMember{Member: text(r.elements[i]), Score: jsonScore(r.elements[i+1])})
+		}
+		out.Value = members
+	}
+	return w.encoder.Encode(out)
+}
+
+func (w *jsonWriter) flush() error {
+	return nil
+}
+
+/*
+jsonScore returns a score as a JSON number, or as text for infinities,
+which JSON numbers can't express
+*/
+func jsonScore(score string) any {
+	f, err := strconv.ParseFloat(score, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return score
+	}
+	return json.Number(score)
+}
+
+/*
+allValidUTF8 reports whether every string is valid UTF-8
+*/
+func allValidUTF8(values []string) bool {
+	for _, v := range values {
+		if !utf8.ValidString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+csvWriter writes records as CSV, one row per element
+*/
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+/*
+newCSVWriter starts a CSV output with its header row
+*/
+func newCSVWriter(out io.Writer) *csvWriter {
+	w := &csvWriter{writer: csv.NewWriter(out)}
+	w.writer.Write([]string{"key", "type", "ttl", "field", "value"})
+	return w
+}
+
+func (w *csvWriter) write(r record) error {
+	ttl := strconv.FormatInt(r.ttl, 10)
+	row := func(field, value string) {
+		w.writer.Write([]string{r.key, r.keyType, ttl, field, value})
+	}
+
+	switch r.keyType {
+	case "string", "set":
+		for _, element := range r.elements {
+			row("", element)
+		}
+	case "list":
+		for i, element := range r.elements {
+			row(strconv.Itoa(i), element)
+		}
+	case "hash", "zset":
+		for i := 0; i+1 < len(r.elements); i += 2 {
+			row(r.elements[i], r.elements[i+1])
+		}
+	}
+	return w.writer.Error()
+}
+
+func (w *csvWriter) flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+/*
+client is a minimal pipelining RESP client
+*/
+type client struct {
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+/*
+send buffers a command, written as a RESP array of bulk strings
+*/
+func (c *client) send(args ...string) {
+	c.writer.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		c.writer.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+}
+
+/*
+receive flushes the buffered commands and reads one reply
+
+Returns: The reply as a string, int64, []any, error or nil; error replies
+are returned as values, the error result is for connection problems
+*/
+func (c *client) receive() (any, error) {
+	if c.writer.Buffered() > 0 {
+		if err := c.writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return readValue(c.reader)
+}
+
+/*
+do sends one command and returns its reply, failing on error replies
+*/
+func (c *client) do(args ...string) (any, error) {
+	c.send(args...)
+	reply, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(error); ok {
+		return nil, fmt.Errorf("%s: %w", strings.Join(args, " "), replyErr)
+	}
+	return reply, nil
+}
+
+/*
+readValue reads one RESP reply and decodes it
+*/
+func readValue(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return errors.New(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", line[0])
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Bulk Importer for Redis Clone
+
+This program loads data into a running server quickly: it pipelines
+commands without waiting for their replies, the way redis-cli --pipe
+does, and reads the replies on the side to count errors.
+
+Key concepts:
+- JSON Lines: The default input is what goredis-export writes, one key
+  per line; keys are sent in batches with IMPORT, the server's fast path
+  that builds whole keys and installs a batch under one lock (see
+  import.go), replacing existing keys
+- RESP: With -format resp the input is a stream of commands in the Redis
+  protocol (as redis-cli --pipe takes it), which are sent as they are
+- Window: At most -window commands are in flight, so a slow server slows
+  the importer down instead of growing its buffers
+- Errors: The first errors are printed with the command they answer;
+  the import carries on, and the summary reports how many there were
+
+Example:
+  goredis-export -address old:5555 | goredis-import -address new:5555
+*/
+
+const maxReportedErrors = 10 // errors printed before only counting them
+
+/*
+importConfig holds the settings parsed from the command line
+*/
+type importConfig struct {
+	address string
+	format  string
+	batch   int
+	window  int
+}
+
+/*
+jsonRecord is a key as goredis-export writes it
+*/
+type jsonRecord struct {
+	Key      string          `json:"key"`
+	Type     string          `json:"type"`
+	TTL      *int64          `json:"ttl"`
+	Encoding string          `json:"encoding"`
+	Value    json.RawMessage `json:"value"`
+}
+
+/*
+jsonMember is a sorted set member with its score
+*/
+type jsonMember struct {
+	Member string          `json:"member"`
+	Score  json.RawMessage `json:"score"` // a number, or "inf" / "-inf"
+}
+
+/*
+summary counts what was sent and what came back
+*/
+type summary struct {
+	commands int
+	keys     int // keys imported, as IMPORT replies count them
+	errors   int
+}
+
+func main() {
+	address := flag.String("address", "127.0.0.1:5555", "address of the Redis server")
+	format := flag.String("format", "json", "input format: json (JSON lines from goredis-export) or resp")
+	input := flag.String("f", "-", "input file, - for standard input")
+	batch := flag.Int("batch", 1000, "keys sent per IMPORT command (json)")
+	window := flag.Int("window", 1000, "most commands sent before their replies are read")
+	flag.Parse()
+
+	if *batch < 1 || *window < 1 {
+		log.Fatal("-batch and -window must be positive")
+	}
+	if *format != "json" && *format != "resp" {
+		log.Fatalf("unknown format %q, want json or resp", *format)
+	}
+
+	in := os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	cfg := importConfig{
+		address: *address,
+		format:  *format,
+		batch:   *batch,
+		window:  *window,
+	}
+	start := time.Now()
+	result, err := run(cfg, in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.format == "json" {
+		log.Printf("imported %d keys with %d commands in %s, %d errors",
+			result.keys, result.commands, time.Since(start).Round(time.Millisecond), result.errors)
+	} else {
+		log.Printf("sent %d commands in %s, %d errors",
+			result.commands, time.Since(start).Round(time.Millisecond), result.errors)
+	}
+	if result.errors > 0 {
+		os.Exit(1)
+	}
+}
+
+/*
+run sends the input to the server and waits for every reply
+*/
+func run(cfg importConfig, in io.Reader) (summary, error) {
+	conn, err := net.Dial("tcp", cfg.address)
+	if err != nil {
+		return summary{}, err
+	}
+	defer conn.Close()
+
+	// Each command sent puts its description in flight; the reader takes it back with the reply
+	inFlight := make(chan string, cfg.window)
+	replies := make(chan summary, 1)
+	go readReplies(bufio.NewReader(conn), inFlight, replies)
+
+	writer := bufio.NewWriter(conn)
+	send := func(description string, args [][]byte) error {
+		writeCommand(writer, args)
+		// Flush before blocking on a full window, or the server never sees what it should answer
+		if len(inFlight) == cap(inFlight) {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+		}
+		inFlight <- description
+		return nil
+	}
+
+	var sent summary
+	if cfg.format == "json" {
+		err = sendJSON(bufio.NewReader(in), cfg.batch, send, &sent)
+	} else {
+		err = sendRESP(bufio.NewReader(in), send, &sent)
+	}
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	close(inFlight)
+	if err != nil {
+		return sent, err
+	}
+
+	received := <-replies
+	if received.commands < sent.commands {
+		return sent, fmt.Errorf("connection lost after %d of %d replies", received.commands, sent.commands)
+	}
+	sent.keys, sent.errors = received.keys, received.errors
+	return sent, nil
+}
+
+/*
+sendJSON sends JSON lines as IMPORT commands of up to batch keys
+*/
+func sendJSON(in *bufio.Reader, batch int, send func(string, [][]byte) error, sent *summary) error {
+	args := [][]byte{[]byte("IMPORT")}
+	keys, line, firstLine := 0, 0, 1
+	flush := func() error {
+		if keys == 0 {
+			return nil
+		}
+		description := fmt.Sprintf("IMPORT of lines %d-%d", firstLine, line)
+		if err := send(description, args); err != nil {
+			return err
+		}
+		sent.commands++
+		args, keys, firstLine = args[:1:1], 0, line+1
+		return nil
+	}
+
+	for {
+		text, err := in.ReadBytes('\n')
+		if len(strings.TrimSpace(string(text))) > 0 {
+			line++
+			record, convErr := importArgs(text)
+			if convErr != nil {
+				return fmt.Errorf("line %d: %w", line, convErr)
+			}
+			args = append(args, record...)
+			if keys++; keys == batch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		} else if len(text) > 0 {
+			line++
+		}
+
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/*
+importArgs converts a JSON line into an IMPORT record: type, key, TTL,
+count and elements
+*/
+func importArgs(line []byte) ([][]byte, error) {
+	var r jsonRecord
+	if err := json.Unmarshal(line, &r); err != nil {
+		return nil, err
+	}
+
+	decode := func(s string) ([]byte, error) { return []byte(s), nil }
+	switch r.Encoding {
+	case "":
+	case "base64":
+		decode = base64.StdEncoding.DecodeString
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", r.Encoding)
+	}
+
+	var elements [][]byte
+	var err error
+	add := func(s string) {
+		if err == nil {
+			var decoded []byte
+			decoded, err = decode(s)
+			elements = append(elements, decoded)
+		}
+	}
+
+	switch r.Type {
+	case "string":
+		var value string
+		err = json.Unmarshal(r.Value, &value)
+		add(value)
+	case "list", "set":
+		var values []string
+		err = json.Unmarshal(r.Value, &values)
+		for _, value := range values {
+			add(value)
+		}
+	case "hash":
+		var fields map[string]string
+		err = json.Unmarshal(r.Value, &fields)
+		for field, value := range fields {
+			add(field)
+			add(value)
+		}
+	case "zset":
+		var members []jsonMember
+		err = json.Unmarshal(r.Value, &members)
+		for _, m := range members {
+			add(m.Member)
+			// Scores are numbers, or strings for the infinities, and never encoded
+			elements = append(elements, []byte(strings.Trim(string(m.Score), `"`)))
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", r.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		return nil, errors.New("no value")
+	}
+
+	key, err := decode(r.Key)
+	if err != nil {
+		return nil, err
+	}
+	ttl := int64(-1)
+	if r.TTL != nil {
+		ttl = *r.TTL
+	}
+	header := [][]byte{[]byte(r.Type), key, []byte(strconv.FormatInt(ttl, 10)), []byte(strconv.Itoa(len(elements)))}
+	return append(header, elements...), nil
+}
+
+/*
+sendRESP forwards a stream of RESP commands
+*/
+func sendRESP(in *bufio.Reader, send func(string, [][]byte) error, sent *summary) error {
+	for {
+		args, err := readCommand(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("command %d: %w", sent.commands+1, err)
+		}
+		description := fmt.Sprintf("command %d (%s)", sent.commands+1, args[0])
+		if err := send(description, args); err != nil {
+			return err
+		}
+		sent.commands++
+	}
+}
+
+/*
+readReplies reads one reply per command in flight until the channel is
+closed, and sends what it counted
+
+Integer replies are added up as keys, which is what IMPORT replies with.
+*/
+func readReplies(r *bufio.Reader, inFlight <-chan string, done chan<- summary) {
+	var received summary
+	defer func() { done <- received }()
+
+	for description := range inFlight {
+		reply, err := readValue(r)
+		if err != nil {
+			log.Printf("reading replies: %v", err)
+			return
+		}
+		received.commands++
+
+		if n, ok := reply.(int64); ok {
+			received.keys += int(n)
+		}
+		if replyErr, ok := reply.(error); ok {
+			if received.errors++; received.errors <= maxReportedErrors {
+				log.Printf("%s: %v", description, replyErr)
+			}
+		}
+	}
+}
+
+/*
+writeCommand buffers a command, written as a RESP array of bulk strings
+*/
+func writeCommand(w *bufio.Writer, args [][]byte) {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.Write(arg)
+		w.WriteString("\r\n")
+	}
+}
+
+/*
+readCommand reads one command of the input: a RESP array of bulk strings,
+or an inline command line
+*/
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimRight(string(line), "\r\n")
+		if text == "" {
+			continue
+		}
+
+		if text[0] != '*' {
+			var args [][]byte
+			for _, field := range strings.Fields(text) {
+				args = append(args, []byte(field))
+			}
+			return args, nil
+		}
+
+		n, err := strconv.Atoi(text[1:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid array header %q", text)
+		}
+		args := make([][]byte, n)
+		for i := range args {
+			header, err := r.ReadString('\n')
+			if err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			header = strings.TrimRight(header, "\r\n")
+			if len(header) == 0 || header[0] != '$' {
+				return nil, fmt.Errorf("invalid bulk header %q", header)
+			}
+			size, err := strconv.Atoi(header[1:])
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("invalid bulk header %q", header)
+			}
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			args[i] = data[:size]
+		}
+		return args, nil
+	}
+}
+
+/*
+readValue reads one RESP reply and decodes it
+*/
+func readValue(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return errors.New(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", line[0])
+	}
+}
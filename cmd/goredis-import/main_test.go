@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+startServer starts a server on a free port until the test ends
+*/
+func startServer(t *testing.T) *goredis.Server {
+	t.Helper()
+
+	server := goredis.NewServer(goredis.Config{ListenAddress: "127.0.0.1:0"})
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; !errors.Is(err, goredis.ErrServerClosed) {
+			t.Errorf("Start returned %v, want ErrServerClosed", err)
+		}
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return server
+}
+
+/*
+testClient sends commands to a server one at a time
+*/
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, server *goredis.Server) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+/*
+do sends a command and returns its reply, decoded by readValue
+*/
+func (c *testClient) do(args ...string) any {
+	c.t.Helper()
+
+	command := make([][]byte, len(args))
+	for i, arg := range args {
+		command[i] = []byte(arg)
+	}
+	writer := bufio.NewWriter(c.conn)
+	writeCommand(writer, command)
+	if err := writer.Flush(); err != nil {
+		c.t.Fatalf("%q: %v", args, err)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := readValue(c.reader)
+	if err != nil {
+		c.t.Fatalf("%q: %v", args, err)
+	}
+	if replyErr, ok := reply.(error); ok {
+		c.t.Fatalf("%q: %v", args, replyErr)
+	}
+	return reply
+}
+
+/*
+sortedPairs returns the field/value pairs of a flat reply, sorted, since
+hashes have no order
+*/
+func sortedPairs(reply any) []string {
+	items, _ := reply.([]any)
+	var pairs []string
+	for i := 0; i+1 < len(items); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", items[i], items[i+1]))
+	}
+	slices.Sort(pairs)
+	return pairs
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is needed to build goredis-export")
+	}
+	exporter := filepath.Join(t.TempDir(), "goredis-export")
+	if out, err := exec.Command(goTool, "build", "-o", exporter, "../goredis-export").CombinedOutput(); err != nil {
+		t.Fatalf("building goredis-export: %v\n%s", err, out)
+	}
+
+	// Every type, with and without a TTL, binary bytes and scores JSON can't hold as numbers
+	source := startServer(t)
+	seed := dial(t, source)
+	seed.do("SET", "string", "hello", "EX", "3600")
+	seed.do("SET", "binary:\xff", "\x00\xfe\r\n", "EX", "3600")
+	seed.do("SADD", "set", "x", "y", "z")
+	seed.do("ZADD", "zset", "1.5", "a", "-inf", "b", "+inf", "c", "-2", "d")
+	// There's no EXPIRE, so the collections with a TTL are seeded directly
+	source.Storage().Import([]goredis.ImportRecord{
+		{Type: goredis.TypeList, Key: []byte("list"), TTL: 10 * time.Minute, Elements: [][]byte{[]byte("c"), []byte("a"), []byte("b"), []byte("a")}},
+		{Type: goredis.TypeHash, Key: []byte("hash"), TTL: 90 * time.Second, Elements: [][]byte{[]byte("name"), []byte("Ada"), []byte("lang"), []byte("go")}},
+	})
+	ttls := map[string]time.Duration{"string": time.Hour, "binary:\xff": time.Hour, "list": 10 * time.Minute, "hash": 90 * time.Second}
+
+	cmd := exec.Command(exporter, "-address", source.Addr().String(), "-count", "2")
+	var exported, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &exported, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("goredis-export: %v\n%s", err, stderr.Bytes())
+	}
+
+	target := startServer(t)
+	result, err := run(importConfig{address: target.Addr().String(), format: "json", batch: 4, window: 2}, &exported)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.keys != 6 || result.errors != 0 {
+		t.Errorf("imported %d keys with %d errors, want 6 and none", result.keys, result.errors)
+	}
+
+	// The target holds the same keys, of the same types, with the TTLs they had left
+	before, after := dial(t, source), dial(t, target)
+	for _, key := range []string{"string", "binary:\xff", "list", "set", "hash", "zset"} {
+		if got, want := after.do("TYPE", key), before.do("TYPE", key); got != want {
+			t.Errorf("TYPE %q: got %v, want %v", key, got, want)
+		}
+		pttl, _ := after.do("PTTL", key).(int64)
+		if ttl, ok := ttls[key]; !ok && pttl != -1 {
+			t.Errorf("PTTL %q: got %d, want no TTL", key, pttl)
+		} else if ok && (pttl <= 0 || pttl > ttl.Milliseconds() || pttl < (ttl-time.Minute).Milliseconds()) {
+			t.Errorf("PTTL %q: got %d, want about %d", key, pttl, ttl.Milliseconds())
+		}
+	}
+	for _, command := range [][]string{
+		{"GET", "string"},
+		{"GET", "binary:\xff"},
+		{"LRANGE", "list", "0", "-1"},
+		{"ZRANGE", "zset", "0", "-1", "WITHSCORES"},
+	} {
+		if got, want := fmt.Sprintf("%q", after.do(command...)), fmt.Sprintf("%q", before.do(command...)); got != want {
+			t.Errorf("%q: got %s, want %s", command, got, want)
+		}
+	}
+	members := func(c *testClient) []string {
+		items, _ := c.do("SMEMBERS", "set").([]any)
+		var values []string
+		for _, item := range items {
+			values = append(values, fmt.Sprint(item))
+		}
+		slices.Sort(values)
+		return values
+	}
+	if got, want := members(after), members(before); !slices.Equal(got, want) {
+		t.Errorf("SMEMBERS set: got %v, want %v", got, want)
+	}
+	if got, want := sortedPairs(after.do("HGETALL", "hash")), sortedPairs(before.do("HGETALL", "hash")); !slices.Equal(got, want) {
+		t.Errorf("HGETALL hash: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+Redis Clone Server
+
+This program runs the server: it turns command line flags into a
+goredis.Config, starts the server and shuts it down on a signal. The
+server itself lives in the goredis package, so Go programs can embed it
+and add commands, middleware, hooks and change handlers of their own.
+
+Key concepts:
+- Flags: Every setting of goredis.Config has a flag; sizes accept units
+  like Redis' config does (e.g. 100mb)
+- Shutdown: Ctrl-C or SIGTERM stops accepting connections and lets
+  clients' pending commands finish, for up to DefaultShutdownTimeout
+- Diagnostics: SIGUSR1 dumps goroutine stacks, queues and memory stats to
+  the log (see the server's diagnostics.go)
+
+Example:
+  goredis -listenAddress :5555 -maxMemory 100mb -maxMemoryPolicy allkeys-lru
+*/
+
+func main() {
+	/*
+		Parse command line flags - This allows users to specify a custom listen address when starting the server
+		Example: ./gotrsredis -listenAddr=":6379"
+	*/
+	listenAddress := flag.String("listenAddress", goredis.DefaultListenAddress, "listen address of the Redis server")
+	clusterEnabled := flag.Bool("clusterEnabled", false, "reject multi-key commands whose keys hash to different cluster slots")
+	websocketAddress := flag.String("websocketAddress", "", "listen address of the WebSocket bridge for browser clients (disabled when empty)")
+	websocketOrigins := flag.String("websocketOrigins", "", "comma-separated origins allowed to use the WebSocket bridge besides the same origin, or *")
+	healthAddress := flag.String("healthAddress", "", "listen address of the HTTP health endpoint (/healthz, /readyz) for load balancers and Kubernetes probes (disabled when empty)")
+	trace := flag.String("trace", "", "log the bytes exchanged with clients whose address or name matches this glob pattern (* for all)")
+	maxMemory := flag.String("maxMemory", "0", "memory budget for the data, e.g. 100mb (0 for no limit)")
+	maxMemoryPolicy := flag.String("maxMemoryPolicy", "noeviction", "what to do above -maxMemory: noeviction, allkeys-lru, volatile-lru, allkeys-random, volatile-random or volatile-ttl")
+	maxMemorySamples := flag.Int("maxMemorySamples", goredis.DefaultEvictionSamples, "keys sampled to pick each key to evict (1 to 64): more is more accurate but costs more CPU")
+	compressThreshold := flag.String("compressThreshold", "0", "store string values of at least this size compressed, e.g. 4kb (0 to never compress)")
+	maxKeySize := flag.String("maxKeySize", "0", "longest key name writes may create, e.g. 1kb (0 for no limit)")
+	maxStringSize := flag.String("maxStringSize", "0", "longest string value writes may create, e.g. 16mb (0 for no limit)")
+	maxElementSize := flag.String("maxElementSize", "0", "longest list element, set or sorted set member, or hash field or value (0 for no limit)")
+	maxElements := flag.Int("maxElements", 0, "most elements a list, set, hash or sorted set may hold (0 for no limit)")
+	flag.Parse()
+
+	maxMemoryBytes, err := goredis.ParseMemorySize(*maxMemory)
+	if err != nil {
+		log.Fatal("Invalid -maxMemory: ", err)
+	}
+	policy, err := goredis.ParseEvictionPolicy(*maxMemoryPolicy)
+	if err != nil {
+		log.Fatal("Invalid -maxMemoryPolicy: ", err)
+	}
+	if *maxMemorySamples < 1 || *maxMemorySamples > goredis.MaxEvictionSamples {
+		log.Fatal("Invalid -maxMemorySamples: must be between 1 and ", goredis.MaxEvictionSamples)
+	}
+	compressThresholdBytes, err := goredis.ParseMemorySize(*compressThreshold)
+	if err != nil {
+		log.Fatal("Invalid -compressThreshold: ", err)
+	}
+	maxKeyBytes, err := goredis.ParseMemorySize(*maxKeySize)
+	if err != nil {
+		log.Fatal("Invalid -maxKeySize: ", err)
+	}
+	maxStringBytes, err := goredis.ParseMemorySize(*maxStringSize)
+	if err != nil {
+		log.Fatal("Invalid -maxStringSize: ", err)
+	}
+	maxElementBytes, err := goredis.ParseMemorySize(*maxElementSize)
+	if err != nil {
+		log.Fatal("Invalid -maxElementSize: ", err)
+	}
+	if *maxElements < 0 {
+		log.Fatal("Invalid -maxElements: must not be negative")
+	}
+
+	// Create a new server instance with the provided configuration
+	server := goredis.NewServer(goredis.Config{
+		ListenAddress:     *listenAddress,
+		ClusterEnabled:    *clusterEnabled,
+		WebSocketAddress:  *websocketAddress,
+		WebSocketOrigins:  *websocketOrigins,
+		HealthAddress:     *healthAddress,
+		TracePattern:      *trace,
+		MaxMemory:         maxMemoryBytes,
+		MaxMemoryPolicy:   policy,
+		MaxMemorySamples:  *maxMemorySamples,
+		CompressThreshold: compressThresholdBytes,
+		Limits: goredis.Limits{
+			MaxKeySize:     int(maxKeyBytes),
+			MaxStringSize:  int(maxStringBytes),
+			MaxElementSize: int(maxElementBytes),
+			MaxElements:    *maxElements,
+		},
+	})
+
+	// Shut down cleanly on Ctrl-C or SIGTERM, letting clients' pending commands finish
+	shutdownDone := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		slog.Info("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), goredis.DefaultShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("shutdown error", "err", err)
+		}
+		close(shutdownDone)
+	}()
+
+	// Dump goroutine stacks, queues and memory stats to the log on SIGUSR1 (see Server.DumpOnSignal)
+	go server.DumpOnSignal()
+
+	if err := server.Start(); !errors.Is(err, goredis.ErrServerClosed) {
+		log.Fatal("Error starting server: ", err)
+	}
+	<-shutdownDone
+}
@@ -1,12 +1,11 @@
-package main
+package goredis
 
 import (
 	"bytes"
-	"fmt"
+	"net"
 	"strconv"
+	"sync"
 	"time"
-
-	"github.com/tidwall/resp"
 )
 
 /*
@@ -52,15 +51,106 @@ const (
 	CommandMGET = "MGET"
 	CommandMSET = "MSET"
 
+	// List commands - ordered sequences of elements
+	CommandLPUSH   = "LPUSH"
+	CommandRPUSH   = "RPUSH"
+	CommandLPOP    = "LPOP"
+	CommandRPOP    = "RPOP"
+	CommandBLPOP   = "BLPOP"
+	CommandBRPOP   = "BRPOP"
+	CommandLLEN    = "LLEN"
+	CommandLRANGE  = "LRANGE"
+	CommandLINDEX  = "LINDEX"
+	CommandLINSERT = "LINSERT"
+	CommandLSET    = "LSET"
+	CommandLREM    = "LREM"
+	CommandLTRIM   = "LTRIM"
+
+	// Set commands - unordered collections of unique members
+	CommandSADD        = "SADD"
+	CommandSREM        = "SREM"
+	CommandSMEMBERS    = "SMEMBERS"
+	CommandSISMEMBER   = "SISMEMBER"
+	CommandSMISMEMBER  = "SMISMEMBER"
+	CommandSCARD       = "SCARD"
+	CommandSMOVE       = "SMOVE"
+	CommandSPOP        = "SPOP"
+	CommandSRANDMEMBER = "SRANDMEMBER"
+	CommandSINTER      = "SINTER"
+	CommandSUNION      = "SUNION"
+	CommandSDIFF       = "SDIFF"
+	CommandSINTERSTORE = "SINTERSTORE"
+	CommandSUNIONSTORE = "SUNIONSTORE"
+	CommandSDIFFSTORE  = "SDIFFSTORE"
+
+	// Hash commands - field/value maps stored under one key
+	CommandHSET    = "HSET"
+	CommandHSETNX  = "HSETNX"
+	CommandHGET    = "HGET"
+	CommandHMGET   = "HMGET"
+	CommandHDEL    = "HDEL"
+	CommandHGETALL = "HGETALL"
+	CommandHLEN    = "HLEN"
+	CommandHEXISTS = "HEXISTS"
+	CommandHINCRBY = "HINCRBY"
+
+	// Hash field TTL commands - expiration of single fields, see hashttl.go
+	CommandHEXPIRE  = "HEXPIRE"
+	CommandHPEXPIRE = "HPEXPIRE"
+	CommandHTTL     = "HTTL"
+	CommandHPTTL    = "HPTTL"
+	CommandHPERSIST = "HPERSIST"
+
+	// Sorted set commands - members ordered by score
+	CommandZADD    = "ZADD"
+	CommandZINCRBY = "ZINCRBY"
+	CommandZSCORE  = "ZSCORE"
+	CommandZREM    = "ZREM"
+	CommandZRANGE  = "ZRANGE"
+
+	CommandZRANGEBYSCORE = "ZRANGEBYSCORE"
+	CommandZRANGEBYLEX   = "ZRANGEBYLEX"
+	CommandZRANDMEMBER   = "ZRANDMEMBER"
+	CommandZCARD         = "ZCARD"
+	CommandZCOUNT        = "ZCOUNT"
+	CommandZLEXCOUNT     = "ZLEXCOUNT"
+
+	// Pub/sub commands - messaging between clients
+	CommandSUBSCRIBE    = "SUBSCRIBE"
+	CommandUNSUBSCRIBE  = "UNSUBSCRIBE"
+	CommandPSUBSCRIBE   = "PSUBSCRIBE"
+	CommandPUNSUBSCRIBE = "PUNSUBSCRIBE"
+	CommandPUBLISH      = "PUBLISH"
+	CommandSSUBSCRIBE   = "SSUBSCRIBE"
+	CommandSUNSUBSCRIBE = "SUNSUBSCRIBE"
+	CommandSPUBLISH     = "SPUBLISH"
+
 	// Utility commands - administrative and helper operations
-	CommandGETSET   = "GETSET"
-	CommandKEYS     = "KEYS"
-	CommandFLUSHALL = "FLUSHALL"
+	CommandGETSET      = "GETSET"
+	CommandKEYS        = "KEYS"
+	CommandSCAN        = "SCAN"
+	CommandFLUSHALL    = "FLUSHALL"
+	CommandIMPORT      = "IMPORT"
+	CommandEXPORT      = "EXPORT"
+	CommandTYPE        = "TYPE"
+	CommandTTL         = "TTL"
+	CommandPTTL        = "PTTL"
+	CommandEXPIRETIME  = "EXPIRETIME"
+	CommandPEXPIRETIME = "PEXPIRETIME"
+	CommandTTLSTATS    = "TTLSTATS"
+	CommandOBJECT      = "OBJECT"
+	CommandCLUSTER     = "CLUSTER"
+	CommandDEBUG       = "DEBUG"
+	CommandINFO        = "INFO"
+	CommandMEMORY      = "MEMORY"
+	CommandCOMMAND     = "COMMAND"
 
 	// Connection commands - client interaction
 	CommandHELLO  = "HELLO"
 	CommandCLIENT = "CLIENT"
 	CommandPING   = "PING"
+	CommandQUIT   = "QUIT"
+	CommandRESET  = "RESET"
 )
 
 /*
@@ -71,7 +161,8 @@ is represented as a struct that implements this interface.
 
 The Execute method:
   - Takes a storage instance to perform operations
-  - Returns the response as bytes (for RESP protocol)
+  - Returns the complete RESP reply (a bulk string is framed with
+    respWriteBulkString, never returned raw), or nil for a null reply
   - Returns an error if the operation fails
 
 This design allows us to:
@@ -116,10 +207,10 @@ Always returns "OK" on success, matching Redis behavior.
 func (c SetCommand) Execute(storage *Storage) ([]byte, error) {
 	if c.expiry > 0 {
 		err := storage.SetWithExpiry(c.key, c.val, c.expiry)
-		return []byte("OK"), err
+		return respWriteSimpleString("OK"), err
 	}
 	err := storage.Set(c.key, c.val)
-	return []byte("OK"), err
+	return respWriteSimpleString("OK"), err
 }
 
 /*
@@ -138,16 +229,16 @@ type GetCommand struct {
 /*
 Execute performs the GET operation
 
-Returns the stored value if the key exists and hasn't expired.
-Returns an error if the key doesn't exist - this gets converted to
-a null response in the RESP protocol.
+Returns the stored value as a bulk string if the key exists and hasn't
+expired. Returns nil if the key doesn't exist, which the handler sends as
+a null (see respNullFor).
 */
 func (c GetCommand) Execute(storage *Storage) ([]byte, error) {
-	val, ok := storage.Get(c.key)
-	if !ok {
-		return nil, fmt.Errorf("key not found")
+	val, ok, err := storage.Get(c.key)
+	if err != nil || !ok {
+		return nil, err
 	}
-	return val, nil
+	return respWriteBulkString(val), nil
 }
 
 /*
@@ -177,7 +268,7 @@ func (c DelCommand) Execute(storage *Storage) ([]byte, error) {
 			count++
 		}
 	}
-	return []byte(strconv.Itoa(count)), nil
+	return respWriteInteger(int64(count)), nil
 }
 
 /*
@@ -206,7 +297,7 @@ func (c ExistsCommand) Execute(storage *Storage) ([]byte, error) {
 			count++
 		}
 	}
-	return []byte(strconv.Itoa(count)), nil
+	return respWriteInteger(int64(count)), nil
 }
 
 /*
@@ -237,8 +328,11 @@ Returns the new length of the string after appending.
 If the key didn't exist, the new length equals the length of the appended value.
 */
 func (c AppendCommand) Execute(storage *Storage) ([]byte, error) {
-	length := storage.Append(c.key, c.val)
-	return []byte(strconv.Itoa(length)), nil
+	length, err := storage.Append(c.key, c.val)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(length)), nil
 }
 
 /*
@@ -255,8 +349,11 @@ type StrlenCommand struct {
 }
 
 func (c StrlenCommand) Execute(storage *Storage) ([]byte, error) {
-	length := storage.Strlen(c.key)
-	return []byte(strconv.Itoa(length)), nil
+	length, err := storage.Strlen(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(length)), nil
 }
 
 /*
@@ -275,8 +372,11 @@ type GetRangeCommand struct {
 }
 
 func (c GetRangeCommand) Execute(storage *Storage) ([]byte, error) {
-	result := storage.GetRange(c.key, c.start, c.end)
-	return result, nil
+	result, err := storage.GetRange(c.key, c.start, c.end)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteBulkString(result), nil
 }
 
 /*
@@ -295,8 +395,11 @@ type SetRangeCommand struct {
 }
 
 func (c SetRangeCommand) Execute(storage *Storage) ([]byte, error) {
-	length := storage.SetRange(c.key, c.offset, c.value)
-	return []byte(strconv.Itoa(length)), nil
+	length, err := storage.SetRange(c.key, c.offset, c.value)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(length)), nil
 }
 
 /*
@@ -324,7 +427,7 @@ func (c IncrCommand) Execute(storage *Storage) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return []byte(strconv.FormatInt(result, 10)), nil
+	return respWriteInteger(result), nil
 }
 
 /*
@@ -345,7 +448,7 @@ func (c DecrCommand) Execute(storage *Storage) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return []byte(strconv.FormatInt(result, 10)), nil
+	return respWriteInteger(result), nil
 }
 
 /*
@@ -367,7 +470,7 @@ func (c IncrByCommand) Execute(storage *Storage) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return []byte(strconv.FormatInt(result, 10)), nil
+	return respWriteInteger(result), nil
 }
 
 /*
@@ -389,7 +492,7 @@ func (c DecrByCommand) Execute(storage *Storage) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return []byte(strconv.FormatInt(result, 10)), nil
+	return respWriteInteger(result), nil
 }
 
 /*
@@ -420,8 +523,15 @@ Uses the storage's MGet method to retrieve all values efficiently.
 Formats the result as a RESP array for proper protocol compliance.
 */
 func (c MGetCommand) Execute(storage *Storage) ([]byte, error) {
+	return joinParts(c.ExecuteParts(storage))
+}
+
+/*
+ExecuteParts performs the MGET operation, returning the reply as parts (see replies.go)
+*/
+func (c MGetCommand) ExecuteParts(storage *Storage) (net.Buffers, error) {
 	results := storage.MGet(c.keys)
-	return respWriteArray(results), nil
+	return respArrayParts(results), nil
 }
 
 /*
@@ -439,234 +549,2332 @@ type MSetCommand struct {
 
 func (c MSetCommand) Execute(storage *Storage) ([]byte, error) {
 	err := storage.MSet(c.pairs)
-	return []byte("OK"), err
+	return respWriteSimpleString("OK"), err
 }
 
 /*
-=== UTILITY COMMANDS ===
+=== LIST COMMANDS ===
 
-These commands provide additional functionality for key management,
-atomic operations, and administrative tasks.
+These commands work with lists: ordered sequences of elements that can be
+pushed and popped at both ends and edited by position or value.
 */
 
 /*
-GetSetCommand represents the GETSET command
+PushCommand represents the LPUSH and RPUSH commands
 
-GETSET atomically sets a key to a new value and returns the old value.
-This is useful for implementing atomic counters, flags, or swapping values.
+Both add one or more elements to a list, creating it when missing.
+LPUSH inserts at the head, RPUSH appends at the tail.
 
-Redis syntax: GETSET key newvalue
-Example: GETSET counter 0 (sets counter to 0 and returns previous value)
+Redis syntax: LPUSH key element [element ...] / RPUSH key element [element ...]
+Example: RPUSH queue job1 job2 (returns 2 for a new list)
 */
-type GetSetCommand struct {
-	key []byte
-	val []byte
+type PushCommand struct {
+	key    []byte
+	values [][]byte
+	head   bool
 }
 
-func (c GetSetCommand) Execute(storage *Storage) ([]byte, error) {
-	oldVal, exists := storage.GetSet(c.key, c.val)
+func (c PushCommand) Execute(storage *Storage) ([]byte, error) {
+	length, err := storage.Push(c.key, c.values, c.head)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(length)), nil
+}
+
+/*
+PopCommand represents the LPOP and RPOP commands
+
+Without a count, a single element is returned as a bulk string (null when
+the key is missing). With a count, the reply is an array of up to count
+elements (a null array when the key is missing).
+
+Redis syntax: LPOP key [count] / RPOP key [count]
+Example: LPOP queue (returns "job1")
+*/
+type PopCommand struct {
+	key      []byte
+	count    int
+	hasCount bool
+	head     bool
+}
+
+func (c PopCommand) Execute(storage *Storage) ([]byte, error) {
+	count := 1
+	if c.hasCount {
+		count = c.count
+	}
+
+	popped, exists, err := storage.Pop(c.key, count, c.head)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.hasCount {
+		if !exists {
+			return respNull, nil
+		}
+		return respWriteBulkString(popped[0]), nil
+	}
 	if !exists {
-		return nil, fmt.Errorf("key not found")
+		return respNullArray, nil
 	}
-	return oldVal, nil
+	return respWriteArray(popped), nil
 }
 
 /*
-KeysCommand represents the KEYS command
+BlockingPopCommand represents the BLPOP and BRPOP commands
 
-KEYS returns all keys matching a given pattern. Uses simple glob-style
-pattern matching with * wildcards.
+Both pop one element from the first non-empty list among keys, from the
+head (BLPOP) or the tail (BRPOP). When every list is empty, the client
+blocks until another client pushes to one of them, or until timeout
+passes (see blocking.go). The reply is the key and the element, or a
+null array on timeout.
 
-WARNING: This command can be slow with large datasets as it scans all keys.
-In production Redis, this command is often disabled.
+Redis syntax: BLPOP key [key ...] timeout / BRPOP key [key ...] timeout
+Example: BLPOP jobs urgent 5 (returns ["jobs", "job1"], or waits up to
+5 seconds for an element)
+*/
+type BlockingPopCommand struct {
+	keys    [][]byte
+	timeout time.Duration // 0 to wait forever
+	head    bool
+}
 
-Redis syntax: KEYS pattern
-Examples:
-- KEYS * (returns all keys)
-- KEYS user:* (returns all keys starting with "user:")
+/*
+Execute pops without blocking, returning a null array when every list is empty
 */
-type KeysCommand struct {
-	pattern string
+func (c BlockingPopCommand) Execute(storage *Storage) ([]byte, error) {
+	for _, key := range c.keys {
+		reply, served, err := c.serve(storage, key)
+		if err != nil || served {
+			return reply, err
+		}
+	}
+	return respNullArray, nil
 }
 
-func (c KeysCommand) Execute(storage *Storage) ([]byte, error) {
-	keys := storage.Keys(c.pattern)
-	keyBytes := make([][]byte, len(keys))
-	for i, key := range keys {
-		keyBytes[i] = []byte(key)
+func (c BlockingPopCommand) blockingKeys() [][]byte      { return c.keys }
+func (c BlockingPopCommand) blockTimeout() time.Duration { return c.timeout }
+
+func (c BlockingPopCommand) serve(storage *Storage, key []byte) ([]byte, bool, error) {
+	popped, exists, err := storage.Pop(key, 1, c.head)
+	if err != nil || !exists {
+		return nil, false, err
 	}
-	return respWriteArray(keyBytes), nil
+	return respWriteArray([][]byte{key, popped[0]}), true, nil
 }
 
 /*
-FlushAllCommand represents the FLUSHALL command
+LLenCommand represents the LLEN command
 
-FLUSHALL removes all keys from the database. This is equivalent to
-restarting with an empty database.
+LLEN returns the number of elements in a list, 0 for a missing key.
 
-WARNING: This operation is destructive and cannot be undone.
+Redis syntax: LLEN key
+*/
+type LLenCommand struct {
+	key []byte
+}
 
-Redis syntax: FLUSHALL
+func (c LLenCommand) Execute(storage *Storage) ([]byte, error) {
+	length, err := storage.LLen(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(length)), nil
+}
+
+/*
+LRangeCommand represents the LRANGE command
+
+LRANGE returns the elements between two inclusive indices.
+Negative indices count from the tail, so 0 -1 returns the whole list.
+
+Redis syntax: LRANGE key start stop
+Example: LRANGE queue 0 -1
 */
-type FlushAllCommand struct{}
+type LRangeCommand struct {
+	key   []byte
+	start int
+	stop  int
+}
 
-func (c FlushAllCommand) Execute(storage *Storage) ([]byte, error) {
-	storage.FlushAll()
-	return []byte("OK"), nil
+func (c LRangeCommand) Execute(storage *Storage) ([]byte, error) {
+	return joinStream(c.ExecuteStream(storage))
+}
+
+func (c LRangeCommand) ExecuteStream(storage *Storage) (replyStream, error) {
+	items, err := storage.listRange(c.key, c.start, c.stop)
+	if err != nil {
+		return nil, err
+	}
+	return newArrayStream(len(items), func(i int) []byte { return items[i] }), nil
 }
 
 /*
-=== CONNECTION COMMANDS ===
+LIndexCommand represents the LINDEX command
 
-These commands handle client-server communication, handshakes,
-and connection management.
+LINDEX returns the element at an index, or null when it is out of range.
+
+Redis syntax: LINDEX key index
 */
+type LIndexCommand struct {
+	key   []byte
+	index int
+}
+
+func (c LIndexCommand) Execute(storage *Storage) ([]byte, error) {
+	item, found, err := storage.LIndex(c.key, c.index)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return respNull, nil
+	}
+	return respWriteBulkString(item), nil
+}
 
 /*
-HelloCommand represents the HELLO command
+LInsertCommand represents the LINSERT command
 
-HELLO is used for protocol negotiation and server information.
-It returns server details in a structured format.
+LINSERT inserts an element before or after the first occurrence of a pivot.
+Returns the new length, -1 when the pivot isn't found and 0 for a missing key.
 
-Redis syntax: HELLO [protover]
+Redis syntax: LINSERT key BEFORE|AFTER pivot element
+Example: LINSERT queue BEFORE job2 urgent
 */
-type HelloCommand struct {
-	value string
+type LInsertCommand struct {
+	key    []byte
+	before bool
+	pivot  []byte
+	value  []byte
+}
+
+func (c LInsertCommand) Execute(storage *Storage) ([]byte, error) {
+	length, err := storage.LInsert(c.key, c.before, c.pivot, c.value)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(length)), nil
 }
 
 /*
-Execute returns server information
+LSetCommand represents the LSET command
 
-Returns a map with server details formatted according to RESP protocol.
-This helps clients understand what server they're connected to.
+LSET overwrites the element at an index. The key must exist and the
+index must be inside the list.
+
+Redis syntax: LSET key index element
+Example: LSET queue 0 first
 */
-func (c HelloCommand) Execute(storage *Storage) ([]byte, error) {
-	spec := map[string]string{
-		"server":  "redis-clone",
-		"version": "1.0.0",
-		"proto":   "2",
-		"mode":    "standalone",
+type LSetCommand struct {
+	key   []byte
+	index int
+	value []byte
+}
+
+func (c LSetCommand) Execute(storage *Storage) ([]byte, error) {
+	if err := storage.LSet(c.key, c.index, c.value); err != nil {
+		return nil, err
 	}
-	return respWriteMap(spec), nil
+	return respWriteSimpleString("OK"), nil
 }
 
 /*
-ClientCommand represents the CLIENT command
+LRemCommand represents the LREM command
 
-CLIENT provides client connection management functionality.
-This is a simplified implementation.
+LREM removes occurrences of an element. A positive count removes from the
+head, a negative count from the tail, and 0 removes every occurrence.
 
-Redis syntax: CLIENT subcommand [arguments...]
+Redis syntax: LREM key count element
+Example: LREM queue -2 job1 (removes the last two "job1" elements)
 */
-type ClientCommand struct {
-	value string
+type LRemCommand struct {
+	key   []byte
+	count int
+	value []byte
 }
 
-func (c ClientCommand) Execute(storage *Storage) ([]byte, error) {
-	return []byte("OK"), nil
+func (c LRemCommand) Execute(storage *Storage) ([]byte, error) {
+	removed, err := storage.LRem(c.key, c.count, c.value)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(removed)), nil
 }
 
 /*
-PingCommand represents the PING command
+LTrimCommand represents the LTRIM command
 
-PING tests the connection to the server. It can optionally echo a message.
-This is commonly used for health checks and connection testing.
+LTRIM keeps only the elements between two inclusive indices.
+It's typically paired with LPUSH to keep a capped list of recent items.
 
-Redis syntax: PING [message]
-Examples:
-- PING (returns "PONG")
-- PING "hello" (returns "hello")
+Redis syntax: LTRIM key start stop
+Example: LTRIM recent 0 99 (keep the 100 newest entries)
 */
-type PingCommand struct {
-	message string
+type LTrimCommand struct {
+	key   []byte
+	start int
+	stop  int
 }
 
-func (c PingCommand) Execute(storage *Storage) ([]byte, error) {
-	if c.message == "" {
-		return []byte("PONG"), nil
+func (c LTrimCommand) Execute(storage *Storage) ([]byte, error) {
+	if err := storage.LTrim(c.key, c.start, c.stop); err != nil {
+		return nil, err
 	}
-	return []byte(c.message), nil
+	return respWriteSimpleString("OK"), nil
 }
 
 /*
-=== RESP PROTOCOL HELPER FUNCTIONS ===
+=== SET COMMANDS ===
 
-RESP (Redis Serialization Protocol) is the protocol Redis uses for
-client-server communication. It's a simple text-based protocol.
+These commands work with sets: unordered collections of unique members.
+*/
 
-RESP Data Types:
-- Simple Strings: +OK\r\n
-- Errors: -Error message\r\n
-- Integers: :123\r\n
-- Bulk Strings: $5\r\nhello\r\n
-- Arrays: *2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n
-- Maps: %2\r\n+key1\r\n+value1\r\n+key2\r\n+value2\r\n
+/*
+SAddCommand represents the SADD command
 
-These helper functions format our response data according to RESP.
+SADD adds members to a set, creating the set when missing.
+Returns how many members were new.
+
+Redis syntax: SADD key member [member ...]
+Example: SADD tags go redis (returns 2 for a new set)
 */
+type SAddCommand struct {
+	key     []byte
+	members [][]byte
+}
+
+func (c SAddCommand) Execute(storage *Storage) ([]byte, error) {
+	added, err := storage.SAdd(c.key, c.members)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(added)), nil
+}
 
 /*
-respWriteMap writes a map as RESP format
+SRemCommand represents the SREM command
 
-Maps are used for structured data like server information.
-Format: %<count>\r\n followed by alternating keys and values.
+SREM removes members from a set and returns how many were present.
 
-Example: {"name": "redis", "version": "1.0"}
-Becomes: %2\r\n+name\r\n+redis\r\n+version\r\n+1.0\r\n
+Redis syntax: SREM key member [member ...]
 */
-func respWriteMap(m map[string]string) []byte {
-	buf := &bytes.Buffer{}
-	buf.WriteString("%" + fmt.Sprintf("%d\r\n", len(m)))
-	for k, v := range m {
-		buf.WriteString("+" + k + "\r\n")
-		buf.WriteString("+" + v + "\r\n")
+type SRemCommand struct {
+	key     []byte
+	members [][]byte
+}
+
+func (c SRemCommand) Execute(storage *Storage) ([]byte, error) {
+	removed, err := storage.SRem(c.key, c.members)
+	if err != nil {
+		return nil, err
 	}
-	return buf.Bytes()
+	return respWriteInteger(int64(removed)), nil
 }
 
 /*
-respWriteArray writes an array as RESP format
+SMembersCommand represents the SMEMBERS command
 
-Arrays are used for multi-value responses like MGET results.
-Format: *<count>\r\n followed by each element.
+SMEMBERS returns all members of a set, in no particular order.
 
-Example: ["hello", "world", null]
-Uses the resp library for proper null handling and bulk string formatting.
+Redis syntax: SMEMBERS key
 */
-func respWriteArray(arr [][]byte) []byte {
-	buf := &bytes.Buffer{}
-	buf.WriteString("*" + fmt.Sprintf("%d\r\n", len(arr)))
-	rw := resp.NewWriter(buf)
-	for _, item := range arr {
-		if item == nil {
-			rw.WriteNull()
-		} else {
-			rw.WriteBytes(item)
+type SMembersCommand struct {
+	key []byte
+}
+
+func (c SMembersCommand) Execute(storage *Storage) ([]byte, error) {
+	return joinStream(c.ExecuteStream(storage))
+}
+
+func (c SMembersCommand) ExecuteStream(storage *Storage) (replyStream, error) {
+	members, err := storage.setMembers(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return newArrayStream(len(members), func(i int) []byte { return []byte(members[i]) }), nil
+}
+
+/*
+SIsMemberCommand represents the SISMEMBER command
+
+SISMEMBER returns 1 if the member is in the set, 0 otherwise.
+
+Redis syntax: SISMEMBER key member
+*/
+type SIsMemberCommand struct {
+	key    []byte
+	member []byte
+}
+
+func (c SIsMemberCommand) Execute(storage *Storage) ([]byte, error) {
+	found, err := storage.SIsMember(c.key, c.member)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return respWriteInteger(1), nil
+	}
+	return respWriteInteger(0), nil
+}
+
+/*
+SMIsMemberCommand represents the SMISMEMBER command
+
+SMISMEMBER checks several members at once and returns an array with 1 for
+every member in the set and 0 for the others, in argument order.
+
+Redis syntax: SMISMEMBER key member [member ...]
+Example: SMISMEMBER tags go rust (returns [1, 0] if only go is a member)
+*/
+type SMIsMemberCommand struct {
+	key     []byte
+	members [][]byte
+}
+
+func (c SMIsMemberCommand) Execute(storage *Storage) ([]byte, error) {
+	found, err := storage.SMIsMember(c.key, c.members)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make([]int64, len(found))
+	for i, isMember := range found {
+		if isMember {
+			flags[i] = 1
 		}
 	}
-	return buf.Bytes()
+	return respWriteIntegerArray(flags), nil
 }
 
 /*
-respWriteInteger writes an integer as RESP format
+SCardCommand represents the SCARD command
 
-Integers are prefixed with : and followed by \r\n
-Example: 42 becomes :42\r\n
+SCARD returns the number of members in a set, 0 for a missing key.
+
+Redis syntax: SCARD key
 */
-func respWriteInteger(num int64) []byte {
-	buf := &bytes.Buffer{}
-	buf.WriteString(":" + strconv.FormatInt(num, 10) + "\r\n")
-	return buf.Bytes()
+type SCardCommand struct {
+	key []byte
+}
+
+func (c SCardCommand) Execute(storage *Storage) ([]byte, error) {
+	card, err := storage.SCard(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(card)), nil
+}
+
+/*
+SMoveCommand represents the SMOVE command
+
+SMOVE atomically moves a member from one set to another.
+Returns 1 if the member was moved, 0 if it wasn't in the source set.
+
+Redis syntax: SMOVE source destination member
+Example: SMOVE todo done task42
+*/
+type SMoveCommand struct {
+	source      []byte
+	destination []byte
+	member      []byte
+}
+
+func (c SMoveCommand) Execute(storage *Storage) ([]byte, error) {
+	moved, err := storage.SMove(c.source, c.destination, c.member)
+	if err != nil {
+		return nil, err
+	}
+	if moved {
+		return respWriteInteger(1), nil
+	}
+	return respWriteInteger(0), nil
+}
+
+/*
+SPopCommand represents the SPOP command
+
+SPOP removes and returns random members. Without a count it returns one
+member as a bulk string (null for a missing key); with a count it returns
+an array of up to count members (empty for a missing key).
+
+Redis syntax: SPOP key [count]
+Example: SPOP raffle 3 (draws three winners)
+*/
+type SPopCommand struct {
+	key      []byte
+	count    int
+	hasCount bool
+}
+
+func (c SPopCommand) Execute(storage *Storage) ([]byte, error) {
+	count := 1
+	if c.hasCount {
+		count = c.count
+	}
+
+	popped, exists, err := storage.SPop(c.key, count)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.hasCount {
+		if !exists {
+			return respNull, nil
+		}
+		return respWriteBulkString(popped[0]), nil
+	}
+	return respWriteArray(popped), nil
+}
+
+/*
+SRandMemberCommand represents the SRANDMEMBER command
+
+SRANDMEMBER returns random members without removing them. Without a count
+it returns one member (null for a missing key). A positive count returns up
+to count distinct members; a negative count returns exactly |count|
+members, possibly repeated.
+
+Redis syntax: SRANDMEMBER key [count]
+Example: SRANDMEMBER deck -5 (five draws with replacement)
+*/
+type SRandMemberCommand struct {
+	key      []byte
+	count    int
+	hasCount bool
+}
+
+func (c SRandMemberCommand) Execute(storage *Storage) ([]byte, error) {
+	count := 1
+	if c.hasCount {
+		count = c.count
+	}
+
+	picked, exists, err := storage.SRandMember(c.key, count)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.hasCount {
+		if !exists {
+			return respNull, nil
+		}
+		return respWriteBulkString(picked[0]), nil
+	}
+	return respWriteArray(picked), nil
+}
+
+/*
+SetOpCommand represents the SINTER, SUNION and SDIFF commands
+
+They compute the intersection, union or difference of the given sets.
+Missing keys count as empty sets.
+
+Redis syntax: SINTER key [key ...] / SUNION key [key ...] / SDIFF key [key ...]
+Example: SINTER friends:alice friends:bob (mutual friends)
+*/
+type SetOpCommand struct {
+	op   setOperation
+	keys [][]byte
+}
+
+func (c SetOpCommand) Execute(storage *Storage) ([]byte, error) {
+	members, err := storage.SetOp(c.op, c.keys)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteArray(members), nil
+}
+
+/*
+SetOpStoreCommand represents the SINTERSTORE, SUNIONSTORE and SDIFFSTORE commands
+
+They compute the same result as SINTER, SUNION and SDIFF but store it at
+the destination key atomically, returning the size of the stored set.
+
+Redis syntax: SINTERSTORE destination key [key ...]
+Example: SUNIONSTORE all:tags tags:1 tags:2
+*/
+type SetOpStoreCommand struct {
+	op          setOperation
+	destination []byte
+	keys        [][]byte
+}
+
+func (c SetOpStoreCommand) Execute(storage *Storage) ([]byte, error) {
+	card, err := storage.SetOpStore(c.op, c.destination, c.keys)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(card)), nil
+}
+
+/*
+=== HASH COMMANDS ===
+
+These commands work with hashes: maps of fields to values stored under a
+single key, typically one hash per object.
+*/
+
+/*
+HSetCommand represents the HSET command
+
+HSET sets one or more fields of a hash, creating the hash when missing.
+Returns how many fields were created; updated fields don't count.
+
+Redis syntax: HSET key field value [field value ...]
+Example: HSET user:1 name "John" age 25
+*/
+type HSetCommand struct {
+	key   []byte
+	pairs [][]byte
+}
+
+func (c HSetCommand) Execute(storage *Storage) ([]byte, error) {
+	created, err := storage.HSet(c.key, c.pairs)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(created)), nil
+}
+
+/*
+HSetNXCommand represents the HSETNX command
+
+HSETNX sets a field only if it doesn't exist yet.
+Returns 1 if the field was set, 0 if it already existed.
+
+Redis syntax: HSETNX key field value
+Example: HSETNX user:1 created_at 1700000000
+*/
+type HSetNXCommand struct {
+	key   []byte
+	field []byte
+	value []byte
+}
+
+func (c HSetNXCommand) Execute(storage *Storage) ([]byte, error) {
+	set, err := storage.HSetNX(c.key, c.field, c.value)
+	if err != nil {
+		return nil, err
+	}
+	if set {
+		return respWriteInteger(1), nil
+	}
+	return respWriteInteger(0), nil
+}
+
+/*
+HGetCommand represents the HGET command
+
+HGET returns the value of a hash field, or null if it doesn't exist.
+
+Redis syntax: HGET key field
+Example: HGET user:1 name (returns "John")
+*/
+type HGetCommand struct {
+	key   []byte
+	field []byte
+}
+
+func (c HGetCommand) Execute(storage *Storage) ([]byte, error) {
+	value, exists, err := storage.HGet(c.key, c.field)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return respNull, nil
+	}
+	return respWriteBulkString(value), nil
+}
+
+/*
+HMGetCommand represents the HMGET command
+
+HMGET returns the values of several fields in one round trip.
+Missing fields are null in their position.
+
+Redis syntax: HMGET key field [field ...]
+Example: HMGET user:1 name age email (returns ["John", "25", null])
+*/
+type HMGetCommand struct {
+	key    []byte
+	fields [][]byte
+}
+
+func (c HMGetCommand) Execute(storage *Storage) ([]byte, error) {
+	return joinParts(c.ExecuteParts(storage))
+}
+
+func (c HMGetCommand) ExecuteParts(storage *Storage) (net.Buffers, error) {
+	values, err := storage.HMGet(c.key, c.fields)
+	if err != nil {
+		return nil, err
+	}
+	return respArrayParts(values), nil
+}
+
+/*
+HDelCommand represents the HDEL command
+
+HDEL removes fields from a hash and returns how many existed.
+
+Redis syntax: HDEL key field [field ...]
+*/
+type HDelCommand struct {
+	key    []byte
+	fields [][]byte
+}
+
+func (c HDelCommand) Execute(storage *Storage) ([]byte, error) {
+	deleted, err := storage.HDel(c.key, c.fields)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(deleted)), nil
+}
+
+/*
+HGetAllCommand represents the HGETALL command
+
+HGETALL returns all fields and values of a hash as a flat array
+alternating field and value.
+
+Redis syntax: HGETALL key
+*/
+type HGetAllCommand struct {
+	key []byte
+}
+
+func (c HGetAllCommand) Execute(storage *Storage) ([]byte, error) {
+	return joinStream(c.ExecuteStream(storage))
+}
+
+func (c HGetAllCommand) ExecuteStream(storage *Storage) (replyStream, error) {
+	fields, values, err := storage.hashEntries(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return newArrayStream(len(fields)*2, func(i int) []byte {
+		if i%2 == 0 {
+			return []byte(fields[i/2])
+		}
+		return values[i/2]
+	}), nil
+}
+
+/*
+HLenCommand represents the HLEN command
+
+HLEN returns the number of fields in a hash, 0 for a missing key.
+
+Redis syntax: HLEN key
+*/
+type HLenCommand struct {
+	key []byte
+}
+
+func (c HLenCommand) Execute(storage *Storage) ([]byte, error) {
+	length, err := storage.HLen(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(length)), nil
+}
+
+/*
+HExistsCommand represents the HEXISTS command
+
+HEXISTS returns 1 if the hash has the field, 0 otherwise.
+
+Redis syntax: HEXISTS key field
+*/
+type HExistsCommand struct {
+	key   []byte
+	field []byte
+}
+
+func (c HExistsCommand) Execute(storage *Storage) ([]byte, error) {
+	exists, err := storage.HExists(c.key, c.field)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return respWriteInteger(1), nil
+	}
+	return respWriteInteger(0), nil
+}
+
+/*
+HIncrByCommand represents the HINCRBY command
+
+HINCRBY increments the integer stored in a hash field, so per-object
+counters can live inside the object's hash instead of separate keys.
+A missing field starts at 0.
+
+Redis syntax: HINCRBY key field increment
+Example: HINCRBY article:7 views 1
+*/
+type HIncrByCommand struct {
+	key       []byte
+	field     []byte
+	increment int64
+}
+
+func (c HIncrByCommand) Execute(storage *Storage) ([]byte, error) {
+	value, err := storage.HIncrBy(c.key, c.field, c.increment)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(value), nil
+}
+
+/*
+HExpireCommand represents the HEXPIRE and HPEXPIRE commands
+
+They give hash fields a TTL of their own, so entries of a hash (sessions,
+cached lookups) expire one by one. HEXPIRE takes seconds, HPEXPIRE
+milliseconds; the options only set the TTL of fields without one (NX),
+with one (XX), or when it moves the expiration later (GT) or earlier (LT).
+
+Redis syntax: HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+Example: HEXPIRE sessions:42 3600 FIELDS 1 token:abc
+*/
+type HExpireCommand struct {
+	key    []byte
+	fields [][]byte
+	ttl    time.Duration
+	cond   fieldExpireCondition
+}
+
+func (c HExpireCommand) Execute(storage *Storage) ([]byte, error) {
+	codes, err := storage.HExpire(c.key, c.fields, time.Now().Add(c.ttl), c.cond)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteIntegerArray(codes), nil
+}
+
+/*
+HTTLCommand represents the HTTL and HPTTL commands
+
+They report the time hash fields have left: HTTL in seconds, rounded up,
+HPTTL in milliseconds; -1 for a field without a TTL and -2 for a missing
+field.
+
+Redis syntax: HTTL key FIELDS numfields field [field ...]
+Example: HTTL sessions:42 FIELDS 2 token:abc token:def
+*/
+type HTTLCommand struct {
+	key    []byte
+	fields [][]byte
+	millis bool // HPTTL
+}
+
+func (c HTTLCommand) Execute(storage *Storage) ([]byte, error) {
+	ttls, err := storage.HPTTL(c.key, c.fields)
+	if err != nil {
+		return nil, err
+	}
+	if !c.millis {
+		for i, ttl := range ttls {
+			if ttl >= 0 {
+				ttls[i] = (ttl + 999) / 1000
+			}
+		}
+	}
+	return respWriteIntegerArray(ttls), nil
+}
+
+/*
+HPersistCommand represents the HPERSIST command
+
+HPERSIST removes the TTL of hash fields, so they stay until deleted: 1 for
+each field whose TTL was removed, -1 for a field without one and -2 for a
+missing field.
+
+Redis syntax: HPERSIST key FIELDS numfields field [field ...]
+Example: HPERSIST sessions:42 FIELDS 1 token:abc
+*/
+type HPersistCommand struct {
+	key    []byte
+	fields [][]byte
+}
+
+func (c HPersistCommand) Execute(storage *Storage) ([]byte, error) {
+	codes, err := storage.HPersist(c.key, c.fields)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteIntegerArray(codes), nil
+}
+
+/*
+=== SORTED SET COMMANDS ===
+
+These commands work with sorted sets: unique members ordered by a score.
+They're the building block for leaderboards, priority queues and indexes.
+*/
+
+/*
+zsetReply formats sorted set members as a RESP array
+
+With scores, members and scores alternate in the array, like Redis does
+over RESP2.
+*/
+func zsetReply(items []zsetItem, withScores bool) []byte {
+	size := len(items)
+	if withScores {
+		size *= 2
+	}
+
+	reply := make([][]byte, 0, size)
+	for _, item := range items {
+		reply = append(reply, []byte(item.member))
+		if withScores {
+			reply = append(reply, formatScore(item.score))
+		}
+	}
+	return respWriteArray(reply)
+}
+
+/*
+ZAddCommand represents the ZADD command
+
+ZADD adds members with scores to a sorted set, creating it when missing.
+Members that already exist get their score updated.
+Options:
+  - NX: only add new members; XX: only update existing ones
+  - GT / LT: only update when the new score is greater / lower
+  - CH: reply with the number of added and changed members
+  - INCR: act like ZINCRBY and reply with the new score (null if the
+    other options prevented the update)
+
+Returns the number of members that were added.
+
+Redis syntax: ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+Example: ZADD leaderboard GT CH 100 alice 85 bob
+*/
+type ZAddCommand struct {
+	key   []byte
+	items []zsetItem
+	opts  zaddOptions
+}
+
+func (c ZAddCommand) Execute(storage *Storage) ([]byte, error) {
+	if c.opts.incr {
+		item := c.items[0]
+		score, ok, err := storage.ZIncrBy(c.key, item.score, []byte(item.member), c.opts)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return respNull, nil
+		}
+		return respWriteBulkString(formatScore(score)), nil
+	}
+
+	count, err := storage.ZAdd(c.key, c.items, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(count)), nil
+}
+
+/*
+ZIncrByCommand represents the ZINCRBY command
+
+ZINCRBY atomically adds to the score of a member and returns the new score.
+A missing member is created with the increment as its score.
+
+Redis syntax: ZINCRBY key increment member
+Example: ZINCRBY leaderboard 5 alice
+*/
+type ZIncrByCommand struct {
+	key       []byte
+	increment float64
+	member    []byte
+}
+
+func (c ZIncrByCommand) Execute(storage *Storage) ([]byte, error) {
+	score, _, err := storage.ZIncrBy(c.key, c.increment, c.member, zaddOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return respWriteBulkString(formatScore(score)), nil
+}
+
+/*
+ZScoreCommand represents the ZSCORE command
+
+ZSCORE returns the score of a member, or null if it doesn't exist.
+
+Redis syntax: ZSCORE key member
+*/
+type ZScoreCommand struct {
+	key    []byte
+	member []byte
+}
+
+func (c ZScoreCommand) Execute(storage *Storage) ([]byte, error) {
+	score, exists, err := storage.ZScore(c.key, c.member)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return respNull, nil
+	}
+	return respWriteBulkString(formatScore(score)), nil
+}
+
+/*
+ZRemCommand represents the ZREM command
+
+ZREM removes members from a sorted set and returns how many were present.
+
+Redis syntax: ZREM key member [member ...]
+*/
+type ZRemCommand struct {
+	key     []byte
+	members [][]byte
+}
+
+func (c ZRemCommand) Execute(storage *Storage) ([]byte, error) {
+	removed, err := storage.ZRem(c.key, c.members)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(removed)), nil
+}
+
+/*
+ZRangeCommand represents the ZRANGE, ZRANGEBYSCORE and ZRANGEBYLEX commands
+
+ZRANGE returns a slice of a sorted set, lowest score first. The slice is
+chosen by rank (the default), by score interval (BYSCORE) or by
+lexicographic interval (BYLEX). REV returns it highest first, and LIMIT
+offset count pages through score and lexicographic ranges.
+
+ZRANGEBYSCORE and ZRANGEBYLEX are the older forms of ZRANGE BYSCORE and
+ZRANGE BYLEX.
+
+Redis syntax: ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+Example: ZRANGE leaderboard +inf 100 BYSCORE REV LIMIT 0 10 WITHSCORES
+*/
+type ZRangeCommand struct {
+	key        []byte
+	by         zrangeBy
+	start      int        // rank range, used with zrangeByRank
+	stop       int        // rank range, used with zrangeByRank
+	scores     scoreRange // used with zrangeByScore
+	lex        lexRange   // used with zrangeByLex
+	rev        bool
+	offset     int
+	count      int // -1 means no LIMIT
+	withScores bool
+}
+
+func (c ZRangeCommand) Execute(storage *Storage) ([]byte, error) {
+	var items []zsetItem
+	var err error
+	switch c.by {
+	case zrangeByScore:
+		items, err = storage.ZRangeByScore(c.key, c.scores, c.rev, c.offset, c.count)
+	case zrangeByLex:
+		items, err = storage.ZRangeByLex(c.key, c.lex, c.rev, c.offset, c.count)
+	default:
+		items, err = storage.ZRange(c.key, c.start, c.stop, c.rev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(items, c.withScores), nil
+}
+
+/*
+ZCardCommand represents the ZCARD command
+
+ZCARD returns the number of members in a sorted set (0 for a missing key).
+
+Redis syntax: ZCARD key
+*/
+type ZCardCommand struct {
+	key []byte
+}
+
+func (c ZCardCommand) Execute(storage *Storage) ([]byte, error) {
+	count, err := storage.ZCard(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(count)), nil
+}
+
+/*
+ZCountCommand represents the ZCOUNT command
+
+ZCOUNT returns the number of members with a score between min and max.
+Bounds are inclusive unless prefixed with "(", and may be -inf or +inf.
+
+Redis syntax: ZCOUNT key min max
+Example: ZCOUNT leaderboard (50 +inf
+*/
+type ZCountCommand struct {
+	key    []byte
+	scores scoreRange
+}
+
+func (c ZCountCommand) Execute(storage *Storage) ([]byte, error) {
+	count, err := storage.ZCount(c.key, c.scores)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(count)), nil
+}
+
+/*
+ZLexCountCommand represents the ZLEXCOUNT command
+
+ZLEXCOUNT returns the number of members between min and max in
+lexicographic order. Bounds are "[member" (inclusive), "(member"
+(exclusive), "-" or "+".
+
+Redis syntax: ZLEXCOUNT key min max
+Example: ZLEXCOUNT words [a (c
+*/
+type ZLexCountCommand struct {
+	key []byte
+	lex lexRange
+}
+
+func (c ZLexCountCommand) Execute(storage *Storage) ([]byte, error) {
+	count, err := storage.ZLexCount(c.key, c.lex)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(count)), nil
+}
+
+/*
+ZRandMemberCommand represents the ZRANDMEMBER command
+
+ZRANDMEMBER returns random members without removing them. Without a count
+it returns one member (null for a missing key). A positive count returns up
+to count distinct members; a negative count returns exactly |count|
+members, possibly repeated. WITHSCORES adds the score after each member.
+
+Redis syntax: ZRANDMEMBER key [count [WITHSCORES]]
+Example: ZRANDMEMBER leaderboard -3 WITHSCORES
+*/
+type ZRandMemberCommand struct {
+	key        []byte
+	count      int
+	hasCount   bool
+	withScores bool
+}
+
+func (c ZRandMemberCommand) Execute(storage *Storage) ([]byte, error) {
+	count := 1
+	if c.hasCount {
+		count = c.count
+	}
+
+	picked, exists, err := storage.ZRandMember(c.key, count)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.hasCount {
+		if !exists {
+			return respNull, nil
+		}
+		return respWriteBulkString([]byte(picked[0].member)), nil
+	}
+	return zsetReply(picked, c.withScores), nil
+}
+
+/*
+=== PUB/SUB COMMANDS ===
+
+These commands implement publish/subscribe messaging (see pubsub.go).
+They work on the connection that sent them, so they implement peerCommand.
+*/
+
+/*
+SubscribeCommand represents the SUBSCRIBE command
+
+SUBSCRIBE subscribes the client to channels. The client gets one
+confirmation per channel and then receives every message published to them.
+
+Redis syntax: SUBSCRIBE channel [channel ...]
+Example: SUBSCRIBE news alerts
+*/
+type SubscribeCommand struct {
+	peerOnly
+	channels [][]byte
+}
+
+func (c SubscribeCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return server.pubsub.Subscribe(peer, c.channels), nil
+}
+
+/*
+UnsubscribeCommand represents the UNSUBSCRIBE command
+
+UNSUBSCRIBE unsubscribes the client from the given channels, or from every
+channel when none are given.
+
+Redis syntax: UNSUBSCRIBE [channel [channel ...]]
+*/
+type UnsubscribeCommand struct {
+	peerOnly
+	channels [][]byte
+}
+
+func (c UnsubscribeCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return server.pubsub.Unsubscribe(peer, c.channels), nil
+}
+
+/*
+PSubscribeCommand represents the PSUBSCRIBE command
+
+PSUBSCRIBE subscribes the client to every channel matching a glob pattern.
+Messages arrive as pmessage frames that also name the matching pattern.
+
+Redis syntax: PSUBSCRIBE pattern [pattern ...]
+Example: PSUBSCRIBE news.* user:[0-9]*
+*/
+type PSubscribeCommand struct {
+	peerOnly
+	patterns [][]byte
+}
+
+func (c PSubscribeCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return server.pubsub.PSubscribe(peer, c.patterns), nil
+}
+
+/*
+PUnsubscribeCommand represents the PUNSUBSCRIBE command
+
+PUNSUBSCRIBE unsubscribes the client from the given patterns, or from every
+pattern when none are given.
+
+Redis syntax: PUNSUBSCRIBE [pattern [pattern ...]]
+*/
+type PUnsubscribeCommand struct {
+	peerOnly
+	patterns [][]byte
+}
+
+func (c PUnsubscribeCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return server.pubsub.PUnsubscribe(peer, c.patterns), nil
+}
+
+/*
+PublishCommand represents the PUBLISH command
+
+PUBLISH sends a message to every client subscribed to the channel, directly
+or through a matching pattern, and returns how many received it.
+
+Redis syntax: PUBLISH channel message
+Example: PUBLISH news "hello"
+*/
+type PublishCommand struct {
+	peerOnly
+	channel []byte
+	message []byte
+}
+
+func (c PublishCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return respWriteInteger(int64(server.pubsub.Publish(c.channel, c.message))), nil
+}
+
+/*
+SSubscribeCommand represents the SSUBSCRIBE command
+
+SSUBSCRIBE subscribes the client to shard channels, the Redis 7 channels
+that cluster-aware clients use for sharded pub/sub.
+
+Redis syntax: SSUBSCRIBE shardchannel [shardchannel ...]
+Example: SSUBSCRIBE orders:{eu}
+*/
+type SSubscribeCommand struct {
+	peerOnly
+	channels [][]byte
+}
+
+func (c SSubscribeCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return server.pubsub.SSubscribe(peer, c.channels), nil
+}
+
+/*
+SUnsubscribeCommand represents the SUNSUBSCRIBE command
+
+SUNSUBSCRIBE unsubscribes the client from the given shard channels, or from
+every shard channel when none are given.
+
+Redis syntax: SUNSUBSCRIBE [shardchannel [shardchannel ...]]
+*/
+type SUnsubscribeCommand struct {
+	peerOnly
+	channels [][]byte
+}
+
+func (c SUnsubscribeCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return server.pubsub.SUnsubscribe(peer, c.channels), nil
+}
+
+/*
+SPublishCommand represents the SPUBLISH command
+
+SPUBLISH sends a message to every client subscribed to a shard channel and
+returns how many received it.
+
+Redis syntax: SPUBLISH shardchannel message
+*/
+type SPublishCommand struct {
+	peerOnly
+	channel []byte
+	message []byte
+}
+
+func (c SPublishCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return respWriteInteger(int64(server.pubsub.SPublish(c.channel, c.message))), nil
+}
+
+/*
+=== UTILITY COMMANDS ===
+
+These commands provide additional functionality for key management,
+atomic operations, and administrative tasks.
+*/
+
+/*
+GetSetCommand represents the GETSET command
+
+GETSET atomically sets a key to a new value and returns the old value.
+This is useful for implementing atomic counters, flags, or swapping values.
+
+Redis syntax: GETSET key newvalue
+Example: GETSET counter 0 (sets counter to 0 and returns previous value,
+or null if counter didn't exist)
+*/
+type GetSetCommand struct {
+	key []byte
+	val []byte
+}
+
+func (c GetSetCommand) Execute(storage *Storage) ([]byte, error) {
+	oldVal, exists, err := storage.GetSet(c.key, c.val)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+	return respWriteBulkString(oldVal), nil
+}
+
+/*
+KeysCommand represents the KEYS command
+
+KEYS returns all keys matching a given pattern. Uses simple glob-style
+pattern matching with * wildcards.
+
+WARNING: This command can be slow with large datasets as it scans all keys.
+In production Redis, this command is often disabled.
+
+Redis syntax: KEYS pattern
+Examples:
+- KEYS * (returns all keys)
+- KEYS user:* (returns all keys starting with "user:")
+*/
+type KeysCommand struct {
+	pattern string
+}
+
+func (c KeysCommand) Execute(storage *Storage) ([]byte, error) {
+	return joinParts(c.ExecuteParts(storage))
+}
+
+func (c KeysCommand) ExecuteParts(storage *Storage) (net.Buffers, error) {
+	keys := storage.Keys(c.pattern)
+	keyBytes := make([][]byte, len(keys))
+	for i, key := range keys {
+		keyBytes[i] = []byte(key)
+	}
+	return respArrayParts(keyBytes), nil
+}
+
+/*
+ScanCommand represents the SCAN command
+
+SCAN iterates the keyspace a page at a time; the reply holds the cursor
+for the next call and the keys of this page (see scan.go).
+
+Redis syntax: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+Example: SCAN 0 MATCH user:* COUNT 100
+*/
+type ScanCommand struct {
+	cursor    uint64
+	pattern   string
+	count     int
+	valueType ValueType
+}
+
+func (c ScanCommand) Execute(storage *Storage) ([]byte, error) {
+	return joinParts(c.ExecuteParts(storage))
+}
+
+func (c ScanCommand) ExecuteParts(storage *Storage) (net.Buffers, error) {
+	next, keys := storage.Scan(c.cursor, c.count, c.pattern, c.valueType)
+
+	keyBytes := make([][]byte, len(keys))
+	for i, key := range keys {
+		keyBytes[i] = []byte(key)
+	}
+
+	// The cursor for the next call, then the keys of this page
+	w := newPartsWriter(estimateArray(keyBytes) + 32)
+	w.writeString("*2\r\n")
+	w.writeBulk(strconv.AppendUint(nil, next, 10))
+	w.writeArray(keyBytes)
+	return w.done(), nil
+}
+
+/*
+FlushAllCommand represents the FLUSHALL command
+
+FLUSHALL removes all keys from the database. This is equivalent to
+restarting with an empty database.
+
+WARNING: This operation is destructive and cannot be undone.
+
+Redis syntax: FLUSHALL
+*/
+type FlushAllCommand struct{}
+
+func (c FlushAllCommand) Execute(storage *Storage) ([]byte, error) {
+	storage.FlushAll()
+	return respWriteSimpleString("OK"), nil
+}
+
+/*
+ImportCommand represents the IMPORT command
+
+IMPORT stores a batch of whole keys, replacing existing ones; it's the
+fast path goredis-import uses to seed a server (see import.go). Each
+record gives the type, the key, the TTL in milliseconds (-1 for none),
+the number of elements and the elements.
+
+Redis syntax: IMPORT type key ttl count element [element ...] [type key ttl count element ...]
+Example: IMPORT string name -1 1 John hash user:1 60000 2 visits 3 (returns 2)
+*/
+type ImportCommand struct {
+	records []ImportRecord
+}
+
+func (c ImportCommand) Execute(storage *Storage) ([]byte, error) {
+	imported, err := storage.Import(c.records)
+	if err != nil {
+		return nil, err
+	}
+	return respWriteInteger(int64(imported)), nil
+}
+
+/*
+ExportCommand represents the EXPORT command
+
+EXPORT reads the keyspace as of one instant, a page at a time, in the
+record format IMPORT takes; it's what goredis-export reads a server with
+(see export.go). The reply holds the cursor for the next call and the
+records of this page, each an array of type, key, TTL in milliseconds
+(-1 for none) and elements.
+
+Redis syntax (an extension, Redis has no such command): EXPORT cursor [COUNT count] [MATCH pattern]
+Example: EXPORT 0 COUNT 1000 (takes a snapshot and returns its first 1000 keys)
+*/
+type ExportCommand struct {
+	peerOnly
+	cursor  uint64
+	count   int
+	pattern string
+}
+
+/*
+ExecutePeer continues the connection's export, or starts one for cursor 0
+
+Returns: The next cursor (0 once every key was returned) and the records
+*/
+func (c ExportCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	sn := peer.session.export
+	if c.cursor == 0 {
+		if sn != nil {
+			sn.Close()
+		}
+		sn = server.storage.SnapshotKeyspace()
+		peer.session.export = sn
+	} else if sn == nil || c.cursor != uint64(sn.next) {
+		return nil, errInvalidCursor
+	}
+
+	entries := sn.Next(c.count)
+	now := time.Now()
+	records := make([][]byte, 0, len(entries))
+	size := 0
+	for _, entry := range entries {
+		if c.pattern != "" && !matchPattern(entry.Key, c.pattern) {
+			continue
+		}
+		if record := exportRecord(entry, now); record != nil {
+			records = append(records, record)
+			size += len(record)
+		}
+	}
+
+	var next uint64
+	if sn.next < sn.Len() {
+		next = uint64(sn.next)
+	} else {
+		sn.Close()
+		peer.session.export = nil
+	}
+
+	reply := make([]byte, 0, size+48)
+	reply = append(reply, "*2\r\n"...)
+	reply = appendBulkString(reply, strconv.AppendUint(nil, next, 10))
+	reply = append(reply, "*"+strconv.Itoa(len(records))+"\r\n"...)
+	for _, record := range records {
+		reply = append(reply, record...)
+	}
+	return reply, nil
+}
+
+/*
+TypeCommand represents the TYPE command
+
+TYPE returns the type of the value stored at a key as a simple string:
+string, list, set, zset, hash, or none when the key doesn't exist.
+
+Redis syntax: TYPE key
+Example: TYPE name (returns "string")
+*/
+type TypeCommand struct {
+	key []byte
+}
+
+func (c TypeCommand) Execute(storage *Storage) ([]byte, error) {
+	return respWriteSimpleString(string(storage.Type(c.key))), nil
+}
+
+/*
+TTLCommand represents the TTL and PTTL commands
+
+TTL returns the time a key has left to live in seconds, PTTL in
+milliseconds; -1 when the key has no TTL and -2 when it doesn't exist.
+
+Redis syntax: TTL key, PTTL key
+Example: TTL session (returns 300 after SET session data EX 300)
+*/
+type TTLCommand struct {
+	key          []byte
+	milliseconds bool
+}
+
+func (c TTLCommand) Execute(storage *Storage) ([]byte, error) {
+	expireAt, exists := storage.ExpireAt(c.key)
+	if !exists {
+		return respWriteInteger(-2), nil
+	}
+	if expireAt.IsZero() {
+		return respWriteInteger(-1), nil
+	}
+
+	// Rounded like Redis, a key expiring in 1.5s has a TTL of 2
+	ttl := max(time.Until(expireAt).Milliseconds(), 0)
+	if !c.milliseconds {
+		ttl = (ttl + 500) / 1000
+	}
+	return respWriteInteger(ttl), nil
+}
+
+/*
+ExpireTimeCommand represents the EXPIRETIME and PEXPIRETIME commands
+
+EXPIRETIME returns the Unix time at which a key expires in seconds,
+PEXPIRETIME in milliseconds; -1 when the key has no TTL and -2 when it
+doesn't exist. Unlike a TTL, the timestamp doesn't depend on when it's
+read, so clients on different machines can compare it.
+
+Redis syntax: EXPIRETIME key, PEXPIRETIME key
+Example: EXPIRETIME session (returns 1767225900 after SET session data EX 300
+at Unix time 1767225600)
+*/
+type ExpireTimeCommand struct {
+	key          []byte
+	milliseconds bool
+}
+
+func (c ExpireTimeCommand) Execute(storage *Storage) ([]byte, error) {
+	expireAt, exists := storage.ExpireAt(c.key)
+	if !exists {
+		return respWriteInteger(-2), nil
+	}
+	if expireAt.IsZero() {
+		return respWriteInteger(-1), nil
+	}
+
+	// Rounded to the nearest second like TTL, as Redis does
+	at := expireAt.UnixMilli()
+	if !c.milliseconds {
+		at = (at + 500) / 1000
+	}
+	return respWriteInteger(at), nil
+}
+
+/*
+TTLStatsCommand represents the TTLSTATS command
+
+TTLSTATS counts the keys with a TTL by how long they have left, so a wave
+of keys about to expire at once shows up before it happens (see
+ttlstats.go).
+
+Redis syntax: none, TTLSTATS is specific to this server
+Example: TTLSTATS (returns keys.count, keys.with-ttl, expired.pending,
+then ttl.<=1s up to ttl.>7d, each followed by its count)
+*/
+type TTLStatsCommand struct{}
+
+func (c TTLStatsCommand) Execute(storage *Storage) ([]byte, error) {
+	return respWriteTTLStats(storage.TTLStats()), nil
+}
+
+/*
+ObjectCommand represents the OBJECT command family
+
+OBJECT inspects the internal representation of the value stored at a key.
+It's mostly used for debugging; the encodings name the structures values
+are really stored in (see Storage.Encoding), some of which Redis doesn't
+have.
+
+Redis syntax: OBJECT ENCODING|REFCOUNT|IDLETIME key, or OBJECT HELP
+Examples:
+- OBJECT ENCODING counter (returns "int")
+- OBJECT IDLETIME name (returns seconds since name was last accessed)
+*/
+type ObjectCommand struct {
+	subcommand string
+	key        []byte
+}
+
+/*
+Execute runs the requested OBJECT subcommand
+
+Missing keys produce a null reply for every subcommand, matching Redis.
+*/
+func (c ObjectCommand) Execute(storage *Storage) ([]byte, error) {
+	switch c.subcommand {
+	case "ENCODING":
+		encoding, ok := storage.Encoding(c.key)
+		if !ok {
+			return nil, nil
+		}
+		return respWriteBulkString([]byte(encoding)), nil
+
+	case "REFCOUNT":
+		refCount, ok := storage.RefCount(c.key)
+		if !ok {
+			return nil, nil
+		}
+		return respWriteInteger(int64(refCount)), nil
+
+	case "IDLETIME":
+		idle, ok := storage.IdleTime(c.key)
+		if !ok {
+			return nil, nil
+		}
+		return respWriteInteger(int64(idle / time.Second)), nil
+	}
+
+	return nil, errUnknownSubcommand(CommandOBJECT, c.subcommand)
+}
+
+/*
+MemoryCommand represents the MEMORY command family
+
+MEMORY reports and manages the server's memory (see memory.go).
+
+Redis syntax: MEMORY STATS|PURGE|USAGE key [SAMPLES count], or MEMORY HELP
+Examples:
+- MEMORY STATS (returns name/value pairs describing memory use)
+- MEMORY PURGE (returns memory the server doesn't need to the OS)
+- MEMORY USAGE name (returns the estimated bytes used by name)
+*/
+type MemoryCommand struct {
+	subcommand string
+	key        []byte // for USAGE
+	samples    int    // for USAGE: collection elements sampled, 0 for all
+}
+
+func (c MemoryCommand) Execute(storage *Storage) ([]byte, error) {
+	switch c.subcommand {
+	case "STATS":
+		// The compressed values are only reported while compression is on
+		var compression *CompressionStats
+		if storage.compressThreshold.Load() > 0 {
+			stats := storage.CompressionStats()
+			compression = &stats
+		}
+		return respWriteMemoryStats(readMemoryStats(), storage.Len(), compression), nil
+
+	case "PURGE":
+		purgeMemory()
+		return respWriteSimpleString("OK"), nil
+
+	case "USAGE":
+		usage, ok := storage.MemoryUsage(c.key, c.samples)
+		if !ok {
+			return nil, nil
+		}
+		return respWriteInteger(int64(usage)), nil
+	}
+
+	return nil, errUnknownSubcommand(CommandMEMORY, c.subcommand)
+}
+
+/*
+DebugCommand represents the DEBUG command family
+
+DEBUG is meant for test suites and operators, not applications. The
+supported subcommands:
+  - DIGEST: a digest of the whole dataset (see digest.go)
+  - DIGEST-VALUE key [key ...]: digests of the values at keys
+  - OBJECT key: low level information about a key (see Storage.DebugObject)
+  - SLEEP seconds: stall the whole server for a while; decimals are allowed
+  - SET-ACTIVE-EXPIRE 0|1: pause or resume the active expire cycle
+  - STRINGMATCH-LEN: fuzz the glob pattern matcher used by KEYS and PSUBSCRIBE
+
+FAULT, TRACE and DIAGNOSTICS work on the server rather than the storage,
+so they are parsed into FaultCommand, TraceCommand and DiagnosticsCommand
+instead.
+
+Redis syntax: DEBUG subcommand [arg]
+Example: DEBUG SLEEP 0.5 (blocks every client for half a second)
+*/
+type DebugCommand struct {
+	subcommand string
+	key        []byte
+	keys       [][]byte // DIGEST-VALUE
+	sleep      time.Duration
+	enabled    bool
+}
+
+/*
+debugFuzzRounds is how many random patterns DEBUG STRINGMATCH-LEN tries
+*/
+const debugFuzzRounds = 1_000_000
+
+/*
+Execute runs the requested DEBUG subcommand
+
+SLEEP runs on the server loop on purpose: like in Redis, no other command
+is served until it returns.
+*/
+func (c DebugCommand) Execute(storage *Storage) ([]byte, error) {
+	switch c.subcommand {
+	case "DIGEST":
+		return respWriteSimpleString(storage.Digest()), nil
+
+	case "DIGEST-VALUE":
+		return respWriteSimpleStrings(storage.DigestValues(c.keys)), nil
+
+	case "OBJECT":
+		info, ok := storage.DebugObject(c.key)
+		if !ok {
+			return nil, errNoSuchKey
+		}
+		return respWriteSimpleString(info), nil
+
+	case "SLEEP":
+		time.Sleep(c.sleep)
+		return respWriteSimpleString("OK"), nil
+
+	case "SET-ACTIVE-EXPIRE":
+		storage.SetActiveExpire(c.enabled)
+		return respWriteSimpleString("OK"), nil
+
+	case "STRINGMATCH-LEN":
+		fuzzMatchPattern(debugFuzzRounds)
+		return respWriteSimpleString("OK"), nil
+	}
+
+	return nil, errUnknownSubcommand(CommandDEBUG, c.subcommand)
+}
+
+/*
+FaultCommand represents DEBUG FAULT, which manages injected faults (see fault.go)
+
+Redis syntax (an extension, Redis has no such subcommand):
+  - DEBUG FAULT SET command DELAY ms|DROP|ERROR message|PARTIAL [RATE percent]
+  - DEBUG FAULT CLEAR [command]
+  - DEBUG FAULT LIST
+
+Examples:
+  - DEBUG FAULT SET GET DELAY 200 RATE 10 (one GET in ten takes 200ms longer)
+
+A DELAY of at most a minute only holds back the faulted client; the rest
+of the server carries on.
+  - DEBUG FAULT SET SET ERROR "LOADING Redis is loading the dataset in memory"
+*/
+type FaultCommand struct {
+	peerOnly
+	verb  string // SET, CLEAR or LIST
+	name  string // the faulted command, upper case; empty for CLEAR of every fault
+	fault fault
+}
+
+/*
+ExecutePeer changes or lists the server's faults
+
+Returns: OK for SET, the number of faults removed for CLEAR, and one line
+per fault for LIST
+*/
+func (c FaultCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	switch c.verb {
+	case "SET":
+		server.setFault(c.name, c.fault)
+		return respWriteSimpleString("OK"), nil
+
+	case "CLEAR":
+		return respWriteInteger(int64(server.clearFaults(c.name))), nil
+	}
+
+	return respWriteArray(server.listFaults()), nil
+}
+
+/*
+TraceCommand represents DEBUG TRACE, which selects the clients whose traffic is logged (see trace.go)
+
+Redis syntax (an extension, Redis has no such subcommand): DEBUG TRACE pattern|OFF
+Example: DEBUG TRACE 10.0.0.7:* (log everything exchanged with clients on 10.0.0.7)
+*/
+type TraceCommand struct {
+	peerOnly
+	pattern string // empty to stop tracing
+}
+
+/*
+ExecutePeer replaces the trace pattern
+
+Returns: The number of connected clients now traced
+*/
+func (c TraceCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return respWriteInteger(int64(server.setTracePattern(c.pattern))), nil
+}
+
+/*
+DiagnosticsCommand represents DEBUG DIAGNOSTICS, which writes a diagnostics
+dump to the server's log, like SIGUSR1 does (see diagnostics.go)
+
+Redis syntax (an extension, Redis has no such subcommand): DEBUG DIAGNOSTICS
+Example: DEBUG DIAGNOSTICS (goroutine stacks, queues and memory stats go to the log)
+*/
+type DiagnosticsCommand struct {
+	peerOnly
+}
+
+func (c DiagnosticsCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	server.dumpDiagnostics("DEBUG DIAGNOSTICS", true)
+	return respWriteSimpleString("OK"), nil
+}
+
+/*
+ClusterCommand represents the CLUSTER command family
+
+Only what makes sense for a single node serving every slot is supported:
+KEYSLOT tells which slot a key maps to, hash tags included.
+
+Redis syntax: CLUSTER KEYSLOT key
+Example: CLUSTER KEYSLOT {user1000}.following (returns 3443)
+*/
+type ClusterCommand struct {
+	peerOnly
+	subcommand string
+	key        []byte
+}
+
+func (c ClusterCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	if !server.ClusterEnabled {
+		return nil, errClusterDisabled
+	}
+	return respWriteInteger(int64(keyHashSlot(c.key))), nil
+}
+
+/*
+CommandCommand represents the COMMAND GETKEYS command
+
+GETKEYS reports the keys a command would touch, found with the key
+positions in commandSpecs; the keys are extracted while parsing.
+
+Redis syntax: COMMAND GETKEYS command [arg [arg ...]]
+Example: COMMAND GETKEYS MSET a 1 b 2 -> ["a", "b"]
+*/
+type CommandCommand struct {
+	keys [][]byte
+}
+
+func (c CommandCommand) Execute(storage *Storage) ([]byte, error) {
+	return respWriteArray(c.keys), nil
+}
+
+/*
+InfoCommand represents the INFO command
+
+INFO reports information and statistics about the server, grouped in
+sections (see info.go).
+
+Redis syntax: INFO [section [section ...]]
+Example: INFO stats
+*/
+type InfoCommand struct {
+	peerOnly
+	sections []string // lowercase section names, empty for every section
+}
+
+func (c InfoCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	return respWriteBulkString([]byte(server.info(c.sections))), nil
+}
+
+/*
+=== CONNECTION COMMANDS ===
+
+These commands handle client-server communication, handshakes,
+and connection management.
+*/
+
+/*
+HelloCommand represents the HELLO command
+
+HELLO is used for protocol negotiation and server information.
+It returns server details in a structured format.
+
+Redis syntax: HELLO [protover]
+*/
+type HelloCommand struct {
+	peerOnly
+	protocol int // the RESP version asked for, 0 to keep the current one
+}
+
+/*
+ExecutePeer switches the client's protocol and returns server information
+
+Returns a map with server details formatted according to RESP protocol.
+This helps clients understand what server they're connected to. The
+protocol version is the one recorded in the client's session, which
+decides how nulls and pub/sub messages are sent (see pubsub.go).
+*/
+func (c HelloCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	if c.protocol != 0 {
+		peer.session.protocol = c.protocol
+	}
+
+	spec := map[string]string{
+		"server":  "redis-clone",
+		"version": serverVersion,
+		"proto":   strconv.Itoa(peer.session.protocol),
+		"mode":    "standalone",
+	}
+	return respWriteMap(spec), nil
+}
+
+/*
+ClientCommand represents the CLIENT command
+
+CLIENT provides client connection management functionality. Supported
+subcommands:
+  - SETNAME name: name the connection (an empty name removes it)
+  - GETNAME: the connection's name, or null if it has none
+  - SETINFO option value: accepted and ignored, for client libraries that
+    send their name and version when connecting
+
+Redis syntax: CLIENT subcommand [arguments...]
+Example: CLIENT SETNAME worker-1
+*/
+type ClientCommand struct {
+	peerOnly
+	subcommand string
+	args       [][]byte
+}
+
+func (c ClientCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	switch c.subcommand {
+	case "SETNAME":
+		name := string(c.args[0])
+		for i := 0; i < len(name); i++ {
+			if name[i] < '!' || name[i] > '~' {
+				return nil, errInvalidClientName
+			}
+		}
+		peer.session.name = name
+		server.retrace(peer)
+
+	case "GETNAME":
+		if peer.session.name == "" {
+			return nil, nil
+		}
+		return respWriteBulkString([]byte(peer.session.name)), nil
+	}
+
+	return respWriteSimpleString("OK"), nil
+}
+
+/*
+PingCommand represents the PING command
+
+PING tests the connection to the server. It can optionally echo a message.
+This is commonly used for health checks and connection testing.
+
+Redis syntax: PING [message]
+Examples:
+- PING (returns +PONG, a simple string)
+- PING "hello" (returns "hello", a bulk string)
+*/
+type PingCommand struct {
+	message string
+}
+
+func (c PingCommand) Execute(storage *Storage) ([]byte, error) {
+	if c.message == "" {
+		return respWriteSimpleString("PONG"), nil
+	}
+	return respWriteBulkString([]byte(c.message)), nil
+}
+
+/*
+QuitCommand represents the QUIT command
+
+QUIT asks the server to close the connection. The server replies OK and
+then closes the connection once the reply has been written; closing is
+done by the message handler, since commands only see the storage.
+
+Redis syntax: QUIT
+*/
+type QuitCommand struct{}
+
+func (c QuitCommand) Execute(storage *Storage) ([]byte, error) {
+	return respWriteSimpleString("OK"), nil
+}
+
+/*
+ResetCommand represents the RESET command
+
+RESET returns the connection to the state of a new one: subscriptions are
+dropped, the protocol goes back to RESP2 and so on (see session.go). The
+client name is kept. Unlike most commands it's allowed in subscribed mode.
+
+Redis syntax: RESET
+*/
+type ResetCommand struct {
+	peerOnly
+}
+
+func (c ResetCommand) ExecutePeer(server *Server, peer *Peer) ([]byte, error) {
+	server.resetSession(peer)
+	return respWriteSimpleString("RESET"), nil
+}
+
+/*
+=== RESP PROTOCOL HELPER FUNCTIONS ===
+
+RESP (Redis Serialization Protocol) is the protocol Redis uses for
+client-server communication. It's a simple text-based protocol.
+
+RESP Data Types:
+- Simple Strings: +OK\r\n
+- Errors: -Error message\r\n
+- Integers: :123\r\n
+- Bulk Strings: $5\r\nhello\r\n
+- Arrays: *2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n
+- Maps: %2\r\n+key1\r\n+value1\r\n+key2\r\n+value2\r\n
+
+These helper functions format our response data according to RESP.
+*/
+
+/*
+respBufferPool recycles the buffers used to build replies
+
+Every reply used to allocate a fresh bytes.Buffer (and grow it while
+writing), which adds up under high QPS. Buffers are taken from the pool,
+filled, and their contents copied into one exactly-sized slice before the
+buffer goes back, so callers own the returned bytes.
+*/
+var respBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+/*
+maxPooledBufferSize keeps very large buffers out of the pool
+
+A single huge reply (e.g. KEYS * on a big dataset) shouldn't pin that much
+memory for the rest of the process lifetime.
+*/
+const maxPooledBufferSize = 64 * 1024
+
+/*
+getRespBuffer takes an empty buffer from the pool
+*/
+func getRespBuffer() *bytes.Buffer {
+	buf := respBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+/*
+releaseRespBuffer copies the buffer contents out and returns the buffer to the pool
+
+Returns: a slice owned by the caller holding the built reply
+*/
+func releaseRespBuffer(buf *bytes.Buffer) []byte {
+	out := make([]byte, buf.Len())
+	copy(out, buf.Bytes())
+	if buf.Cap() <= maxPooledBufferSize {
+		respBufferPool.Put(buf)
+	}
+	return out
+}
+
+/*
+respWriteMap writes a map as RESP format
+
+Maps are used for structured data like server information.
+Format: %<count>\r\n followed by alternating keys and values.
+
+Example: {"name": "redis", "version": "1.0"}
+Becomes: %2\r\n+name\r\n+redis\r\n+version\r\n+1.0\r\n
+*/
+func respWriteMap(m map[string]string) []byte {
+	buf := getRespBuffer()
+	buf.WriteString("%" + strconv.Itoa(len(m)) + "\r\n")
+	for k, v := range m {
+		buf.WriteString("+" + k + "\r\n")
+		buf.WriteString("+" + v + "\r\n")
+	}
+	return releaseRespBuffer(buf)
+}
+
+/*
+respWriteArray writes an array as RESP format
+
+Arrays are used for multi-value responses like MGET results.
+Format: *<count>\r\n followed by each element as a bulk string.
+
+Example: ["hello", "world", null]
+Becomes: *3\r\n$5\r\nhello\r\n$5\r\nworld\r\n$-1\r\n
+*/
+func respWriteArray(arr [][]byte) []byte {
+	buf := getRespBuffer()
+	buf.WriteString("*" + strconv.Itoa(len(arr)) + "\r\n")
+	for _, item := range arr {
+		if item == nil {
+			buf.WriteString("$-1\r\n")
+			continue
+		}
+		buf.WriteString("$" + strconv.Itoa(len(item)) + "\r\n")
+		buf.Write(item)
+		buf.WriteString("\r\n")
+	}
+	return releaseRespBuffer(buf)
+}
+
+/*
+respWritePush writes a RESP3 push frame: an array with a > header
+
+RESP3 clients get out-of-band data, like published messages, in push
+frames so they can tell it apart from command replies.
+Example: ["message", "news", "hi"] becomes >3\r\n$7\r\nmessage\r\n...
+*/
+func respWritePush(arr [][]byte) []byte {
+	elements := make([][]byte, len(arr))
+	for i, item := range arr {
+		elements[i] = respWriteBulkString(item)
+	}
+	return respWritePushFrame(3, elements...)
+}
+
+/*
+respWritePushFrame writes a frame pushed to a client outside of command
+replies, from elements already framed: a push frame (>) for RESP3 clients,
+an array (*) for RESP2 clients, which have no push type
+
+Example: respWritePushFrame(3, $9 subscribe, $4 news, :1) becomes
+>3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n
+*/
+func respWritePushFrame(protocol int, elements ...[]byte) []byte {
+	prefix := "*"
+	if protocol >= 3 {
+		prefix = ">"
+	}
+	size := 0
+	for _, element := range elements {
+		size += len(element)
+	}
+	frame := make([]byte, 0, size+16)
+	frame = append(frame, prefix+strconv.Itoa(len(elements))+"\r\n"...)
+	for _, element := range elements {
+		frame = append(frame, element...)
+	}
+	return frame
+}
+
+/*
+respWriteBulkString writes a binary-safe string as RESP format
+
+Bulk strings carry their length up front, so they may contain any bytes.
+Example: "hello" becomes $5\r\nhello\r\n
+*/
+func respWriteBulkString(data []byte) []byte {
+	return appendBulkString(make([]byte, 0, bulkStringSize(len(data))), data)
+}
+
+/*
+respNull is the RESP null bulk string, sent for missing values
+*/
+var respNull = []byte("$-1\r\n")
+
+/*
+respNull3 is the RESP3 null
+*/
+var respNull3 = []byte("_\r\n")
+
+/*
+respNullFor returns the null reply for a client's protocol version
+
+Commands returning nil get this one: $-1 for RESP2, _ for RESP3.
+*/
+func respNullFor(protocol int) []byte {
+	if protocol >= 3 {
+		return respNull3
+	}
+	return respNull
+}
+
+/*
+respNullArray is the RESP null array, sent when a whole array reply is missing
+*/
+var respNullArray = []byte("*-1\r\n")
+
+/*
+sharedIntegerRepliesMin is the smallest integer with a pre-rendered reply
+
+-1 and -2 are what TTL and friends answer for keys without a TTL or
+missing keys.
+*/
+const sharedIntegerRepliesMin = -2
+
+/*
+sharedIntegerReplies holds the RESP frames of the integers -2 to 9999
+
+Counters, lengths and the 0/1 answers of commands like EXISTS make up
+most integer replies, so these are sent from one table instead of being
+rendered and allocated every time, like Redis' shared integers. The
+frames are capped (len == cap) and never modified; replies handed to
+Peer.Send aren't modified anyway.
+*/
+var sharedIntegerReplies = func() [][]byte {
+	shared := make([][]byte, sharedIntegersCount-sharedIntegerRepliesMin)
+	for i := range shared {
+		frame := appendInteger(nil, int64(i+sharedIntegerRepliesMin))
+		shared[i] = frame[:len(frame):len(frame)]
+	}
+	return shared
+}()
+
+/*
+respWriteInteger writes an integer as RESP format
+
+Integers are prefixed with : and followed by \r\n
+Example: 42 becomes :42\r\n
+
+Small integers come from sharedIntegerReplies; others are rendered on
+the stack and copied into the one exactly sized slice returned.
+*/
+func respWriteInteger(num int64) []byte {
+	if num >= sharedIntegerRepliesMin && num < sharedIntegersCount {
+		return sharedIntegerReplies[num-sharedIntegerRepliesMin]
+	}
+	var frame [24]byte // ':', a sign, 19 digits and \r\n
+	return ownBytes(appendInteger(frame[:0], num))
+}
+
+/*
+appendInteger appends the RESP frame of an integer to buf
+*/
+func appendInteger(buf []byte, num int64) []byte {
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, num, 10)
+	return append(buf, '\r', '\n')
+}
+
+/*
+respWriteIntegerArray writes an array of integers as RESP format
+
+Format: *<count>\r\n followed by each element as an integer.
+Example: [1, 0] becomes *2\r\n:1\r\n:0\r\n
+*/
+func respWriteIntegerArray(nums []int64) []byte {
+	buf := getRespBuffer()
+	buf.WriteString("*" + strconv.Itoa(len(nums)) + "\r\n")
+	for _, num := range nums {
+		buf.Write(appendInteger(buf.AvailableBuffer(), num))
+	}
+	return releaseRespBuffer(buf)
+}
+
+/*
+respWriteSimpleString writes a simple string as RESP format
+
+Simple strings are prefixed with + and followed by \r\n
+Example: "OK" becomes +OK\r\n
+*/
+func respWriteSimpleString(str string) []byte {
+	buf := getRespBuffer()
+	buf.WriteString("+" + str + "\r\n")
+	return releaseRespBuffer(buf)
+}
+
+/*
+respWriteHelp writes HELP output as RESP format
+
+Redis sends help text as an array of simple strings, one per line.
+*/
+func respWriteHelp(lines []string) []byte {
+	return respWriteSimpleStrings(lines)
+}
+
+/*
+respWriteSimpleStrings writes an array of simple strings as RESP format
+
+Example: ["a", "b"] becomes *2\r\n+a\r\n+b\r\n
+*/
+func respWriteSimpleStrings(strs []string) []byte {
+	buf := getRespBuffer()
+	buf.WriteString("*" + strconv.Itoa(len(strs)) + "\r\n")
+	for _, str := range strs {
+		buf.WriteString("+" + str + "\r\n")
+	}
+	return releaseRespBuffer(buf)
 }
 
 /*
 respWriteError writes an error as RESP format
 
 Errors are prefixed with - and followed by \r\n
-Example: "key not found" becomes -key not found\r\n
+Example: "ERR syntax error" becomes -ERR syntax error\r\n
 */
 func respWriteError(err string) []byte {
-	buf := &bytes.Buffer{}
+	buf := getRespBuffer()
 	buf.WriteString("-" + err + "\r\n")
-	return buf.Bytes()
+	return releaseRespBuffer(buf)
 }
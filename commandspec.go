@@ -0,0 +1,430 @@
+package goredis
+
+import "strings"
+
+/*
+Command Specifications for Redis Clone
+
+This file declares the shape of every built-in command in one table: its
+arity, the positions of its keys and, for container commands (OBJECT,
+DEBUG, ...), its subcommands with their arity and help text. The parser
+checks every command against the table before the command's own parser
+runs, so argument count errors are consistent everywhere, the HELP
+subcommand of every container command is generated from it, and COMMAND
+GETKEYS finds the keys of a command with it.
+
+Key concepts:
+- Arity: Like in Redis' command table, the count includes the command
+  name; a positive arity is exact, a negative one is a minimum
+- Subcommands: Their arity counts the command and the subcommand, and a
+  mismatch reports "command|subcommand", like Redis
+- What's Left to Parsers: Shapes an arity can't express, such as an upper
+  bound on optional arguments or field/value pairs, are still checked by
+  each parser
+- HELP: Every container command accepts HELP, which lists its
+  subcommands in declaration order followed by HELP itself
+- Key Positions: First, last and step, like Redis' legacy key
+  specification and CommandSpec for custom commands; the keys of container
+  commands are given per subcommand, and IMPORT, whose keys move with the
+  element counts, is marked movable and parsed to find them
+*/
+
+/*
+commandSpec describes the arguments of a command
+*/
+type commandSpec struct {
+	arity       int              // argument count including the name, negative for a minimum
+	keys        keySpec          // where the keys are, if the command takes any
+	subcommands []subcommandSpec // for container commands, in HELP order
+}
+
+/*
+subcommandSpec describes a subcommand of a container command
+*/
+type subcommandSpec struct {
+	name  string   // upper-case subcommand name
+	arity int      // argument count including command and subcommand, negative for a minimum
+	keys  keySpec  // where the keys are, counting the command as position 0
+	usage string   // first HELP line, e.g. "ENCODING <key>"
+	help  []string // description lines, indented in HELP output
+}
+
+/*
+keySpec locates the keys among a command's arguments, the name being position 0
+*/
+type keySpec struct {
+	first   int  // position of the first key, 0 if there are none
+	last    int  // position of the last key; negative counts from the end (-1 is the last argument)
+	step    int  // distance between keys, e.g. 2 for key/value pairs
+	movable bool // the keys can't be found by position; the parsed command lists them
+}
+
+var (
+	oneKey        = keySpec{first: 1, last: 1, step: 1}  // the first argument is the key
+	allKeys       = keySpec{first: 1, last: -1, step: 1} // every argument is a key
+	pairKeys      = keySpec{first: 1, last: -1, step: 2} // key/value pairs
+	subcommandKey = keySpec{first: 2, last: 2, step: 1}  // the argument after the subcommand is the key
+	keysThenLast  = keySpec{first: 1, last: -2, step: 1} // every argument but the last, a timeout
+)
+
+/*
+extract returns the arguments of args at the key positions
+
+Positions past the end of args are ignored, so a command with optional
+keys (SUNSUBSCRIBE) may have none.
+*/
+func (k keySpec) extract(args [][]byte) [][]byte {
+	if k.first == 0 || k.first >= len(args) {
+		return nil
+	}
+
+	last := k.last
+	if last < 0 {
+		last += len(args)
+	}
+	last = min(last, len(args)-1)
+
+	var keys [][]byte
+	for i := k.first; i <= last; i += k.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+/*
+helpSubcommand is the HELP subcommand every container command supports
+*/
+var helpSubcommand = subcommandSpec{name: "HELP", arity: 2, usage: "HELP", help: []string{"Print this help."}}
+
+/*
+commandSpecs is the table of built-in commands
+*/
+var commandSpecs = map[string]commandSpec{
+	CommandSET:    {arity: -3, keys: oneKey},
+	CommandGET:    {arity: 2, keys: oneKey},
+	CommandDEL:    {arity: -2, keys: allKeys},
+	CommandEXISTS: {arity: -2, keys: allKeys},
+
+	CommandAPPEND:   {arity: 3, keys: oneKey},
+	CommandSTRLEN:   {arity: 2, keys: oneKey},
+	CommandGETRANGE: {arity: 4, keys: oneKey},
+	CommandSETRANGE: {arity: 4, keys: oneKey},
+
+	CommandINCR:   {arity: 2, keys: oneKey},
+	CommandDECR:   {arity: 2, keys: oneKey},
+	CommandINCRBY: {arity: 3, keys: oneKey},
+	CommandDECRBY: {arity: 3, keys: oneKey},
+
+	CommandMGET: {arity: -2, keys: allKeys},
+	CommandMSET: {arity: -3, keys: pairKeys},
+
+	CommandLPUSH:   {arity: -3, keys: oneKey},
+	CommandRPUSH:   {arity: -3, keys: oneKey},
+	CommandLPOP:    {arity: -2, keys: oneKey},
+	CommandRPOP:    {arity: -2, keys: oneKey},
+	CommandBLPOP:   {arity: -3, keys: keysThenLast},
+	CommandBRPOP:   {arity: -3, keys: keysThenLast},
+	CommandLLEN:    {arity: 2, keys: oneKey},
+	CommandLRANGE:  {arity: 4, keys: oneKey},
+	CommandLINDEX:  {arity: 3, keys: oneKey},
+	CommandLINSERT: {arity: 5, keys: oneKey},
+	CommandLSET:    {arity: 4, keys: oneKey},
+	CommandLREM:    {arity: 4, keys: oneKey},
+	CommandLTRIM:   {arity: 4, keys: oneKey},
+
+	CommandSADD:        {arity: -3, keys: oneKey},
+	CommandSREM:        {arity: -3, keys: oneKey},
+	CommandSMEMBERS:    {arity: 2, keys: oneKey},
+	CommandSISMEMBER:   {arity: 3, keys: oneKey},
+	CommandSMISMEMBER:  {arity: -3, keys: oneKey},
+	CommandSCARD:       {arity: 2, keys: oneKey},
+	CommandSMOVE:       {arity: 4, keys: keySpec{first: 1, last: 2, step: 1}},
+	CommandSPOP:        {arity: -2, keys: oneKey},
+	CommandSRANDMEMBER: {arity: -2, keys: oneKey},
+	CommandSINTER:      {arity: -2, keys: allKeys},
+	CommandSUNION:      {arity: -2, keys: allKeys},
+	CommandSDIFF:       {arity: -2, keys: allKeys},
+	CommandSINTERSTORE: {arity: -3, keys: allKeys},
+	CommandSUNIONSTORE: {arity: -3, keys: allKeys},
+	CommandSDIFFSTORE:  {arity: -3, keys: allKeys},
+
+	CommandHSET:    {arity: -4, keys: oneKey},
+	CommandHSETNX:  {arity: 4, keys: oneKey},
+	CommandHGET:    {arity: 3, keys: oneKey},
+	CommandHMGET:   {arity: -3, keys: oneKey},
+	CommandHDEL:    {arity: -3, keys: oneKey},
+	CommandHGETALL: {arity: 2, keys: oneKey},
+	CommandHLEN:    {arity: 2, keys: oneKey},
+	CommandHEXISTS: {arity: 3, keys: oneKey},
+	CommandHINCRBY: {arity: 4, keys: oneKey},
+
+	CommandHEXPIRE:  {arity: -6, keys: oneKey},
+	CommandHPEXPIRE: {arity: -6, keys: oneKey},
+	CommandHTTL:     {arity: -5, keys: oneKey},
+	CommandHPTTL:    {arity: -5, keys: oneKey},
+	CommandHPERSIST: {arity: -5, keys: oneKey},
+
+	CommandZADD:          {arity: -4, keys: oneKey},
+	CommandZINCRBY:       {arity: 4, keys: oneKey},
+	CommandZSCORE:        {arity: 3, keys: oneKey},
+	CommandZREM:          {arity: -3, keys: oneKey},
+	CommandZRANGE:        {arity: -4, keys: oneKey},
+	CommandZRANGEBYSCORE: {arity: -4, keys: oneKey},
+	CommandZRANGEBYLEX:   {arity: -4, keys: oneKey},
+	CommandZRANDMEMBER:   {arity: -2, keys: oneKey},
+	CommandZCARD:         {arity: 2, keys: oneKey},
+	CommandZCOUNT:        {arity: 4, keys: oneKey},
+	CommandZLEXCOUNT:     {arity: 4, keys: oneKey},
+
+	CommandSUBSCRIBE:    {arity: -2},
+	CommandUNSUBSCRIBE:  {arity: -1},
+	CommandPSUBSCRIBE:   {arity: -2},
+	CommandPUNSUBSCRIBE: {arity: -1},
+	CommandPUBLISH:      {arity: 3},
+	CommandSSUBSCRIBE:   {arity: -2, keys: allKeys},
+	CommandSUNSUBSCRIBE: {arity: -1, keys: allKeys},
+	CommandSPUBLISH:     {arity: 3, keys: oneKey},
+
+	CommandGETSET:      {arity: 3, keys: oneKey},
+	CommandKEYS:        {arity: 2},
+	CommandSCAN:        {arity: -2},
+	CommandFLUSHALL:    {arity: 1},
+	CommandIMPORT:      {arity: -6, keys: keySpec{movable: true}},
+	CommandEXPORT:      {arity: -2},
+	CommandTYPE:        {arity: 2, keys: oneKey},
+	CommandTTL:         {arity: 2, keys: oneKey},
+	CommandPTTL:        {arity: 2, keys: oneKey},
+	CommandEXPIRETIME:  {arity: 2, keys: oneKey},
+	CommandPEXPIRETIME: {arity: 2, keys: oneKey},
+	CommandTTLSTATS:    {arity: 1},
+
+	CommandOBJECT: {arity: -2, subcommands: []subcommandSpec{
+		{name: "ENCODING", arity: 3, keys: subcommandKey, usage: "ENCODING <key>", help: []string{
+			"Return the kind of internal representation used in order to store the value",
+			"associated with a <key>.",
+		}},
+		{name: "IDLETIME", arity: 3, keys: subcommandKey, usage: "IDLETIME <key>", help: []string{
+			"Return the idle time of the <key>, that is the approximated number of",
+			"seconds elapsed since the last access to the key.",
+		}},
+		{name: "REFCOUNT", arity: 3, keys: subcommandKey, usage: "REFCOUNT <key>", help: []string{
+			"Return the number of references of the value associated with the specified",
+			"<key>.",
+		}},
+	}},
+
+	CommandCLUSTER: {arity: -2, subcommands: []subcommandSpec{
+		{name: "KEYSLOT", arity: 3, usage: "KEYSLOT <key>", help: []string{
+			"Return the hash slot for <key>.",
+		}},
+	}},
+
+	CommandDEBUG: {arity: -2, subcommands: []subcommandSpec{
+		{name: "DIAGNOSTICS", arity: 2, usage: "DIAGNOSTICS", help: []string{
+			"Write goroutine stacks, client queues, the storage lock state and memory",
+			"stats to the server log, like sending the process SIGUSR1.",
+		}},
+		{name: "DIGEST", arity: 2, usage: "DIGEST", help: []string{
+			"Output a hex signature representing the current DB content.",
+		}},
+		{name: "DIGEST-VALUE", arity: -2, usage: "DIGEST-VALUE <key> [<key> ...]", help: []string{
+			"Output a hex signature of the values of all the specified keys.",
+		}},
+		{name: "FAULT", arity: -3, usage: "FAULT SET <command> <action> [RATE <percent>]", help: []string{
+			"Inject a fault into calls of <command>, all of them or <percent> of them.",
+			"Actions are:",
+			"* DELAY <ms>: hold the command back for <ms> milliseconds (at most 60000),",
+			"  then run it. Only the faulted client waits.",
+			"* DROP: neither run the command nor reply, like a lost request.",
+			"* ERROR <message>: reply with the error <message> instead of running it.",
+			"* PARTIAL: run the command, send half of the reply and close the connection.",
+			"FAULT CLEAR [<command>] removes the fault of <command>, or every fault, and",
+			"FAULT LIST lists them.",
+		}},
+		{name: "OBJECT", arity: 3, usage: "OBJECT <key>", help: []string{
+			"Show low level info about the `key` and associated value.",
+		}},
+		{name: "SET-ACTIVE-EXPIRE", arity: 3, usage: "SET-ACTIVE-EXPIRE <0|1>", help: []string{
+			"Setting it to 0 disables expiring keys in background when they are not",
+			"accessed (otherwise the Redis behavior). Setting it to 1 reenables back the",
+			"default.",
+		}},
+		{name: "SLEEP", arity: 3, usage: "SLEEP <seconds>", help: []string{
+			"Stop the server for <seconds>. Decimals allowed.",
+		}},
+		{name: "TRACE", arity: 3, usage: "TRACE <pattern|OFF>", help: []string{
+			"Log every byte read from and written to clients whose address or name",
+			"matches the glob-style <pattern>, e.g. * or 127.0.0.1:*. OFF stops tracing.",
+		}},
+		{name: "STRINGMATCH-LEN", arity: 2, usage: "STRINGMATCH-LEN", help: []string{
+			"Run a fuzz tester against the stringmatchlen() function.",
+		}},
+	}},
+
+	CommandINFO: {arity: -1},
+	CommandCOMMAND: {arity: -2, subcommands: []subcommandSpec{
+		{name: "GETKEYS", arity: -3, usage: "GETKEYS <full-command>", help: []string{
+			"Return the keys from a full Redis command.",
+		}},
+	}},
+	CommandMEMORY: {arity: -2, subcommands: []subcommandSpec{
+		{name: "PURGE", arity: 2, usage: "PURGE", help: []string{
+			"Attempt to purge dirty pages for reclamation by the allocator.",
+		}},
+		{name: "STATS", arity: 2, usage: "STATS", help: []string{
+			"Return information about the memory usage of the server.",
+		}},
+		{name: "USAGE", arity: -3, keys: subcommandKey, usage: "USAGE <key> [SAMPLES <count>]", help: []string{
+			"Return memory in bytes used by <key> and its value. Nested values are",
+			"sampled up to <count> times (default: 5, 0 means sample all).",
+		}},
+	}},
+
+	CommandHELLO: {arity: -1},
+	CommandCLIENT: {arity: -2, subcommands: []subcommandSpec{
+		{name: "GETNAME", arity: 2, usage: "GETNAME", help: []string{
+			"Return the name of the current connection.",
+		}},
+		{name: "SETINFO", arity: 4, usage: "SETINFO <option> <value>", help: []string{
+			"Set client meta attr. Options are:",
+			"* LIB-NAME: the client lib name.",
+			"* LIB-VER: the client lib version.",
+		}},
+		{name: "SETNAME", arity: 3, usage: "SETNAME <name>", help: []string{
+			"Assign the name <name> to the current connection.",
+		}},
+	}},
+	CommandPING:  {arity: -1},
+	CommandQUIT:  {arity: -1},
+	CommandRESET: {arity: 1},
+}
+
+/*
+commandKeySpec returns the key positions of a command invocation, the
+name being args[0]
+
+Custom commands are looked up in the registry when the table doesn't know
+the name. Unlike checkArity, mismatches are reported the way COMMAND
+GETKEYS reports them.
+
+Returns: errInvalidCommand for unknown commands or subcommands, or
+errInvalidCommandArgs if the argument count doesn't match
+*/
+func commandKeySpec(args [][]byte) (keySpec, error) {
+	name := strings.ToUpper(string(args[0]))
+	spec, ok := commandSpecs[name]
+	if !ok {
+		custom := customCommands[name]
+		if custom == nil {
+			return keySpec{}, errInvalidCommand
+		}
+		if !arityMatches(custom.Arity, len(args)) {
+			return keySpec{}, errInvalidCommandArgs
+		}
+		return custom.keySpec(), nil
+	}
+
+	if !arityMatches(spec.arity, len(args)) {
+		return keySpec{}, errInvalidCommandArgs
+	}
+	if spec.subcommands == nil {
+		return spec.keys, nil
+	}
+	sub, ok := spec.subcommand(strings.ToUpper(string(args[1])))
+	if !ok {
+		return keySpec{}, errInvalidCommand
+	}
+	if !arityMatches(sub.arity, len(args)) {
+		return keySpec{}, errInvalidCommandArgs
+	}
+	return sub.keys, nil
+}
+
+/*
+arityMatches reports whether argc arguments satisfy a Redis-style arity
+*/
+func arityMatches(arity, argc int) bool {
+	if arity < 0 {
+		return argc >= -arity
+	}
+	return argc == arity
+}
+
+/*
+checkArity validates a command's argument count, and its subcommand, against the table
+
+Commands missing from the table (custom commands, unknown names) pass
+unchecked; they're handled further on.
+
+Returns: errWrongNumberOfArgs for a bad argument count, or
+errUnknownSubcommand for a subcommand the command doesn't have
+*/
+func checkArity(name string, arr [][]byte) error {
+	spec, ok := commandSpecs[name]
+	if !ok {
+		return nil
+	}
+	if !arityMatches(spec.arity, len(arr)) {
+		return errWrongNumberOfArgs(name)
+	}
+	if spec.subcommands == nil {
+		return nil
+	}
+
+	sub, ok := spec.subcommand(strings.ToUpper(string(arr[1])))
+	if !ok {
+		return errUnknownSubcommand(name, string(arr[1]))
+	}
+	if !arityMatches(sub.arity, len(arr)) {
+		return errWrongNumberOfArgs(name + "|" + sub.name)
+	}
+	return nil
+}
+
+/*
+subcommand looks up a subcommand by upper-case name, HELP included
+*/
+func (spec commandSpec) subcommand(name string) (subcommandSpec, bool) {
+	if name == helpSubcommand.name {
+		return helpSubcommand, true
+	}
+	for _, sub := range spec.subcommands {
+		if sub.name == name {
+			return sub, true
+		}
+	}
+	return subcommandSpec{}, false
+}
+
+/*
+isHelpRequest reports whether arr asks a container command for its HELP
+*/
+func isHelpRequest(name string, arr [][]byte) bool {
+	return commandSpecs[name].subcommands != nil && len(arr) == 2 &&
+		strings.EqualFold(string(arr[1]), helpSubcommand.name)
+}
+
+/*
+HelpCommand represents the HELP subcommand of a container command
+
+The text is generated from the command's table entry, in the layout Redis
+uses: a header line, then each subcommand's usage followed by its
+description indented by four spaces.
+
+Redis syntax: <command> HELP
+Example: OBJECT HELP
+*/
+type HelpCommand struct {
+	command string
+}
+
+func (c HelpCommand) Execute(storage *Storage) ([]byte, error) {
+	lines := []string{c.command + " <subcommand> [<arg> [value] [opt] ...]. Subcommands are:"}
+	for _, sub := range append(commandSpecs[c.command].subcommands, helpSubcommand) {
+		lines = append(lines, sub.usage)
+		for _, line := range sub.help {
+			lines = append(lines, "    "+line)
+		}
+	}
+	return respWriteHelp(lines), nil
+}
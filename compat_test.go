@@ -0,0 +1,408 @@
+package goredis_test
+
+import (
+	"strings"
+	"testing"
+)
+
+/*
+Redis Compatibility Tests for Redis Clone
+
+TestCompat starts the server on a random free port, drives it over a
+plain TCP connection and compares every reply byte-for-byte with what a
+real Redis server answers for the same command.
+
+Key concepts:
+- Golden Replies: Each case stores the exact RESP bytes real Redis returns
+- Ordered Cases: Cases run in sequence on one connection, so later cases
+  can depend on keys written by earlier ones
+- Full Coverage: Every supported command is exercised, including error
+  messages and nil replies, since client libraries depend on both
+
+Example:
+  go test -run TestCompat -v .
+*/
+
+/*
+compatCase is a single command together with the reply real Redis gives
+*/
+type compatCase struct {
+	args     []string
+	expected string
+}
+
+/*
+compatCases is the golden table of commands and their Redis replies
+
+The table is grouped the same way as the command constants in the server.
+Replies were captured from a Redis 7 server started with default settings,
+so the table only holds commands Redis has, with the replies it gives.
+Commands specific to goredis, and replies that differ on purpose, are
+checked by TestExtensions (see extensions_test.go) instead.
+*/
+var compatCases = []compatCase{
+	// Connection commands
+	{[]string{"FLUSHALL"}, "+OK\r\n"},
+	{[]string{"PING"}, "+PONG\r\n"},
+	{[]string{"PING", "hello"}, "$5\r\nhello\r\n"},
+	{[]string{"PING", "a", "b"}, "-ERR wrong number of arguments for 'ping' command\r\n"},
+	{[]string{"HELLO", "4"}, "-NOPROTO unsupported protocol version\r\n"},
+	{[]string{"HELLO", "two"}, "-ERR Protocol version is not an integer or out of range\r\n"},
+
+	// Basic string commands
+	{[]string{"SET", "name", "John"}, "+OK\r\n"},
+	{[]string{"GET", "name"}, "$4\r\nJohn\r\n"},
+	{[]string{"GET", "missing"}, "$-1\r\n"},
+	{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+
+	// Values that look like RESP are still bulk strings
+	{[]string{"SET", "resp", "+hello"}, "+OK\r\n"},
+	{[]string{"GET", "resp"}, "$6\r\n+hello\r\n"},
+	{[]string{"SET", "resp", "-ERR not an error"}, "+OK\r\n"},
+	{[]string{"GET", "resp"}, "$17\r\n-ERR not an error\r\n"},
+	{[]string{"SET", "resp", ":42"}, "+OK\r\n"},
+	{[]string{"GET", "resp"}, "$3\r\n:42\r\n"},
+	{[]string{"SET", "resp", "$3\r\nabc"}, "+OK\r\n"},
+	{[]string{"GET", "resp"}, "$7\r\n$3\r\nabc\r\n"},
+	{[]string{"SET", "resp", "*0"}, "+OK\r\n"},
+	{[]string{"GETSET", "resp", ">1"}, "$2\r\n*0\r\n"},
+	{[]string{"GET", "resp"}, "$2\r\n>1\r\n"},
+	{[]string{"GETRANGE", "resp", "0", "0"}, "$1\r\n>\r\n"},
+	{[]string{"SET", "resp", "%1"}, "+OK\r\n"},
+	{[]string{"GET", "resp"}, "$2\r\n%1\r\n"},
+	{[]string{"SET", "binary", "\x00\xff\r\n-\x80"}, "+OK\r\n"},
+	{[]string{"GET", "binary"}, "$6\r\n\x00\xff\r\n-\x80\r\n"},
+	{[]string{"PING", "-pong"}, "$5\r\n-pong\r\n"},
+	{[]string{"DEL", "resp", "binary"}, ":2\r\n"},
+	{[]string{"SET", "name"}, "-ERR wrong number of arguments for 'set' command\r\n"},
+	{[]string{"SET", "temp", "data", "EX", "300"}, "+OK\r\n"},
+	{[]string{"SET", "temp", "data", "EX", "soon"}, "-ERR value is not an integer or out of range\r\n"},
+	{[]string{"SET", "temp", "data", "EX", "-1"}, "-ERR invalid expire time in 'set' command\r\n"},
+	{[]string{"SET", "temp", "data", "BOGUS"}, "-ERR syntax error\r\n"},
+	{[]string{"EXISTS", "name", "temp", "missing"}, ":2\r\n"},
+	{[]string{"EXISTS", "name", "name"}, ":2\r\n"},
+	{[]string{"DEL", "temp", "missing"}, ":1\r\n"},
+	{[]string{"EXISTS", "temp"}, ":0\r\n"},
+	{[]string{"TTL", "temp"}, ":-2\r\n"},
+	{[]string{"PTTL", "name"}, ":-1\r\n"},
+	{[]string{"TTL", "name", "extra"}, "-ERR wrong number of arguments for 'ttl' command\r\n"},
+	{[]string{"EXPIRETIME", "temp"}, ":-2\r\n"},
+	{[]string{"PEXPIRETIME", "name"}, ":-1\r\n"},
+	{[]string{"DEBUG", "DIGEST-VALUE", "missing"}, "*1\r\n+0000000000000000000000000000000000000000\r\n"},
+
+	// String manipulation commands
+	{[]string{"SET", "greeting", "Hello"}, "+OK\r\n"},
+	{[]string{"APPEND", "greeting", " World"}, ":11\r\n"},
+	{[]string{"APPEND", "fresh", "abc"}, ":3\r\n"},
+	{[]string{"STRLEN", "greeting"}, ":11\r\n"},
+	{[]string{"STRLEN", "missing"}, ":0\r\n"},
+	{[]string{"GETRANGE", "greeting", "0", "4"}, "$5\r\nHello\r\n"},
+	{[]string{"GETRANGE", "greeting", "-5", "-1"}, "$5\r\nWorld\r\n"},
+	{[]string{"GETRANGE", "greeting", "20", "30"}, "$0\r\n\r\n"},
+	{[]string{"GETRANGE", "missing", "0", "-1"}, "$0\r\n\r\n"},
+	{[]string{"GETRANGE", "greeting", "a", "b"}, "-ERR value is not an integer or out of range\r\n"},
+	{[]string{"SETRANGE", "greeting", "6", "Redis"}, ":11\r\n"},
+	{[]string{"GET", "greeting"}, "$11\r\nHello Redis\r\n"},
+	{[]string{"SETRANGE", "padded", "3", "x"}, ":4\r\n"},
+	{[]string{"GET", "padded"}, "$4\r\n\x00\x00\x00x\r\n"},
+	{[]string{"SETRANGE", "padded", "-1", "x"}, "-ERR offset is out of range\r\n"},
+
+	// Numeric commands
+	{[]string{"INCR", "counter"}, ":1\r\n"},
+	{[]string{"INCR", "counter"}, ":2\r\n"},
+	{[]string{"DECR", "counter"}, ":1\r\n"},
+	{[]string{"INCRBY", "counter", "10"}, ":11\r\n"},
+	{[]string{"DECRBY", "counter", "5"}, ":6\r\n"},
+	{[]string{"GET", "counter"}, "$1\r\n6\r\n"},
+	{[]string{"INCRBY", "counter", "ten"}, "-ERR value is not an integer or out of range\r\n"},
+	{[]string{"INCR", "name"}, "-ERR value is not an integer or out of range\r\n"},
+	{[]string{"SET", "big", "9223372036854775807"}, "+OK\r\n"},
+	{[]string{"INCR", "big"}, "-ERR increment or decrement would overflow\r\n"},
+
+	// Multiple key commands
+	{[]string{"MSET", "a", "1", "b", "2"}, "+OK\r\n"},
+	{[]string{"MGET", "a", "b", "missing"}, "*3\r\n$1\r\n1\r\n$1\r\n2\r\n$-1\r\n"},
+	{[]string{"MSET", "a"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+	{[]string{"MSET", "a", "1", "b"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+
+	// List commands
+	{[]string{"RPUSH", "list", "a", "b", "c"}, ":3\r\n"},
+	{[]string{"LPUSH", "list", "y", "z"}, ":5\r\n"},
+	{[]string{"LRANGE", "list", "0", "-1"}, "*5\r\n$1\r\nz\r\n$1\r\ny\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+	{[]string{"LLEN", "list"}, ":5\r\n"},
+	{[]string{"LINDEX", "list", "-1"}, "$1\r\nc\r\n"},
+	{[]string{"LINDEX", "list", "99"}, "$-1\r\n"},
+	{[]string{"LINSERT", "list", "BEFORE", "b", "x"}, ":6\r\n"},
+	{[]string{"LINSERT", "list", "AFTER", "nope", "x"}, ":-1\r\n"},
+	{[]string{"LINSERT", "missing", "AFTER", "a", "x"}, ":0\r\n"},
+	{[]string{"LINSERT", "list", "MIDDLE", "b", "x"}, "-ERR syntax error\r\n"},
+	{[]string{"LSET", "list", "0", "first"}, "+OK\r\n"},
+	{[]string{"LSET", "list", "99", "v"}, "-ERR index out of range\r\n"},
+	{[]string{"LSET", "missing", "0", "v"}, "-ERR no such key\r\n"},
+	{[]string{"RPUSH", "list", "x"}, ":7\r\n"},
+	{[]string{"LREM", "list", "-1", "x"}, ":1\r\n"},
+	{[]string{"LREM", "list", "0", "x"}, ":1\r\n"},
+	{[]string{"LTRIM", "list", "1", "-2"}, "+OK\r\n"},
+	{[]string{"LRANGE", "list", "0", "-1"}, "*3\r\n$1\r\ny\r\n$1\r\na\r\n$1\r\nb\r\n"},
+	{[]string{"LPOP", "list"}, "$1\r\ny\r\n"},
+	{[]string{"RPOP", "list", "5"}, "*2\r\n$1\r\nb\r\n$1\r\na\r\n"},
+	{[]string{"EXISTS", "list"}, ":0\r\n"},
+	{[]string{"LPOP", "list"}, "$-1\r\n"},
+	{[]string{"LPOP", "list", "2"}, "*-1\r\n"},
+	{[]string{"LPOP", "list", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+	{[]string{"LRANGE", "missing", "0", "-1"}, "*0\r\n"},
+	{[]string{"LPUSH", "greeting", "x"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"LPUSH", "list"}, "-ERR wrong number of arguments for 'lpush' command\r\n"},
+	{[]string{"RPUSH", "list", "v"}, ":1\r\n"},
+	{[]string{"TYPE", "list"}, "+list\r\n"},
+	{[]string{"GET", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"BRPOP", "missing", "list", "1"}, "*2\r\n$4\r\nlist\r\n$1\r\nv\r\n"},
+	{[]string{"BLPOP", "list", "0.01"}, "*-1\r\n"},
+	{[]string{"BLPOP", "greeting", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"BLPOP", "list", "-1"}, "-ERR timeout is negative\r\n"},
+	{[]string{"BLPOP", "list", "soon"}, "-ERR timeout is not a float or out of range\r\n"},
+	{[]string{"BRPOP", "list"}, "-ERR wrong number of arguments for 'brpop' command\r\n"},
+
+	// Set commands (replies are only compared where Redis' order or choice is fixed)
+	{[]string{"SADD", "set", "a", "b", "c", "a"}, ":3\r\n"},
+	{[]string{"SADD", "set", "c", "d"}, ":1\r\n"},
+	{[]string{"SCARD", "set"}, ":4\r\n"},
+	{[]string{"SISMEMBER", "set", "a"}, ":1\r\n"},
+	{[]string{"SISMEMBER", "set", "z"}, ":0\r\n"},
+	{[]string{"SMISMEMBER", "set", "a", "z", "d"}, "*3\r\n:1\r\n:0\r\n:1\r\n"},
+	{[]string{"SMISMEMBER", "missing", "a"}, "*1\r\n:0\r\n"},
+	{[]string{"SMISMEMBER", "set"}, "-ERR wrong number of arguments for 'smismember' command\r\n"},
+	{[]string{"SREM", "set", "a", "b", "z"}, ":2\r\n"},
+	{[]string{"SREM", "set", "c"}, ":1\r\n"},
+	{[]string{"SMEMBERS", "set"}, "*1\r\n$1\r\nd\r\n"},
+	{[]string{"SRANDMEMBER", "set"}, "$1\r\nd\r\n"},
+	{[]string{"SRANDMEMBER", "set", "5"}, "*1\r\n$1\r\nd\r\n"},
+	{[]string{"SRANDMEMBER", "set", "-3"}, "*3\r\n$1\r\nd\r\n$1\r\nd\r\n$1\r\nd\r\n"},
+	{[]string{"SRANDMEMBER", "set", "0"}, "*0\r\n"},
+	{[]string{"SRANDMEMBER", "missing"}, "$-1\r\n"},
+	{[]string{"SRANDMEMBER", "missing", "3"}, "*0\r\n"},
+	{[]string{"SPOP", "set", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+	{[]string{"SPOP", "set"}, "$1\r\nd\r\n"},
+	{[]string{"EXISTS", "set"}, ":0\r\n"},
+	{[]string{"SPOP", "set"}, "$-1\r\n"},
+	{[]string{"SPOP", "set", "2"}, "*0\r\n"},
+	{[]string{"SADD", "set", "1", "2"}, ":2\r\n"},
+	{[]string{"TYPE", "set"}, "+set\r\n"},
+	{[]string{"SADD", "greeting", "x"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"SCARD"}, "-ERR wrong number of arguments for 'scard' command\r\n"},
+	{[]string{"SADD", "s1", "a", "b", "c"}, ":3\r\n"},
+	{[]string{"SADD", "s2", "b", "c", "d"}, ":3\r\n"},
+	{[]string{"SINTERSTORE", "inter", "s1", "s2"}, ":2\r\n"},
+	{[]string{"SUNIONSTORE", "union", "s1", "s2"}, ":4\r\n"},
+	{[]string{"SDIFF", "s1", "s2"}, "*1\r\n$1\r\na\r\n"},
+	{[]string{"SDIFFSTORE", "s1", "s1", "s2"}, ":1\r\n"},
+	{[]string{"SMEMBERS", "s1"}, "*1\r\n$1\r\na\r\n"},
+	{[]string{"SINTER", "s2", "missing"}, "*0\r\n"},
+	{[]string{"SMOVE", "s1", "moved", "a"}, ":1\r\n"},
+	{[]string{"SMOVE", "s1", "moved", "a"}, ":0\r\n"},
+	{[]string{"EXISTS", "s1"}, ":0\r\n"},
+	{[]string{"SMEMBERS", "moved"}, "*1\r\n$1\r\na\r\n"},
+	{[]string{"SMOVE", "moved", "greeting", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"SMOVE", "moved", "moved", "a"}, ":1\r\n"},
+	{[]string{"SINTERSTORE", "inter", "s2", "missing"}, ":0\r\n"},
+	{[]string{"EXISTS", "inter"}, ":0\r\n"},
+	{[]string{"SUNION", "s1", "greeting"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"SDIFFSTORE", "out"}, "-ERR wrong number of arguments for 'sdiffstore' command\r\n"},
+
+	// Hash commands
+	{[]string{"HSET", "user", "name", "John"}, ":1\r\n"},
+	{[]string{"HSET", "user", "name", "Jane"}, ":0\r\n"},
+	{[]string{"HGET", "user", "name"}, "$4\r\nJane\r\n"},
+	{[]string{"HGET", "user", "age"}, "$-1\r\n"},
+	{[]string{"HGETALL", "user"}, "*2\r\n$4\r\nname\r\n$4\r\nJane\r\n"},
+	{[]string{"HINCRBY", "user", "visits", "5"}, ":5\r\n"},
+	{[]string{"HINCRBY", "user", "visits", "-7"}, ":-2\r\n"},
+	{[]string{"HINCRBY", "user", "name", "1"}, "-ERR hash value is not an integer\r\n"},
+	{[]string{"HINCRBY", "user", "visits", "x"}, "-ERR value is not an integer or out of range\r\n"},
+	{[]string{"HSET", "user", "big", "9223372036854775807"}, ":1\r\n"},
+	{[]string{"HINCRBY", "user", "big", "1"}, "-ERR increment or decrement would overflow\r\n"},
+	{[]string{"HLEN", "user"}, ":3\r\n"},
+	{[]string{"HEXISTS", "user", "visits"}, ":1\r\n"},
+	{[]string{"HDEL", "user", "visits"}, ":1\r\n"},
+	{[]string{"HEXISTS", "user", "visits"}, ":0\r\n"},
+	{[]string{"TYPE", "user"}, "+hash\r\n"},
+	{[]string{"HGETALL", "missing"}, "*0\r\n"},
+	{[]string{"HSET", "user", "a", "1", "b", "2", "name", "Joe"}, ":2\r\n"},
+	{[]string{"HSET", "user", "a", "1", "b"}, "-ERR wrong number of arguments for 'hset' command\r\n"},
+	{[]string{"HSETNX", "user", "a", "9"}, ":0\r\n"},
+	{[]string{"HSETNX", "user", "c", "3"}, ":1\r\n"},
+	{[]string{"HMGET", "user", "a", "nope", "c"}, "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n3\r\n"},
+
+	// Hash field TTLs
+	{[]string{"HSET", "fttl", "a", "1", "b", "2", "c", "3"}, ":3\r\n"},
+	{[]string{"HEXPIRE", "fttl", "100", "FIELDS", "2", "a", "nope"}, "*2\r\n:1\r\n:-2\r\n"},
+	{[]string{"HEXPIRE", "fttl", "100", "NX", "FIELDS", "1", "a"}, "*1\r\n:0\r\n"},
+	{[]string{"HEXPIRE", "fttl", "200", "GT", "FIELDS", "2", "a", "b"}, "*2\r\n:1\r\n:0\r\n"},
+	{[]string{"HTTL", "fttl", "FIELDS", "3", "a", "b", "nope"}, "*3\r\n:200\r\n:-1\r\n:-2\r\n"},
+	{[]string{"HPERSIST", "fttl", "FIELDS", "2", "a", "b"}, "*2\r\n:1\r\n:-1\r\n"},
+	{[]string{"HPEXPIRE", "fttl", "0", "FIELDS", "1", "c"}, "*1\r\n:2\r\n"},
+	{[]string{"HLEN", "fttl"}, ":2\r\n"},
+	{[]string{"HPTTL", "missing", "FIELDS", "1", "a"}, "*1\r\n:-2\r\n"},
+	{[]string{"HEXPIRE", "fttl", "-1", "FIELDS", "1", "a"}, "-ERR invalid expire time, must be >= 0\r\n"},
+	{[]string{"HEXPIRE", "fttl", "9223372036854775807", "FIELDS", "1", "a"}, "-ERR invalid expire time in 'hexpire' command\r\n"},
+	{[]string{"HEXPIRE", "fttl", "10", "FOO", "FIELDS", "1", "a"}, "-ERR Mandatory argument FIELDS is missing or not at the right position\r\n"},
+	{[]string{"HEXPIRE", "fttl", "10", "FIELDS", "2", "a"}, "-ERR The `numfields` parameter must match the number of arguments\r\n"},
+	{[]string{"HTTL", "fttl", "FIELDS", "0", "a"}, "-ERR Parameter `numFields` should be greater than 0\r\n"},
+	{[]string{"HPERSIST", "greeting", "FIELDS", "1", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"HMGET", "missing", "a"}, "*1\r\n$-1\r\n"},
+	{[]string{"HDEL", "user", "a", "b", "nope"}, ":2\r\n"},
+	{[]string{"HDEL", "user", "name", "big", "c"}, ":3\r\n"},
+	{[]string{"EXISTS", "user"}, ":0\r\n"},
+	{[]string{"HGET", "greeting", "x"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	{[]string{"HGET", "user"}, "-ERR wrong number of arguments for 'hget' command\r\n"},
+
+	// Sorted set commands
+	{[]string{"ZADD", "board", "10", "alice", "5", "bob", "10", "aaron"}, ":3\r\n"},
+	{[]string{"ZADD", "board", "1.5", "bob"}, ":0\r\n"},
+	{[]string{"ZRANGE", "board", "0", "-1"}, "*3\r\n$3\r\nbob\r\n$5\r\naaron\r\n$5\r\nalice\r\n"},
+	{[]string{"ZRANGE", "board", "0", "0", "WITHSCORES"}, "*2\r\n$3\r\nbob\r\n$3\r\n1.5\r\n"},
+	{[]string{"ZSCORE", "board", "alice"}, "$2\r\n10\r\n"},
+	{[]string{"ZSCORE", "board", "nobody"}, "$-1\r\n"},
+	{[]string{"ZINCRBY", "board", "2.5", "bob"}, "$1\r\n4\r\n"},
+	{[]string{"ZINCRBY", "board", "3", "carol"}, "$1\r\n3\r\n"},
+	{[]string{"ZINCRBY", "board", "inf", "carol"}, "$3\r\ninf\r\n"},
+	{[]string{"ZINCRBY", "board", "-inf", "carol"}, "-ERR resulting score is not a number (NaN)\r\n"},
+	{[]string{"ZINCRBY", "board", "x", "carol"}, "-ERR value is not a valid float\r\n"},
+	{[]string{"ZADD", "board", "nan", "x"}, "-ERR value is not a valid float\r\n"},
+	{[]string{"ZADD", "board", "1", "x", "2"}, "-ERR syntax error\r\n"},
+	{[]string{"ZREM", "board", "carol", "nobody"}, ":1\r\n"},
+	{[]string{"ZADD", "opts", "NX", "1", "a", "2", "b"}, ":2\r\n"},
+	{[]string{"ZADD", "opts", "NX", "5", "a", "3", "c"}, ":1\r\n"},
+	{[]string{"ZADD", "opts", "XX", "CH", "5", "a", "9", "d"}, ":1\r\n"},
+	{[]string{"ZADD", "opts", "GT", "CH", "4", "a", "3", "b", "1", "e"}, ":2\r\n"},
+	{[]string{"ZADD", "opts", "LT", "CH", "1", "a", "1", "a"}, ":1\r\n"},
+	{[]string{"ZADD", "opts", "INCR", "2.5", "a"}, "$3\r\n3.5\r\n"},
+	{[]string{"ZADD", "opts", "NX", "INCR", "1", "a"}, "$-1\r\n"},
+	{[]string{"ZADD", "opts", "XX", "INCR", "1", "nobody"}, "$-1\r\n"},
+	{[]string{"ZRANGE", "opts", "0", "-1", "WITHSCORES"}, "*8\r\n$1\r\ne\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n3\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\na\r\n$3\r\n3.5\r\n"},
+	{[]string{"ZADD", "opts", "NX", "XX", "1", "a"}, "-ERR XX and NX options at the same time are not compatible\r\n"},
+	{[]string{"ZADD", "opts", "GT", "NX", "1", "a"}, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+	{[]string{"ZADD", "opts", "GT", "LT", "1", "a"}, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+	{[]string{"ZADD", "opts", "INCR", "1", "a", "2", "b"}, "-ERR INCR option supports a single increment-element pair\r\n"},
+	{[]string{"ZADD", "opts", "CH", "NX"}, "-ERR syntax error\r\n"},
+	{[]string{"ZADD", "nozset", "XX", "1", "a"}, ":0\r\n"},
+	{[]string{"EXISTS", "nozset"}, ":0\r\n"},
+	{[]string{"ZRANGE", "board", "-2", "-1", "WITHSCORES"}, "*4\r\n$5\r\naaron\r\n$2\r\n10\r\n$5\r\nalice\r\n$2\r\n10\r\n"},
+	{[]string{"TYPE", "board"}, "+zset\r\n"},
+	{[]string{"ZRANGE", "missing", "0", "-1"}, "*0\r\n"},
+	{[]string{"ZADD", "single", "7", "only"}, ":1\r\n"},
+	{[]string{"ZRANDMEMBER", "single"}, "$4\r\nonly\r\n"},
+	{[]string{"ZRANDMEMBER", "single", "5", "WITHSCORES"}, "*2\r\n$4\r\nonly\r\n$1\r\n7\r\n"},
+	{[]string{"ZRANDMEMBER", "single", "-2"}, "*2\r\n$4\r\nonly\r\n$4\r\nonly\r\n"},
+	{[]string{"ZRANDMEMBER", "single", "0"}, "*0\r\n"},
+	{[]string{"ZRANDMEMBER", "missing"}, "$-1\r\n"},
+	{[]string{"ZRANDMEMBER", "missing", "3"}, "*0\r\n"},
+	{[]string{"ZRANDMEMBER", "single", "1", "BOGUS"}, "-ERR syntax error\r\n"},
+	{[]string{"ZRANDMEMBER", "single", "x"}, "-ERR value is not an integer or out of range\r\n"},
+	{[]string{"ZRANGE", "board", "0", "0", "REV"}, "*1\r\n$5\r\nalice\r\n"},
+	{[]string{"ZRANGEBYSCORE", "board", "(4", "+inf", "WITHSCORES"}, "*4\r\n$5\r\naaron\r\n$2\r\n10\r\n$5\r\nalice\r\n$2\r\n10\r\n"},
+	{[]string{"ZRANGEBYSCORE", "board", "-inf", "+inf", "LIMIT", "1", "1"}, "*1\r\n$5\r\naaron\r\n"},
+	{[]string{"ZRANGE", "board", "(10", "-inf", "BYSCORE", "REV"}, "*1\r\n$3\r\nbob\r\n"},
+	{[]string{"ZRANGEBYSCORE", "board", "x", "1"}, "-ERR min or max is not a float\r\n"},
+	{[]string{"ZADD", "words", "0", "a", "0", "b", "0", "c", "0", "d"}, ":4\r\n"},
+	{[]string{"ZRANGEBYLEX", "words", "(a", "[c"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+	{[]string{"ZRANGEBYLEX", "words", "-", "+", "LIMIT", "2", "-1"}, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+	{[]string{"ZRANGE", "words", "+", "(b", "BYLEX", "REV", "LIMIT", "0", "2"}, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n"},
+	{[]string{"ZRANGEBYLEX", "words", "a", "+"}, "-ERR min or max not valid string range item\r\n"},
+	{[]string{"ZCARD", "words"}, ":4\r\n"},
+	{[]string{"ZCARD", "missing"}, ":0\r\n"},
+	{[]string{"ZLEXCOUNT", "words", "-", "+"}, ":4\r\n"},
+	{[]string{"ZLEXCOUNT", "words", "[b", "(d"}, ":2\r\n"},
+	{[]string{"ZLEXCOUNT", "words", "+", "-"}, ":0\r\n"},
+	{[]string{"ZLEXCOUNT", "words", "b", "c"}, "-ERR min or max not valid string range item\r\n"},
+	{[]string{"ZCOUNT", "board", "-inf", "+inf"}, ":3\r\n"},
+	{[]string{"ZCOUNT", "board", "(4", "10"}, ":2\r\n"},
+	{[]string{"ZCOUNT", "board", "(10", "+inf"}, ":0\r\n"},
+	{[]string{"ZCOUNT", "board", "5", "1"}, ":0\r\n"},
+	{[]string{"ZCOUNT", "board", "[1", "2"}, "-ERR min or max is not a float\r\n"},
+	{[]string{"ZCOUNT", "board", "1"}, "-ERR wrong number of arguments for 'zcount' command\r\n"},
+	{[]string{"ZRANGE", "words", "-", "+", "BYLEX", "WITHSCORES"}, "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n"},
+	{[]string{"ZRANGE", "words", "0", "-1", "LIMIT", "0", "1"}, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+	{[]string{"ZRANGEBYSCORE", "board", "0", "1", "REV"}, "-ERR syntax error\r\n"},
+	{[]string{"ZSCORE", "greeting", "x"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+
+	// Pub/sub commands (only single-reply cases; delivery needs a second connection)
+	{[]string{"PUBLISH", "news", "hello"}, ":0\r\n"},
+	{[]string{"SUBSCRIBE"}, "-ERR wrong number of arguments for 'subscribe' command\r\n"},
+	{[]string{"SUBSCRIBE", "news"}, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n"},
+	{[]string{"PSUBSCRIBE", "n[aeiou]ws.*"}, "*3\r\n$10\r\npsubscribe\r\n$12\r\nn[aeiou]ws.*\r\n:2\r\n"},
+	{[]string{"PING"}, "*2\r\n$4\r\npong\r\n$0\r\n\r\n"},
+	{[]string{"GET", "greeting"}, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context\r\n"},
+	{[]string{"UNSUBSCRIBE", "news"}, "*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:1\r\n"},
+	{[]string{"PUNSUBSCRIBE"}, "*3\r\n$12\r\npunsubscribe\r\n$12\r\nn[aeiou]ws.*\r\n:0\r\n"},
+	{[]string{"UNSUBSCRIBE"}, "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n"},
+	{[]string{"SPUBLISH", "orders", "x"}, ":0\r\n"},
+	{[]string{"SSUBSCRIBE", "orders"}, "*3\r\n$10\r\nssubscribe\r\n$6\r\norders\r\n:1\r\n"},
+	{[]string{"SUBSCRIBE", "news"}, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n"},
+	{[]string{"UNSUBSCRIBE"}, "*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:0\r\n"},
+	{[]string{"GET", "greeting"}, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context\r\n"},
+	{[]string{"SUNSUBSCRIBE", "orders"}, "*3\r\n$12\r\nsunsubscribe\r\n$6\r\norders\r\n:0\r\n"},
+	{[]string{"SUNSUBSCRIBE"}, "*3\r\n$12\r\nsunsubscribe\r\n$-1\r\n:0\r\n"},
+	{[]string{"SPUBLISH", "orders"}, "-ERR wrong number of arguments for 'spublish' command\r\n"},
+
+	// Utility commands
+	{[]string{"GETSET", "a", "10"}, "$1\r\n1\r\n"},
+	{[]string{"GETSET", "nothing", "x"}, "$-1\r\n"},
+	{[]string{"GET", "nothing"}, "$1\r\nx\r\n"},
+	{[]string{"KEYS", "gree*"}, "*1\r\n$8\r\ngreeting\r\n"},
+	{[]string{"KEYS", "nomatch*"}, "*0\r\n"},
+	{[]string{"KEYS", "gr?et[h-j]ng"}, "*1\r\n$8\r\ngreeting\r\n"},
+	{[]string{"KEYS", "[^a-f]reeting"}, "*1\r\n$8\r\ngreeting\r\n"},
+	{[]string{"KEYS", "gree\\*"}, "*0\r\n"},
+	{[]string{"TYPE", "greeting"}, "+string\r\n"},
+	{[]string{"TYPE", "missing"}, "+none\r\n"},
+	// Only int is also what Redis reports; the other encodings differ (see TestObjectEncoding)
+	{[]string{"OBJECT", "ENCODING", "counter"}, "$3\r\nint\r\n"},
+	{[]string{"OBJECT", "ENCODING", "missing"}, "$-1\r\n"},
+	{[]string{"OBJECT", "REFCOUNT", "name"}, ":1\r\n"},
+	{[]string{"OBJECT", "ENCODING"}, "-ERR wrong number of arguments for 'object|encoding' command\r\n"},
+	{[]string{"OBJECT", "nope"}, "-ERR unknown subcommand 'nope'. Try OBJECT HELP.\r\n"},
+	{[]string{"OBJECT", "HELP", "extra"}, "-ERR wrong number of arguments for 'object|help' command\r\n"},
+	{[]string{"CLUSTER", "KEYSLOT", "foo"}, "-ERR This instance has cluster support disabled\r\n"},
+	{[]string{"COMMAND", "GETKEYS", "MSET", "a", "1", "b", "2"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+	{[]string{"COMMAND", "GETKEYS", "OBJECT", "ENCODING", "k"}, "*1\r\n$1\r\nk\r\n"},
+	{[]string{"COMMAND", "GETKEYS", "PING"}, "-ERR The command has no key arguments\r\n"},
+	{[]string{"COMMAND", "GETKEYS", "GET"}, "-ERR Invalid number of arguments specified for command\r\n"},
+	{[]string{"COMMAND", "GETKEYS", "nope"}, "-ERR Invalid command specified\r\n"},
+	{[]string{"CLIENT"}, "-ERR wrong number of arguments for 'client' command\r\n"},
+	{[]string{"CLIENT", "nope"}, "-ERR unknown subcommand 'nope'. Try CLIENT HELP.\r\n"},
+	{[]string{"CLIENT", "GETNAME"}, "$-1\r\n"},
+	{[]string{"CLIENT", "SETNAME", "compat"}, "+OK\r\n"},
+	{[]string{"CLIENT", "SETNAME", "two words"}, "-ERR Client names cannot contain spaces, newlines or special characters.\r\n"},
+	{[]string{"RESET"}, "+RESET\r\n"},
+	{[]string{"CLIENT", "GETNAME"}, "$6\r\ncompat\r\n"},
+	{[]string{"INFO", "nosuchsection"}, "$0\r\n\r\n"},
+	{[]string{"MEMORY", "USAGE", "missing"}, "$-1\r\n"},
+	{[]string{"MEMORY", "USAGE", "name", "SAMPLES"}, "-ERR syntax error\r\n"},
+	{[]string{"SCAN", "0", "MATCH", "greeting", "COUNT", "1000"}, "*2\r\n$1\r\n0\r\n*1\r\n$8\r\ngreeting\r\n"},
+	{[]string{"SCAN", "0", "COUNT", "1000", "TYPE", "hash", "MATCH", "gree*"}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+	{[]string{"SCAN", "abc"}, "-ERR invalid cursor\r\n"},
+	{[]string{"SCAN", "0", "COUNT", "0"}, "-ERR syntax error\r\n"},
+	{[]string{"SCAN", "0", "MATCH"}, "-ERR syntax error\r\n"},
+	{[]string{"SCAN", "0", "TYPE", "foo"}, "-ERR unknown type name 'foo'\r\n"},
+	{[]string{"FLUSHALL"}, "+OK\r\n"},
+	{[]string{"EXISTS", "name", "a", "b"}, ":0\r\n"},
+
+	// Protocol errors
+	{[]string{"NOSUCHCOMMAND"}, "-ERR unknown command 'NOSUCHCOMMAND', with args beginning with: \r\n"},
+	{[]string{"nosuchcommand", "x", "y"}, "-ERR unknown command 'nosuchcommand', with args beginning with: 'x' 'y' \r\n"},
+
+	// QUIT closes the connection, so it must stay the last case
+	{[]string{"QUIT"}, "+OK\r\n"},
+}
+
+func TestCompat(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	for _, c := range compatCases {
+		if got := client.do(c.args...); got != c.expected {
+			t.Errorf("%s\n expected %q\n got      %q", strings.Join(c.args, " "), c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package goredis
+
+import (
+	"bytes"
+	"compress/flate"
+	"hash/maphash"
+	"io"
+	"sync"
+)
+
+/*
+Value Compression for Redis Clone
+
+Caches often hold large, text-heavy values (HTML fragments, JSON
+documents) that compress several times over. With -compressThreshold the
+storage compresses string values above that size when they're written,
+and decompresses them on every read, trading CPU for a bigger working set
+in the same memory.
+
+Key concepts:
+- Threshold: Only string values of at least the threshold are considered;
+  0 (the default) turns compression off
+- Worth It: A value is kept compressed only if that saves at least an
+  eighth of its size, so already compressed data (images, archives) is
+  stored as it is
+- Before the Lock: SET, SETEX and MSET compress before taking the write
+  lock, so other connections can read the storage meanwhile (from
+  snapshots or the active expire cycle); commands still run one at a time
+  on the server loop, so a large value delays the commands queued behind it
+- Reads: GET and the other string reads decompress into a fresh buffer;
+  STRLEN knows the size without decompressing
+- Modified in Place: APPEND and SETRANGE store their result uncompressed,
+  since recompressing on every small change would cost more than it saves
+- Visibility: OBJECT ENCODING reports compressed values as "compressed",
+  and MEMORY STATS reports how much the compressed values hold and take, from
+  totals kept up to date as values are written
+*/
+
+/*
+compressedString is a string value stored compressed (see Storage.stringEntry)
+*/
+type compressedString struct {
+	data []byte // the value, compressed with DEFLATE
+	size int    // the length of the value
+}
+
+/*
+Compressors are expensive to create (hundreds of KB of state), so they're
+reused; decompressors are pooled for the same reason.
+*/
+var (
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	}}
+	flateReaders = sync.Pool{New: func() any {
+		return flate.NewReader(bytes.NewReader(nil))
+	}}
+)
+
+/*
+SetCompressThreshold makes string values of at least threshold bytes be
+stored compressed, or turns compression off with 0
+
+Values already stored keep their representation.
+*/
+func (s *Storage) SetCompressThreshold(threshold int) {
+	s.compressThreshold.Store(int64(threshold))
+}
+
+/*
+stringEntry creates an entry for a string value, compressing it when
+compression is on and it's worth it (see newStringEntry otherwise)
+
+Doesn't need the lock, so callers build the entry before taking it.
+*/
+func (s *Storage) stringEntry(val []byte) *entry {
+	threshold := s.compressThreshold.Load()
+	if threshold == 0 || int64(len(val)) < threshold {
+		return newStringEntry(val)
+	}
+	if compressed := compress(val); len(compressed) <= len(val)-len(val)/8 {
+		return newEntry(&compressedString{data: compressed, size: len(val)})
+	}
+	return newStringEntry(val)
+}
+
+/*
+compress returns val compressed with DEFLATE, in an exactly sized slice
+*/
+func compress(val []byte) []byte {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	// Writes to a bytes.Buffer can't fail
+	w.Write(val)
+	w.Close()
+	flateWriters.Put(w)
+	return ownBytes(buf.Bytes())
+}
+
+/*
+bytes decompresses the value into a new slice
+*/
+func (c *compressedString) bytes() []byte {
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+	r.(flate.Resetter).Reset(bytes.NewReader(c.data), nil)
+
+	val := make([]byte, c.size)
+	if _, err := io.ReadFull(r, val); err != nil {
+		// The data was compressed by this process, so this is memory corruption
+		panic("goredis: corrupt compressed value: " + err.Error())
+	}
+	return val
+}
+
+/*
+CompressionStats describes the string values stored compressed
+
+Values compressed before compression was turned off stay counted until
+they're overwritten or removed; see MEMORY STATS.
+*/
+type CompressionStats struct {
+	Keys        int   // string values stored compressed
+	RawBytes    int64 // their total length
+	StoredBytes int64 // the bytes they take compressed
+}
+
+/*
+CompressionStats returns the totals of the compressed string values
+*/
+func (s *Storage) CompressionStats() CompressionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.compressed
+}
+
+/*
+countCompressed adds an entry to the compression totals as it enters the
+keyspace (sign 1), or takes it out as it leaves (sign -1); e may be nil
+
+Must be called with the write lock held, by every write that may store,
+replace or remove a string value (see putEntry and deleteEntry).
+*/
+func (s *Storage) countCompressed(e *entry, sign int) {
+	if e == nil {
+		return
+	}
+	if c, ok := e.value.(*compressedString); ok {
+		s.compressed.Keys += sign
+		s.compressed.RawBytes += int64(sign * c.size)
+		s.compressed.StoredBytes += int64(sign * len(c.data))
+	}
+}
+
+/*
+putEntry stores e as keyStr, replacing any entry it had
+
+Every write that adds a key goes through it, so the SCAN index (see
+scan.go) holds the key too. Must be called with the write lock held.
+*/
+func (s *Storage) putEntry(keyStr string, e *entry) {
+	old, exists := s.entries[keyStr]
+	if !exists {
+		s.scanKeys.add(scanItem{hash: maphash.String(s.scanSeed, keyStr), key: keyStr})
+	}
+	s.countCompressed(old, -1)
+	s.countCompressed(e, 1)
+	s.entries[keyStr] = e
+}
+
+/*
+deleteEntry removes keyStr
+
+Every write that removes a key goes through it. Must be called with the
+write lock held.
+*/
+func (s *Storage) deleteEntry(keyStr string) {
+	old, exists := s.entries[keyStr]
+	if !exists {
+		return
+	}
+	s.scanKeys.remove(scanItem{hash: maphash.String(s.scanSeed, keyStr), key: keyStr})
+	s.countCompressed(old, -1)
+	delete(s.entries, keyStr)
+}
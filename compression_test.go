@@ -0,0 +1,123 @@
+package goredis_test
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+checkString checks key holds want, stored with the given encoding
+*/
+func checkString(t *testing.T, storage *goredis.Storage, key, want, encoding string) {
+	t.Helper()
+
+	if got, ok, err := storage.Get([]byte(key)); err != nil || !ok || string(got) != want {
+		t.Errorf("GET %s: %d bytes, %v, %v; want the %d bytes written", key, len(got), ok, err, len(want))
+	}
+	if n, err := storage.Strlen([]byte(key)); err != nil || n != len(want) {
+		t.Errorf("STRLEN %s = %d, %v, want %d", key, n, err, len(want))
+	}
+	if got, _ := storage.Encoding([]byte(key)); got != encoding {
+		t.Errorf("OBJECT ENCODING %s = %q, want %q", key, got, encoding)
+	}
+}
+
+/*
+checkCompressed checks the compression totals count the given keys and raw bytes
+*/
+func checkCompressed(t *testing.T, storage *goredis.Storage, keys int, rawBytes int64) {
+	t.Helper()
+
+	stats := storage.CompressionStats()
+	if stats.Keys != keys || stats.RawBytes != rawBytes {
+		t.Errorf("compression totals %+v, want %d keys of %d bytes", stats, keys, rawBytes)
+	}
+	if (stats.StoredBytes == 0) != (keys == 0) || stats.StoredBytes > stats.RawBytes-stats.RawBytes/8 {
+		t.Errorf("compression totals %+v store an unlikely number of bytes", stats)
+	}
+}
+
+func TestCompressedStrings(t *testing.T) {
+	storage := goredis.NewStorage()
+	storage.SetCompressThreshold(64)
+	text := string(bytes.Repeat([]byte("hello compressed world "), 100))
+
+	storage.Set([]byte("doc"), []byte(text))
+	checkString(t, storage, "doc", text, "compressed")
+	checkCompressed(t, storage, 1, int64(len(text)))
+	if got, err := storage.GetRange([]byte("doc"), 6, 15); err != nil || string(got) != "compressed" {
+		t.Errorf("GETRANGE doc 6 15 = %q, %v", got, err)
+	}
+
+	// Short values, and values that don't shrink, are stored as they are
+	noise := make([]byte, 4096)
+	for i := range noise {
+		noise[i] = byte(rand.IntN(256))
+	}
+	storage.Set([]byte("short"), []byte("hello"))
+	storage.Set([]byte("noise"), noise)
+	checkString(t, storage, "short", "hello", "raw")
+	checkString(t, storage, "noise", string(noise), "raw")
+	checkCompressed(t, storage, 1, int64(len(text)))
+
+	// Overwriting replaces the value in the totals instead of adding to them
+	storage.Set([]byte("doc"), []byte(text+text))
+	checkCompressed(t, storage, 1, int64(2*len(text)))
+	storage.SetWithExpiry([]byte("doc2"), []byte(text), time.Hour)
+	checkCompressed(t, storage, 2, int64(3*len(text)))
+
+	// APPEND and SETRANGE store their result uncompressed
+	if n, err := storage.Append([]byte("doc"), []byte("!")); err != nil || n != 2*len(text)+1 {
+		t.Errorf("APPEND = %d, %v", n, err)
+	}
+	checkString(t, storage, "doc", text+text+"!", "raw")
+	checkCompressed(t, storage, 1, int64(len(text)))
+	if n, err := storage.SetRange([]byte("doc2"), 6, []byte("COMPRESSED")); err != nil || n != len(text) {
+		t.Errorf("SETRANGE = %d, %v", n, err)
+	}
+	checkString(t, storage, "doc2", text[:6]+"COMPRESSED"+text[16:], "raw")
+	checkCompressed(t, storage, 0, 0)
+
+	// Removing a key takes it out of the totals, however it's removed
+	storage.Set([]byte("doc"), []byte(text))
+	storage.SetWithExpiry([]byte("doc2"), []byte(text), time.Millisecond)
+	storage.Set([]byte("doc3"), []byte(text))
+	storage.Set([]byte("doc5"), []byte(text))
+	checkCompressed(t, storage, 4, int64(4*len(text)))
+	storage.Delete([]byte("doc"))
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := storage.Get([]byte("doc2")); ok {
+		t.Error("doc2 outlived its TTL")
+	}
+	checkCompressed(t, storage, 2, int64(2*len(text)))
+	storage.Set([]byte("doc5"), []byte("small"))
+	checkCompressed(t, storage, 1, int64(len(text)))
+
+	// Turning compression off keeps what's stored, until it's overwritten or flushed
+	storage.SetCompressThreshold(0)
+	storage.Set([]byte("doc4"), []byte(text))
+	checkString(t, storage, "doc3", text, "compressed")
+	checkString(t, storage, "doc4", text, "raw")
+	checkCompressed(t, storage, 1, int64(len(text)))
+	storage.FlushAll()
+	checkCompressed(t, storage, 0, 0)
+}
+
+func TestCompressedMemoryUsage(t *testing.T) {
+	storage := goredis.NewStorage()
+	text := bytes.Repeat([]byte("0123456789"), 1000)
+	storage.Set([]byte("plain"), text)
+	storage.SetCompressThreshold(64)
+	storage.Set([]byte("packed"), text)
+
+	plain, _ := storage.MemoryUsage([]byte("plain"), 0)
+	packed, _ := storage.MemoryUsage([]byte("packed"), 0)
+	stored := storage.CompressionStats().StoredBytes
+	if packed >= plain/4 || int64(packed) < stored {
+		t.Errorf("MEMORY USAGE: compressed %d, plain %d, want the compressed value's %d bytes and little more", packed, plain, stored)
+	}
+}
@@ -0,0 +1,203 @@
+package goredis
+
+import (
+	"cmp"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"time"
+)
+
+/*
+Diagnostics Dump for Redis Clone
+
+A server that stops answering is hard to look into: INFO and the health
+endpoint go through the server loop, which may be what's stuck. Sending
+the process SIGUSR1, or running DEBUG DIAGNOSTICS while it still answers,
+writes what an operator needs to find the cause to the log.
+
+Key concepts:
+- Out of Band: The dump runs on its own goroutine for SIGUSR1 and never
+  waits on the server loop or a lock for long, so a wedged server still
+  produces one
+- Contents: Every goroutine's stack, the queues (clients waiting for a
+  turn, commands queued in each client's inbox, replies queued in its
+  outbox), client counts, the storage lock and memory stats
+- Locks: The storage has a single lock rather than shards; the dump tells
+  how long it waited for it, or that it gave up, which says whether a
+  command or the active expire cycle is holding it
+- Server Loop: A probe like the liveness check's (see health.go) tells
+  whether the loop still gets to its events
+- Busy Clients: Only the clients with the longest queues are listed, so a
+  server with thousands of connections still gets a readable dump
+*/
+
+/*
+diagnosticsWait is how long the dump waits for the server loop and each lock
+*/
+const diagnosticsWait = time.Second
+
+/*
+diagnosticsMaxPeers is how many clients with queued commands or replies the dump lists
+*/
+const diagnosticsMaxPeers = 20
+
+/*
+DumpOnSignal writes a diagnostics dump every time the process gets one of
+diagnosticsSignals (SIGUSR1), until the server quits
+
+cmd/goredis runs it on a goroutine of its own; code embedding the server
+may do the same, since signals go to the whole process.
+*/
+func (s *Server) DumpOnSignal() {
+	if len(diagnosticsSignals) == 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, diagnosticsSignals...)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			s.dumpDiagnostics(sig.String(), false)
+		case <-s.quitChannel:
+			return
+		}
+	}
+}
+
+/*
+peerQueues is the depth of one client's queues in a dump
+*/
+type peerQueues struct {
+	remoteAddress string
+	inbox         int // commands waiting to run
+	outbox        int // replies waiting to be written
+}
+
+/*
+dumpDiagnostics writes the server's state to the log
+
+onLoop is set when the server loop itself runs the dump (DEBUG
+DIAGNOSTICS), which it then doesn't probe.
+*/
+func (s *Server) dumpDiagnostics(trigger string, onLoop bool) {
+	slog.Warn("diagnostics dump", "trigger", trigger, "uptime", time.Since(s.startedAt).Round(time.Second))
+
+	// Server loop
+	loop := "running this dump"
+	if !onLoop {
+		loop = "responding"
+		if problems := s.liveProblems(); len(problems) > 0 {
+			loop = problems[0]
+		}
+	}
+
+	// Clients and their queues, under the lifecycle lock
+	var peers []*Peer
+	peersKnown := false
+	if waited, ok := waitForLock(s.mu.TryLock); ok {
+		for peer := range s.peers {
+			peers = append(peers, peer)
+		}
+		s.mu.Unlock()
+		peersKnown = true
+	} else {
+		slog.Warn("diagnostics: server mutex held", "waited", waited)
+	}
+
+	queued, replies := 0, 0
+	var busy []peerQueues
+	for _, peer := range peers {
+		q := peerQueues{remoteAddress: peer.connect.RemoteAddr().String(), inbox: s.scheduler.queued(peer), outbox: len(peer.outbox)}
+		queued += q.inbox
+		replies += q.outbox
+		if q.inbox > 0 || q.outbox > 0 {
+			busy = append(busy, q)
+		}
+	}
+
+	s.scheduler.mu.Lock()
+	turns := len(s.scheduler.ready)
+	s.scheduler.mu.Unlock()
+
+	slog.Warn("diagnostics: server",
+		"loop", loop,
+		"clientsKnown", peersKnown,
+		"connectedClients", len(peers),
+		"blockedClients", s.blocking.waiting.Load(),
+		"clientsWaitingForTurn", turns,
+		"queuedCommands", queued,
+		"queuedReplies", replies,
+	)
+
+	slices.SortFunc(busy, func(a, b peerQueues) int { return cmp.Compare(b.inbox+b.outbox, a.inbox+a.outbox) })
+	for _, q := range busy[:min(len(busy), diagnosticsMaxPeers)] {
+		slog.Warn("diagnostics: client queues", "remoteAddress", q.remoteAddress, "inbox", q.inbox, "inboxSize", peerInboxSize, "outbox", q.outbox, "outboxSize", peerOutboxSize)
+	}
+	if len(busy) > diagnosticsMaxPeers {
+		slog.Warn("diagnostics: more clients with queues", "count", len(busy)-diagnosticsMaxPeers)
+	}
+
+	// Storage lock
+	if waited, ok := waitForLock(s.storage.mu.TryRLock); ok {
+		keys := len(s.storage.entries)
+		s.storage.mu.RUnlock()
+		slog.Warn("diagnostics: storage", "lock", "free", "waited", waited, "keys", keys)
+	} else {
+		slog.Warn("diagnostics: storage", "lock", "held", "waited", waited)
+	}
+
+	// Memory
+	m := readMemoryStats()
+	slog.Warn("diagnostics: memory",
+		"heapAllocated", m.allocated,
+		"heapLive", m.live,
+		"heapGoal", m.heapGoal,
+		"heapObjects", m.objects,
+		"runtimeTotal", m.total,
+		"released", m.released,
+		"gcCycles", m.gcCycles,
+		"gomemlimit", m.memoryLimit,
+		"maxmemory", s.MaxMemory,
+		"oom", s.pressure.oom.Load(),
+	)
+
+	// Stacks last, since they're long; printed as is so they stay readable
+	log.Printf("diagnostics: %d goroutines\n%s", runtime.NumGoroutine(), goroutineStacks())
+}
+
+/*
+waitForLock tries to take a lock for up to diagnosticsWait
+
+Returns: How long it waited, and whether it got the lock; the caller
+releases it
+*/
+func waitForLock(try func() bool) (time.Duration, bool) {
+	start := time.Now()
+	for !try() {
+		if time.Since(start) >= diagnosticsWait {
+			return time.Since(start), false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return time.Since(start), true
+}
+
+/*
+goroutineStacks returns the stacks of every goroutine, like a crash prints them
+*/
+func goroutineStacks() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,110 @@
+package goredis_test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+logBuffer collects what the server logs, written from its goroutines
+*/
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+/*
+captureLog sends the log, and slog's default logger that writes through
+it, to a buffer until the test ends
+*/
+func captureLog(t *testing.T) *logBuffer {
+	t.Helper()
+
+	var logged logBuffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &logged
+}
+
+/*
+checkDump checks a diagnostics dump in the log holds each of want
+*/
+func checkDump(t *testing.T, dump string, want ...string) {
+	t.Helper()
+
+	for _, w := range want {
+		if !strings.Contains(dump, w) {
+			t.Errorf("dump lacks %q:\n%.2000s", w, dump)
+		}
+	}
+}
+
+func TestDiagnosticsDump(t *testing.T) {
+	logged := captureLog(t)
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().Set([]byte("a"), []byte("1"))
+		server.Storage().Set([]byte("b"), []byte("2"))
+	})
+	client := dial(t, server)
+	dial(t, server)
+
+	client.expect("+OK\r\n", "DEBUG", "DIAGNOSTICS")
+	checkDump(t, logged.String(),
+		`diagnostics dump trigger="DEBUG DIAGNOSTICS"`,
+		`loop="running this dump" clientsKnown=true connectedClients=2 blockedClients=0`,
+		"diagnostics: storage lock=free",
+		"keys=2",
+		"diagnostics: memory heapAllocated=",
+		"goroutines\ngoroutine ",
+		"dumpDiagnostics",
+	)
+}
+
+func TestDiagnosticsListBusyClients(t *testing.T) {
+	logged := captureLog(t)
+	server := startServer(t, nil)
+	sleeper := dial(t, server)
+	busy := dial(t, server)
+	client := dial(t, server)
+
+	// Commands a client sends while the server sleeps queue up in its inbox
+	sleeper.send("DEBUG", "SLEEP", "1")
+	time.Sleep(100 * time.Millisecond)
+	commands := make([][]string, 10)
+	for i := range commands {
+		commands[i] = []string{"PING"}
+	}
+	busy.pipeline(commands...)
+	client.send("DEBUG", "DIAGNOSTICS")
+	if got := client.read(); got != "+OK\r\n" {
+		t.Fatalf("DEBUG DIAGNOSTICS: got %q", got)
+	}
+
+	busyAddress := busy.conn.LocalAddr().String()
+	checkDump(t, logged.String(),
+		"queuedCommands=",
+		"diagnostics: client queues remoteAddress="+busyAddress+" inbox=",
+	)
+	if strings.Contains(logged.String(), "remoteAddress="+client.conn.LocalAddr().String()+" inbox=") {
+		t.Error("the dump lists a client with nothing queued")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package goredis
+
+import "os"
+
+/*
+diagnosticsSignals is empty where there's no SIGUSR1, like on Windows;
+DEBUG DIAGNOSTICS still dumps diagnostics there (see diagnostics.go)
+*/
+var diagnosticsSignals []os.Signal
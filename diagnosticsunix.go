@@ -0,0 +1,14 @@
+//go:build unix
+
+package goredis
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+diagnosticsSignals are the signals that make the server dump diagnostics
+to the log (see diagnostics.go)
+*/
+var diagnosticsSignals = []os.Signal{syscall.SIGUSR1}
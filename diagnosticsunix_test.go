@@ -0,0 +1,46 @@
+//go:build unix
+
+package goredis_test
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticsOnSignal(t *testing.T) {
+	logged := captureLog(t)
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	// Caught here too, so a signal sent before DumpOnSignal listens doesn't kill the test binary
+	caught := make(chan os.Signal, 8)
+	signal.Notify(caught, syscall.SIGUSR1)
+	defer signal.Stop(caught)
+	go server.DumpOnSignal()
+
+	// A server loop that doesn't answer still gets its dump, which says so
+	client.send("DEBUG", "SLEEP", "3")
+	time.Sleep(100 * time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logged.String(), `trigger="user defined signal 1"`) {
+		if time.Now().After(deadline) {
+			t.Fatal("no diagnostics dump after SIGUSR1")
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		time.Sleep(50 * time.Millisecond)
+	}
+	for !strings.Contains(logged.String(), "diagnostics: server") {
+		if time.Now().After(deadline) {
+			t.Fatal("diagnostics dump stopped at the server loop probe")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	checkDump(t, logged.String(), `loop="server loop not responding"`)
+	if got := client.read(); got != "+OK\r\n" {
+		t.Errorf("DEBUG SLEEP: got %q", got)
+	}
+}
@@ -0,0 +1,178 @@
+package goredis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"strconv"
+	"time"
+)
+
+/*
+Dataset Digests for Redis Clone
+
+DEBUG DIGEST hashes the whole dataset into one 160-bit value, so two
+servers (a primary and its copy, or a server before and after an import)
+can be compared by comparing 40 hex characters. DEBUG DIGEST-VALUE does
+the same for the values of single keys.
+
+Key concepts:
+- Order Independent: The dataset digest XORs the digests of its keys, and
+  sets and hashes XOR the digests of their elements, so the order of map
+  iteration doesn't matter; lists are hashed in order, and sorted sets
+  are ordered by their scores anyway
+- Representation Independent: Values are hashed as Redis sees them, so a
+  string stored as an integer, compressed or sparse digests like the same
+  string stored as it is
+- What Counts: A key's digest covers its name, type, value and expiration
+  time; DIGEST-VALUE covers just the type and value
+- Empty: An empty dataset, or a missing key, digests to forty zeros, like
+  Redis
+- Compatibility: The digests are only comparable between servers of this
+  implementation, not with Redis'
+*/
+
+/*
+digest is a SHA-1 sized dataset or value digest
+*/
+type digest [sha1.Size]byte
+
+/*
+String returns the digest in hex, as DEBUG DIGEST replies it
+*/
+func (d digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+/*
+xor folds another digest into d, where order must not matter
+*/
+func (d *digest) xor(other digest) {
+	for i := range d {
+		d[i] ^= other[i]
+	}
+}
+
+/*
+digester computes digests, reusing one SHA-1 state
+*/
+type digester struct {
+	h hash.Hash
+}
+
+func newDigester() *digester {
+	return &digester{h: sha1.New()}
+}
+
+/*
+mix returns the digest of d followed by data, where order matters
+*/
+func (g *digester) mix(d digest, data []byte) digest {
+	g.h.Reset()
+	g.h.Write(d[:])
+	g.h.Write(data)
+	var out digest
+	g.h.Sum(out[:0])
+	return out
+}
+
+/*
+mixString is mix for string data
+*/
+func (g *digester) mixString(d digest, data string) digest {
+	return g.mix(d, []byte(data))
+}
+
+/*
+value returns the digest of an entry's type and value
+
+Must be called with at least the read lock held.
+*/
+func (g *digester) value(e *entry) digest {
+	d := g.mixString(digest{}, string(e.valueType()))
+	switch v := e.value.(type) {
+	case *listValue:
+		for _, item := range v.items {
+			d = g.mix(d, item)
+		}
+	case *setValue:
+		var members digest
+		for _, member := range v.members {
+			members.xor(g.mixString(digest{}, member))
+		}
+		d = g.mix(d, members[:])
+	case *hashValue:
+		var fields digest
+		now := time.Now().UnixNano()
+		for field, value := range v.fields {
+			if v.fieldExpired(field, now) {
+				continue
+			}
+			fields.xor(g.mix(g.mixString(digest{}, field), value))
+		}
+		d = g.mix(d, fields[:])
+	case *zsetValue:
+		for n := v.sorted.first(); n != nil; n = n.next() {
+			d = g.mix(g.mixString(d, n.item.member), formatScore(n.item.score))
+		}
+	default:
+		d = g.mix(d, e.stringBytes())
+	}
+	return d
+}
+
+/*
+key returns the digest of a key: its name, value and expiration time
+*/
+func (g *digester) key(keyStr string, e *entry) digest {
+	d := g.mixString(digest{}, keyStr)
+	value := g.value(e)
+	d = g.mix(d, value[:])
+	if e.expireAt != 0 {
+		d = g.mix(d, strconv.AppendInt([]byte("!!expire!!"), e.expireAt/int64(time.Millisecond), 10))
+	}
+	return d
+}
+
+/*
+Digest returns the digest of the whole dataset, in hex
+
+Implements DEBUG DIGEST. Walks the keyspace under the read lock, so like
+KEYS it's meant for tests and occasional checks.
+*/
+func (s *Storage) Digest() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	g := newDigester()
+	var d digest
+	now := time.Now().UnixNano()
+	for keyStr, e := range s.entries {
+		if !e.expired(now) {
+			d.xor(g.key(keyStr, e))
+		}
+	}
+	return d.String()
+}
+
+/*
+DigestValues returns the digests of the values at keys, in hex, zeros
+for missing keys
+
+Implements DEBUG DIGEST-VALUE.
+*/
+func (s *Storage) DigestValues(keys [][]byte) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	g := newDigester()
+	digests := make([]string, len(keys))
+	for i, key := range keys {
+		var d digest
+		if e := s.lookupRead(string(key)); e != nil {
+			d = g.value(e)
+		}
+		digests[i] = d.String()
+	}
+	return digests
+}
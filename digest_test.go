@@ -0,0 +1,140 @@
+package goredis_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+digestRecords returns a dataset of every type, each collection big enough
+for its map iteration order to vary
+*/
+func digestRecords() []goredis.ImportRecord {
+	var members, fields, scored [][]byte
+	for i := range 200 {
+		members = append(members, fmt.Appendf(nil, "member:%d", i))
+		fields = append(fields, fmt.Appendf(nil, "field:%d", i), fmt.Appendf(nil, "value:%d", i))
+		scored = append(scored, fmt.Appendf(nil, "player:%d", i), fmt.Appendf(nil, "%d", i%7))
+	}
+	records := []goredis.ImportRecord{
+		{Type: goredis.TypeString, Key: []byte("string"), Elements: [][]byte{[]byte("hello")}},
+		{Type: goredis.TypeString, Key: []byte("number"), Elements: [][]byte{[]byte("12345")}},
+		{Type: goredis.TypeList, Key: []byte("list"), Elements: [][]byte{[]byte("c"), []byte("a"), []byte("b")}},
+		{Type: goredis.TypeSet, Key: []byte("set"), Elements: members},
+		{Type: goredis.TypeHash, Key: []byte("hash"), Elements: fields},
+		{Type: goredis.TypeZSet, Key: []byte("zset"), Elements: scored},
+	}
+	for i := range 100 {
+		records = append(records, goredis.ImportRecord{Type: goredis.TypeString, Key: fmt.Appendf(nil, "key:%d", i), Elements: [][]byte{[]byte("x")}})
+	}
+	return records
+}
+
+/*
+shuffled returns the records in a random order, each set, hash and sorted
+set with its elements in a random order too
+*/
+func shuffled(records []goredis.ImportRecord) []goredis.ImportRecord {
+	out := slices.Clone(records)
+	rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	for i, r := range out {
+		switch r.Type {
+		case goredis.TypeSet:
+			r.Elements = slices.Clone(r.Elements)
+			rand.Shuffle(len(r.Elements), func(i, j int) { r.Elements[i], r.Elements[j] = r.Elements[j], r.Elements[i] })
+		case goredis.TypeHash, goredis.TypeZSet:
+			pairs := slices.Clone(r.Elements)
+			rand.Shuffle(len(pairs)/2, func(i, j int) {
+				pairs[2*i], pairs[2*j] = pairs[2*j], pairs[2*i]
+				pairs[2*i+1], pairs[2*j+1] = pairs[2*j+1], pairs[2*i+1]
+			})
+			r.Elements = pairs
+		}
+		out[i] = r
+	}
+	return out
+}
+
+func TestDigestIgnoresInsertionOrder(t *testing.T) {
+	records := digestRecords()
+	reference := goredis.NewStorage()
+	reference.Import(records)
+	want := reference.Digest()
+	if want == strings.Repeat("0", 40) {
+		t.Fatal("a dataset digests to zeros")
+	}
+
+	// Keys, members and fields added in another order, one key at a time
+	for range 10 {
+		storage := goredis.NewStorage()
+		for _, r := range shuffled(records) {
+			if _, err := storage.Import([]goredis.ImportRecord{r}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := storage.Digest(); got != want {
+			t.Fatalf("digest %s of the same dataset built in another order, want %s", got, want)
+		}
+	}
+
+	// How a string is stored doesn't matter, only what it holds
+	storage := goredis.NewStorage()
+	storage.Import(records)
+	storage.Set([]byte("number"), []byte("123"))
+	storage.Append([]byte("number"), []byte("45"))
+	if got := storage.Digest(); got != want {
+		t.Errorf("digest %s after building the same number with APPEND, want %s", got, want)
+	}
+}
+
+func TestDigestChangesWithTheData(t *testing.T) {
+	records := digestRecords()
+	reference := goredis.NewStorage()
+	reference.Import(records)
+	want := reference.Digest()
+
+	for name, change := range map[string]func(storage *goredis.Storage){
+		"list pushed": func(storage *goredis.Storage) { storage.Push([]byte("list"), [][]byte{[]byte("d")}, false) },
+		"set member":  func(storage *goredis.Storage) { storage.SAdd([]byte("set"), [][]byte{[]byte("another")}) },
+		"hash value": func(storage *goredis.Storage) {
+			storage.HSet([]byte("hash"), [][]byte{[]byte("field:0"), []byte("changed")})
+		},
+		"string": func(storage *goredis.Storage) { storage.Set([]byte("string"), []byte("hellp")) },
+		"key renamed": func(storage *goredis.Storage) {
+			storage.Delete([]byte("key:0"))
+			storage.Set([]byte("key:100"), []byte("x"))
+		},
+		"expiry": func(storage *goredis.Storage) {
+			storage.SetWithExpiry([]byte("string"), []byte("hello"), time.Hour)
+		},
+	} {
+		storage := goredis.NewStorage()
+		storage.Import(records)
+		change(storage)
+		if got := storage.Digest(); got == want {
+			t.Errorf("%s: digest unchanged", name)
+		}
+	}
+}
+
+func TestDebugDigest(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	zeros := strings.Repeat("0", 40)
+	client.expect("+"+zeros+"\r\n", "DEBUG", "DIGEST")
+	client.do("SADD", "a", "x", "y")
+	client.do("SADD", "b", "y", "x")
+	reply := client.do("DEBUG", "DIGEST-VALUE", "a", "b", "missing")
+	digests := strings.Split(reply, "\r\n")
+	if len(digests) != 5 || digests[0] != "*3" || digests[1] != digests[2] || digests[1] == "+"+zeros || digests[3] != "+"+zeros {
+		t.Errorf("DIGEST-VALUE of equal sets and a missing key: %q", reply)
+	}
+	client.expect("+"+server.Storage().Digest()+"\r\n", "DEBUG", "DIGEST")
+}
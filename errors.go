@@ -0,0 +1,221 @@
+package goredis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+Error Replies for Redis Clone
+
+This file defines every error reply the server can send. Client libraries
+parse and match on Redis error strings (for example to detect a wrong
+argument count or a non-integer value), so each message here is the exact
+string real Redis sends, error code included.
+
+Key concepts:
+- Error Codes: The first word of an error reply is its code (ERR, WRONGTYPE, ...)
+- Full Messages: Errors are created with their code, so the handler and the
+  peer send err.Error() unchanged instead of adding a prefix
+- Lowercase Names: Redis reports command names in lowercase in arity errors
+*/
+
+/*
+ErrWrongType is returned when a command is used against a key of another type
+
+It is exported so code using Storage directly can detect it with errors.Is.
+*/
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+var (
+	// errSyntax is returned for unknown or misplaced command options
+	errSyntax = errors.New("ERR syntax error")
+
+	// errNotInteger is returned when an argument or stored value must be a 64-bit integer
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+
+	// errOverflow is returned when INCR/DECR style commands would overflow int64
+	errOverflow = errors.New("ERR increment or decrement would overflow")
+
+	// errOffsetOutOfRange is returned by SETRANGE for negative offsets
+	errOffsetOutOfRange = errors.New("ERR offset is out of range")
+
+	// errBulkTooLarge is returned by SETRANGE when the string would outgrow a bulk reply
+	errBulkTooLarge = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+
+	// errHashNotInteger is returned by HINCRBY when the field doesn't hold an integer
+	errHashNotInteger = errors.New("ERR hash value is not an integer")
+
+	// errNotFloat is returned when a score or increment isn't a valid float
+	errNotFloat = errors.New("ERR value is not a valid float")
+
+	// errScoreNaN is returned when adding to a score gives NaN (inf + -inf)
+	errScoreNaN = errors.New("ERR resulting score is not a number (NaN)")
+
+	// errZAddNXAndXX, errZAddGTLTNX and errZAddIncrPair reject invalid ZADD option combinations
+	errZAddNXAndXX  = errors.New("ERR XX and NX options at the same time are not compatible")
+	errZAddGTLTNX   = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	errZAddIncrPair = errors.New("ERR INCR option supports a single increment-element pair")
+
+	// errCrossSlot is returned in cluster mode when a command's keys map to different slots
+	errCrossSlot = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+
+	// errClusterDisabled is returned by CLUSTER when the server runs without -clusterEnabled
+	errClusterDisabled = errors.New("ERR This instance has cluster support disabled")
+
+	// errNeedsConnection is returned if a peer command is executed without its connection
+	errNeedsConnection = errors.New("ERR command needs a client connection")
+
+	// errMinMaxNotFloat is returned for a bad ZRANGEBYSCORE interval bound
+	errMinMaxNotFloat = errors.New("ERR min or max is not a float")
+
+	// errMinMaxNotLex is returned for a bad ZRANGEBYLEX interval bound
+	errMinMaxNotLex = errors.New("ERR min or max not valid string range item")
+
+	// errLimitWithoutBy is returned by ZRANGE when LIMIT is used with a rank range
+	errLimitWithoutBy = errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+
+	// errWithScoresByLex is returned when WITHSCORES is combined with a lexicographic range
+	errWithScoresByLex = errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+
+	// errNoSuchKey is returned by commands that need an existing key, like LSET
+	errNoSuchKey = errors.New("ERR no such key")
+
+	// errIndexOutOfRange is returned by LSET for an index outside the list
+	errIndexOutOfRange = errors.New("ERR index out of range")
+
+	// errValueOutOfRange is returned for numeric arguments outside the accepted range
+	errValueOutOfRange = errors.New("ERR value is out of range")
+
+	// errNotPositive is returned for COUNT arguments that must not be negative
+	errNotPositive = errors.New("ERR value is out of range, must be positive")
+
+	// errTimeoutNotFloat and errTimeoutNegative are returned for a bad timeout of a blocking command
+	errTimeoutNotFloat = errors.New("ERR timeout is not a float or out of range")
+	errTimeoutNegative = errors.New("ERR timeout is negative")
+
+	// errFieldExpireNegative is returned by HEXPIRE and HPEXPIRE for a negative time
+	errFieldExpireNegative = errors.New("ERR invalid expire time, must be >= 0")
+
+	// errFieldsMissing, errNumFieldsNotPositive and errNumFieldsMismatch reject a bad FIELDS clause of the hash field TTL commands
+	errFieldsMissing        = errors.New("ERR Mandatory argument FIELDS is missing or not at the right position")
+	errNumFieldsNotPositive = errors.New("ERR Parameter `numFields` should be greater than 0")
+	errNumFieldsMismatch    = errors.New("ERR The `numfields` parameter must match the number of arguments")
+
+	// errInvalidCursor is returned by SCAN for a cursor that isn't an unsigned integer
+	errInvalidCursor = errors.New("ERR invalid cursor")
+
+	// errInvalidCommand, errInvalidCommandArgs and errNoKeyArguments are returned by COMMAND GETKEYS
+	errInvalidCommand     = errors.New("ERR Invalid command specified")
+	errInvalidCommandArgs = errors.New("ERR Invalid number of arguments specified for command")
+	errNoKeyArguments     = errors.New("ERR The command has no key arguments")
+
+	// errNoProto and errProtoVersion are returned by HELLO for a protocol version other than 2 or 3
+	errNoProto      = errors.New("NOPROTO unsupported protocol version")
+	errProtoVersion = errors.New("ERR Protocol version is not an integer or out of range")
+
+	// errFaultNotAllowed is returned by DEBUG FAULT SET for DEBUG (needed to clear faults) and QUIT (which must close the connection)
+	errFaultNotAllowed = errors.New("ERR DEBUG and QUIT can't be faulted")
+
+	// errInvalidClientName is returned by CLIENT SETNAME for names with spaces or control characters
+	errInvalidClientName = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+
+	// errOOM is returned for commands that need memory while used memory is above maxmemory and nothing can be evicted
+	errOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+	// Size limits on writes, see limits.go
+	errKeyTooLarge     = errors.New("ERR key exceeds maximum allowed size (maxKeySize)")
+	errStringTooLarge  = errors.New("ERR string exceeds maximum allowed size (maxStringSize)")
+	errElementTooLarge = errors.New("ERR element exceeds maximum allowed size (maxElementSize)")
+	errTooManyElements = errors.New("ERR collection exceeds maximum allowed length (maxElements)")
+)
+
+/*
+errWrongNumberOfArgs builds the arity error for a command
+
+Example: errWrongNumberOfArgs("GET") -> ERR wrong number of arguments for 'get' command
+*/
+func errWrongNumberOfArgs(command string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+}
+
+/*
+errUnknownTypeName builds the error for an unknown SCAN TYPE
+
+Example: errUnknownTypeName("foo") -> ERR unknown type name 'foo'
+*/
+func errUnknownTypeName(name string) error {
+	return fmt.Errorf("ERR unknown type name '%s'", name)
+}
+
+/*
+errUnknownSubcommand builds the error for unknown subcommands of container commands
+
+Example: errUnknownSubcommand("OBJECT", "foo") -> ERR unknown subcommand 'foo'. Try OBJECT HELP.
+*/
+func errUnknownSubcommand(command, subcommand string) error {
+	return fmt.Errorf("ERR unknown subcommand '%s'. Try %s HELP.", subcommand, strings.ToUpper(command))
+}
+
+/*
+errInvalidExpireTime builds the error for non-positive expire times
+
+Example: errInvalidExpireTime("SET") -> ERR invalid expire time in 'set' command
+*/
+func errInvalidExpireTime(command string) error {
+	return fmt.Errorf("ERR invalid expire time in '%s' command", strings.ToLower(command))
+}
+
+/*
+errSubscribedMode builds the error for commands sent by a client in subscribed mode
+
+Example: errSubscribedMode("GET") -> ERR Can't execute 'get': only (P|S)SUBSCRIBE / ... are allowed in this context
+*/
+func errSubscribedMode(command string) error {
+	return fmt.Errorf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(command))
+}
+
+/*
+errUnknownCommand builds the error for commands the server doesn't know
+
+Like Redis, the command name is echoed exactly as the client sent it and
+the reply lists the first arguments (up to roughly 128 characters) so users
+can spot typos in pipelines.
+
+Example: errUnknownCommand("foo", ["a", "b"]) ->
+ERR unknown command 'foo', with args beginning with: 'a' 'b'
+*/
+func errUnknownCommand(name string, args []string) error {
+	var b strings.Builder
+	for _, arg := range args {
+		if b.Len() >= 128 {
+			break
+		}
+		remaining := 128 - b.Len()
+		if len(arg) > remaining {
+			arg = arg[:remaining]
+		}
+		b.WriteString("'" + arg + "' ")
+	}
+
+	if len(name) > 128 {
+		name = name[:128]
+	}
+
+	return fmt.Errorf("ERR unknown command '%s', with args beginning with: %s", name, b.String())
+}
+
+/*
+errProtocol builds a protocol error for input that isn't a valid command
+
+Errors coming from the RESP reader already start with "Protocol error",
+so the prefix is only added when missing.
+*/
+func errProtocol(err error) error {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "Protocol error") {
+		msg = "Protocol error: " + msg
+	}
+	return errors.New("ERR " + msg)
+}
@@ -0,0 +1,229 @@
+package goredis
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+/*
+Eviction for Redis Clone
+
+When used memory is above -maxMemory, keys are evicted following the
+-maxMemoryPolicy (see maxmemory.go). Finding the very least recently used
+key would mean ordering the whole keyspace, so like Redis the victims are
+approximated by sampling, with a pool that remembers good candidates.
+
+Key concepts:
+- Samples: Each time a victim is needed, -maxMemorySamples random keys
+  (5 by default, keys with a TTL for the volatile policies) are scored:
+  their idle time for the LRU policies, how soon they expire for
+  volatile-ttl; more samples pick better victims for more CPU
+- Pool: The 16 best scored candidates seen so far are kept between
+  picks, so a good candidate sampled once isn't forgotten; the best one
+  is evicted, after checking it still exists
+- Random Policies: allkeys-random and volatile-random evict the first
+  sampled key and don't use the pool
+- Batches: Keys are evicted a batch at a time under the write lock, so
+  commands can run between batches
+*/
+
+const (
+	evictionPoolSize = 16 // candidates kept between picks
+	evictionBatch    = 64 // keys evicted per hold of the write lock
+
+	DefaultEvictionSamples = 5  // keys sampled per pick, as Redis' maxmemory-samples
+	MaxEvictionSamples     = 64 // the most -maxMemorySamples allows
+
+	// evictionScanFactor bounds how many keys are walked, per sample, to
+	// find keys with a TTL for the volatile policies
+	evictionScanFactor = 20
+)
+
+/*
+evictionCandidate is a key in the eviction pool with its score
+*/
+type evictionCandidate struct {
+	key   string
+	score int64 // higher is evicted first
+}
+
+/*
+evictionPool keeps the best eviction candidates seen so far
+
+Candidates are sorted by ascending score, so the best is last. Guarded by
+the storage write lock.
+*/
+type evictionPool struct {
+	candidates []evictionCandidate
+}
+
+/*
+offer adds a candidate if the pool has room or it beats the worst one
+*/
+func (p *evictionPool) offer(key string, score int64) {
+	// A key sampled again gets its new score
+	if i := slices.IndexFunc(p.candidates, func(c evictionCandidate) bool { return c.key == key }); i >= 0 {
+		p.candidates = slices.Delete(p.candidates, i, i+1)
+	}
+
+	i, _ := slices.BinarySearchFunc(p.candidates, score, func(c evictionCandidate, score int64) int {
+		return cmp.Compare(c.score, score)
+	})
+	if len(p.candidates) == evictionPoolSize {
+		if i == 0 {
+			return
+		}
+		// Drop the worst candidate to make room
+		copy(p.candidates, p.candidates[1:i])
+		p.candidates[i-1] = evictionCandidate{key: key, score: score}
+		return
+	}
+	p.candidates = slices.Insert(p.candidates, i, evictionCandidate{key: key, score: score})
+}
+
+/*
+pop removes and returns the best candidate
+*/
+func (p *evictionPool) pop() (string, bool) {
+	if len(p.candidates) == 0 {
+		return "", false
+	}
+	best := p.candidates[len(p.candidates)-1]
+	p.candidates = p.candidates[:len(p.candidates)-1]
+	return best.key, true
+}
+
+/*
+random reports whether the policy evicts keys at random
+*/
+func (p EvictionPolicy) random() bool {
+	return p == PolicyAllKeysRandom || p == PolicyVolatileRandom
+}
+
+/*
+score rates how much the policy wants to evict an entry, higher first
+*/
+func (p EvictionPolicy) score(e *entry, now int64) int64 {
+	if p == PolicyVolatileTTL {
+		// The sooner it expires, the higher
+		return math.MaxInt64 - e.expireAt
+	}
+	// Idle time for the LRU policies
+	return now - e.lastAccess.Load()
+}
+
+/*
+Evict removes keys chosen by policy until about bytes were freed
+
+Each victim is picked among samples sampled keys and the eviction pool.
+HookEvict is fired for every evicted key.
+
+Returns: The estimated number of bytes freed, less than bytes if the
+policy ran out of keys
+*/
+func (s *Storage) Evict(policy EvictionPolicy, samples int, bytes int64) int64 {
+	var freed int64
+	for freed < bytes {
+		batch, more := s.evictBatch(policy, samples, bytes-freed)
+		freed += batch
+		if !more {
+			break
+		}
+	}
+	return freed
+}
+
+/*
+evictBatch evicts up to evictionBatch keys
+
+Returns: The estimated bytes freed and false once no key may be evicted
+*/
+func (s *Storage) evictBatch(policy EvictionPolicy, samples int, bytes int64) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var freed int64
+	for i := 0; i < evictionBatch && freed < bytes; i++ {
+		keyStr, e := s.nextVictim(policy, samples)
+		if e == nil {
+			return freed, false
+		}
+		freed += int64(estimateSize(keyStr, e, memoryUsageSamples))
+		s.evict(keyStr)
+	}
+	return freed, true
+}
+
+/*
+nextVictim returns the key policy evicts next
+
+Must be called with the write lock held.
+
+Returns: The key and its entry, or a nil entry if no key may be evicted
+*/
+func (s *Storage) nextVictim(policy EvictionPolicy, samples int) (string, *entry) {
+	if policy.random() {
+		var victim string
+		var found *entry
+		s.sampleEvictable(policy, 1, func(keyStr string, e *entry) {
+			victim, found = keyStr, e
+		})
+		return victim, found
+	}
+
+	// A second round in case every pooled candidate was gone
+	for round := 0; round < 2; round++ {
+		now := time.Now().UnixNano()
+		s.sampleEvictable(policy, samples, func(keyStr string, e *entry) {
+			s.evictionPool.offer(keyStr, policy.score(e, now))
+		})
+
+		for {
+			keyStr, ok := s.evictionPool.pop()
+			if !ok {
+				break
+			}
+			// Pooled keys may have been deleted, or lost their TTL, since they were sampled
+			if e := s.entries[keyStr]; e != nil && (!policy.volatile() || e.expireAt != 0) {
+				return keyStr, e
+			}
+		}
+	}
+	return "", nil
+}
+
+/*
+sampleEvictable calls fn for up to samples keys the policy may evict
+
+Go randomizes where a map iteration starts, so every call samples a
+different part of the keyspace. Must be called with the write lock held.
+*/
+func (s *Storage) sampleEvictable(policy EvictionPolicy, samples int, fn func(keyStr string, e *entry)) {
+	sampled, scanned := 0, 0
+	for keyStr, e := range s.entries {
+		if scanned++; scanned > samples*evictionScanFactor || sampled == samples {
+			return
+		}
+		if policy.volatile() && e.expireAt == 0 {
+			continue
+		}
+
+		sampled++
+		fn(keyStr, e)
+	}
+}
+
+/*
+evict removes a key to free memory
+
+Must be called with the write lock held. The key is counted in the
+evicted_keys statistic and HookEvict is fired.
+*/
+func (s *Storage) evict(keyStr string) {
+	s.preserve(keyStr)
+	s.deleteEntry(keyStr)
+	s.evictedKeys++
+	s.fire(HookEvict, keyStr)
+}
@@ -0,0 +1,174 @@
+package goredis_test
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+survivors returns which of the keys prefix:0 to prefix:n-1 are still stored
+*/
+func survivors(storage *goredis.Storage, prefix string, n int) []int {
+	var alive []int
+	for i := range n {
+		if _, ok, _ := storage.Get(fmt.Appendf(nil, "%s:%d", prefix, i)); ok {
+			alive = append(alive, i)
+		}
+	}
+	return alive
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		policy    goredis.EvictionPolicy
+		evictions int
+		want      map[string][]int // the keys of each prefix left afterwards
+	}{
+		// The ttl keys were written first, and the keys numbered 0 to 4 were read since
+		{goredis.PolicyAllKeysLRU, 10, map[string][]int{"plain": {0, 1, 2, 3, 4}, "ttl": {0, 1, 2, 3, 4}}},
+		{goredis.PolicyVolatileLRU, 5, map[string][]int{"plain": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, "ttl": {0, 1, 2, 3, 4}}},
+		{goredis.PolicyVolatileRandom, 10, map[string][]int{"plain": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, "ttl": nil}},
+		// ttl:i expires in i+1 minutes, so the lowest go first
+		{goredis.PolicyVolatileTTL, 3, map[string][]int{"plain": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, "ttl": {3, 4, 5, 6, 7, 8, 9}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			storage := goredis.NewStorage()
+			for i := range 10 {
+				storage.SetWithExpiry(fmt.Appendf(nil, "ttl:%d", i), []byte("x"), time.Duration(i+1)*time.Minute)
+			}
+			time.Sleep(2 * time.Millisecond)
+			for i := range 10 {
+				storage.Set(fmt.Appendf(nil, "plain:%d", i), []byte("x"))
+			}
+			time.Sleep(2 * time.Millisecond)
+			for i := range 5 {
+				storage.Get(fmt.Appendf(nil, "plain:%d", i))
+				storage.Get(fmt.Appendf(nil, "ttl:%d", i))
+			}
+
+			// Sampling every key makes the pick exact; a 1 byte goal evicts one key
+			for range tt.evictions {
+				if freed := storage.Evict(tt.policy, goredis.MaxEvictionSamples, 1); freed == 0 {
+					t.Fatal("Evict freed nothing while keys were left to evict")
+				}
+			}
+			for prefix, want := range tt.want {
+				if got := survivors(storage, prefix, 10); fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("%s keys left: %v, want %v", prefix, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("allkeys-random", func(t *testing.T) {
+		storage := goredis.NewStorage()
+		for i := range 20 {
+			storage.Set(fmt.Appendf(nil, "key:%d", i), []byte("x"))
+		}
+		for range 20 {
+			storage.Evict(goredis.PolicyAllKeysRandom, goredis.DefaultEvictionSamples, 1)
+		}
+		if got := survivors(storage, "key", 20); len(got) != 0 {
+			t.Errorf("keys left: %v, want every key evicted", got)
+		}
+		if freed := storage.Evict(goredis.PolicyAllKeysRandom, goredis.DefaultEvictionSamples, 1); freed != 0 {
+			t.Errorf("Evict on an empty storage freed %d bytes", freed)
+		}
+	})
+}
+
+/*
+startMemoryLimitedServer starts a server whose budget is always exceeded,
+holding the keys set by fill
+
+GOMEMLIMIT is set beforehand, so the server keeps it instead of deriving a
+limit of a few bytes from maxmemory, which would make the collector run
+nonstop for the whole test binary. A collection runs once the keys are set:
+the live heap is only measured by one, and a small heap with a huge limit
+may never trigger it.
+*/
+func startMemoryLimitedServer(t *testing.T, policy goredis.EvictionPolicy, fill func(storage *goredis.Storage)) *testClient {
+	t.Helper()
+
+	debug.SetMemoryLimit(1 << 40)
+	t.Cleanup(func() { debug.SetMemoryLimit(math.MaxInt64) })
+
+	server := startServer(t, func(server *goredis.Server) {
+		server.MaxMemory = 1
+		server.MaxMemoryPolicy = policy
+		fill(server.Storage())
+	})
+	runtime.GC()
+	return dial(t, server)
+}
+
+/*
+exists builds an EXISTS command for the keys prefix:0 to prefix:99
+*/
+func exists(prefix string) []string {
+	args := []string{"EXISTS"}
+	for i := range 100 {
+		args = append(args, fmt.Sprintf("%s:%d", prefix, i))
+	}
+	return args
+}
+
+/*
+waitFor polls the client until reply answers args, or fails the test after 5s
+*/
+func waitFor(t *testing.T, client *testClient, reply string, args ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := client.do(args...)
+		if got == reply {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: got %q, want %q", strings.Join(args, " "), got, reply)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMaxMemoryEvicts(t *testing.T) {
+	fill := func(storage *goredis.Storage) {
+		for i := range 100 {
+			storage.Set(fmt.Appendf(nil, "plain:%d", i), []byte("x"))
+			storage.SetWithExpiry(fmt.Appendf(nil, "ttl:%d", i), []byte("x"), time.Hour)
+		}
+	}
+	oom := "-OOM command not allowed when used memory > 'maxmemory'.\r\n"
+
+	t.Run("allkeys-lru", func(t *testing.T) {
+		client := startMemoryLimitedServer(t, goredis.PolicyAllKeysLRU, fill)
+		waitFor(t, client, ":0\r\n", exists("plain")...)
+		client.expect(":0\r\n", exists("ttl")...)
+	})
+
+	t.Run("volatile-lru", func(t *testing.T) {
+		// Only the keys with a TTL go; once they're gone, writes are rejected
+		client := startMemoryLimitedServer(t, goredis.PolicyVolatileLRU, fill)
+		waitFor(t, client, ":0\r\n", exists("ttl")...)
+		waitFor(t, client, oom, "SET", "new", "x")
+		client.expect(":100\r\n", exists("plain")...)
+		client.expect("$1\r\nx\r\n", "GET", "plain:0")
+		client.expect(":1\r\n", "DEL", "plain:0")
+	})
+
+	t.Run("noeviction", func(t *testing.T) {
+		client := startMemoryLimitedServer(t, goredis.PolicyNoEviction, fill)
+		waitFor(t, client, oom, "SET", "new", "x")
+		client.expect(":100\r\n", exists("plain")...)
+		client.expect(":100\r\n", exists("ttl")...)
+	})
+}
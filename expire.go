@@ -0,0 +1,166 @@
+package goredis
+
+import "time"
+
+/*
+Active Expiration for Redis Clone
+
+Lazy expiration only removes a key when something touches it, so keys that
+are never read again would stay in memory forever. Like Redis, the server
+also runs an active expire cycle in the background that samples keys with
+a TTL and deletes the expired ones.
+
+Key concepts:
+- Sampling: Each cycle looks at up to 20 keys with a TTL, starting at a
+  random position of the keyspace, and deletes those that expired
+- Adaptive: While more than a quarter of a sample was expired, the cycle
+  samples again, so a burst of expiring keys is cleared quickly
+- Bounded: A cycle never runs longer than 25ms, a quarter of the 100ms
+  interval (Redis' default hz of 10)
+- Hash Fields: Fields of hashes with a TTL of their own (HEXPIRE) are
+  sampled the same way, after the keys, within the same budget
+- Switchable: DEBUG SET-ACTIVE-EXPIRE 0 turns it off, leaving only lazy
+  expiration, which test suites use to observe expired keys
+*/
+
+const (
+	activeExpireInterval = 100 * time.Millisecond // time between cycles
+	activeExpireBudget   = 25 * time.Millisecond  // longest a cycle may run
+	activeExpireSample   = 20                     // keys with a TTL checked per round
+
+	// activeExpireMaxScan bounds how many keys a round walks looking for keys
+	// with a TTL, so a keyspace where few keys have one isn't walked in full
+	activeExpireMaxScan = activeExpireSample * 20
+)
+
+/*
+ExpireAt returns when key expires
+
+Implements TTL, PTTL, EXPIRETIME and PEXPIRETIME. Like the other introspection commands, it doesn't
+count as an access to the key.
+
+Returns: The expiration time, zero if the key has no TTL, and whether the
+key exists
+*/
+func (s *Storage) ExpireAt(key []byte) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return time.Time{}, false
+	}
+	if e.expireAt == 0 {
+		return time.Time{}, true
+	}
+	return time.Unix(0, e.expireAt), true
+}
+
+/*
+SetActiveExpire enables or disables the active expire cycle
+
+Implements DEBUG SET-ACTIVE-EXPIRE. Expired keys are still removed lazily
+while the cycle is disabled.
+*/
+func (s *Storage) SetActiveExpire(enabled bool) {
+	s.activeExpireDisabled.Store(!enabled)
+}
+
+/*
+ActiveExpireCycle deletes expired keys found by sampling keys with a TTL,
+then expired hash fields found by sampling fields with a TTL (see hashttl.go)
+
+It takes the write lock for one round at a time, so commands can run
+between rounds. HookExpire is fired for every deleted key.
+
+Returns: The number of keys and hash fields deleted
+*/
+func (s *Storage) ActiveExpireCycle() int {
+	if s.activeExpireDisabled.Load() {
+		return 0
+	}
+
+	start := time.Now()
+	expired := activeExpireRounds(start, s.activeExpireRound)
+	return expired + activeExpireRounds(start, s.activeExpireFieldsRound)
+}
+
+/*
+activeExpireRounds runs sampling rounds while they keep finding expired
+keys (or fields), within the cycle's budget
+
+Returns: The number deleted
+*/
+func activeExpireRounds(start time.Time, round func() (sampled, expired int)) int {
+	expired := 0
+	for {
+		sampled, deleted := round()
+		expired += deleted
+
+		// Keep going only while expired keys are common and there's time left
+		if sampled == 0 || deleted*4 <= sampled || time.Since(start) > activeExpireBudget {
+			return expired
+		}
+	}
+}
+
+/*
+activeExpireRound samples keys with a TTL once and deletes the expired ones
+
+Go randomizes where a map iteration starts, so every round looks at a
+different part of the keyspace.
+
+Returns: How many keys with a TTL were sampled and how many were deleted
+*/
+func (s *Storage) activeExpireRound() (sampled, expired int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	scanned := 0
+	for keyStr, e := range s.entries {
+		if scanned++; scanned > activeExpireMaxScan || sampled == activeExpireSample {
+			break
+		}
+		if e.expireAt == 0 {
+			continue
+		}
+
+		sampled++
+		if e.expired(now) {
+			s.expire(keyStr)
+			expired++
+		}
+	}
+	return sampled, expired
+}
+
+/*
+expire removes a key whose TTL passed
+
+Must be called with the write lock held. The key is counted in the
+expired_keys statistic and HookExpire is fired.
+*/
+func (s *Storage) expire(keyStr string) {
+	s.preserve(keyStr)
+	s.deleteEntry(keyStr)
+	s.expiredKeys++
+	s.fire(HookExpire, keyStr)
+}
+
+/*
+activeExpireLoop runs the active expire cycle until the server quits
+*/
+func (s *Server) activeExpireLoop() {
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.storage.ActiveExpireCycle()
+		case <-s.quitChannel:
+			return
+		}
+	}
+}
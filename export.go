@@ -0,0 +1,85 @@
+package goredis
+
+import (
+	"strconv"
+	"time"
+)
+
+/*
+Snapshot Export for Redis Clone
+
+EXPORT is the read side of IMPORT: it pages through a keyspace snapshot
+(see snapshot.go) and returns whole keys in the record format IMPORT
+takes, so goredis-export can dump the dataset as of one instant while
+other clients keep writing.
+
+Key concepts:
+- One Export per Connection: EXPORT 0 takes a snapshot and keeps it in
+  the connection's session; the cursor it returns continues that snapshot,
+  and 0 means it's done. A new EXPORT 0, RESET or disconnecting closes it
+- Cursor: The number of snapshot keys read so far; a cursor that isn't
+  the connection's current one is rejected, since the snapshot can't be
+  read out of order
+- Records: Each key comes back as its type, name, TTL in milliseconds
+  (-1 for none) and elements, which are the value of a string, the
+  elements of a list or set, or the field/value (hash) and member/score
+  (zset) pairs
+- MATCH: Filters each page, like SCAN's; the snapshot still covers every
+  key, so a page may come back short or empty before the export is over
+- Expiry: Keys whose TTL passes during the export are left out, since
+  they would expire as soon as they were imported
+*/
+
+/*
+exportDefaultCount is the number of snapshot keys read per EXPORT without COUNT
+*/
+const exportDefaultCount = 100
+
+/*
+exportRecord formats a snapshot entry as an EXPORT record, an array of
+type, key, TTL and elements
+
+Returns: The record, or nil if the key's TTL passed since the snapshot
+was taken
+*/
+func exportRecord(entry SnapshotEntry, now time.Time) []byte {
+	ttl := int64(-1)
+	if !entry.ExpireAt.IsZero() {
+		ttl = entry.ExpireAt.Sub(now).Milliseconds()
+		if ttl < 1 {
+			return nil
+		}
+	}
+
+	var elements [][]byte
+	switch value := entry.Value.(type) {
+	case []byte:
+		elements = [][]byte{value}
+	case [][]byte:
+		elements = value
+	case []string:
+		elements = make([][]byte, len(value))
+		for i, member := range value {
+			elements[i] = []byte(member)
+		}
+	case map[string][]byte:
+		elements = make([][]byte, 0, 2*len(value))
+		for field, fieldValue := range value {
+			elements = append(elements, []byte(field), fieldValue)
+		}
+	case []ScoredMember:
+		elements = make([][]byte, 0, 2*len(value))
+		for _, member := range value {
+			elements = append(elements, []byte(member.Member), formatScore(member.Score))
+		}
+	}
+
+	w := newPartsWriter(estimateArray(elements) + len(entry.Key) + 48)
+	w.writeString("*4\r\n")
+	w.writeBulk([]byte(entry.Type))
+	w.writeBulk([]byte(entry.Key))
+	w.writeString(":" + strconv.FormatInt(ttl, 10) + "\r\n")
+	w.writeArray(elements)
+	record, _ := joinParts(w.done(), nil)
+	return record
+}
@@ -0,0 +1,30 @@
+package goredis_test
+
+import (
+	"strings"
+	"testing"
+)
+
+/*
+extensionCases are commands Redis doesn't have, or answers differently,
+with the replies goredis gives
+
+They run like compatCases, in order on one connection.
+*/
+var extensionCases = []compatCase{
+	{[]string{"TTLSTATS", "extra"}, "-ERR wrong number of arguments for 'ttlstats' command\r\n"},
+	{[]string{"DEBUG", "DIAGNOSTICS"}, "+OK\r\n"},
+	// Redis answers every CLUSTER subcommand with an error when cluster support is off
+	{[]string{"CLUSTER", "HELP"}, "*5\r\n+CLUSTER <subcommand> [<arg> [value] [opt] ...]. Subcommands are:\r\n+KEYSLOT <key>\r\n+    Return the hash slot for <key>.\r\n+HELP\r\n+    Print this help.\r\n"},
+}
+
+func TestExtensions(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	for _, c := range extensionCases {
+		if got := client.do(c.args...); got != c.expected {
+			t.Errorf("%s\n expected %q\n got      %q", strings.Join(c.args, " "), c.expected, got)
+		}
+	}
+}
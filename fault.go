@@ -0,0 +1,208 @@
+package goredis
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Fault Injection for Redis Clone
+
+Applications using the server as a cache should survive it being slow,
+failing or dropping the connection. DEBUG FAULT lets a test suite make
+that happen on demand: a fault is attached to a command name and then
+disturbs every call of that command, or a random share of them.
+
+Key concepts:
+- Actions: DELAY holds the command back before running it, DROP
+  neither runs it nor replies (a lost request), ERROR replies with an
+  error instead of running it, PARTIAL runs it but sends only half of the
+  reply before closing the connection (a connection lost mid-reply)
+- Rate: A fault fires on the given percentage of calls, picked at random
+- Server Wide: Faults apply to every client, are kept until cleared and
+  are only touched by the server loop; DEBUG itself can't be faulted, so
+  the faults can always be cleared, and neither can QUIT
+- Delay Only Slows Its Client: A delayed command parks its client like a
+  blocking command does (see blocking.go) and a timer brings it back to
+  the server loop; other clients carry on meanwhile, and the commands the
+  client pipelined behind it wait their turn, so replies stay in order.
+  Delays are capped at faultMaxDelay
+- No Persistence Faults: The server keeps nothing on disk, so there is no
+  persistence path to slow down; only commands can be faulted
+*/
+
+/*
+faultMaxDelay is the longest delay DEBUG FAULT SET accepts
+*/
+const faultMaxDelay = time.Minute
+
+/*
+faultAction says how an injected fault disturbs a command
+*/
+type faultAction int
+
+const (
+	faultDelay   faultAction = iota // hold the command back, then run it
+	faultDrop                       // don't run the command and don't reply
+	faultError                      // reply with an error instead of running the command
+	faultPartial                    // run the command, send half the reply and disconnect
+)
+
+/*
+fault is an injected fault for one command name
+*/
+type fault struct {
+	action  faultAction
+	delay   time.Duration // for faultDelay
+	message string        // the error reply for faultError, code included
+	rate    int           // percentage of calls affected, 1 to 100
+}
+
+/*
+String describes the fault the way DEBUG FAULT SET takes it, e.g. "DELAY 100 RATE 50"
+*/
+func (f fault) String() string {
+	var desc string
+	switch f.action {
+	case faultDelay:
+		desc = "DELAY " + strconv.FormatInt(f.delay.Milliseconds(), 10)
+	case faultDrop:
+		desc = "DROP"
+	case faultError:
+		desc = "ERROR " + f.message
+	case faultPartial:
+		desc = "PARTIAL"
+	}
+	return desc + " RATE " + strconv.Itoa(f.rate)
+}
+
+/*
+faultFor returns the fault to inject into a command, if any fires
+
+Returns: The fault and true if the command named by args[0] has a fault
+and this call was picked to suffer it
+*/
+func (s *Server) faultFor(args [][]byte) (fault, bool) {
+	if len(s.faults) == 0 {
+		return fault{}, false
+	}
+
+	f, ok := s.faults[strings.ToUpper(string(args[0]))]
+	if !ok || (f.rate < 100 && rand.IntN(100) >= f.rate) {
+		return fault{}, false
+	}
+	return f, true
+}
+
+/*
+setFault injects f into every later call of the command name
+*/
+func (s *Server) setFault(name string, f fault) {
+	if s.faults == nil {
+		s.faults = make(map[string]fault)
+	}
+	s.faults[name] = f
+}
+
+/*
+clearFaults removes the fault of the command name, or every fault if name is empty
+
+Returns: How many faults were removed
+*/
+func (s *Server) clearFaults(name string) int {
+	if name == "" {
+		n := len(s.faults)
+		clear(s.faults)
+		return n
+	}
+	if _, ok := s.faults[name]; !ok {
+		return 0
+	}
+	delete(s.faults, name)
+	return 1
+}
+
+/*
+listFaults describes every injected fault, one "<command> <fault>" line each, sorted by command
+*/
+func (s *Server) listFaults() [][]byte {
+	names := make([]string, 0, len(s.faults))
+	for name := range s.faults {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	lines := make([][]byte, len(names))
+	for i, name := range names {
+		lines[i] = []byte(name + " " + s.faults[name].String())
+	}
+	return lines
+}
+
+/*
+delayMessage holds a command back for delay, then runs it on the server loop
+
+Its client is parked meanwhile, so the commands it sends later wait behind it.
+*/
+func (s *Server) delayMessage(msg Message, delay time.Duration) {
+	s.delayed[msg.peer] = false
+	s.scheduler.park(msg.peer)
+
+	time.AfterFunc(delay, func() {
+		select {
+		case s.delayedChannel <- msg:
+		case <-s.quitChannel:
+		}
+	})
+}
+
+/*
+runDelayed runs a command whose delay is over, and gives its client its turn back
+
+Called by the server loop. A client that disconnected meanwhile gets its
+remaining commands run, as on any disconnect.
+*/
+func (s *Server) runDelayed(msg Message) {
+	peer := msg.peer
+	gone := s.delayed[peer]
+	delete(s.delayed, peer)
+
+	if err := s.executeMessage(msg, false); err != nil {
+		slog.Error("message handling error", "err", err)
+	}
+	s.serveBlocked()
+
+	switch {
+	case gone:
+		s.disconnected(peer)
+	case !s.blocking.isBlocked(peer):
+		s.scheduler.resume(peer)
+	}
+}
+
+/*
+disconnected drops what the server kept for a client that disconnected
+
+Called by the server loop. The commands the client queued still run, up to
+one that holds it; a delayed one finishes the job when its delay is over.
+*/
+func (s *Server) disconnected(peer *Peer) {
+	s.drainInbox(peer)
+	if _, delayed := s.delayed[peer]; delayed {
+		s.delayed[peer] = true
+	}
+	s.resetSession(peer)
+}
+
+/*
+held reports whether a client waits for something before its next command
+runs: data for a blocking command, or the end of a delay
+*/
+func (s *Server) held(peer *Peer) bool {
+	_, delayed := s.delayed[peer]
+	return delayed || s.blocking.isBlocked(peer)
+}
@@ -0,0 +1,70 @@
+package goredis_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFaultDelayOnlyHoldsItsClient(t *testing.T) {
+	server := startServer(t, nil)
+	slow := dial(t, server)
+	other := dial(t, server)
+
+	slow.expect("+OK\r\n", "DEBUG", "FAULT", "SET", "GET", "DELAY", "300")
+	slow.expect("+OK\r\n", "SET", "greeting", "hello")
+
+	// The delayed GET and the PING pipelined behind it answer in order, after the delay
+	start := time.Now()
+	slow.send("GET", "greeting")
+	slow.send("PING")
+
+	// Meanwhile another client is served at once
+	other.expect("+PONG\r\n", "PING")
+	other.expect("+OK\r\n", "SET", "greeting", "bye")
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("other client waited %v for the delayed one", elapsed)
+	}
+
+	// The GET runs after its delay, so it sees the write made meanwhile
+	if got := slow.read(); got != "$3\r\nbye\r\n" {
+		t.Errorf("delayed GET got %q, want %q", got, "$3\r\nbye\r\n")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("delayed GET answered after %v, want at least 300ms", elapsed)
+	}
+	if got := slow.read(); got != "+PONG\r\n" {
+		t.Errorf("PING behind the delayed GET got %q", got)
+	}
+}
+
+func TestFaultDelayIsCapped(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	client.expect("+OK\r\n", "DEBUG", "FAULT", "SET", "GET", "DELAY", "60000")
+	client.expect("-ERR value is out of range\r\n", "DEBUG", "FAULT", "SET", "GET", "DELAY", "60001")
+	client.expect("-ERR value is out of range\r\n", "DEBUG", "FAULT", "SET", "GET", "DELAY", "9223372036854775807")
+	client.expect("*1\r\n$24\r\nGET DELAY 60000 RATE 100\r\n", "DEBUG", "FAULT", "LIST")
+}
+
+func TestFaultDelayClientDisconnects(t *testing.T) {
+	server := startServer(t, nil)
+	slow := dial(t, server)
+	other := dial(t, server)
+
+	// The commands of a client gone while delayed still run once the delay is over
+	slow.expect("+OK\r\n", "DEBUG", "FAULT", "SET", "INCR", "DELAY", "100")
+	slow.send("INCR", "counter")
+	slow.send("SET", "after", "yes")
+	slow.conn.Close()
+
+	other.expect(":1\r\n", "DEBUG", "FAULT", "CLEAR")
+	deadline := time.Now().Add(5 * time.Second)
+	for other.do("GET", "after") != "$3\r\nyes\r\n" {
+		if time.Now().After(deadline) {
+			t.Fatal("the commands queued behind the delayed one never ran")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	other.expect("$1\r\n1\r\n", "GET", "counter")
+}
@@ -1,5 +1,3 @@
 module github.com/debarshee2004/goredis
 
 go 1.23.6
-
-require github.com/tidwall/resp v0.1.1
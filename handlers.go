@@ -1,10 +1,9 @@
-package main
+package goredis
 
 import (
-	"fmt"
+	"bytes"
 	"log/slog"
-
-	"github.com/tidwall/resp"
+	"net"
 )
 
 /*
@@ -32,15 +31,18 @@ handleMessage processes incoming command messages from clients
 This is the central message processing function that gets called whenever
 a client sends a command to the server. It follows this flow:
 
-1. Execute the command using the storage engine
-2. Handle any execution errors by sending error responses
-3. Format successful results according to RESP protocol
-4. Send the response back to the client
-5. Log any communication errors
+1. Apply a fault injected with DEBUG FAULT, if any
+2. Execute the command through the middleware chain (see dispatch)
+3. Turn execution errors into error responses
+4. Format successful results according to RESP protocol
+5. Send the response back to the client
+6. Log any communication errors
 
 The function must handle different types of command results:
   - Simple values (strings, numbers)
   - Complex RESP-formatted data (arrays, maps)
+  - Large replies built in parts (see replies.go)
+  - Huge replies streamed as they are written (see streaming.go)
   - Null responses (when keys don't exist)
   - Error conditions
 
@@ -50,129 +52,192 @@ Parameters:
 Returns: error if there was a communication problem (not command errors)
 
 Error Handling Philosophy:
-  - Command errors (like "key not found") are sent to the client as RESP errors
-  - Communication errors (network issues) are returned as Go errors
+  - Command errors (like a wrong type or a syntax error) are sent to the client as RESP errors
+  - Communication errors (the client is already gone) are returned as Go errors
   - This separation allows the server to stay running even when individual commands fail
 */
 func (s *Server) handleMessage(msg Message) error {
-	/*
-		Execute the command using the storage engine
-		This calls the Execute method on the Command interface
-		The storage engine performs the actual operation (GET, SET, etc.)
-	*/
-	result, err := msg.cmd.Execute(s.storage)
+	// A command that failed to parse only gets its error, in order with the replies before it
+	if msg.err != nil {
+		return msg.peer.Send(respWriteError(msg.err.Error()))
+	}
+
+	s.stats.commandsProcessed.Add(1)
+
+	// A client in subscribed mode may only run a few commands
+	if reply, handled := s.subscribedModeReply(msg); handled {
+		return msg.peer.Send(reply)
+	}
+
+	// A fault injected with DEBUG FAULT may delay, drop or fail the command (see fault.go)
+	fault, faulty := s.faultFor(msg.args)
+	if faulty {
+		switch fault.action {
+		case faultDelay:
+			s.delayMessage(msg, fault.delay)
+			return nil
+		case faultDrop:
+			return nil
+		case faultError:
+			return msg.peer.Send(respWriteError(fault.message))
+		}
+	}
+
+	return s.executeMessage(msg, faulty && fault.action == faultPartial)
+}
+
+/*
+executeMessage runs a command and sends its reply, the part of
+handleMessage after faults are applied
 
+Parameters:
+  - msg: The command and the peer that sent it
+  - partial: A PARTIAL fault fired, so only half the reply is sent before disconnecting
+
+Returns: error if there was a communication problem (not command errors)
+*/
+func (s *Server) executeMessage(msg Message, partial bool) error {
 	/*
-		Handle command execution errors
-		These are logical errors like "key not found" or "wrong type"
-		They should be reported to the client, not crash the server
+		Run the command through the middleware chain (see middleware.go)
+		Without middleware the handler is dispatch itself
 	*/
-	if err != nil {
+	req := &Request{args: msg.args, cmd: msg.cmd, peer: msg.peer}
+	result, err := s.handler(req)
+	if req.blocked {
+		// The reply is sent when the client is served or times out
+		return nil
+	}
+
+	var reply []byte
+	var buffered bool // reply was framed in the peer's output buffer (see outputbuffer.go)
+	var parts net.Buffers
+	var stream replyStream
+	switch {
+	case err != nil:
 		/*
-			Format error message according to Redis conventions
-			Redis error messages start with "ERR " followed by the description
+			Handle command execution errors
+			These are logical errors like "wrong type" or "not an integer"
+			They should be reported to the client, not crash the server
+			RESP errors start with "-" and end with "\r\n"
+			Errors already carry their Redis error code (see errors.go),
+			so they are sent unchanged
 		*/
-		errorMsg := fmt.Sprintf("ERR %s", err.Error())
+		text := err.Error()
+		reply, buffered = msg.peer.out.alloc(len(text) + 3)
+		reply = appendError(reply, text)
 
+	case req.parts != nil:
 		/*
-			Send error response to client using RESP protocol
-			RESP errors start with "-" and end with "\r\n"
+			Send a large reply in parts, written with one vectored write
+			Only dispatch sets them, when no middleware needs the reply whole
 		*/
-		if writeErr := resp.NewWriter(msg.peer.connect).WriteError(fmt.Errorf(errorMsg)); writeErr != nil {
-			slog.Error("failed to write error response", "err", writeErr)
-			return writeErr
-		}
-		return nil
-	}
+		parts = req.parts
 
-	/*
-		Send successful response to client
-		The response format depends on what the command returned
-	*/
-	if result != nil {
+	case req.stream != nil:
 		/*
-			Check if result is already formatted as RESP data
-			Some commands (like MGET, KEYS) return pre-formatted RESP responses
-			Others return raw data that needs to be wrapped in RESP format
+			Stream a huge reply, produced a chunk at a time as it's written
+			Also only set by dispatch (see streaming.go)
 		*/
-		if isRESPFormatted(result) {
-			/*
-				Send raw RESP data directly to client
-				This is used for complex responses like arrays and maps
-			*/
-			_, writeErr := msg.peer.Send(result)
-			if writeErr != nil {
-				slog.Error("failed to send RESP response", "err", writeErr)
-				return writeErr
-			}
-		} else {
-			/*
-				Send as bulk string (most common case)
-				RESP bulk strings: $<length>\r\n<data>\r\n
-				Example: $5\r\nhello\r\n for the string "hello"
-			*/
-			if writeErr := resp.NewWriter(msg.peer.connect).WriteBytes(result); writeErr != nil {
-				slog.Error("failed to write bulk response", "err", writeErr)
-				return writeErr
-			}
-		}
-	} else {
+		stream = req.stream
+
+	case result == nil:
 		/*
 			Send null response for commands that return nil
 			This happens when GET is called on a non-existent key
-			RESP null: $-1\r\n
+			RESP2 null: $-1\r\n, RESP3 null: _\r\n
+		*/
+		reply = respNullFor(msg.peer.session.protocol)
+
+	default:
+		/*
+			Send the reply as is
+			Commands return complete RESP replies, framed by the respWrite
+			helpers; the reply type is never guessed from the data, since a
+			stored value may start with any byte
 		*/
-		if writeErr := resp.NewWriter(msg.peer.connect).WriteNull(); writeErr != nil {
-			slog.Error("failed to write null response", "err", writeErr)
-			return writeErr
+		reply = result
+	}
+
+	// A PARTIAL fault loses the connection halfway through the reply
+	if partial {
+		if parts != nil {
+			reply = bytes.Join(parts, nil)
 		}
+		if stream != nil {
+			reply, _ = joinStream(stream, nil)
+		}
+		msg.peer.send(reply[:len(reply)/2], buffered)
+		msg.peer.Close()
+		return nil
+	}
+
+	var writeErr error
+	if parts != nil {
+		writeErr = msg.peer.SendParts(parts)
+	} else if stream != nil {
+		writeErr = msg.peer.SendStream(stream)
+	} else {
+		writeErr = msg.peer.send(reply, buffered)
+	}
+	if writeErr != nil {
+		slog.Error("failed to send response", "err", writeErr)
+		return writeErr
+	}
+
+	/*
+		QUIT closes the connection once its OK reply is written.
+		Close flushes queued replies before closing the socket.
+	*/
+	if _, ok := msg.cmd.(QuitCommand); ok {
+		msg.peer.Close()
 	}
 
 	return nil
 }
 
 /*
-isRESPFormatted checks if the byte slice contains RESP formatted data
-
-RESP (Redis Serialization Protocol) uses specific prefix characters to indicate
-data types. This function checks if data is already in RESP format so we know
-whether to send it directly or wrap it in a bulk string.
-
-RESP Data Type Prefixes:
-  - '+' Simple String: +OK\r\n
-  - '-' Error: -ERR something went wrong\r\n
-  - ':' Integer: :42\r\n
-  - '$' Bulk String: $5\r\nhello\r\n
-  - '*' Array: *2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n
-  - '%' Map: %2\r\n+key1\r\n+value1\r\n+key2\r\n+value2\r\n (Redis 6.0+)
-
-Parameters:
-  - data: The byte slice to check
-
-Returns: true if data starts with a RESP prefix character, false otherwise
+dispatch executes a request; it's the last handler of the middleware chain
+
+Commands that work on the connection itself get the server and peer
+instead of the storage. Commands with large replies leave them in parts
+on the request when no middleware is registered (see replies.go), and
+commands with huge ones leave them as streams (see streaming.go).
+Blocking commands may park the client instead of replying (see
+blocking.go). A successful write is reported to the change data capture
+handlers.
+*/
+func (s *Server) dispatch(req *Request) ([]byte, error) {
+	// In cluster mode, multi-key commands must stay within one slot
+	if err := s.checkSlots(req.cmd); err != nil {
+		return nil, err
+	}
 
-Usage Examples:
-  - isRESPFormatted([]byte("+OK\r\n")) -> true (simple string)
-  - isRESPFormatted([]byte("hello")) -> false (raw data, needs bulk string wrapper)
-  - isRESPFormatted([]byte("*2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n")) -> true (array)
+	// Out of memory, commands that would use more are rejected (see maxmemory.go)
+	if err := s.checkMemory(req.cmd); err != nil {
+		return nil, err
+	}
 
-Why This Matters:
-  - Pre-formatted RESP data should be sent as-is to maintain correct protocol structure
-  - Raw data needs to be wrapped in bulk string format for protocol compliance
-  - Mixing formatted and unformatted data would break the RESP protocol
-*/
-func isRESPFormatted(data []byte) bool {
-	// Empty data is not considered RESP formatted
-	if len(data) == 0 {
-		return false
+	/*
+		Execute the command using the storage engine
+		This calls the Execute method on the Command interface
+		The storage engine performs the actual operation (GET, SET, etc.)
+	*/
+	var result []byte
+	var err error
+	if cmd, ok := req.cmd.(peerCommand); ok {
+		result, err = cmd.ExecutePeer(s, req.peer)
+	} else if cmd, ok := req.cmd.(blockingCommand); ok {
+		result, err = s.executeBlocking(cmd, req)
+	} else if cmd, ok := req.cmd.(streamCommand); ok && len(s.middleware) == 0 {
+		req.stream, err = cmd.ExecuteStream(s.storage)
+	} else if cmd, ok := req.cmd.(partsCommand); ok && len(s.middleware) == 0 {
+		req.parts, err = cmd.ExecuteParts(s.storage)
+	} else {
+		result, err = req.cmd.Execute(s.storage)
 	}
 
-	// Check first character against known RESP prefixes
-	firstChar := data[0]
-	return firstChar == '+' ||
-		firstChar == '-' ||
-		firstChar == ':' ||
-		firstChar == '$' ||
-		firstChar == '*' ||
-		firstChar == '%'
+	if err == nil && !req.blocked {
+		s.emitChanges(req)
+	}
+	return result, err
 }
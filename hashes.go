@@ -0,0 +1,388 @@
+package goredis
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+/*
+Hash Storage for Redis Clone
+
+This file implements the hash type: a map of fields to values stored under
+one key, typically used to represent an object. It adds the hash operations
+to Storage; the commands using them live in commands.go.
+
+Key concepts:
+- Fields: Each field name is unique within its hash; values are binary-safe
+- Field Counters: HINCRBY treats a field value as a 64-bit integer
+- No Empty Hashes: A hash that loses its last field is deleted, like in Redis
+- Field TTLs: Fields may expire on their own (see hashttl.go); reads skip
+  expired fields and writes delete them first
+*/
+
+/*
+hashValue is the value of a hash key
+
+It's stored by pointer in the entry so operations can modify it in place.
+*/
+type hashValue struct {
+	fields  map[string][]byte
+	expires map[string]int64 // Unix nanoseconds at which fields with a TTL expire, nil if none has one
+}
+
+/*
+newHashValue creates an empty hash
+*/
+func newHashValue() *hashValue {
+	return &hashValue{fields: make(map[string][]byte)}
+}
+
+/*
+hashOf returns the hash held by an entry
+
+Returns: nil for a missing entry, ErrWrongType if the entry holds another type
+*/
+func hashOf(e *entry) (*hashValue, error) {
+	if e == nil {
+		return nil, nil
+	}
+	h, ok := e.value.(*hashValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return h, nil
+}
+
+/*
+writeHash returns the hash at key for modification, creating it when missing
+
+Must be called with the write lock held. Expired fields are deleted first.
+*/
+func (s *Storage) writeHash(keyStr string) (*hashValue, *entry, error) {
+	e := s.lookupWrite(keyStr)
+	h, err := hashOf(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h != nil && s.expireFields(h, time.Now().UnixNano()) > 0 && len(h.fields) == 0 {
+		s.expire(keyStr)
+		h = nil
+	}
+	if h == nil {
+		h = newHashValue()
+		e = newEntry(h)
+		s.putEntry(keyStr, e)
+	}
+	e.touch()
+	return h, e, nil
+}
+
+/*
+HSet sets one or more fields of a hash, creating the hash when missing
+
+Implements Redis HSET. The pairs alternate field and value; when a field
+appears twice the last value wins.
+
+Returns: The number of fields that were created (updated fields don't count)
+*/
+func (s *Storage) HSet(key []byte, pairs [][]byte) (int, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, err
+	}
+	if err := s.checkElements(pairs...); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	if err := s.checkMembersAdded(keyStr, TypeHash, len(pairs)/2, func(i int) string { return string(pairs[2*i]) }); err != nil {
+		return 0, err
+	}
+	h, _, err := s.writeHash(keyStr)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		field := string(pairs[i])
+		if _, exists := h.fields[field]; !exists {
+			created++
+		}
+		h.fields[field] = ownBytes(pairs[i+1])
+		h.persistField(field)
+	}
+	s.changed(keyStr)
+	return created, nil
+}
+
+/*
+HSetNX sets a hash field only if it doesn't exist yet
+
+Implements Redis HSETNX.
+
+Returns: true if the field was set, false if it already existed
+*/
+func (s *Storage) HSetNX(key, field, value []byte) (bool, error) {
+	if err := s.checkKey(key); err != nil {
+		return false, err
+	}
+	if err := s.checkElements(field, value); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	if err := s.checkMembersAdded(keyStr, TypeHash, 1, func(int) string { return string(field) }); err != nil {
+		return false, err
+	}
+	h, _, err := s.writeHash(keyStr)
+	if err != nil {
+		return false, err
+	}
+
+	fieldStr := string(field)
+	if _, exists := h.fields[fieldStr]; exists {
+		return false, nil
+	}
+	h.fields[fieldStr] = ownBytes(value)
+	s.changed(keyStr)
+	return true, nil
+}
+
+/*
+HGet returns the value of a hash field
+
+Implements Redis HGET.
+
+Returns: The value, and false if the key or the field doesn't exist
+*/
+func (s *Storage) HGet(key, field []byte) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	h, err := hashOf(e)
+	if err != nil || h == nil {
+		return nil, false, err
+	}
+	e.touch()
+
+	fieldStr := string(field)
+	if h.fieldExpired(fieldStr, time.Now().UnixNano()) {
+		return nil, false, nil
+	}
+	value, exists := h.fields[fieldStr]
+	return s.readBytes(value), exists, nil
+}
+
+/*
+HMGet returns the values of several hash fields
+
+Implements Redis HMGET. Missing fields (and every field of a missing key)
+come back as nil, in the same position as the requested field.
+*/
+func (s *Storage) HMGet(key []byte, fields [][]byte) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	h, err := hashOf(e)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(fields))
+	if h == nil {
+		return values, nil
+	}
+	e.touch()
+
+	now := time.Now().UnixNano()
+	for i, field := range fields {
+		if fieldStr := string(field); !h.fieldExpired(fieldStr, now) {
+			values[i] = h.fields[fieldStr]
+		}
+	}
+	return s.readSlices(values), nil
+}
+
+/*
+HDel removes fields from a hash
+
+Implements Redis HDEL. The key is deleted once the hash is empty.
+
+Returns: The number of fields that existed and were removed
+*/
+func (s *Storage) HDel(key []byte, fields [][]byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	h, err := hashOf(e)
+	if err != nil || h == nil {
+		return 0, err
+	}
+	s.expireFields(h, time.Now().UnixNano())
+
+	deleted := 0
+	for _, field := range fields {
+		fieldStr := string(field)
+		if _, exists := h.fields[fieldStr]; exists {
+			delete(h.fields, fieldStr)
+			h.persistField(fieldStr)
+			deleted++
+		}
+	}
+
+	s.deleteIfEmptyHash(keyStr, h)
+	e.touch()
+	if deleted > 0 {
+		s.changed(keyStr)
+	}
+	return deleted, nil
+}
+
+/*
+HGetAll returns every field and value of a hash
+
+Implements Redis HGETALL. The result alternates field and value, in no
+particular order. Missing keys are empty hashes.
+*/
+func (s *Storage) HGetAll(key []byte) ([][]byte, error) {
+	fields, values, err := s.hashEntries(key)
+	result := make([][]byte, 0, len(fields)*2)
+	for i, field := range fields {
+		result = append(result, []byte(field), s.readBytes(values[i]))
+	}
+	return result, err
+}
+
+/*
+hashEntries is HGetAll returning the fields and the stored values
+themselves, whatever SetCopyOnRead says; the caller must not modify them
+*/
+func (s *Storage) hashEntries(key []byte) ([]string, [][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	h, err := hashOf(e)
+	if err != nil || h == nil {
+		return nil, nil, err
+	}
+	e.touch()
+
+	now := time.Now().UnixNano()
+	fields := make([]string, 0, len(h.fields))
+	values := make([][]byte, 0, len(h.fields))
+	for field, value := range h.fields {
+		if h.fieldExpired(field, now) {
+			continue
+		}
+		fields = append(fields, field)
+		values = append(values, value)
+	}
+	return fields, values, nil
+}
+
+/*
+HLen returns the number of fields in a hash
+
+Implements Redis HLEN. Missing keys count as empty hashes.
+*/
+func (s *Storage) HLen(key []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h, err := hashOf(s.lookupRead(string(key)))
+	if err != nil || h == nil {
+		return 0, err
+	}
+	return h.liveLen(time.Now().UnixNano()), nil
+}
+
+/*
+HExists reports whether a hash has a field
+
+Implements Redis HEXISTS.
+*/
+func (s *Storage) HExists(key, field []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h, err := hashOf(s.lookupRead(string(key)))
+	if err != nil || h == nil {
+		return false, err
+	}
+
+	fieldStr := string(field)
+	_, exists := h.fields[fieldStr]
+	return exists && !h.fieldExpired(fieldStr, time.Now().UnixNano()), nil
+}
+
+/*
+HIncrBy increments the integer value of a hash field
+
+Implements Redis HINCRBY. A missing key or field counts as 0. The field
+value must be a 64-bit integer in its canonical decimal form.
+
+Returns: The new value, errHashNotInteger if the field isn't an integer,
+or errOverflow if the result would overflow a 64-bit integer
+*/
+func (s *Storage) HIncrBy(key, field []byte, increment int64) (int64, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, err
+	}
+	if err := s.checkElements(field); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	if err := s.checkMembersAdded(keyStr, TypeHash, 1, func(int) string { return string(field) }); err != nil {
+		return 0, err
+	}
+	h, _, err := s.writeHash(keyStr)
+	if err != nil {
+		return 0, err
+	}
+
+	fieldStr := string(field)
+	var current int64
+	if value, exists := h.fields[fieldStr]; exists {
+		current, err = strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return 0, errHashNotInteger
+		}
+	}
+
+	if (increment > 0 && current > math.MaxInt64-increment) ||
+		(increment < 0 && current < math.MinInt64-increment) {
+		return 0, errOverflow
+	}
+	current += increment
+
+	h.fields[fieldStr] = []byte(strconv.FormatInt(current, 10))
+	s.changed(keyStr)
+	return current, nil
+}
+
+/*
+deleteIfEmptyHash removes a hash key once its last field is gone
+
+Must be called with the write lock held.
+*/
+func (s *Storage) deleteIfEmptyHash(keyStr string, h *hashValue) {
+	if len(h.fields) == 0 {
+		s.deleteEntry(keyStr)
+	}
+}
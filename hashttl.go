@@ -0,0 +1,348 @@
+package goredis
+
+import "time"
+
+/*
+Hash Field Expiration for Redis Clone
+
+Like Redis 7.4, single fields of a hash can have a TTL of their own, so a
+hash holding, say, the sessions of a user can drop each session on time
+without a key per session. HEXPIRE and HPEXPIRE set it, HTTL and HPTTL
+report it and HPERSIST removes it.
+
+Key concepts:
+- Per Field: A hash keeps the expiration times of its fields with a TTL
+  next to their values; the key's own TTL is separate and still removes
+  the whole hash
+- Lazy: Reads skip fields whose TTL passed, and writes to the hash delete
+  them first; a hash left without fields is deleted, like any empty hash
+- Active: The active expire cycle (see expire.go) also samples the fields
+  of hashes with field TTLs and deletes the expired ones, so fields nobody
+  touches don't stay in memory
+- Overwrites: HSET on a field drops its TTL, like SET does for keys;
+  HINCRBY keeps it
+- Replies: One integer per field: -2 for a missing field (or key), and
+  for HEXPIRE 0 when the condition (NX, XX, GT or LT) failed, 1 when the
+  TTL was set and 2 when the time was already past and the field deleted
+- Statistics: Expired fields count in INFO stats as expired_subkeys
+*/
+
+/*
+fieldExpireCondition is the NX, XX, GT or LT option of HEXPIRE
+*/
+type fieldExpireCondition int
+
+const (
+	fieldExpireAlways fieldExpireCondition = iota // no option: always set the TTL
+	fieldExpireNX                                 // only fields without a TTL
+	fieldExpireXX                                 // only fields with a TTL
+	fieldExpireGT                                 // only a later expiration; no TTL counts as never
+	fieldExpireLT                                 // only an earlier expiration; no TTL counts as never
+)
+
+/*
+Reply codes of the hash field TTL commands
+*/
+const (
+	fieldNotFound   = -2 // the field (or the key) doesn't exist
+	fieldNoTTL      = -1 // HTTL, HPERSIST: the field has no TTL
+	fieldNotSet     = 0  // HEXPIRE: the condition failed
+	fieldTTLSet     = 1  // HEXPIRE: the TTL was set; HPERSIST: it was removed
+	fieldTTLExpired = 2  // HEXPIRE: the time was already past, the field was deleted
+)
+
+/*
+maxFieldExpireAt is the latest expiration time, in Unix milliseconds, a
+field can have; field expirations are kept in nanoseconds like keys'
+*/
+const maxFieldExpireAt = int64(1<<63-1) / int64(time.Millisecond)
+
+/*
+fieldExpired reports whether a field of the hash has a TTL that passed
+*/
+func (h *hashValue) fieldExpired(field string, now int64) bool {
+	at, ok := h.expires[field]
+	return ok && at <= now
+}
+
+/*
+liveLen returns the number of fields whose TTL didn't pass
+*/
+func (h *hashValue) liveLen(now int64) int {
+	n := len(h.fields)
+	for _, at := range h.expires {
+		if at <= now {
+			n--
+		}
+	}
+	return n
+}
+
+/*
+persistField drops the TTL of a field, if it has one
+*/
+func (h *hashValue) persistField(field string) {
+	if len(h.expires) == 0 {
+		return
+	}
+	delete(h.expires, field)
+	if len(h.expires) == 0 {
+		h.expires = nil
+	}
+}
+
+/*
+expireFields deletes the fields of a hash whose TTL passed
+
+Must be called with the write lock held, after lookupWrite (so open
+snapshots saved the hash). The caller deletes the hash if it's left empty.
+
+Returns: The number of fields deleted
+*/
+func (s *Storage) expireFields(h *hashValue, now int64) int {
+	expired := 0
+	for field, at := range h.expires {
+		if at <= now {
+			delete(h.fields, field)
+			delete(h.expires, field)
+			expired++
+		}
+	}
+	if expired > 0 && len(h.expires) == 0 {
+		h.expires = nil
+	}
+	s.expiredFields += int64(expired)
+	return expired
+}
+
+/*
+writableHash returns the hash at key for a field TTL command, with its
+expired fields deleted
+
+Must be called with the write lock held.
+
+Returns: nil if the key is missing or only held expired fields,
+ErrWrongType if it holds another type
+*/
+func (s *Storage) writableHash(keyStr string) (*hashValue, error) {
+	h, err := hashOf(s.lookupWrite(keyStr))
+	if err != nil || h == nil {
+		return nil, err
+	}
+	if s.expireFields(h, time.Now().UnixNano()) > 0 && len(h.fields) == 0 {
+		s.expire(keyStr)
+		return nil, nil
+	}
+	return h, nil
+}
+
+/*
+HExpire sets the expiration time of hash fields
+
+Implements Redis HEXPIRE and HPEXPIRE. A time already past deletes the
+fields right away, and the hash with them if it's left empty.
+
+Returns: One reply code per field (see the constants above)
+*/
+func (s *Storage) HExpire(key []byte, fields [][]byte, expireAt time.Time, cond fieldExpireCondition) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	codes := make([]int64, len(fields))
+	h, err := s.writableHash(keyStr)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		for i := range codes {
+			codes[i] = fieldNotFound
+		}
+		return codes, nil
+	}
+
+	at := expireAt.UnixNano()
+	now := time.Now().UnixNano()
+	changed := false
+	for i, field := range fields {
+		fieldStr := string(field)
+		if _, exists := h.fields[fieldStr]; !exists {
+			codes[i] = fieldNotFound
+			continue
+		}
+
+		current, hasTTL := h.expires[fieldStr]
+		ok := true
+		switch cond {
+		case fieldExpireNX:
+			ok = !hasTTL
+		case fieldExpireXX:
+			ok = hasTTL
+		case fieldExpireGT:
+			ok = hasTTL && at > current
+		case fieldExpireLT:
+			ok = !hasTTL || at < current
+		}
+		if !ok {
+			codes[i] = fieldNotSet
+			continue
+		}
+
+		changed = true
+		if at <= now {
+			delete(h.fields, fieldStr)
+			h.persistField(fieldStr)
+			codes[i] = fieldTTLExpired
+			continue
+		}
+		if h.expires == nil {
+			h.expires = make(map[string]int64)
+		}
+		h.expires[fieldStr] = at
+		s.hashesWithTTL[keyStr] = struct{}{}
+		codes[i] = fieldTTLSet
+	}
+
+	s.deleteIfEmptyHash(keyStr, h)
+	if changed {
+		s.changed(keyStr)
+	}
+	return codes, nil
+}
+
+/*
+HPTTL returns the time hash fields have left, in milliseconds
+
+Implements Redis HTTL and HPTTL; HTTL rounds the milliseconds up to seconds.
+
+Returns: One value per field: the milliseconds left, fieldNoTTL or
+fieldNotFound
+*/
+func (s *Storage) HPTTL(key []byte, fields [][]byte) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h, err := hashOf(s.lookupRead(string(key)))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	ttls := make([]int64, len(fields))
+	for i, field := range fields {
+		fieldStr := string(field)
+		if h == nil || h.fieldExpired(fieldStr, now) {
+			ttls[i] = fieldNotFound
+			continue
+		}
+		if _, exists := h.fields[fieldStr]; !exists {
+			ttls[i] = fieldNotFound
+			continue
+		}
+		at, hasTTL := h.expires[fieldStr]
+		if !hasTTL {
+			ttls[i] = fieldNoTTL
+			continue
+		}
+		ttls[i] = (at - now) / int64(time.Millisecond)
+	}
+	return ttls, nil
+}
+
+/*
+HPersist removes the TTL of hash fields
+
+Implements Redis HPERSIST.
+
+Returns: One reply code per field: fieldTTLSet if the TTL was removed,
+fieldNoTTL or fieldNotFound
+*/
+func (s *Storage) HPersist(key []byte, fields [][]byte) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	codes := make([]int64, len(fields))
+	h, err := s.writableHash(keyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for i, field := range fields {
+		fieldStr := string(field)
+		if h == nil {
+			codes[i] = fieldNotFound
+			continue
+		}
+		if _, exists := h.fields[fieldStr]; !exists {
+			codes[i] = fieldNotFound
+			continue
+		}
+		if _, hasTTL := h.expires[fieldStr]; !hasTTL {
+			codes[i] = fieldNoTTL
+			continue
+		}
+		h.persistField(fieldStr)
+		codes[i] = fieldTTLSet
+		changed = true
+	}
+
+	if changed {
+		s.changed(keyStr)
+	}
+	return codes, nil
+}
+
+/*
+activeExpireFieldsRound samples fields of hashes with field TTLs once and
+deletes the expired ones
+
+Hashes that no longer have field TTLs (deleted, overwritten or persisted
+since) are dropped from the candidates as they're found. A hash left
+without fields is deleted, counted as an expired key, with HookExpire;
+one that keeps fields fires HookWrite.
+
+Returns: How many fields with a TTL were sampled and how many were deleted
+*/
+func (s *Storage) activeExpireFieldsRound() (sampled, expired int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	for keyStr := range s.hashesWithTTL {
+		if sampled >= activeExpireSample {
+			break
+		}
+		e := s.entries[keyStr]
+		h, _ := hashOf(e)
+		if h == nil || len(h.expires) == 0 || e.expired(now) {
+			// Expired keys are left to the keys' own rounds
+			delete(s.hashesWithTTL, keyStr)
+			continue
+		}
+
+		due := false
+		for _, at := range h.expires {
+			if sampled >= activeExpireSample {
+				break
+			}
+			sampled++
+			if at <= now {
+				due = true
+			}
+		}
+		if !due {
+			continue
+		}
+
+		s.preserve(keyStr)
+		expired += s.expireFields(h, now)
+		if len(h.fields) == 0 {
+			s.expire(keyStr)
+		} else {
+			s.fire(HookWrite, keyStr)
+		}
+	}
+	return sampled, expired
+}
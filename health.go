@@ -0,0 +1,139 @@
+package goredis
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Health Endpoint for Redis Clone
+
+Kubernetes probes and load balancers check services over HTTP, and can't
+send a RESP PING. When started with -healthAddress, the server also
+answers two HTTP paths on that address:
+
+	GET /healthz  liveness: 200 while the server loop runs commands
+	GET /readyz   readiness: 200 while the server should get traffic
+
+Both answer "ok", or 503 with one reason per line.
+
+Key concepts:
+- Liveness: The check passes a probe through the server loop, like a
+  command would, so a server whose loop is stuck (or stopped) fails it
+  instead of answering from a healthy HTTP goroutine
+- Readiness: Live, not shutting down, and not rejecting writes with -OOM
+  because used memory is above -maxMemory and nothing can be evicted
+- Shutdown: The endpoint keeps answering while connections drain, so
+  /readyz reports the shutdown and load balancers stop sending clients
+  before the port goes away
+- Not Checked: The server loads no dataset at startup and has no
+  replication, so readiness has nothing to wait for there
+*/
+
+const (
+	healthProbeTimeout      = time.Second     // how long the liveness check waits for the server loop
+	healthReadHeaderTimeout = 5 * time.Second // how long a client may take to send a request's headers
+)
+
+/*
+serveHealth answers health checks on the configured address
+
+It runs for the lifetime of the server, like acceptLoop, and returns
+http.ErrServerClosed after Shutdown.
+*/
+func (s *Server) serveHealth() error {
+	ln, err := net.Listen("tcp", s.HealthAddress)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.healthAddr = ln.Addr()
+	s.mu.Unlock()
+
+	slog.Info("health endpoint running", "healthAddress", s.HealthAddress)
+	return s.healthServer.Serve(ln)
+}
+
+/*
+HealthAddr returns the address the health endpoint listens on, nil until
+it's bound or when the endpoint isn't configured
+
+With a HealthAddress of ":0" this is where to find the endpoint.
+*/
+func (s *Server) HealthAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.healthAddr
+}
+
+/*
+healthHandler routes /healthz and /readyz
+*/
+func (s *Server) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, s.liveProblems())
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, s.readyProblems())
+	})
+	return mux
+}
+
+/*
+liveProblems returns why the server isn't live, nothing if it is
+*/
+func (s *Server) liveProblems() []string {
+	done := make(chan struct{})
+	timeout := time.NewTimer(healthProbeTimeout)
+	defer timeout.Stop()
+
+	select {
+	case s.healthChannel <- done:
+	case <-timeout.C:
+		return []string{"server loop not responding"}
+	}
+	select {
+	case <-done:
+		return nil
+	case <-timeout.C:
+		return []string{"server loop not responding"}
+	}
+}
+
+/*
+readyProblems returns why the server shouldn't get traffic, nothing if it should
+*/
+func (s *Server) readyProblems() []string {
+	s.mu.Lock()
+	closing := s.closing
+	s.mu.Unlock()
+
+	if closing {
+		// The loop stops once connections drain; no point waiting for it
+		return []string{"shutting down"}
+	}
+	problems := s.liveProblems()
+	if s.pressure.oom.Load() {
+		problems = append(problems, "used memory above maxmemory, writes are rejected")
+	}
+	return problems
+}
+
+/*
+writeHealth answers a health check: 200 "ok" without problems, 503 listing them otherwise
+*/
+func writeHealth(w http.ResponseWriter, problems []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if len(problems) == 0 {
+		w.Write([]byte("ok\n"))
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(strings.Join(problems, "\n") + "\n"))
+}
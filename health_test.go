@@ -0,0 +1,126 @@
+package goredis_test
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+startHealthServer starts a server with its health endpoint on a free port,
+returning the server and the endpoint's base URL
+*/
+func startHealthServer(t *testing.T, setup func(server *goredis.Server)) (*goredis.Server, string) {
+	t.Helper()
+
+	server := startServer(t, func(server *goredis.Server) {
+		server.HealthAddress = "127.0.0.1:0"
+		if setup != nil {
+			setup(server)
+		}
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for server.HealthAddr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("health endpoint did not start listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return server, "http://" + server.HealthAddr().String()
+}
+
+/*
+checkHealth requests url and checks the status code and body of the answer
+*/
+func checkHealth(t *testing.T, method, url string, status int, body string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: reading the body: %v", method, url, err)
+	}
+	if resp.StatusCode != status {
+		t.Errorf("%s %s: got %d %q, want %d", method, url, resp.StatusCode, got, status)
+	}
+	if body != "" && string(got) != body {
+		t.Errorf("%s %s: got body %q, want %q", method, url, got, body)
+	}
+	if status == http.StatusOK && resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("%s %s: Cache-Control %q, want no-store", method, url, resp.Header.Get("Cache-Control"))
+	}
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	server, base := startHealthServer(t, nil)
+
+	checkHealth(t, "GET", base+"/healthz", http.StatusOK, "ok\n")
+	checkHealth(t, "GET", base+"/readyz", http.StatusOK, "ok\n")
+	checkHealth(t, "POST", base+"/healthz", http.StatusMethodNotAllowed, "")
+	checkHealth(t, "GET", base+"/metrics", http.StatusNotFound, "")
+
+	// A server loop that doesn't answer makes the server neither live nor ready
+	client := dial(t, server)
+	client.send("DEBUG", "SLEEP", "2")
+	time.Sleep(100 * time.Millisecond)
+	checkHealth(t, "GET", base+"/healthz", http.StatusServiceUnavailable, "server loop not responding\n")
+	if got := client.read(); got != "+OK\r\n" {
+		t.Fatalf("DEBUG SLEEP: got %q", got)
+	}
+	checkHealth(t, "GET", base+"/healthz", http.StatusOK, "ok\n")
+}
+
+func TestHealthDuringShutdown(t *testing.T) {
+	server, base := startHealthServer(t, nil)
+
+	// The sleeping client keeps the shutdown draining, and the endpoint answering
+	client := dial(t, server)
+	client.send("DEBUG", "SLEEP", "1")
+	time.Sleep(100 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- server.Shutdown(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+
+	checkHealth(t, "GET", base+"/readyz", http.StatusServiceUnavailable, "shutting down\n")
+	if got := client.read(); got != "+OK\r\n" {
+		t.Errorf("DEBUG SLEEP sent before the shutdown: got %q", got)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Error("health endpoint still answering after Shutdown returned")
+	}
+}
+
+func TestHealthUnderMemoryPressure(t *testing.T) {
+	debug.SetMemoryLimit(1 << 40)
+	t.Cleanup(func() { debug.SetMemoryLimit(math.MaxInt64) })
+
+	server, base := startHealthServer(t, func(server *goredis.Server) {
+		server.MaxMemory = 1
+		server.MaxMemoryPolicy = goredis.PolicyNoEviction
+	})
+	runtime.GC()
+	client := dial(t, server)
+
+	// Rejecting writes keeps the server live, but it asks not to get traffic
+	waitFor(t, client, "-OOM command not allowed when used memory > 'maxmemory'.\r\n", "SET", "key", "value")
+	checkHealth(t, "GET", base+"/healthz", http.StatusOK, "ok\n")
+	checkHealth(t, "GET", base+"/readyz", http.StatusServiceUnavailable, "used memory above maxmemory, writes are rejected\n")
+}
@@ -0,0 +1,102 @@
+package goredis
+
+/*
+Storage Hooks for Redis Clone
+
+This file lets code using Storage as a library react to keys changing,
+for example to invalidate a local cache or keep a secondary index. A hook
+registered with RegisterHook is called with the key and what happened to
+it every time the storage writes, deletes, expires or evicts a key.
+
+Key concepts:
+- Synchronous: Hooks run inside the Storage method that caused the event,
+  on the goroutine that called it (for the server, the server loop, or the
+  active expire goroutine for HookExpire and for HookWrite when it deletes
+  expired hash fields), while the storage write lock is held
+- Ordering: Since every event is fired under the write lock, hooks see
+  events in exactly the order the changes were applied, with no two hooks
+  running at the same time
+- No Re-entry: Hooks must not call back into the Storage, since the lock
+  is still held; work that needs the storage should be handed off
+- Expiration: Expired keys are removed when a write or GET touches them,
+  or when the active expire cycle finds them (see expire.go), so
+  HookExpire fires shortly after the expiry instant rather than at it
+*/
+
+/*
+HookEvent says what happened to a key
+*/
+type HookEvent int
+
+const (
+	HookWrite  HookEvent = iota // the key was created or modified
+	HookDelete                  // the key was removed by a command (DEL, FLUSHALL, popping the last element, ...)
+	HookExpire                  // the key was removed because its TTL passed
+	HookEvict                   // the key was removed to free memory
+)
+
+/*
+String returns the name of the event, e.g. "write"
+*/
+func (e HookEvent) String() string {
+	switch e {
+	case HookWrite:
+		return "write"
+	case HookDelete:
+		return "delete"
+	case HookExpire:
+		return "expire"
+	case HookEvict:
+		return "evict"
+	}
+	return "unknown"
+}
+
+/*
+Hook is a callback fired when a key changes
+
+See the file comment for the goroutine it runs on and what it may do.
+*/
+type Hook func(event HookEvent, key string)
+
+/*
+RegisterHook adds a hook called for every write, deletion, expiration and eviction
+
+Hooks are called in the order they were registered. RegisterHook is safe
+to call at any time, also while the storage is in use.
+*/
+func (s *Storage) RegisterHook(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks = append(s.hooks, hook)
+}
+
+/*
+fire calls every hook with event and key
+
+Must be called with the write lock held.
+*/
+func (s *Storage) fire(event HookEvent, keyStr string) {
+	for _, hook := range s.hooks {
+		hook(event, keyStr)
+	}
+}
+
+/*
+changed fires the hooks for a key a command just modified
+
+Must be called with the write lock held, after the modification. A key
+that's gone afterwards (e.g. a list whose last element was popped) is
+reported as deleted, anything else as written.
+*/
+func (s *Storage) changed(keyStr string) {
+	if len(s.hooks) == 0 {
+		return
+	}
+	if _, exists := s.entries[keyStr]; exists {
+		s.fire(HookWrite, keyStr)
+	} else {
+		s.fire(HookDelete, keyStr)
+	}
+}
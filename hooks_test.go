@@ -0,0 +1,101 @@
+package goredis_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+hookEvent is one call of a hook
+*/
+type hookEvent struct {
+	event goredis.HookEvent
+	key   string
+}
+
+/*
+hookRecorder collects the events a storage fires
+*/
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []hookEvent
+}
+
+func (r *hookRecorder) hook(event goredis.HookEvent, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, hookEvent{event, key})
+}
+
+/*
+take returns the events recorded so far and forgets them
+*/
+func (r *hookRecorder) take() []hookEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestRegisterHook(t *testing.T) {
+	storage := goredis.NewStorage()
+	var recorder hookRecorder
+	storage.RegisterHook(recorder.hook)
+
+	tests := []struct {
+		name string
+		run  func()
+		want []hookEvent
+	}{
+		{"write", func() { storage.Set([]byte("a"), []byte("1")) }, []hookEvent{{goredis.HookWrite, "a"}}},
+		{"overwrite", func() { storage.Set([]byte("a"), []byte("2")) }, []hookEvent{{goredis.HookWrite, "a"}}},
+		{"read", func() { storage.Get([]byte("a")) }, nil},
+		{"delete", func() { storage.Delete([]byte("a")) }, []hookEvent{{goredis.HookDelete, "a"}}},
+		{"delete missing", func() { storage.Delete([]byte("a")) }, nil},
+		{"expire", func() {
+			storage.SetWithExpiry([]byte("session"), []byte("token"), time.Millisecond)
+			time.Sleep(5 * time.Millisecond)
+			storage.Get([]byte("session"))
+		}, []hookEvent{{goredis.HookWrite, "session"}, {goredis.HookExpire, "session"}}},
+		{"evict", func() {
+			storage.Set([]byte("big"), []byte("value"))
+			recorder.take()
+			storage.Evict(goredis.PolicyAllKeysRandom, 5, 1)
+		}, []hookEvent{{goredis.HookEvict, "big"}}},
+		{"flush", func() {
+			storage.Set([]byte("b"), []byte("1"))
+			recorder.take()
+			storage.FlushAll()
+		}, []hookEvent{{goredis.HookDelete, "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run()
+			if got := recorder.take(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterHookSeesServerCommands(t *testing.T) {
+	var recorder hookRecorder
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().RegisterHook(recorder.hook)
+	})
+	client := dial(t, server)
+
+	client.expect(":2\r\n", "RPUSH", "queue", "a", "b")
+	client.expect("*2\r\n$1\r\na\r\n$1\r\nb\r\n", "LPOP", "queue", "2")
+	client.expect("$-1\r\n", "GET", "queue")
+
+	want := []hookEvent{{goredis.HookWrite, "queue"}, {goredis.HookDelete, "queue"}}
+	if got := recorder.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package goredis
+
+import (
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Server Information for Redis Clone
+
+INFO reports what the server is doing, in the same text format as Redis,
+so dashboards and exporters written for Redis can read it.
+
+Key concepts:
+- Sections: The report is made of sections ("# Stats") of name:value
+  lines; INFO with no argument, "default", "all" or "everything" returns
+  every section, otherwise only the sections named (unknown names are
+  skipped, as in Redis)
+- Counters: Totals like expired_keys count from startup and are never
+  reset, so monitoring can compute rates from them; the instantaneous_*
+  fields are such rates, computed by the server (see metrics.go)
+- Keyspace: The db0 line counts keys the way Redis does, including keys
+  whose TTL passed but that weren't removed yet
+*/
+
+/*
+serverVersion is the version reported by HELLO and INFO
+*/
+const serverVersion = "1.0.0"
+
+/*
+infoSections lists the INFO sections in the order they're reported
+*/
+var infoSections = []struct {
+	name  string
+	title string
+	write func(s *Server, b *strings.Builder)
+}{
+	{"server", "Server", (*Server).writeInfoServer},
+	{"clients", "Clients", (*Server).writeInfoClients},
+	{"memory", "Memory", (*Server).writeInfoMemory},
+	{"stats", "Stats", (*Server).writeInfoStats},
+	{"keyspace", "Keyspace", (*Server).writeInfoKeyspace},
+}
+
+/*
+StorageStats is a snapshot of the keyspace and its counters
+*/
+type StorageStats struct {
+	Keys        int           // keys stored, including expired keys not removed yet
+	Expires     int           // keys with a TTL
+	AvgTTL      time.Duration // average remaining TTL of the keys with one
+	ExpiredKeys int64         // keys removed since startup because their TTL passed
+	EvictedKeys int64         // keys removed since startup to free memory
+}
+
+/*
+Stats returns the current keyspace statistics
+
+Counting the keys with a TTL visits the whole keyspace under the read lock.
+*/
+func (s *Storage) Stats() StorageStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := StorageStats{
+		Keys:        len(s.entries),
+		ExpiredKeys: s.expiredKeys,
+		EvictedKeys: s.evictedKeys,
+	}
+
+	now := time.Now().UnixNano()
+	var ttlSum int64
+	for _, e := range s.entries {
+		if e.expireAt == 0 {
+			continue
+		}
+		stats.Expires++
+		if e.expireAt > now {
+			ttlSum += e.expireAt - now
+		}
+	}
+	if stats.Expires > 0 {
+		stats.AvgTTL = time.Duration(ttlSum / int64(stats.Expires))
+	}
+	return stats
+}
+
+/*
+removedKeys returns the expired_keys, expired_subkeys and evicted_keys
+counters, without visiting the keyspace like Stats does
+*/
+func (s *Storage) removedKeys() (expired, expiredFields, evicted int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.expiredKeys, s.expiredFields, s.evictedKeys
+}
+
+/*
+info renders the INFO report for the requested sections
+
+sections holds lowercase section names; empty means every section.
+*/
+func (s *Server) info(sections []string) string {
+	all := len(sections) == 0
+	for _, name := range sections {
+		if name == "default" || name == "all" || name == "everything" {
+			all = true
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !slices.Contains(sections, section.name) {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + section.title + "\r\n")
+		section.write(s, &b)
+	}
+	return b.String()
+}
+
+func (s *Server) writeInfoServer(b *strings.Builder) {
+	s.mu.Lock()
+	port := ""
+	if s.ln != nil {
+		_, port, _ = net.SplitHostPort(s.ln.Addr().String())
+	}
+	s.mu.Unlock()
+
+	uptime := time.Since(s.startedAt)
+	writeInfoField(b, "redis_version", serverVersion)
+	writeInfoField(b, "redis_mode", "standalone")
+	writeInfoField(b, "process_id", strconv.Itoa(os.Getpid()))
+	writeInfoField(b, "tcp_port", port)
+	writeInfoField(b, "uptime_in_seconds", strconv.FormatInt(int64(uptime/time.Second), 10))
+	writeInfoField(b, "uptime_in_days", strconv.FormatInt(int64(uptime/(24*time.Hour)), 10))
+}
+
+func (s *Server) writeInfoClients(b *strings.Builder) {
+	s.mu.Lock()
+	connected := len(s.peers)
+	s.mu.Unlock()
+
+	writeInfoField(b, "connected_clients", strconv.Itoa(connected))
+	writeInfoField(b, "blocked_clients", strconv.Itoa(len(s.blocking.clients)))
+}
+
+func (s *Server) writeInfoMemory(b *strings.Builder) {
+	m := readMemoryStats()
+	writeInfoField(b, "used_memory", strconv.FormatUint(m.live, 10))
+	writeInfoField(b, "used_memory_rss", strconv.FormatUint(m.resident(), 10))
+	writeInfoField(b, "maxmemory", strconv.FormatInt(s.MaxMemory, 10))
+	writeInfoField(b, "maxmemory_policy", s.MaxMemoryPolicy.String())
+	writeInfoField(b, "gomemlimit", strconv.FormatUint(m.memoryLimit, 10))
+}
+
+func (s *Server) writeInfoStats(b *strings.Builder) {
+	expired, expiredFields, evicted := s.storage.removedKeys()
+	writeInfoField(b, "total_connections_received", strconv.FormatInt(s.stats.connectionsReceived.Load(), 10))
+	writeInfoField(b, "total_accept_errors", strconv.FormatInt(s.stats.acceptErrors.Load(), 10))
+	writeInfoField(b, "total_listener_rebinds", strconv.FormatInt(s.stats.listenerRebinds.Load(), 10))
+	writeInfoField(b, "total_commands_processed", strconv.FormatInt(s.stats.commandsProcessed.Load(), 10))
+	writeInfoField(b, "instantaneous_ops_per_sec", strconv.FormatInt(int64(s.stats.instantaneous(rateCommands)), 10))
+	writeInfoField(b, "total_net_input_bytes", strconv.FormatInt(s.stats.netInputBytes.Load(), 10))
+	writeInfoField(b, "total_net_output_bytes", strconv.FormatInt(s.stats.netOutputBytes.Load(), 10))
+	writeInfoField(b, "instantaneous_input_kbps", strconv.FormatFloat(s.stats.instantaneous(rateNetInput)/1024, 'f', 2, 64))
+	writeInfoField(b, "instantaneous_output_kbps", strconv.FormatFloat(s.stats.instantaneous(rateNetOutput)/1024, 'f', 2, 64))
+	writeInfoField(b, "expired_keys", strconv.FormatInt(expired, 10))
+	writeInfoField(b, "expired_subkeys", strconv.FormatInt(expiredFields, 10))
+	writeInfoField(b, "evicted_keys", strconv.FormatInt(evicted, 10))
+}
+
+func (s *Server) writeInfoKeyspace(b *strings.Builder) {
+	stats := s.storage.Stats()
+	if stats.Keys == 0 {
+		return
+	}
+	writeInfoField(b, "db0", "keys="+strconv.Itoa(stats.Keys)+
+		",expires="+strconv.Itoa(stats.Expires)+
+		",avg_ttl="+strconv.FormatInt(stats.AvgTTL.Milliseconds(), 10))
+}
+
+/*
+writeInfoField writes one name:value line of an INFO section
+*/
+func writeInfoField(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteString("\r\n")
+}
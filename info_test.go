@@ -0,0 +1,98 @@
+package goredis_test
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+info runs INFO and returns the section titles and the fields of its reply
+*/
+func info(t *testing.T, client *testClient, sections ...string) ([]string, map[string]string) {
+	t.Helper()
+
+	reply := client.do(append([]string{"INFO"}, sections...)...)
+	header, body, _ := strings.Cut(reply, "\r\n")
+	if size, err := strconv.Atoi(header[1:]); err != nil || header[0] != '$' || len(body) != size+2 {
+		t.Fatalf("INFO reply %.80q is not a bulk string", reply)
+	}
+
+	var titles []string
+	fields := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n") {
+		if title, ok := strings.CutPrefix(line, "# "); ok {
+			titles = append(titles, title)
+		} else if name, value, ok := strings.Cut(line, ":"); ok {
+			fields[name] = value
+		}
+	}
+	return titles, fields
+}
+
+func TestInfoSections(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	for _, tt := range []struct {
+		sections []string
+		want     string
+	}{
+		{nil, "Server Clients Memory Stats Keyspace"},
+		{[]string{"everything"}, "Server Clients Memory Stats Keyspace"},
+		{[]string{"stats"}, "Stats"},
+		{[]string{"KEYSPACE", "clients", "nosuchsection"}, "Clients Keyspace"},
+	} {
+		if titles, _ := info(t, client, tt.sections...); strings.Join(titles, " ") != tt.want {
+			t.Errorf("INFO %v: sections %v, want %s", tt.sections, titles, tt.want)
+		}
+	}
+
+	// The keyspace section has no db0 line while there are no keys
+	if _, fields := info(t, client, "keyspace"); fields["db0"] != "" {
+		t.Errorf("db0 of an empty keyspace: got %q", fields["db0"])
+	}
+	client.expect("+OK\r\n", "SET", "key", "value")
+	if _, fields := info(t, client, "keyspace"); fields["db0"] != "keys=1,expires=0,avg_ttl=0" {
+		t.Errorf("db0: got %q", fields["db0"])
+	}
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+	if _, fields := info(t, client, "server"); fields["tcp_port"] != port {
+		t.Errorf("tcp_port: got %q, want %s", fields["tcp_port"], port)
+	}
+}
+
+func TestInfoCounters(t *testing.T) {
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().SetWithExpiry([]byte("short"), []byte("x"), time.Millisecond)
+		server.Storage().SetWithExpiry([]byte("long"), []byte("x"), time.Hour)
+		server.Storage().Set([]byte("plain"), []byte("x"))
+	})
+	client := dial(t, server)
+	dial(t, server)
+
+	_, fields := info(t, client)
+	if got := fields["connected_clients"]; got != "2" {
+		t.Errorf("connected_clients: got %s, want 2", got)
+	}
+	if got := fields["total_connections_received"]; got != "2" {
+		t.Errorf("total_connections_received: got %s, want 2", got)
+	}
+	if got := fields["db0"]; !strings.HasPrefix(got, "keys=3,expires=2,avg_ttl=") {
+		t.Errorf("db0: got %q, want 3 keys, 2 with a TTL", got)
+	}
+
+	// A key whose TTL passed is counted when it's removed, and an evicted key too
+	time.Sleep(2 * time.Millisecond)
+	client.expect("$-1\r\n", "GET", "short")
+	server.Storage().Evict(goredis.PolicyVolatileTTL, goredis.MaxEvictionSamples, 1)
+	client.expect(":0\r\n", "EXISTS", "long")
+	_, fields = info(t, client, "stats")
+	if fields["expired_keys"] != "1" || fields["evicted_keys"] != "1" {
+		t.Errorf("expired_keys %s, evicted_keys %s, want 1 each", fields["expired_keys"], fields["evicted_keys"])
+	}
+}
@@ -0,0 +1,147 @@
+package goredis
+
+/*
+Size Limits for Redis Clone
+
+On a server shared by several applications, one client writing a
+gigabyte value or a list with millions of elements can take the memory
+everyone else needs. Limits cap the size of what a write may create, and
+writes that would exceed one fail with an error naming it, leaving the
+data untouched.
+
+Key concepts:
+- Keys: -maxKeySize caps the length of key names created by writes
+- Strings: -maxStringSize caps the length of string values, including
+  what APPEND and SETRANGE grow them to
+- Elements: -maxElementSize caps list elements, set and sorted set
+  members, and hash fields and values
+- Collections: -maxElements caps how many elements a list, set, hash or
+  sorted set may hold; only elements a write actually adds count, so a
+  full collection can still be updated
+- Existing Data: Limits apply to writes; values stored before a limit was
+  set are still readable, and writes that shrink them are allowed
+- 0 means no limit, the default for all of them
+*/
+
+/*
+Limits are the size limits enforced on writes, 0 meaning unlimited
+*/
+type Limits struct {
+	MaxKeySize     int // bytes in a key name
+	MaxStringSize  int // bytes in a string value
+	MaxElementSize int // bytes in a collection element, member, field or hash value
+	MaxElements    int // elements in a list, set, hash or sorted set
+}
+
+/*
+SetLimits sets the size limits enforced on writes (see Limits)
+*/
+func (s *Storage) SetLimits(limits Limits) {
+	s.limits.Store(&limits)
+}
+
+/*
+checkKey rejects a key name longer than MaxKeySize
+*/
+func (s *Storage) checkKey(key []byte) error {
+	if l := s.limits.Load(); l != nil && l.MaxKeySize > 0 && len(key) > l.MaxKeySize {
+		return errKeyTooLarge
+	}
+	return nil
+}
+
+/*
+checkString rejects a string value of size bytes longer than MaxStringSize
+*/
+func (s *Storage) checkString(size int) error {
+	if l := s.limits.Load(); l != nil && l.MaxStringSize > 0 && size > l.MaxStringSize {
+		return errStringTooLarge
+	}
+	return nil
+}
+
+/*
+checkElements rejects elements longer than MaxElementSize
+*/
+func (s *Storage) checkElements(elements ...[]byte) error {
+	for _, element := range elements {
+		if err := s.checkElementSize(len(element)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+checkElementSize rejects an element of size bytes longer than MaxElementSize
+*/
+func (s *Storage) checkElementSize(size int) error {
+	if l := s.limits.Load(); l != nil && l.MaxElementSize > 0 && size > l.MaxElementSize {
+		return errElementTooLarge
+	}
+	return nil
+}
+
+/*
+checkLength rejects a collection growing to length elements beyond MaxElements
+*/
+func (s *Storage) checkLength(length int) error {
+	if l := s.limits.Load(); l != nil && l.MaxElements > 0 && length > l.MaxElements {
+		return errTooManyElements
+	}
+	return nil
+}
+
+/*
+checkStringWrite rejects writing a string of size bytes at key (see
+checkKey and checkString)
+*/
+func (s *Storage) checkStringWrite(key []byte, size int) error {
+	if err := s.checkKey(key); err != nil {
+		return err
+	}
+	return s.checkString(size)
+}
+
+/*
+checkMembersAdded rejects adding n members to the set, hash (fields) or
+sorted set at keyStr if it would grow beyond MaxElements; member(i)
+returns the i-th member
+
+Must be called with the write lock held, before a missing collection is
+created. Members already there, or given twice, don't count. A key of
+another type passes, so the command still fails with WRONGTYPE.
+*/
+func (s *Storage) checkMembersAdded(keyStr string, valueType ValueType, n int, member func(i int) string) error {
+	if l := s.limits.Load(); l == nil || l.MaxElements == 0 {
+		return nil
+	}
+
+	length, exists := 0, func(string) bool { return false }
+	if e := s.lookupWrite(keyStr); e != nil {
+		if e.valueType() != valueType {
+			return nil
+		}
+		switch v := e.value.(type) {
+		case *setValue:
+			length, exists = len(v.members), v.has
+		case *hashValue:
+			length = len(v.fields)
+			exists = func(field string) bool { _, ok := v.fields[field]; return ok }
+		case *zsetValue:
+			length = v.len()
+			exists = func(member string) bool { _, ok := v.scores[member]; return ok }
+		}
+	}
+
+	seen := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		m := member(i)
+		if _, dup := seen[m]; dup || exists(m) {
+			continue
+		}
+		seen[m] = struct{}{}
+		length++
+	}
+	return s.checkLength(length)
+}
@@ -0,0 +1,127 @@
+package goredis_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+const (
+	errKeyTooLarge     = "ERR key exceeds maximum allowed size (maxKeySize)"
+	errStringTooLarge  = "ERR string exceeds maximum allowed size (maxStringSize)"
+	errElementTooLarge = "ERR element exceeds maximum allowed size (maxElementSize)"
+	errTooManyElements = "ERR collection exceeds maximum allowed length (maxElements)"
+)
+
+/*
+wantLimit checks err is the limit error want, or no error if want is empty
+*/
+func wantLimit(t *testing.T, op string, err error, want string) {
+	t.Helper()
+
+	if got := fmt.Sprint(err); (want == "" && err != nil) || (want != "" && got != want) {
+		t.Errorf("%s: got error %v, want %q", op, err, want)
+	}
+}
+
+func TestLimitsOnStrings(t *testing.T) {
+	storage := goredis.NewStorage()
+	storage.Set([]byte("big"), bytes.Repeat([]byte("x"), 20))
+	storage.SetLimits(goredis.Limits{MaxKeySize: 8, MaxStringSize: 16})
+
+	wantLimit(t, "SET long key", storage.Set([]byte("a-long-key"), []byte("x")), errKeyTooLarge)
+	wantLimit(t, "SET long value", storage.Set([]byte("k"), bytes.Repeat([]byte("x"), 17)), errStringTooLarge)
+	wantLimit(t, "SET at the limit", storage.Set([]byte("k"), bytes.Repeat([]byte("x"), 16)), "")
+
+	// Growing past the limit fails and leaves the value as it was
+	_, err := storage.Append([]byte("k"), []byte("y"))
+	wantLimit(t, "APPEND", err, errStringTooLarge)
+	_, err = storage.SetRange([]byte("k"), 16, []byte("y"))
+	wantLimit(t, "SETRANGE past the end", err, errStringTooLarge)
+	_, err = storage.SetRange([]byte("k"), 0, []byte("yy"))
+	wantLimit(t, "SETRANGE within", err, "")
+	if got, _, _ := storage.Get([]byte("k")); string(got) != "yy"+strings.Repeat("x", 14) {
+		t.Errorf("GET k = %q after the failed writes", got)
+	}
+
+	// A value stored before the limit stays readable and writable, but can't grow
+	if got, ok, _ := storage.Get([]byte("big")); !ok || len(got) != 20 {
+		t.Errorf("GET big = %q, %v, want the 20 bytes stored before the limit", got, ok)
+	}
+	_, err = storage.SetRange([]byte("big"), 0, []byte("y"))
+	wantLimit(t, "SETRANGE within a value over the limit", err, "")
+	_, err = storage.SetRange([]byte("big"), 20, []byte("y"))
+	wantLimit(t, "SETRANGE growing a value over the limit", err, errStringTooLarge)
+	wantLimit(t, "SET shrinking it", storage.Set([]byte("big"), []byte("small")), "")
+
+	// 0 lifts a limit
+	storage.SetLimits(goredis.Limits{MaxKeySize: 8})
+	wantLimit(t, "SET without a string limit", storage.Set([]byte("k"), bytes.Repeat([]byte("x"), 1000)), "")
+}
+
+func TestLimitsOnCollections(t *testing.T) {
+	storage := goredis.NewStorage()
+	storage.SetLimits(goredis.Limits{MaxElementSize: 4, MaxElements: 3})
+	elements := func(values ...string) [][]byte {
+		out := make([][]byte, len(values))
+		for i, v := range values {
+			out[i] = []byte(v)
+		}
+		return out
+	}
+
+	// Lists
+	_, err := storage.Push([]byte("list"), elements("a", "toolong"), false)
+	wantLimit(t, "RPUSH long element", err, errElementTooLarge)
+	_, err = storage.Push([]byte("list"), elements("a", "b", "c", "d"), false)
+	wantLimit(t, "RPUSH 4 elements", err, errTooManyElements)
+	if n, _ := storage.LLen([]byte("list")); n != 0 {
+		t.Errorf("LLEN = %d after the failed pushes, want 0", n)
+	}
+	_, err = storage.Push([]byte("list"), elements("a", "b", "c"), false)
+	wantLimit(t, "RPUSH 3 elements", err, "")
+	_, err = storage.Push([]byte("list"), elements("d"), true)
+	wantLimit(t, "LPUSH onto a full list", err, errTooManyElements)
+
+	// Sets: members already there don't count
+	_, err = storage.SAdd([]byte("set"), elements("a", "b", "c", "a"))
+	wantLimit(t, "SADD 3 members, one twice", err, "")
+	_, err = storage.SAdd([]byte("set"), elements("a", "b"))
+	wantLimit(t, "SADD existing members to a full set", err, "")
+	_, err = storage.SAdd([]byte("set"), elements("a", "d"))
+	wantLimit(t, "SADD a new member to a full set", err, errTooManyElements)
+	if n, _ := storage.SCard([]byte("set")); n != 3 {
+		t.Errorf("SCARD = %d, want 3", n)
+	}
+
+	// Hashes: fields and values are elements
+	_, err = storage.HSet([]byte("hash"), elements("f", "toolong"))
+	wantLimit(t, "HSET long value", err, errElementTooLarge)
+	_, err = storage.HSet([]byte("hash"), elements("f1", "1", "f2", "2", "f3", "3"))
+	wantLimit(t, "HSET 3 fields", err, "")
+	_, err = storage.HSet([]byte("hash"), elements("f1", "new"))
+	wantLimit(t, "HSET updating a field of a full hash", err, "")
+	_, err = storage.HSet([]byte("hash"), elements("f4", "4"))
+	wantLimit(t, "HSET a new field into a full hash", err, errTooManyElements)
+	if got, _, _ := storage.HGet([]byte("hash"), []byte("f1")); string(got) != "new" {
+		t.Errorf("HGET hash f1 = %q, want the update", got)
+	}
+}
+
+func TestLimitsOnCommands(t *testing.T) {
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().SetLimits(goredis.Limits{MaxElements: 2})
+	})
+	client := dial(t, server)
+
+	// The error reaches the client and the command changes nothing
+	client.expect(":2\r\n", "ZADD", "board", "1", "a", "2", "b")
+	client.expect("-"+errTooManyElements+"\r\n", "ZADD", "board", "3", "c")
+	client.expect(":0\r\n", "ZADD", "board", "5", "a")
+	client.expect("*2\r\n$1\r\nb\r\n$1\r\na\r\n", "ZRANGE", "board", "0", "-1")
+	client.expect("-"+errTooManyElements+"\r\n", "RPUSH", "list", "a", "b", "c")
+	client.expect(":0\r\n", "EXISTS", "list")
+}
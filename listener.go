@@ -0,0 +1,121 @@
+package goredis
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+)
+
+/*
+Listener Recovery for Redis Clone
+
+Accept can fail for reasons that pass, like running out of file
+descriptors, and for reasons that don't, like the listening socket being
+broken. Retrying straight away in either case spins the accept loop at
+full CPU, logging an error per turn. Instead, the two are told apart.
+
+Key concepts:
+- Temporary Errors: Out of file descriptors or buffers, an aborted
+  connection or a timeout; the loop waits before accepting again, 5 ms
+  after the first failure and twice as long after each following one, up
+  to a second, and goes back to full speed after a successful accept
+- Fatal Errors: Anything else means the listener is broken; it's closed
+  and bound again on the same address, 100 ms later, retrying after twice
+  as long each time
+- Giving Up: If the address can't be bound again after five attempts
+  (about 2.5 seconds), the server shuts down, letting connected clients
+  finish, and Start returns the error, so a supervisor can restart the
+  process
+- Metrics: INFO stats reports total_accept_errors and
+  total_listener_rebinds
+*/
+
+const (
+	acceptBackoffMin = 5 * time.Millisecond   // wait after the first failed accept
+	acceptBackoffMax = time.Second            // longest wait between attempts
+	rebindDelay      = 100 * time.Millisecond // wait before the first bind
+	rebindAttempts   = 5                      // binds tried before shutting down
+)
+
+/*
+acceptBackoff is the growing wait between failing attempts
+*/
+type acceptBackoff struct {
+	delay time.Duration // the last wait, 0 after a success
+}
+
+/*
+next returns how long to wait before the next attempt, growing it for the one after
+*/
+func (b *acceptBackoff) next() time.Duration {
+	b.delay = min(max(2*b.delay, acceptBackoffMin), acceptBackoffMax)
+	return b.delay
+}
+
+/*
+reset starts over from the shortest wait
+*/
+func (b *acceptBackoff) reset() {
+	b.delay = 0
+}
+
+/*
+temporaryAcceptError reports whether a failed Accept may succeed later on
+the same listener
+*/
+func temporaryAcceptError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{
+		syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM,
+		syscall.ECONNABORTED, syscall.ECONNRESET, syscall.EINTR, syscall.EAGAIN,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+rebindListener replaces a broken listener with a new one on the same address
+
+Returns: ErrServerClosed if Shutdown was called meanwhile, or the last
+bind error once every attempt failed
+*/
+func (s *Server) rebindListener(broken net.Listener) error {
+	broken.Close()
+
+	delay := rebindDelay
+	var err error
+	for attempt := 1; attempt <= rebindAttempts; attempt++ {
+		time.Sleep(delay)
+		delay = min(2*delay, acceptBackoffMax)
+
+		var ln net.Listener
+		ln, err = net.Listen("tcp", s.ListenAddress)
+		if err != nil {
+			slog.Error("listener rebind failed", "err", err, "attempt", attempt)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			ln.Close()
+			return ErrServerClosed
+		}
+		s.ln = ln
+		s.mu.Unlock()
+
+		s.stats.listenerRebinds.Add(1)
+		slog.Info("listener rebound", "listenPortAddress", s.ListenAddress)
+		return nil
+	}
+	return fmt.Errorf("listener on %s can't be bound again: %w", s.ListenAddress, err)
+}
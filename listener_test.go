@@ -0,0 +1,132 @@
+package goredis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+/*
+brokenListener fails every Accept with an error that isn't temporary, like
+a listening socket that went bad
+*/
+type brokenListener struct {
+	net.Listener
+}
+
+func (brokenListener) Accept() (net.Conn, error) {
+	return nil, errors.New("listening socket broken")
+}
+
+/*
+ping connects to addr and checks the server answers a PING
+*/
+func ping(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if reply != "+PONG\r\n" {
+		return fmt.Errorf("PING: got %q", reply)
+	}
+	return nil
+}
+
+func TestListenerRebindsAfterAcceptError(t *testing.T) {
+	// Binding again needs a fixed address, not ":0"
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.Addr().String()
+	free.Close()
+
+	server := NewServer(Config{ListenAddress: addr})
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Start returned %v, want ErrServerClosed", err)
+		}
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The accept loop picks up the broken listener once the connection in flight is accepted
+	server.mu.Lock()
+	server.ln = brokenListener{server.ln}
+	server.mu.Unlock()
+	if err := ping(addr); err != nil {
+		t.Fatalf("before the accept error: %v", err)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for server.stats.listenerRebinds.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("listener not bound again after the accept error")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ping(addr); err != nil {
+		t.Fatalf("after the rebind: %v", err)
+	}
+	if got := server.stats.acceptErrors.Load(); got != 1 {
+		t.Errorf("total_accept_errors: got %d, want 1", got)
+	}
+}
+
+func TestAcceptErrors(t *testing.T) {
+	tests := []struct {
+		err       error
+		temporary bool
+	}{
+		{&net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EMFILE)}, true},
+		{&net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.ECONNABORTED)}, true},
+		{os.ErrDeadlineExceeded, true},
+		{&net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EBADF)}, false},
+		{errors.New("listening socket broken"), false},
+	}
+	for _, tt := range tests {
+		if got := temporaryAcceptError(tt.err); got != tt.temporary {
+			t.Errorf("temporaryAcceptError(%v) = %v, want %v", tt.err, got, tt.temporary)
+		}
+	}
+
+	// The wait doubles up to its cap, and starts over after a success
+	var backoff acceptBackoff
+	var waits []time.Duration
+	for range 10 {
+		waits = append(waits, backoff.next())
+	}
+	want := []time.Duration{5, 10, 20, 40, 80, 160, 320, 640, 1000, 1000}
+	for i := range want {
+		if waits[i] != want[i]*time.Millisecond {
+			t.Fatalf("waits: got %v, want %v ms", waits, want)
+		}
+	}
+	backoff.reset()
+	if got := backoff.next(); got != acceptBackoffMin {
+		t.Errorf("first wait after a reset: got %v, want %v", got, acceptBackoffMin)
+	}
+}
@@ -0,0 +1,483 @@
+package goredis
+
+/*
+List Storage for Redis Clone
+
+This file implements the list type: an ordered sequence of binary-safe
+elements stored under one key. It adds the list operations to Storage;
+the commands using them live in commands.go.
+
+Key concepts:
+- Head and Tail: LPUSH/LPOP work on the head (index 0), RPUSH/RPOP on the tail;
+  both ends take O(1) amortized time, so a list works as a queue either way
+- Negative Indices: -1 is the last element, -2 the one before it, and so on
+- No Empty Lists: A list that loses its last element is deleted, like in Redis,
+  so an empty list and a missing key are indistinguishable
+*/
+
+/*
+listValue is the value of a list key
+
+The elements are kept in a plain slice, so indexing is O(1). It's stored
+by pointer in the entry so operations can modify the list in place.
+
+Appending leaves spare capacity at the tail, and pushHead leaves spare
+room at the head the same way: items is then a window into buf, which
+has free slots before it. Operations that move the elements to a new
+array drop buf, so it never keeps an old array alive.
+*/
+type listValue struct {
+	items [][]byte
+	buf   [][]byte // the array items is a window into, with room at the head; nil if none
+}
+
+/*
+headRoom returns the number of free slots before the first element
+*/
+func (l *listValue) headRoom() int {
+	if cap(l.buf) == 0 || cap(l.items) == 0 {
+		return 0
+	}
+	// A window into buf ends where buf ends
+	buf, items := l.buf[:cap(l.buf)], l.items[:cap(l.items)]
+	if &buf[len(buf)-1] != &items[len(items)-1] {
+		return 0
+	}
+	return len(buf) - len(items)
+}
+
+/*
+pushHead inserts values at the head one after the other, so the last one
+ends up first
+
+When the room at the head runs out, the elements move to a new array with
+as much room again as the list then holds, so every element is copied
+O(1) times on average over a run of pushes, like appends at the tail.
+*/
+func (l *listValue) pushHead(values [][]byte) {
+	room := l.headRoom()
+	if room < len(values) {
+		room = len(l.items) + len(values)
+		buf := make([][]byte, room+len(l.items))
+		copy(buf[room:], l.items)
+		l.buf, l.items = buf, buf[room:]
+	}
+	for i, value := range values {
+		l.buf[room-1-i] = ownBytes(value)
+	}
+	l.items = l.buf[room-len(values) : room+len(l.items)]
+}
+
+/*
+pushTail appends values at the tail
+*/
+func (l *listValue) pushTail(values [][]byte) {
+	for _, value := range values {
+		l.items = append(l.items, ownBytes(value))
+	}
+	l.dropStaleBuf()
+}
+
+/*
+dropStaleBuf forgets buf once items moved to another array
+*/
+func (l *listValue) dropStaleBuf() {
+	if l.buf != nil && l.headRoom() == 0 {
+		l.buf = nil
+	}
+}
+
+/*
+listOf returns the list held by an entry
+
+Returns: nil for a missing entry, ErrWrongType if the entry holds another type
+*/
+func listOf(e *entry) (*listValue, error) {
+	if e == nil {
+		return nil, nil
+	}
+	l, ok := e.value.(*listValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return l, nil
+}
+
+/*
+normalizeRange converts Redis start/stop indices to slice bounds
+
+Both indices are inclusive and may be negative. Out of range indices are
+clamped the way LRANGE and LTRIM do it.
+
+Returns: the half-open range [from, to) and false if the range is empty
+*/
+func normalizeRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start = length + start
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+/*
+Push adds elements to the head or tail of a list
+
+Implements Redis LPUSH and RPUSH. Elements are inserted one after the other,
+so LPUSH key a b c leaves the list as c b a. A missing key is created.
+
+Returns: The length of the list after the push
+*/
+func (s *Storage) Push(key []byte, values [][]byte, head bool) (int, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, err
+	}
+	if err := s.checkElements(values...); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	l, err := listOf(e)
+	if err != nil {
+		return 0, err
+	}
+	length := len(values)
+	if l != nil {
+		length += len(l.items)
+	}
+	if err := s.checkLength(length); err != nil {
+		return 0, err
+	}
+	if l == nil {
+		l = &listValue{}
+		e = newEntry(l)
+		s.putEntry(keyStr, e)
+	}
+
+	if head {
+		l.pushHead(values)
+	} else {
+		l.pushTail(values)
+	}
+
+	e.touch()
+	s.changed(keyStr)
+	return len(l.items), nil
+}
+
+/*
+Pop removes and returns up to count elements from the head or tail of a list
+
+Implements Redis LPOP and RPOP. The key is deleted once the list is empty.
+
+Returns: The popped elements in pop order, and false if the key doesn't exist
+*/
+func (s *Storage) Pop(key []byte, count int, head bool) ([][]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	l, err := listOf(e)
+	if err != nil || l == nil {
+		return nil, false, err
+	}
+
+	count = min(count, len(l.items))
+	popped := make([][]byte, count)
+	if head {
+		copy(popped, l.items[:count])
+		clear(l.items[:count])
+		l.items = l.items[count:]
+	} else {
+		for i := 0; i < count; i++ {
+			popped[i] = l.items[len(l.items)-1-i]
+		}
+		clear(l.items[len(l.items)-count:])
+		l.items = l.items[:len(l.items)-count]
+	}
+
+	s.deleteIfEmptyList(keyStr, l)
+	e.touch()
+	s.changed(keyStr)
+	return popped, true, nil
+}
+
+/*
+LLen returns the length of a list
+
+Implements Redis LLEN. Missing keys count as empty lists.
+*/
+func (s *Storage) LLen(key []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l, err := listOf(s.lookupRead(string(key)))
+	if err != nil || l == nil {
+		return 0, err
+	}
+	return len(l.items), nil
+}
+
+/*
+LRange returns the elements between start and stop (both inclusive)
+
+Implements Redis LRANGE. Supports negative indices; out of range indices
+are clamped instead of being an error.
+*/
+func (s *Storage) LRange(key []byte, start, stop int) ([][]byte, error) {
+	items, err := s.listRange(key, start, stop)
+	return s.readSlices(items), err
+}
+
+/*
+listRange is LRange returning the stored elements themselves, whatever
+SetCopyOnRead says; the caller must not modify them
+*/
+func (s *Storage) listRange(key []byte, start, stop int) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	l, err := listOf(e)
+	if err != nil || l == nil {
+		return [][]byte{}, err
+	}
+	e.touch()
+
+	from, to, ok := normalizeRange(start, stop, len(l.items))
+	if !ok {
+		return [][]byte{}, nil
+	}
+
+	result := make([][]byte, to-from)
+	copy(result, l.items[from:to])
+	return result, nil
+}
+
+/*
+LIndex returns the element at index
+
+Implements Redis LINDEX. Negative indices count from the tail.
+
+Returns: The element and false if the key is missing or the index is out of range
+*/
+func (s *Storage) LIndex(key []byte, index int) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	l, err := listOf(e)
+	if err != nil || l == nil {
+		return nil, false, err
+	}
+	e.touch()
+
+	if index < 0 {
+		index = len(l.items) + index
+	}
+	if index < 0 || index >= len(l.items) {
+		return nil, false, nil
+	}
+	return s.readBytes(l.items[index]), true, nil
+}
+
+/*
+LInsert inserts value before or after the first occurrence of pivot
+
+Implements Redis LINSERT.
+
+Returns: The new length of the list, 0 if the key doesn't exist,
+or -1 if pivot wasn't found
+*/
+func (s *Storage) LInsert(key []byte, before bool, pivot, value []byte) (int, error) {
+	if err := s.checkElements(value); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	l, err := listOf(e)
+	if err != nil || l == nil {
+		return 0, err
+	}
+
+	for i, item := range l.items {
+		if string(item) != string(pivot) {
+			continue
+		}
+		if err := s.checkLength(len(l.items) + 1); err != nil {
+			return 0, err
+		}
+		if !before {
+			i++
+		}
+		l.items = append(l.items, nil)
+		copy(l.items[i+1:], l.items[i:])
+		l.items[i] = ownBytes(value)
+		l.dropStaleBuf()
+		e.touch()
+		s.changed(keyStr)
+		return len(l.items), nil
+	}
+
+	return -1, nil
+}
+
+/*
+LSet overwrites the element at index
+
+Implements Redis LSET. Unlike most list commands, LSET fails on a missing
+key instead of creating it.
+
+Returns: errNoSuchKey for a missing key, errIndexOutOfRange for a bad index
+*/
+func (s *Storage) LSet(key []byte, index int, value []byte) error {
+	if err := s.checkElements(value); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	l, err := listOf(e)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return errNoSuchKey
+	}
+
+	if index < 0 {
+		index = len(l.items) + index
+	}
+	if index < 0 || index >= len(l.items) {
+		return errIndexOutOfRange
+	}
+
+	l.items[index] = ownBytes(value)
+	e.touch()
+	s.changed(keyStr)
+	return nil
+}
+
+/*
+LRem removes elements equal to value
+
+Implements Redis LREM. The count argument selects which occurrences go:
+  - count > 0: the first count occurrences, scanning from head to tail
+  - count < 0: the last |count| occurrences, scanning from tail to head
+  - count = 0: every occurrence
+
+Returns: The number of removed elements
+*/
+func (s *Storage) LRem(key []byte, count int, value []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	l, err := listOf(e)
+	if err != nil || l == nil {
+		return 0, err
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	// Mark the elements to drop, walking from the end count selects
+	remove := make([]bool, len(l.items))
+	removed := 0
+	for n := 0; n < len(l.items) && (limit == 0 || removed < limit); n++ {
+		i := n
+		if count < 0 {
+			i = len(l.items) - 1 - n
+		}
+		if string(l.items[i]) == string(value) {
+			remove[i] = true
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	kept := l.items[:0]
+	for i, item := range l.items {
+		if !remove[i] {
+			kept = append(kept, item)
+		}
+	}
+	clear(l.items[len(kept):])
+	l.items = kept
+
+	s.deleteIfEmptyList(keyStr, l)
+	e.touch()
+	s.changed(keyStr)
+	return removed, nil
+}
+
+/*
+LTrim trims a list so it only contains the elements between start and stop
+
+Implements Redis LTRIM. Indices work like in LRANGE. Trimming to an empty
+range deletes the key.
+*/
+func (s *Storage) LTrim(key []byte, start, stop int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	l, err := listOf(e)
+	if err != nil || l == nil {
+		return err
+	}
+
+	from, to, ok := normalizeRange(start, stop, len(l.items))
+	if !ok {
+		l.items = nil
+	} else {
+		// Copy so the dropped elements don't stay reachable through the old array
+		l.items = append([][]byte(nil), l.items[from:to]...)
+	}
+	l.buf = nil
+
+	s.deleteIfEmptyList(keyStr, l)
+	e.touch()
+	s.changed(keyStr)
+	return nil
+}
+
+/*
+deleteIfEmptyList removes a list key once its last element is gone
+
+Must be called with the write lock held.
+*/
+func (s *Storage) deleteIfEmptyList(keyStr string, l *listValue) {
+	if len(l.items) == 0 {
+		s.deleteEntry(keyStr)
+	}
+}
@@ -0,0 +1,259 @@
+package goredis
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Memory Limit for Redis Clone
+
+With -maxMemory the server keeps its data within a memory budget, like
+Redis' maxmemory: once the budget is exceeded it evicts keys according to
+the -maxMemoryPolicy, or rejects the commands that would use more memory
+(-OOM) if nothing may be evicted.
+
+The Go runtime complicates this. Memory isn't freed when a key is deleted
+but when the garbage collector next runs, and the heap normally grows to
+twice the live data before it does, so the budget is enforced together
+with the runtime's own memory limit.
+
+Key concepts:
+- Live Heap: Used memory is the heap that survived the last collection,
+  the closest the runtime gets to Redis' used_memory; between collections
+  it can't change, so the controller doesn't evict twice for one excess
+- Controller: A background job checks used memory every 100ms and evicts
+  (or starts rejecting writes) when it's above the budget, before the
+  heap grows further; while it rejects writes, it forces a collection
+  every second, since nothing else may trigger one
+- GOMEMLIMIT: Unless set already, the runtime's soft memory limit is set
+  to 1.5 times the budget, so the collector runs harder as the process
+  approaches it instead of letting garbage pile up; when GOMEMLIMIT is
+  set, the budget is capped at two thirds of it, keeping the same room
+  for garbage
+- Estimated Sizes: Eviction can't measure what it frees, so each key
+  counts for its estimated size, as MEMORY USAGE reports it; the next
+  collection shows what was really freed
+- Victims: Keys are picked by sampling, see eviction.go
+*/
+
+const (
+	memoryCheckInterval = 100 * time.Millisecond // time between controller checks
+	oomCollectInterval  = time.Second            // time between forced collections while rejecting writes
+)
+
+/*
+EvictionPolicy says which keys may be evicted and in what order, once
+Config.MaxMemory is exceeded
+*/
+type EvictionPolicy int
+
+const (
+	PolicyNoEviction     EvictionPolicy = iota // reject writes instead of evicting
+	PolicyAllKeysLRU                           // evict the least recently used keys
+	PolicyVolatileLRU                          // evict the least recently used keys with a TTL
+	PolicyAllKeysRandom                        // evict any keys
+	PolicyVolatileRandom                       // evict any keys with a TTL
+	PolicyVolatileTTL                          // evict the keys with a TTL closest to expiring
+)
+
+var evictionPolicyNames = []string{
+	PolicyNoEviction:     "noeviction",
+	PolicyAllKeysLRU:     "allkeys-lru",
+	PolicyVolatileLRU:    "volatile-lru",
+	PolicyAllKeysRandom:  "allkeys-random",
+	PolicyVolatileRandom: "volatile-random",
+	PolicyVolatileTTL:    "volatile-ttl",
+}
+
+func (p EvictionPolicy) String() string {
+	return evictionPolicyNames[p]
+}
+
+/*
+ParseEvictionPolicy parses a policy name as Redis spells it, e.g. "allkeys-lru"
+*/
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	for policy, policyName := range evictionPolicyNames {
+		if strings.EqualFold(name, policyName) {
+			return EvictionPolicy(policy), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown maxmemory policy %q", name)
+}
+
+/*
+volatile reports whether the policy only evicts keys with a TTL
+*/
+func (p EvictionPolicy) volatile() bool {
+	return p == PolicyVolatileLRU || p == PolicyVolatileRandom || p == PolicyVolatileTTL
+}
+
+/*
+ParseMemorySize parses a memory size the way Redis' config does
+
+Accepts plain bytes or a unit: k/kb, m/mb, g/gb (1000 or 1024 based).
+Example: "100mb" -> 104857600
+*/
+func ParseMemorySize(size string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+
+	lower := strings.ToLower(size)
+	scale := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower, scale = strings.TrimSuffix(lower, unit.suffix), unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/scale {
+		return 0, fmt.Errorf("invalid memory size %q", size)
+	}
+	return n * scale, nil
+}
+
+/*
+memoryPressure is the controller's state
+*/
+type memoryPressure struct {
+	// Set while used memory is above the budget and nothing could be
+	// evicted; writes that need memory are rejected meanwhile
+	oom atomic.Bool
+
+	// Controller goroutine only: GC cycle count when keys were last
+	// evicted, and when a collection was last forced
+	evictedAtCycle uint64
+	collectedAt    time.Time
+}
+
+/*
+configureMemoryLimit sets GOMEMLIMIT from maxmemory, unless it's set already
+*/
+func (s *Server) configureMemoryLimit() {
+	if s.MaxMemory == 0 {
+		return
+	}
+
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		slog.Info("keeping GOMEMLIMIT", "GOMEMLIMIT", limit, "maxmemory", s.MaxMemory)
+		return
+	}
+	limit := s.MaxMemory + s.MaxMemory/2
+	debug.SetMemoryLimit(limit)
+	slog.Info("set GOMEMLIMIT from maxmemory", "GOMEMLIMIT", limit, "maxmemory", s.MaxMemory)
+}
+
+/*
+memoryBudget returns the used memory the controller allows
+
+maxmemory, capped at two thirds of GOMEMLIMIT. 0 means unlimited.
+*/
+func (s *Server) memoryBudget(m memoryStats) int64 {
+	if s.MaxMemory == 0 {
+		return 0
+	}
+	budget := s.MaxMemory
+	if m.memoryLimit < math.MaxInt64 && int64(m.memoryLimit/3*2) < budget {
+		budget = int64(m.memoryLimit / 3 * 2)
+	}
+	return budget
+}
+
+/*
+memoryLoop runs the pressure controller until the server stops
+*/
+func (s *Server) memoryLoop() {
+	if s.MaxMemory == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.relieveMemoryPressure()
+		case <-s.quitChannel:
+			return
+		}
+	}
+}
+
+/*
+relieveMemoryPressure evicts keys, or rejects writes, while used memory
+is above the budget
+*/
+func (s *Server) relieveMemoryPressure() {
+	// Rejected writes allocate nothing, so the collector may never run to see memory freed by DEL
+	if s.pressure.oom.Load() && time.Since(s.pressure.collectedAt) >= oomCollectInterval {
+		runtime.GC()
+		s.pressure.collectedAt = time.Now()
+	}
+
+	m := readMemoryStats()
+	used, budget := int64(m.live), s.memoryBudget(m)
+	if used <= budget {
+		s.pressure.oom.Store(false)
+		return
+	}
+
+	// The live heap hasn't been measured again since the last eviction
+	if m.gcCycles == s.pressure.evictedAtCycle {
+		return
+	}
+
+	excess := used - budget
+	if s.MaxMemoryPolicy != PolicyNoEviction {
+		if freed := s.storage.Evict(s.MaxMemoryPolicy, s.MaxMemorySamples, excess); freed > 0 {
+			s.pressure.evictedAtCycle = m.gcCycles
+			if freed >= excess {
+				s.pressure.oom.Store(false)
+				return
+			}
+		}
+	}
+	s.pressure.oom.Store(true)
+}
+
+/*
+checkMemory rejects commands that need memory while the server is out of it
+*/
+func (s *Server) checkMemory(cmd Command) error {
+	if s.pressure.oom.Load() && deniedOnOOM(cmd) {
+		return errOOM
+	}
+	return nil
+}
+
+/*
+deniedOnOOM reports whether cmd may grow the dataset
+
+Writes that only remove data stay allowed, so clients can free memory.
+*/
+func deniedOnOOM(cmd Command) bool {
+	if _, ok := cmd.(writeCommand); !ok {
+		return false
+	}
+	switch cmd.(type) {
+	case DelCommand, PopCommand, LRemCommand, LTrimCommand, SRemCommand, SPopCommand,
+		HDelCommand, ZRemCommand:
+		return false
+	}
+	return true
+}
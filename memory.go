@@ -0,0 +1,281 @@
+package goredis
+
+import (
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+)
+
+/*
+Memory Reporting for Redis Clone
+
+Redis reports memory as seen by its allocator; here the Go runtime is the
+allocator, so MEMORY STATS reads runtime/metrics and presents the numbers
+under the names Redis tools look for, plus a few about the garbage
+collector.
+
+Key concepts:
+- Allocated: Bytes of heap objects, live ones and garbage not collected yet
+- Live: Bytes of the heap objects that survived the last collection, the
+  closest match to what Redis calls used memory (INFO used_memory)
+- Active: Allocated plus the unused space in the heap spans holding those
+  objects
+- Resident: Everything the runtime got from the OS and hasn't given back
+  (stacks and runtime metadata included), an estimate of the RSS
+- Fragmentation: Resident divided by allocated; much more than 1 means the
+  runtime keeps memory it doesn't need right now, which MEMORY PURGE
+  returns to the OS
+- Key Sizes: MEMORY USAGE estimates the memory of one key from its data
+  and the usual overhead of the structures holding it; for collections
+  it samples a few elements and extrapolates, like Redis
+*/
+
+const (
+	memoryUsageSamples = 5 // elements sampled by MEMORY USAGE by default
+
+	// entryOverhead estimates the memory of a key beyond its name and
+	// value: the map slot, the entry and the key's string header
+	entryOverhead = 96
+)
+
+/*
+Runtime metrics read by readMemoryStats, in the order of memoryStats' fields
+*/
+var memoryMetrics = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/unused:bytes",
+	"/memory/classes/heap/released:bytes",
+	"/memory/classes/total:bytes",
+	"/gc/heap/live:bytes",
+	"/gc/heap/objects:objects",
+	"/gc/cycles/total:gc-cycles",
+	"/gc/heap/goal:bytes",
+	"/gc/gogc:percent",
+	"/gc/gomemlimit:bytes",
+	"/sched/goroutines:goroutines",
+}
+
+/*
+memoryStats is a snapshot of the Go runtime's memory use
+*/
+type memoryStats struct {
+	allocated   uint64 // bytes in heap objects
+	unused      uint64 // bytes in heap spans but not in objects
+	released    uint64 // heap bytes returned to the OS
+	total       uint64 // bytes mapped by the runtime
+	live        uint64 // bytes of heap objects that survived the last GC
+	objects     uint64 // heap objects
+	gcCycles    uint64 // completed GC cycles
+	heapGoal    uint64 // heap size at which the next GC starts
+	gogc        uint64 // GOGC percentage
+	memoryLimit uint64 // GOMEMLIMIT in bytes
+	goroutines  uint64
+}
+
+/*
+readMemoryStats reads the runtime's current memory use
+
+Unlike runtime.ReadMemStats, reading metrics doesn't stop the world.
+*/
+func readMemoryStats() memoryStats {
+	samples := make([]metrics.Sample, len(memoryMetrics))
+	for i, name := range memoryMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	values := make([]uint64, len(samples))
+	for i, sample := range samples {
+		// Metrics unknown to this Go version read as KindBad and stay 0
+		if sample.Value.Kind() == metrics.KindUint64 {
+			values[i] = sample.Value.Uint64()
+		}
+	}
+
+	return memoryStats{
+		allocated:   values[0],
+		unused:      values[1],
+		released:    values[2],
+		total:       values[3],
+		live:        values[4],
+		objects:     values[5],
+		gcCycles:    values[6],
+		heapGoal:    values[7],
+		gogc:        values[8],
+		memoryLimit: values[9],
+		goroutines:  values[10],
+	}
+}
+
+/*
+active returns the bytes of heap spans holding objects
+*/
+func (m memoryStats) active() uint64 {
+	return m.allocated + m.unused
+}
+
+/*
+resident returns the bytes the runtime holds from the OS
+*/
+func (m memoryStats) resident() uint64 {
+	return m.total - m.released
+}
+
+/*
+respWriteMemoryStats writes MEMORY STATS' reply
+
+Like Redis, the reply is a flat array of names, each followed by its
+value: an integer, or a bulk string for ratios. The compression fields
+are only there when compression is given (see compression.go).
+*/
+func respWriteMemoryStats(m memoryStats, keys int, compression *CompressionStats) []byte {
+	buf := getRespBuffer()
+	fields := 0
+	field := func(name string, value []byte) {
+		buf.WriteString("$" + strconv.Itoa(len(name)) + "\r\n" + name + "\r\n")
+		buf.Write(value)
+		fields++
+	}
+	integer := func(v uint64) []byte {
+		return []byte(":" + strconv.FormatUint(v, 10) + "\r\n")
+	}
+	ratio := func(a, b uint64) []byte {
+		r := 0.0
+		if b > 0 {
+			r = float64(a) / float64(b)
+		}
+		return respWriteBulkString(strconv.AppendFloat(nil, r, 'f', 3, 64))
+	}
+	difference := func(a, b uint64) []byte {
+		return []byte(":" + strconv.FormatInt(int64(a)-int64(b), 10) + "\r\n")
+	}
+
+	field("total.allocated", integer(m.allocated))
+	field("keys.count", integer(uint64(keys)))
+	field("allocator.allocated", integer(m.allocated))
+	field("allocator.active", integer(m.active()))
+	field("allocator.resident", integer(m.resident()))
+	field("allocator-fragmentation.ratio", ratio(m.active(), m.allocated))
+	field("allocator-fragmentation.bytes", difference(m.active(), m.allocated))
+	field("fragmentation", ratio(m.resident(), m.allocated))
+	field("fragmentation.bytes", difference(m.resident(), m.allocated))
+	field("heap.live", integer(m.live))
+	field("heap.objects", integer(m.objects))
+	field("gc.cycles", integer(m.gcCycles))
+	field("gc.heap-goal", integer(m.heapGoal))
+	field("gc.gogc", integer(m.gogc))
+	field("gc.memory-limit", integer(m.memoryLimit))
+	field("goroutines", integer(m.goroutines))
+	if compression != nil {
+		field("compression.keys", integer(uint64(compression.Keys)))
+		field("compression.raw-bytes", integer(uint64(compression.RawBytes)))
+		field("compression.stored-bytes", integer(uint64(compression.StoredBytes)))
+		field("compression.ratio", ratio(uint64(compression.RawBytes), uint64(compression.StoredBytes)))
+	}
+
+	reply := releaseRespBuffer(buf)
+	return append([]byte("*"+strconv.Itoa(fields*2)+"\r\n"), reply...)
+}
+
+/*
+MemoryUsage estimates the bytes used by key and its value
+
+Implements MEMORY USAGE. Collections are estimated from up to samples of
+their elements (all of them when samples is 0).
+
+Returns: The estimate and false if the key doesn't exist
+*/
+func (s *Storage) MemoryUsage(key []byte, samples int) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keyStr := string(key)
+	e := s.lookupRead(keyStr)
+	if e == nil {
+		return 0, false
+	}
+	return estimateSize(keyStr, e, samples), true
+}
+
+/*
+estimateSize estimates the bytes used by a key and its entry
+
+Each element counts for its data plus the headers and map slots holding
+it; collections larger than samples are extrapolated from their first
+samples elements (samples 0 means all).
+*/
+func estimateSize(keyStr string, e *entry, samples int) int {
+	size := len(keyStr) + entryOverhead
+	switch v := e.value.(type) {
+	case int64:
+		size += 8
+	case []byte:
+		// Counting the spare capacity APPEND leaves (see Storage.appendCapacity)
+		size += 24 + cap(v)
+	case *compressedString:
+		size += 40 + len(v.data)
+	case *sparseString:
+		// Each page is a map slot, a slice header and the page itself
+		size += 48 + len(v.pages)*(40+sparsePageSize)
+	case *listValue:
+		size += sampledSize(len(v.items), samples, func(i int) int {
+			return 24 + len(v.items[i])
+		})
+	case *setValue:
+		// The index map shares the member strings
+		size += sampledSize(len(v.members), samples, func(i int) int {
+			return 48 + len(v.members[i])
+		})
+	case *zsetValue:
+		// The scores map shares the member strings; a skiplist node has
+		// 4/3 levels on average
+		node := v.sorted.first()
+		size += sampledSize(v.len(), samples, func(int) int {
+			member := node.item.member
+			node = node.next()
+			return 112 + len(member)
+		})
+	case *hashValue:
+		sampled, sampledBytes := 0, 0
+		for field, value := range v.fields {
+			if samples > 0 && sampled == samples {
+				break
+			}
+			sampled++
+			sampledBytes += 48 + len(field) + len(value)
+		}
+		if sampled > 0 {
+			size += sampledBytes * len(v.fields) / sampled
+		}
+		// Field TTLs: a map entry sharing the field string
+		size += 40 * len(v.expires)
+	}
+	return size
+}
+
+/*
+sampledSize sums elementSize over n elements, or extrapolates it from
+the first samples ones
+*/
+func sampledSize(n, samples int, elementSize func(i int) int) int {
+	if samples == 0 || samples > n {
+		samples = n
+	}
+	if samples == 0 {
+		return 0
+	}
+
+	total := 0
+	for i := 0; i < samples; i++ {
+		total += elementSize(i)
+	}
+	return total * n / samples
+}
+
+/*
+purgeMemory runs a garbage collection and returns as much memory as
+possible to the OS
+*/
+func purgeMemory() {
+	debug.FreeOSMemory()
+}
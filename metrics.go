@@ -0,0 +1,168 @@
+package goredis
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Throughput Metrics for Redis Clone
+
+INFO stats reports totals since startup (commands processed, bytes read
+and written, connections received) along with how fast they grow right
+now, the way Redis computes its instantaneous_* fields.
+
+Key concepts:
+- Counters: Totals are atomic counters bumped where the work happens:
+  commands in the server loop, bytes by a wrapper around every
+  connection (WebSocket payloads included), connections and failed
+  accepts in the accept loop
+- Sampling: A background job looks at the counters every 100ms and turns
+  the growth since its last look into a per-second rate
+- Sliding Window: The instantaneous values are the average of the last 16
+  samples, so they follow the load of the last 1.6 seconds without jumping
+  on every burst
+*/
+
+const (
+	metricsInterval = 100 * time.Millisecond // how often the rates are sampled
+	metricsSamples  = 16                     // samples averaged into an instantaneous value
+)
+
+/*
+Rates kept by the sampler, indexes into serverStats.rates
+*/
+const (
+	rateCommands = iota
+	rateNetInput
+	rateNetOutput
+	rateCount
+)
+
+/*
+serverStats holds the server's throughput counters and their rates
+*/
+type serverStats struct {
+	connectionsReceived atomic.Int64
+	acceptErrors        atomic.Int64 // failed accepts, see listener.go
+	listenerRebinds     atomic.Int64 // broken listeners replaced
+	commandsProcessed   atomic.Int64
+	netInputBytes       atomic.Int64
+	netOutputBytes      atomic.Int64
+
+	mu    sync.Mutex // guards rates, written by the sampler and read by INFO
+	rates [rateCount]rollingRate
+}
+
+/*
+rollingRate is a per-second rate averaged over the last metricsSamples samples
+*/
+type rollingRate struct {
+	samples   [metricsSamples]float64
+	next      int   // where the next sample goes
+	lastValue int64 // the counter at the previous sample
+	lastTime  time.Time
+}
+
+/*
+sample records how fast the counter grew since the previous sample
+*/
+func (r *rollingRate) sample(value int64, now time.Time) {
+	if !r.lastTime.IsZero() {
+		if elapsed := now.Sub(r.lastTime); elapsed > 0 {
+			r.samples[r.next] = float64(value-r.lastValue) / elapsed.Seconds()
+			r.next = (r.next + 1) % metricsSamples
+		}
+	}
+	r.lastValue = value
+	r.lastTime = now
+}
+
+/*
+average returns the rate per second over the sliding window
+*/
+func (r *rollingRate) average() float64 {
+	var sum float64
+	for _, v := range r.samples {
+		sum += v
+	}
+	return sum / metricsSamples
+}
+
+/*
+sample records one sample of every rate
+*/
+func (st *serverStats) sample(now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.rates[rateCommands].sample(st.commandsProcessed.Load(), now)
+	st.rates[rateNetInput].sample(st.netInputBytes.Load(), now)
+	st.rates[rateNetOutput].sample(st.netOutputBytes.Load(), now)
+}
+
+/*
+instantaneous returns the current per-second value of a rate
+*/
+func (st *serverStats) instantaneous(rate int) float64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.rates[rate].average()
+}
+
+/*
+metricsLoop samples the rates until the server stops
+*/
+func (s *Server) metricsLoop() {
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.stats.sample(now)
+		case <-s.quitChannel:
+			return
+		}
+	}
+}
+
+/*
+countingConn counts the bytes read from and written to a connection
+*/
+type countingConn struct {
+	net.Conn
+	stats *serverStats
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.stats.netInputBytes.Add(int64(n))
+	return n, err
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.stats.netOutputBytes.Add(int64(n))
+	return n, err
+}
+
+/*
+WriteBuffers writes bufs to the wrapped connection, with one writev when
+it's a TCP connection and as one message when it's a WebSocket (see
+replies.go)
+*/
+func (c countingConn) WriteBuffers(bufs *net.Buffers, more bool) (int64, error) {
+	var n int64
+	var err error
+	if w, ok := c.Conn.(buffersWriter); ok {
+		n, err = w.WriteBuffers(bufs, more)
+	} else {
+		n, err = bufs.WriteTo(c.Conn)
+	}
+	c.stats.netOutputBytes.Add(n)
+	return n, err
+}
@@ -0,0 +1,75 @@
+package goredis_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+/*
+counter returns an integer INFO field
+*/
+func counter(t *testing.T, fields map[string]string, name string) int64 {
+	t.Helper()
+
+	n, err := strconv.ParseInt(fields[name], 10, 64)
+	if err != nil {
+		t.Fatalf("INFO field %s: %q is not an integer", name, fields[name])
+	}
+	return n
+}
+
+func TestThroughputCounters(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	// Every command is counted, and every byte both ways
+	const pings = 100
+	_, before := info(t, client, "stats")
+	commands := make([][]string, pings)
+	for i := range commands {
+		commands[i] = []string{"PING"}
+	}
+	client.pipeline(commands...)
+	for range pings {
+		client.read()
+	}
+	_, after := info(t, client, "stats")
+	if got := counter(t, after, "total_commands_processed") - counter(t, before, "total_commands_processed"); got != pings+1 {
+		t.Errorf("total_commands_processed grew by %d, want %d", got, pings+1)
+	}
+	sent := int64(pings*len(encodeCommand([]string{"PING"})) + len(encodeCommand([]string{"INFO", "stats"})))
+	if got := counter(t, after, "total_net_input_bytes") - counter(t, before, "total_net_input_bytes"); got != sent {
+		t.Errorf("total_net_input_bytes grew by %d, want %d", got, sent)
+	}
+	if got := counter(t, after, "total_net_output_bytes") - counter(t, before, "total_net_output_bytes"); got < pings*int64(len("+PONG\r\n")) {
+		t.Errorf("total_net_output_bytes grew by %d, less than the %d PONGs", got, pings)
+	}
+
+}
+
+func TestInstantaneousRates(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	// A steady load for a few samples shows in the rates
+	commands := make([][]string, 1000)
+	for i := range commands {
+		commands[i] = []string{"SET", "key", "value"}
+	}
+	for start := time.Now(); time.Since(start) < 500*time.Millisecond; {
+		client.pipeline(commands...)
+		for range commands {
+			client.read()
+		}
+	}
+	_, fields := info(t, client, "stats")
+	if ops := counter(t, fields, "instantaneous_ops_per_sec"); ops <= 0 {
+		t.Errorf("instantaneous_ops_per_sec: got %d under load", ops)
+	}
+	for _, name := range []string{"instantaneous_input_kbps", "instantaneous_output_kbps"} {
+		if kbps, err := strconv.ParseFloat(fields[name], 64); err != nil || kbps <= 0 {
+			t.Errorf("%s: got %q under load", name, fields[name])
+		}
+	}
+}
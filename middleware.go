@@ -0,0 +1,147 @@
+package goredis
+
+import (
+	"net"
+	"strings"
+)
+
+/*
+Command Middleware for Redis Clone
+
+This file lets code embedding the server wrap command dispatch with its
+own logic, the same way HTTP middleware wraps a handler: custom
+authentication, logging, quotas, or rewriting requests before they run.
+
+A Middleware receives the next handler in the chain and returns a new
+handler, which may inspect the request, call next (or not), and inspect
+or replace its reply:
+
+	server.Use(func(next goredis.CommandHandler) goredis.CommandHandler {
+		return func(req *goredis.Request) ([]byte, error) {
+			if req.Name() == "FLUSHALL" {
+				return nil, errors.New("NOPERM FLUSHALL is disabled")
+			}
+			return next(req)
+		}
+	})
+
+Key concepts:
+- Ordering: Middleware registered first runs first (outermost); the last
+  handler in the chain executes the command
+- Server Loop: Handlers run on the server loop goroutine, one command at a
+  time, so they need no locking but must not block
+- Replies: A handler returns what Command.Execute returns: a complete RESP
+  reply, sent as is, nil for a null reply, or an error
+  whose text (which should start with an error code such as "ERR") is sent
+  as a RESP error. Replies may be shared (small integers, for one), so a
+  handler replaces a reply instead of modifying it
+- Scope: Middleware sees every command that reaches the server loop; a
+  client in subscribed mode is limited before the chain runs (see
+  subscribedModeReply), and commands that fail to parse never reach it
+*/
+
+/*
+Request is a command on its way through the middleware chain
+*/
+type Request struct {
+	args    [][]byte
+	cmd     Command
+	peer    *Peer
+	parts   net.Buffers // a large reply left in parts by dispatch (see replies.go)
+	stream  replyStream // a huge reply left as a stream by dispatch (see streaming.go)
+	blocked bool        // the command blocked the client, its reply comes later (see blocking.go)
+}
+
+/*
+CommandHandler handles a request and returns its result (see Command.Execute)
+*/
+type CommandHandler func(req *Request) ([]byte, error)
+
+/*
+Middleware wraps a CommandHandler with additional behavior
+*/
+type Middleware func(next CommandHandler) CommandHandler
+
+/*
+Name returns the command name, upper-case (e.g. "SET")
+*/
+func (r *Request) Name() string {
+	return strings.ToUpper(string(r.args[0]))
+}
+
+/*
+protocol returns the RESP version of the client that sent the request,
+2 for a request that doesn't come from a client
+*/
+func (r *Request) protocol() int {
+	if r.peer == nil {
+		return 2
+	}
+	return r.peer.session.protocol
+}
+
+/*
+Args returns the arguments following the command name
+
+The slices are shared with the parsed command and must not be modified;
+use Rewrite to change the request.
+*/
+func (r *Request) Args() [][]byte {
+	return r.args[1:]
+}
+
+/*
+RemoteAddr returns the network address of the client that sent the request
+
+It identifies the connection, so per-client state (authentication,
+quotas) can be kept in a map keyed by its string form.
+*/
+func (r *Request) RemoteAddr() net.Addr {
+	return r.peer.connect.RemoteAddr()
+}
+
+/*
+Blocked reports whether the command blocked the client, like BLPOP on empty lists
+
+The result of a blocked command is nil and isn't sent; the client gets its
+reply once it's served or times out.
+*/
+func (r *Request) Blocked() bool {
+	return r.blocked
+}
+
+/*
+Rewrite replaces the request with another command, given as name and arguments
+
+The new command is parsed like one sent by the client, and the handlers
+further down the chain see the rewritten request.
+
+Returns: The parse error if the new command is invalid; the request is
+left unchanged in that case
+*/
+func (r *Request) Rewrite(name string, args ...[]byte) error {
+	rewritten := append([][]byte{[]byte(name)}, args...)
+	cmd, err := r.peer.parseCommand(rewritten)
+	if err != nil {
+		return err
+	}
+
+	r.args = rewritten
+	r.cmd = cmd
+	return nil
+}
+
+/*
+Use appends middleware to the command dispatch chain
+
+Middleware runs in the order it was added. Use must be called before Start.
+*/
+func (s *Server) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+
+	// Wrap from the innermost handler outwards, so the first middleware runs first
+	s.handler = s.dispatch
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		s.handler = s.middleware[i](s.handler)
+	}
+}
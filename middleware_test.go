@@ -0,0 +1,156 @@
+package goredis_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+func TestUseRunsMiddlewareInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) goredis.Middleware {
+		return func(next goredis.CommandHandler) goredis.CommandHandler {
+			return func(req *goredis.Request) ([]byte, error) {
+				mu.Lock()
+				calls = append(calls, name+" "+req.Name())
+				mu.Unlock()
+				return next(req)
+			}
+		}
+	}
+
+	server := startServer(t, func(server *goredis.Server) {
+		server.Use(record("first"), record("second"))
+		server.Use(record("third"))
+	})
+	client := dial(t, server)
+	client.expect("+PONG\r\n", "ping")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"first PING", "second PING", "third PING"}; !slices.Equal(calls, want) {
+		t.Errorf("calls: got %v, want %v", calls, want)
+	}
+}
+
+func TestUseCanRejectAndReplace(t *testing.T) {
+	server := startServer(t, func(server *goredis.Server) {
+		server.Use(func(next goredis.CommandHandler) goredis.CommandHandler {
+			return func(req *goredis.Request) ([]byte, error) {
+				switch req.Name() {
+				case "FLUSHALL":
+					return nil, errors.New("NOPERM FLUSHALL is disabled")
+				case "GET":
+					// Inspect the reply, and replace it instead of modifying it
+					reply, err := next(req)
+					if err != nil || reply == nil {
+						return reply, err
+					}
+					return bytes.ToUpper(reply), nil
+				}
+				return next(req)
+			}
+		})
+	})
+	client := dial(t, server)
+
+	client.expect("-NOPERM FLUSHALL is disabled\r\n", "FLUSHALL")
+	client.expect("+OK\r\n", "SET", "name", "john")
+	client.expect("$4\r\nJOHN\r\n", "GET", "name")
+	client.expect("$-1\r\n", "GET", "missing")
+	client.expect(":1\r\n", "EXISTS", "name")
+}
+
+func TestRequestRewrite(t *testing.T) {
+	var mu sync.Mutex
+	var rewriteErrors []error
+	server := startServer(t, func(server *goredis.Server) {
+		// Every client gets keys of its own, by prefixing them with its address
+		server.Use(func(next goredis.CommandHandler) goredis.CommandHandler {
+			return func(req *goredis.Request) ([]byte, error) {
+				if req.Name() != "SET" && req.Name() != "GET" {
+					return next(req)
+				}
+				args := slices.Clone(req.Args())
+				args[0] = []byte(req.RemoteAddr().String() + ":" + string(args[0]))
+				if err := req.Rewrite(req.Name(), args...); err != nil {
+					return nil, err
+				}
+				return next(req)
+			}
+		})
+
+		// An invalid rewrite fails and leaves the request as it was
+		server.Use(func(next goredis.CommandHandler) goredis.CommandHandler {
+			return func(req *goredis.Request) ([]byte, error) {
+				if req.Name() == "SET" {
+					err := req.Rewrite("SET")
+					mu.Lock()
+					rewriteErrors = append(rewriteErrors, err)
+					mu.Unlock()
+				}
+				return next(req)
+			}
+		})
+	})
+
+	alice, bob := dial(t, server), dial(t, server)
+	alice.expect("+OK\r\n", "SET", "name", "Alice")
+	bob.expect("+OK\r\n", "SET", "name", "Bob")
+	alice.expect("$5\r\nAlice\r\n", "GET", "name")
+	bob.expect("$3\r\nBob\r\n", "GET", "name")
+
+	keys := alice.do("KEYS", "*")
+	if !strings.HasPrefix(keys, "*2\r\n") || strings.Contains(keys, "$4\r\nname\r\n") {
+		t.Errorf("KEYS: got %q, want two prefixed keys", keys)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rewriteErrors) != 2 {
+		t.Fatalf("got %d rewrite attempts, want 2", len(rewriteErrors))
+	}
+	for _, err := range rewriteErrors {
+		if err == nil || !strings.Contains(err.Error(), "wrong number of arguments") {
+			t.Errorf("invalid rewrite: got error %v, want wrong number of arguments", err)
+		}
+	}
+}
+
+func TestRequestBlocked(t *testing.T) {
+	blocked := make(chan bool, 1)
+	server := startServer(t, func(server *goredis.Server) {
+		server.Use(func(next goredis.CommandHandler) goredis.CommandHandler {
+			return func(req *goredis.Request) ([]byte, error) {
+				reply, err := next(req)
+				if req.Name() == "BLPOP" {
+					blocked <- req.Blocked()
+				}
+				return reply, err
+			}
+		})
+	})
+	client := dial(t, server)
+
+	client.send("BLPOP", "jobs", "0")
+	if !<-blocked {
+		t.Error("BLPOP on an empty list: Blocked is false, want true")
+	}
+	other := dial(t, server)
+	other.expect(":1\r\n", "RPUSH", "jobs", "a")
+	if got, want := client.read(), "*2\r\n$4\r\njobs\r\n$1\r\na\r\n"; got != want {
+		t.Errorf("BLPOP: got %q, want %q", got, want)
+	}
+
+	other.expect(":1\r\n", "RPUSH", "jobs", "b")
+	client.expect("*2\r\n$4\r\njobs\r\n$1\r\nb\r\n", "BLPOP", "jobs", "0")
+	if <-blocked {
+		t.Error("BLPOP on a list with elements: Blocked is true, want false")
+	}
+}
@@ -0,0 +1,46 @@
+package goredis_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().SetCompressThreshold(64)
+	})
+	client := dial(t, server)
+
+	client.expect(":1\r\n", "RPUSH", "list", "a")
+	client.expect(":2\r\n", "SADD", "ints", "1", "2")
+	client.expect(":1\r\n", "SADD", "set", "a")
+	client.expect(":1\r\n", "HSET", "hash", "a", "1")
+	client.expect(":1\r\n", "HSET", "fttl", "a", "1")
+	client.expect("*1\r\n:1\r\n", "HEXPIRE", "fttl", "100", "FIELDS", "1", "a")
+	client.expect(":1\r\n", "ZADD", "zset", "1", "a")
+	client.expect("+OK\r\n", "SET", "counter", "42")
+	client.expect("+OK\r\n", "SET", "name", "ann")
+	client.expect("+OK\r\n", "SET", "page", strings.Repeat("<p>hello</p>", 20))
+	client.expect(":1048577\r\n", "SETRANGE", "bits", "1048576", "x")
+
+	// Small collections get the same encoding as large ones, unlike in Redis
+	for key, want := range map[string]string{
+		"list":    "array",
+		"ints":    "hashtable",
+		"set":     "hashtable",
+		"hash":    "hashtable",
+		"fttl":    "hashtable",
+		"zset":    "skiplist",
+		"counter": "int",
+		"name":    "raw",
+		"page":    "compressed",
+		"bits":    "sparse",
+	} {
+		if got := client.do("OBJECT", "ENCODING", key); got != "$"+strconv.Itoa(len(want))+"\r\n"+want+"\r\n" {
+			t.Errorf("OBJECT ENCODING %s: got %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package goredis
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Output Buffers for Redis Clone
+
+Every reply handleMessage frames itself (an error, say) used to be built
+in a pooled buffer and then copied into a freshly allocated
+slice, since the peer's writer sends it later, on its own goroutine. With
+hundreds of thousands of commands a second those allocations keep the
+garbage collector busy. Instead, each peer has an output buffer its
+replies are framed into directly, reused for the life of the connection.
+
+Key concepts:
+- Carving: Each reply takes the next free bytes of the buffer, and the
+  writer sends that slice; the server loop only ever writes past what it
+  handed out, so the two never touch the same bytes
+- Reuse: The writer counts the replies from the buffer it has written;
+  once it has written all of them, the buffer is filled from the start
+  again
+- Growth: A buffer too full for a reply is replaced with one twice as big,
+  from 4 KB up to 64 KB (the writer may still be sending the old one);
+  longer replies are allocated on their own
+- Shrinking: Once a second the server loop shrinks the buffers of peers
+  that used less than half of them since the last check, and releases the
+  buffers of peers that sent nothing, so idle connections hold no memory
+*/
+
+const (
+	outputBufferSize          = 4 << 10 // first buffer of a peer
+	outputBufferMax           = 64 << 10
+	outputBufferCheckInterval = time.Second
+)
+
+/*
+outputBuffer is the buffer a peer's replies are framed into
+
+Only the server loop calls its methods; the writer only adds to written.
+*/
+type outputBuffer struct {
+	buf     []byte       // the buffer; replies are carved off its end
+	queued  int64        // replies carved off the buffers so far
+	written atomic.Int64 // of those, the ones the writer has written
+	peak    int          // most bytes in use since the last shrink
+}
+
+/*
+alloc returns an empty slice with room for a reply of exactly n bytes
+
+The second result tells whether it was carved off the buffer, so the
+reply must be sent with Peer.sendBuffered; replies longer than
+outputBufferMax get a slice of their own.
+*/
+func (o *outputBuffer) alloc(n int) ([]byte, bool) {
+	if n > outputBufferMax {
+		return make([]byte, 0, n), false
+	}
+
+	// The writer is done with every reply, so the whole buffer is free again
+	if o.queued == o.written.Load() {
+		o.buf = o.buf[:0]
+	}
+	if cap(o.buf)-len(o.buf) < n {
+		size := min(max(2*cap(o.buf), outputBufferSize), outputBufferMax)
+		o.buf = make([]byte, 0, max(size, n))
+	}
+
+	start := len(o.buf)
+	o.buf = o.buf[:start+n]
+	o.queued++
+	o.peak = max(o.peak, len(o.buf))
+	return o.buf[start:start:len(o.buf)], true
+}
+
+/*
+shrink releases the buffer if nothing was carved off it since the last
+call, or halves it if less than half of it was used
+*/
+func (o *outputBuffer) shrink() {
+	switch {
+	case o.peak == 0:
+		o.buf = nil
+	case o.peak < cap(o.buf)/2 && cap(o.buf) > outputBufferSize:
+		// The writer keeps the old buffer alive for as long as it needs it
+		o.buf = make([]byte, 0, max(cap(o.buf)/2, outputBufferSize))
+	}
+	o.peak = 0
+}
+
+/*
+shrinkOutputBuffers shrinks the output buffers of the connected peers
+
+Runs on the server loop, like everything else using them.
+*/
+func (s *Server) shrinkOutputBuffers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for peer := range s.peers {
+		peer.out.shrink()
+	}
+}
+
+/*
+bulkStringSize returns the length of the RESP bulk string holding n bytes
+*/
+func bulkStringSize(n int) int {
+	var digits [20]byte
+	return 1 + len(strconv.AppendInt(digits[:0], int64(n), 10)) + 2 + n + 2
+}
+
+/*
+appendBulkString appends data to buf as a RESP bulk string (see respWriteBulkString)
+*/
+func appendBulkString(buf, data []byte) []byte {
+	buf = append(buf, '$')
+	buf = strconv.AppendInt(buf, int64(len(data)), 10)
+	buf = append(buf, '\r', '\n')
+	buf = append(buf, data...)
+	return append(buf, '\r', '\n')
+}
+
+/*
+appendError appends a RESP error to buf (see respWriteError)
+*/
+func appendError(buf []byte, err string) []byte {
+	buf = append(buf, '-')
+	buf = append(buf, err...)
+	return append(buf, '\r', '\n')
+}
@@ -0,0 +1,110 @@
+package goredis_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+pipeline sends commands in one write, without reading their replies
+*/
+func (c *testClient) pipeline(commands ...[]string) {
+	c.t.Helper()
+
+	var buf bytes.Buffer
+	for _, args := range commands {
+		buf.Write(encodeCommand(args))
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		c.t.Fatalf("write pipeline: %v", err)
+	}
+}
+
+func TestBufferedRepliesSurviveALaggingWriter(t *testing.T) {
+	big := strings.Repeat("v", 200<<10)
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().Set([]byte("big"), []byte(big))
+		server.Storage().Set([]byte("text"), []byte("abc"))
+		server.Storage().Push([]byte("list"), [][]byte{[]byte("x")}, false)
+	})
+	client := dial(t, server)
+
+	/*
+		Error replies are framed in the output buffer while the big replies
+		ahead of them fill the socket, so the writer falls behind and the
+		buffer is grown and reused under it
+	*/
+	const n = 5000
+	var commands [][]string
+	var want []string
+	for i := range n {
+		switch {
+		case i%50 == 0:
+			commands = append(commands, []string{"GET", "big"})
+			want = append(want, fmt.Sprintf("$%d\r\n%s\r\n", len(big), big))
+		case i%2 == 0:
+			commands = append(commands, []string{"INCR", "text"})
+			want = append(want, "-ERR value is not an integer or out of range\r\n")
+		default:
+			commands = append(commands, []string{"GET", "list"})
+			want = append(want, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		}
+	}
+	client.pipeline(commands...)
+	time.Sleep(200 * time.Millisecond)
+
+	for i := range n {
+		if got := client.read(); got != want[i] {
+			t.Fatalf("reply %d: got %.80q, want %.80q", i, got, want[i])
+		}
+	}
+}
+
+func TestStalledClientIsDisconnected(t *testing.T) {
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().Set([]byte("big"), bytes.Repeat([]byte("v"), 64<<10))
+	})
+	stalled := dial(t, server)
+	other := dial(t, server)
+
+	// More replies than the socket and the outbox hold, none of them read
+	commands := make([][]string, 3000)
+	for i := range commands {
+		commands[i] = []string{"GET", "big"}
+	}
+	stalled.pipeline(commands...)
+	time.Sleep(100 * time.Millisecond)
+
+	// The server waits for the stalled client a while, then drops it and serves the others again
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		other.send("INFO", "clients")
+		other.conn.SetReadDeadline(deadline)
+		reply, err := readRawReply(other.reader)
+		if err != nil {
+			t.Fatalf("INFO from another client: %v", err)
+		}
+		if strings.Contains(string(reply), "connected_clients:1\r\n") {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// What the stalled client gets is cut short by the disconnect, a reset if replies were left unsent
+	stalled.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	received, err := io.Copy(io.Discard, stalled.conn)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("stalled client still connected after receiving %d bytes", received)
+	}
+	if full := int64(len(commands)) * (64<<10 + 12); received >= full {
+		t.Errorf("stalled client received all %d bytes of its replies", received)
+	}
+}
@@ -0,0 +1,136 @@
+package goredis
+
+/*
+Pattern Index for Redis Clone
+
+Every PUBLISH has to find the PSUBSCRIBE patterns matching its channel.
+Trying each pattern makes publishing cost O(patterns), which adds up when
+thousands of clients each subscribe to a pattern like "user.1234.*".
+Instead, patterns are indexed in a trie by their literal prefix (what
+comes before the first wildcard), and a publish only tries the patterns
+whose prefix the channel starts with.
+
+Key concepts:
+- Literal Prefix: The characters a match must start with: "news.*" has
+  "news.", "a\*b*" has "a*b", and "*.log" or "?x" have none
+- Candidates: A publish walks the trie along the channel, so it only
+  visits the patterns whose prefix is a prefix of the channel; each of
+  them is then matched in full with matchPattern
+- Unprefixed Patterns: Patterns starting with a wildcard sit at the root
+  and are tried for every channel, as before
+- Pruning: Nodes left without patterns or children are removed, so the
+  trie only holds what is subscribed
+*/
+
+/*
+patternIndex is a trie of patterns keyed by their literal prefix
+*/
+type patternIndex struct {
+	root patternNode
+}
+
+/*
+patternNode is a node of the trie: the patterns whose prefix ends here,
+and the nodes for longer prefixes
+*/
+type patternNode struct {
+	children map[byte]*patternNode
+	patterns []string
+}
+
+/*
+literalPrefix returns the characters every channel matching pattern
+starts with: the pattern up to its first wildcard, escapes resolved
+*/
+func literalPrefix(pattern string) string {
+	var prefix []byte
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*', '?', '[':
+			return string(prefix)
+		case '\\':
+			// A trailing backslash has nothing to escape and matches itself (see matchPattern)
+			if i+1 < len(pattern) {
+				i++
+			}
+			prefix = append(prefix, pattern[i])
+		default:
+			prefix = append(prefix, c)
+		}
+	}
+	return string(prefix)
+}
+
+/*
+add indexes a pattern, which must not be indexed already
+*/
+func (t *patternIndex) add(pattern string) {
+	node := &t.root
+	prefix := literalPrefix(pattern)
+	for i := 0; i < len(prefix); i++ {
+		child := node.children[prefix[i]]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[byte]*patternNode)
+			}
+			child = &patternNode{}
+			node.children[prefix[i]] = child
+		}
+		node = child
+	}
+	node.patterns = append(node.patterns, pattern)
+}
+
+/*
+remove drops a pattern from the index, pruning the nodes it leaves empty
+*/
+func (t *patternIndex) remove(pattern string) {
+	prefix := literalPrefix(pattern)
+	path := make([]*patternNode, 0, len(prefix)+1)
+	node := &t.root
+	path = append(path, node)
+	for i := 0; i < len(prefix); i++ {
+		if node = node.children[prefix[i]]; node == nil {
+			return
+		}
+		path = append(path, node)
+	}
+
+	for i, p := range node.patterns {
+		if p == pattern {
+			last := len(node.patterns) - 1
+			node.patterns[i] = node.patterns[last]
+			node.patterns[last] = ""
+			node.patterns = node.patterns[:last]
+			break
+		}
+	}
+
+	// Walk back up, unlinking nodes that hold nothing anymore
+	for i := len(path) - 1; i > 0; i-- {
+		if len(path[i].patterns) > 0 || len(path[i].children) > 0 {
+			break
+		}
+		delete(path[i-1].children, prefix[i-1])
+	}
+}
+
+/*
+match calls fn with every indexed pattern matching channel
+*/
+func (t *patternIndex) match(channel string, fn func(pattern string)) {
+	node := &t.root
+	for i := 0; ; i++ {
+		for _, pattern := range node.patterns {
+			if matchPattern(channel, pattern) {
+				fn(pattern)
+			}
+		}
+		if i == len(channel) {
+			return
+		}
+		if node = node.children[channel[i]]; node == nil {
+			return
+		}
+	}
+}
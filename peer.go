@@ -1,15 +1,18 @@
-package main
+package goredis
 
 import (
-	"fmt"
+	"bytes"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/tidwall/resp"
 )
 
 /*
@@ -27,6 +30,10 @@ Key concepts:
 - Command Parsing: Converting raw RESP data into typed Command structs
 - Goroutine per Client: Each client runs in its own goroutine for concurrency
 - Channel Communication: Peers communicate with the main server via channels
+- Stalled Clients: A client that stops reading its replies fills its
+  outbox, and the server loop then waits for the writer to make room;
+  once the writer has been stuck for peerStallTimeout, the client is
+  disconnected so it can't hold up everyone else
 */
 
 /*
@@ -37,21 +44,95 @@ It acts as a bridge between the network connection and the main server.
 
 Architecture:
   - connect: The actual TCP connection to the client
-  - messageChannel: Channel to send parsed commands to the main server
+  - scheduler: Where parsed commands are queued for the main server
+  - inbox: The commands queued, waiting for their turn (see schedule.go)
   - deleteChannel: Channel to notify the server when this client disconnects
-
-The peer runs in its own goroutine and continuously:
- 1. Reads RESP data from the client
- 2. Parses it into Command structs
- 3. Sends commands to the server via messageChannel
- 4. Sends responses back to the client
+  - outbox: Queue of replies waiting to be written to the client
+  - closed: Closed when the peer shuts down; tells the writer to flush and exit
+  - session: Connection-level state such as the client name and
+    subscriptions, only touched by the server loop (see session.go)
+  - trace: Whether the bytes exchanged are logged (see trace.go)
+  - out: The buffer replies are framed into (see outputbuffer.go)
+
+Each peer runs two goroutines:
+  - readLoop reads RESP data, parses it into Command structs and queues
+    them in the inbox, where the server loop takes them in turns
+  - writeLoop is the only code that writes to the connection; every reply
+    goes through Send and the outbox, so replies can never interleave.
+    Replies queued together are written together, with one vectored write
 */
 type Peer struct {
-	connect        net.Conn
-	messageChannel chan Message
-	deleteChannel  chan *Peer
+	connect       net.Conn
+	scheduler     *scheduler
+	inbox         []Message     // commands waiting for their turn, guarded by scheduler.mu
+	inboxBytes    int           // size of the arguments in inbox, guarded by scheduler.mu
+	room          chan struct{} // wakes the reader waiting for room in inbox
+	scheduled     bool          // in the scheduler's ring or its round, guarded by scheduler.mu
+	parked        bool          // blocked by a blocking command, guarded by scheduler.mu
+	quitting      atomic.Bool   // QUIT is queued; it drops a blocking command (see blocking.go)
+	deleteChannel chan *Peer
+	outbox        chan outgoing
+	closed        chan struct{}
+	closeOnce     sync.Once
+	session       session
+	trace         atomic.Bool // log every byte read and written (see trace.go)
+	streamBuf     []byte      // the writer's buffer for streamed replies (see streaming.go)
+	out           outputBuffer
+	outWritten    int64        // replies from out in the batch being written
+	writes        atomic.Int64 // writes to the connection so far, to tell a stalled writer from a slow one
+}
+
+/*
+peerOutboxSize is how many replies can be queued for a peer before Send blocks
+
+This lets the server loop run ahead of a slow client by a whole pipeline
+instead of waiting on every socket write.
+*/
+const peerOutboxSize = 1024
+
+/*
+peerStallTimeout is how long Send waits on a full outbox while the writer
+finishes no write, before disconnecting the client
+
+A client that reads slowly but steadily is waited for. Progress is only
+seen when a write returns, so this leaves a large batch time to go out
+over a slow link.
+*/
+const peerStallTimeout = 5 * time.Second
+
+/*
+peerWriteBatch is the most queued replies written with one vectored write
+*/
+const peerWriteBatch = 64
+
+/*
+outgoing is a reply queued in a peer's outbox: one slice, the parts of a
+large reply (see replies.go), or a stream (see streaming.go)
+*/
+type outgoing struct {
+	message  []byte
+	buffered bool // message was carved off the peer's output buffer
+	parts    net.Buffers
+	stream   replyStream
 }
 
+/*
+errPeerClosed is returned by Send once the peer has been closed
+*/
+var errPeerClosed = errors.New("peer connection closed")
+
+/*
+errPeerStalled is returned by Send when the client was disconnected for
+not reading its replies
+*/
+var errPeerStalled = errors.New("client stopped reading its replies")
+
+/*
+errParkedReadAhead drops a blocked client that queued more than
+parkedReadAhead bytes of commands (see schedule.go)
+*/
+var errParkedReadAhead = errors.New("blocked client reached the read-ahead limit")
+
 /*
 NewPeer creates a new peer instance
 
@@ -60,30 +141,270 @@ and the channels needed to communicate with the main server.
 
 Parameters:
   - connect: The TCP connection from net.Accept()
-  - messageChannel: Channel where parsed commands will be sent
+  - scheduler: Where parsed commands will be queued
   - deleteChannel: Channel to notify when this peer disconnects
 */
-func NewPeer(connect net.Conn, messageChannel chan Message, deleteChannel chan *Peer) *Peer {
+func NewPeer(connect net.Conn, scheduler *scheduler, deleteChannel chan *Peer) *Peer {
 	return &Peer{
-		connect:        connect,
-		messageChannel: messageChannel,
-		deleteChannel:  deleteChannel,
+		connect:       connect,
+		scheduler:     scheduler,
+		room:          make(chan struct{}, 1),
+		deleteChannel: deleteChannel,
+		outbox:        make(chan outgoing, peerOutboxSize),
+		closed:        make(chan struct{}),
+		session:       newSession(),
 	}
 }
 
 /*
-Send sends a message to the client
+Send queues a message for the client
 
-This method writes response data back to the client over the TCP connection.
-It's used to send command results, errors, and other responses.
+The message is handed to the peer's writer goroutine, which writes queued
+messages in order. It's used to send command results, errors, and other
+responses, from any goroutine.
 
 Parameters:
-  - message: The response data to send (usually RESP-formatted)
+  - message: The response data to send (RESP-formatted). The peer takes
+    ownership of the slice; callers must not modify it afterwards.
+
+Returns: errPeerClosed if the peer is closed and the message was dropped
+*/
+func (p *Peer) Send(message []byte) error {
+	return p.queue(outgoing{message: message})
+}
+
+/*
+send queues a message like Send, buffered telling whether it was carved
+off the peer's output buffer (see outputBuffer.alloc)
+*/
+func (p *Peer) send(message []byte, buffered bool) error {
+	return p.queue(outgoing{message: message, buffered: buffered})
+}
+
+/*
+SendParts queues a reply built in parts, like Send
+
+The parts are written in order, with nothing in between.
+*/
+func (p *Peer) SendParts(parts net.Buffers) error {
+	return p.queue(outgoing{parts: parts})
+}
+
+/*
+SendStream queues a streamed reply, like Send
+
+The writer produces and writes the stream's pieces in order, with nothing
+in between.
+*/
+func (p *Peer) SendStream(stream replyStream) error {
+	return p.queue(outgoing{stream: stream})
+}
+
+/*
+queue hands a reply to the writer goroutine
+*/
+func (p *Peer) queue(reply outgoing) error {
+	select {
+	case <-p.closed:
+		return errPeerClosed
+	default:
+	}
+
+	select {
+	case p.outbox <- reply:
+		return nil
+	case <-p.closed:
+		return errPeerClosed
+	default:
+	}
+
+	// The outbox is full: wait for room while the writer gets anywhere
+	timer := time.NewTimer(peerStallTimeout)
+	defer timer.Stop()
+	writes := p.writes.Load()
+	for {
+		select {
+		case p.outbox <- reply:
+			return nil
+		case <-p.closed:
+			return errPeerClosed
+		case <-timer.C:
+			if now := p.writes.Load(); now != writes {
+				writes = now
+				timer.Reset(peerStallTimeout)
+				continue
+			}
+			slog.Warn("disconnecting a client that stopped reading its replies", "remoteAddress", p.connect.RemoteAddr())
+			// Closing the connection fails the write the writer is stuck in, and the reader's read
+			p.Close()
+			p.connect.Close()
+			return errPeerStalled
+		}
+	}
+}
+
+/*
+Close shuts the peer down
+
+Replies already queued are still written before the connection is closed,
+so a final error or goodbye message reaches the client. Close is safe to
+call more than once and from any goroutine.
+*/
+func (p *Peer) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+}
+
+/*
+writeLoop writes queued replies to the client connection
+
+It runs in its own goroutine for the lifetime of the peer. Every reply
+already queued behind the first one (up to peerWriteBatch) is written
+along with it, so a pipeline's replies cost one system call instead of
+one each. A streamed reply ends the batch unless it fits in one chunk; the
+rest of it is written a chunk at a time after the batch, and the replies
+queued behind it wait for the next batch. When the peer is closed it flushes whatever is still queued and
+closes the connection, which also unblocks readLoop. A write error means
+the client is gone: the peer is closed and further replies are dropped.
+*/
+func (p *Peer) writeLoop() {
+	defer p.connect.Close()
 
-Returns: number of bytes written and any error
+	var batch net.Buffers
+	for {
+		select {
+		case reply := <-p.outbox:
+			var err error
+			if batch, err = p.flush(batch, reply); err != nil {
+				p.Close()
+				return
+			}
+		case <-p.closed:
+			for {
+				select {
+				case reply := <-p.outbox:
+					var err error
+					if batch, err = p.flush(batch, reply); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+/*
+flush writes a reply and the replies queued behind it, returning batch
+to be reused
+*/
+func (p *Peer) flush(batch net.Buffers, reply outgoing) (net.Buffers, error) {
+	batch, stream := p.gather(batch[:0], reply)
+	if err := p.write(batch, stream != nil); err != nil {
+		return batch, err
+	}
+
+	// The server loop may reuse the output buffer once all its replies are written
+	p.out.written.Add(p.outWritten)
+	p.outWritten = 0
+
+	if stream != nil {
+		return batch, p.writeStream(stream)
+	}
+	return batch, nil
+}
+
+/*
+gather appends a reply, and the replies queued behind it, to batch
+
+A stream that doesn't fit in one chunk ends the batch with its first
+chunk and is returned to be finished after the batch is written.
+*/
+func (p *Peer) gather(batch net.Buffers, reply outgoing) (net.Buffers, replyStream) {
+	for i := 0; ; i++ {
+		switch {
+		case reply.stream != nil:
+			piece := reply.stream.next(p.streamBuffer())
+			if p.trace.Load() {
+				p.traceData("out", piece)
+			}
+			if !reply.stream.done() {
+				return append(batch, piece), reply.stream
+			}
+			// The buffer is reused, so a complete small reply keeps a copy
+			batch = append(batch, bytes.Clone(piece))
+		case reply.parts != nil:
+			if p.trace.Load() {
+				p.traceData("out", bytes.Join(reply.parts, nil))
+			}
+			batch = append(batch, reply.parts...)
+		default:
+			if p.trace.Load() {
+				p.traceData("out", reply.message)
+			}
+			if reply.buffered {
+				p.outWritten++
+			}
+			batch = append(batch, reply.message)
+		}
+
+		if i+1 == peerWriteBatch {
+			return batch, nil
+		}
+		select {
+		case reply = <-p.outbox:
+		default:
+			return batch, nil
+		}
+	}
+}
+
+/*
+writeStream writes the rest of a streamed reply, a chunk at a time
+*/
+func (p *Peer) writeStream(stream replyStream) error {
+	for piece := stream.next(p.streamBuffer()); piece != nil; piece = stream.next(p.streamBuffer()) {
+		if p.trace.Load() {
+			p.traceData("out", piece)
+		}
+		if err := p.write(net.Buffers{piece}, !stream.done()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+streamBuffer returns the writer's empty buffer for streamed replies,
+allocated with room for a chunk and a header the first time
 */
-func (p *Peer) Send(message []byte) (int, error) {
-	return p.connect.Write(message)
+func (p *Peer) streamBuffer() []byte {
+	if p.streamBuf == nil {
+		p.streamBuf = make([]byte, 0, replyChunkSize+replyLargeElement)
+	}
+	return p.streamBuf[:0]
+}
+
+/*
+write writes a batch of replies to the connection
+
+more is set when the batch ends with the start of a streamed reply (see
+buffersWriter). The batch's slices are cleared afterwards, so the replies
+can be collected while the batch is reused.
+*/
+func (p *Peer) write(batch net.Buffers, more bool) error {
+	bufs := batch
+	var err error
+	if w, ok := p.connect.(buffersWriter); ok {
+		_, err = w.WriteBuffers(&bufs, more)
+	} else {
+		_, err = bufs.WriteTo(p.connect)
+	}
+	clear(batch)
+	p.writes.Add(1)
+	return err
 }
 
 /*
@@ -100,39 +421,72 @@ The loop continues until:
 
 Error handling:
   - EOF: Normal client disconnection
-  - Parse errors: Send error response to client, continue reading
-  - Network errors: Log and disconnect the client
+  - Parse errors: Queue an error reply in turn with the commands, continue reading
+  - Protocol/network errors: Send a protocol error, disconnect the client and
+    return the error so the caller can log it
 */
 func (p *Peer) readLoop() error {
-	// Create RESP reader for parsing Redis protocol data
-	rd := resp.NewReader(p.connect)
+	// Create RESP reader for parsing Redis protocol data (see resp.go), tracing what it reads
+	rd := newRespReader(traceReader{peer: p})
 
 	for {
-		// Read RESP value from client. This blocks until data arrives or connection closes
-		v, _, err := rd.ReadValue()
+		// Read the next command from client. This blocks until data arrives or connection closes
+		args, err := rd.ReadCommand()
 		if err == io.EOF {
 			p.deleteChannel <- p
 			break
 		}
 		if err != nil {
-			log.Fatal("Error reading from peer: ", err)
+			/*
+				The connection was closed on our side (e.g. by a write error), or
+				the server is shutting down and stopped reading (see shutdown.go)
+			*/
+			if p.isClosed() || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, net.ErrClosed) {
+				p.deleteChannel <- p
+				return nil
+			}
+
+			/*
+				Malformed RESP input or a broken connection must only drop this
+				client, never the whole server. Redis answers protocol errors
+				with an error reply before closing the connection.
+			*/
+			p.Send(respWriteError(errProtocol(err).Error()))
 			p.deleteChannel <- p
-			break
+			return err
 		}
 
-		// Parse the RESP value into a Command struct
-		cmd, err := p.parseCommand(v)
+		// Parse the argument list into a Command struct
+		cmd, err := p.parseCommand(args)
+		msg := Message{cmd: cmd, peer: p, args: args}
 		if err != nil {
-			errorResp := respWriteError(fmt.Sprintf("ERR %s", err.Error()))
-			p.Send(errorResp)
-			continue
+			// The error is queued like a command, so it's sent after the replies to the commands before it
+			msg = Message{peer: p, args: args, err: err}
 		}
 
-		// Send successfully parsed command to server for processing
+		// Queue the command for the server, which runs it in its turn
 		// The server will execute the command and send a response back
-		p.messageChannel <- Message{
-			cmd:  cmd,
-			peer: p,
+		_, quit := cmd.(QuitCommand)
+		if quit {
+			p.quitting.Store(true)
+		}
+		if err := p.scheduler.push(p, msg); err != nil {
+			// Closed while waiting for room (shutdown, or a write error), or blocked and sending too much
+			p.deleteChannel <- p
+			if errors.Is(err, errPeerClosed) {
+				return nil
+			}
+			return err
+		}
+
+		/*
+			After QUIT nothing else is read. The handler closes the peer once
+			the OK reply is queued; wait for that so the reply isn't lost.
+		*/
+		if quit {
+			<-p.closed
+			p.deleteChannel <- p
+			return nil
 		}
 	}
 
@@ -140,10 +494,22 @@ func (p *Peer) readLoop() error {
 }
 
 /*
-parseCommand parses a RESP value into a Command
+isClosed reports whether Close has been called
+*/
+func (p *Peer) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+parseCommand parses a command argument list into a Command
 
-This is the main command parsing dispatcher. It takes raw RESP data
-and converts it into one of our typed Command structs.
+This is the main command parsing dispatcher. It takes the argument list
+read by the RESP reader and converts it into one of our typed Command structs.
 
 RESP Command Format:
 Commands come as arrays: ["SET", "key", "value"]
@@ -152,29 +518,28 @@ Commands come as arrays: ["SET", "key", "value"]
   - Different commands have different argument requirements
 
 Parameters:
-  - v: The RESP value from the client (should be an array)
+  - arr: The command arguments read from the client (never empty)
 
 Returns: A Command interface implementation, or error if parsing fails
 
 Error cases:
-  - Not an array: Commands must be RESP arrays
-  - Empty array: Must have at least a command name
   - Unknown command: Command name not recognized
   - Wrong arguments: Command has wrong number/type of arguments
 */
-func (p *Peer) parseCommand(v resp.Value) (Command, error) {
-	// Commands must be arrays in RESP protocol
-	if v.Type() != resp.Array {
-		return nil, fmt.Errorf("expected array")
-	}
+func (p *Peer) parseCommand(arr [][]byte) (Command, error) {
+	// Get command name (case-insensitive)
+	cmdName := strings.ToUpper(string(arr[0]))
 
-	arr := v.Array()
-	if len(arr) == 0 {
-		return nil, fmt.Errorf("empty command")
+	/*
+		Check the argument count against the command table first, so every
+		command reports it the same way, and answer container HELP from it
+	*/
+	if err := checkArity(cmdName, arr); err != nil {
+		return nil, err
+	}
+	if isHelpRequest(cmdName, arr) {
+		return HelpCommand{command: cmdName}, nil
 	}
-
-	// Get command name (case-insensitive)
-	cmdName := strings.ToUpper(arr[0].String())
 
 	/*
 		Dispatch to specific parsing method based on command name
@@ -209,20 +574,167 @@ func (p *Peer) parseCommand(v resp.Value) (Command, error) {
 		return p.parseMGetCommand(arr)
 	case CommandMSET:
 		return p.parseMSetCommand(arr)
+	case CommandLPUSH:
+		return p.parsePushCommand(arr, true)
+	case CommandRPUSH:
+		return p.parsePushCommand(arr, false)
+	case CommandLPOP:
+		return p.parsePopCommand(arr, true)
+	case CommandRPOP:
+		return p.parsePopCommand(arr, false)
+	case CommandBLPOP:
+		return p.parseBlockingPopCommand(arr, true)
+	case CommandBRPOP:
+		return p.parseBlockingPopCommand(arr, false)
+	case CommandLLEN:
+		return p.parseLLenCommand(arr)
+	case CommandLRANGE:
+		return p.parseLRangeCommand(arr)
+	case CommandLINDEX:
+		return p.parseLIndexCommand(arr)
+	case CommandLINSERT:
+		return p.parseLInsertCommand(arr)
+	case CommandLSET:
+		return p.parseLSetCommand(arr)
+	case CommandLREM:
+		return p.parseLRemCommand(arr)
+	case CommandLTRIM:
+		return p.parseLTrimCommand(arr)
+	case CommandSADD, CommandSREM:
+		return p.parseSAddCommand(arr)
+	case CommandSMEMBERS:
+		return p.parseSMembersCommand(arr)
+	case CommandSISMEMBER:
+		return p.parseSIsMemberCommand(arr)
+	case CommandSMISMEMBER:
+		return p.parseSMIsMemberCommand(arr)
+	case CommandSCARD:
+		return p.parseSCardCommand(arr)
+	case CommandSMOVE:
+		return p.parseSMoveCommand(arr)
+	case CommandSPOP:
+		return p.parseSPopCommand(arr)
+	case CommandSRANDMEMBER:
+		return p.parseSRandMemberCommand(arr)
+	case CommandSINTER:
+		return p.parseSetOpCommand(arr, setOpInter)
+	case CommandSUNION:
+		return p.parseSetOpCommand(arr, setOpUnion)
+	case CommandSDIFF:
+		return p.parseSetOpCommand(arr, setOpDiff)
+	case CommandSINTERSTORE:
+		return p.parseSetOpStoreCommand(arr, setOpInter)
+	case CommandSUNIONSTORE:
+		return p.parseSetOpStoreCommand(arr, setOpUnion)
+	case CommandSDIFFSTORE:
+		return p.parseSetOpStoreCommand(arr, setOpDiff)
+	case CommandHSET:
+		return p.parseHSetCommand(arr)
+	case CommandHSETNX:
+		return p.parseHSetNXCommand(arr)
+	case CommandHGET:
+		return p.parseHGetCommand(arr)
+	case CommandHMGET:
+		return p.parseHMGetCommand(arr)
+	case CommandHDEL:
+		return p.parseHDelCommand(arr)
+	case CommandHGETALL:
+		return p.parseHGetAllCommand(arr)
+	case CommandHLEN:
+		return p.parseHLenCommand(arr)
+	case CommandHEXISTS:
+		return p.parseHExistsCommand(arr)
+	case CommandHINCRBY:
+		return p.parseHIncrByCommand(arr)
+	case CommandHEXPIRE, CommandHPEXPIRE:
+		return p.parseHExpireCommand(arr)
+	case CommandHTTL, CommandHPTTL:
+		return p.parseHTTLCommand(arr)
+	case CommandHPERSIST:
+		return p.parseHPersistCommand(arr)
+	case CommandZADD:
+		return p.parseZAddCommand(arr)
+	case CommandZINCRBY:
+		return p.parseZIncrByCommand(arr)
+	case CommandZSCORE:
+		return p.parseZScoreCommand(arr)
+	case CommandZREM:
+		return p.parseZRemCommand(arr)
+	case CommandZRANGE:
+		return p.parseZRangeCommand(arr, zrangeByRank)
+	case CommandZRANGEBYSCORE:
+		return p.parseZRangeCommand(arr, zrangeByScore)
+	case CommandZRANGEBYLEX:
+		return p.parseZRangeCommand(arr, zrangeByLex)
+	case CommandZRANDMEMBER:
+		return p.parseZRandMemberCommand(arr)
+	case CommandZCARD:
+		return p.parseZCardCommand(arr)
+	case CommandZCOUNT:
+		return p.parseZCountCommand(arr)
+	case CommandZLEXCOUNT:
+		return p.parseZLexCountCommand(arr)
+	case CommandSUBSCRIBE:
+		return p.parseSubscribeCommand(arr)
+	case CommandUNSUBSCRIBE:
+		return p.parseUnsubscribeCommand(arr)
+	case CommandPSUBSCRIBE:
+		return p.parsePSubscribeCommand(arr)
+	case CommandPUNSUBSCRIBE:
+		return p.parsePUnsubscribeCommand(arr)
+	case CommandPUBLISH:
+		return p.parsePublishCommand(arr)
+	case CommandSSUBSCRIBE:
+		return p.parseSSubscribeCommand(arr)
+	case CommandSUNSUBSCRIBE:
+		return p.parseSUnsubscribeCommand(arr)
+	case CommandSPUBLISH:
+		return p.parseSPublishCommand(arr)
 	case CommandGETSET:
 		return p.parseGetSetCommand(arr)
 	case CommandKEYS:
 		return p.parseKeysCommand(arr)
+	case CommandSCAN:
+		return p.parseScanCommand(arr)
 	case CommandFLUSHALL:
 		return p.parseFlushAllCommand(arr)
+	case CommandIMPORT:
+		return p.parseImportCommand(arr)
+	case CommandEXPORT:
+		return p.parseExportCommand(arr)
+	case CommandTYPE:
+		return p.parseTypeCommand(arr)
+	case CommandTTL, CommandPTTL:
+		return p.parseTTLCommand(arr)
+	case CommandEXPIRETIME, CommandPEXPIRETIME:
+		return p.parseExpireTimeCommand(arr)
+	case CommandTTLSTATS:
+		return TTLStatsCommand{}, nil
+	case CommandOBJECT:
+		return p.parseObjectCommand(arr)
+	case CommandCLUSTER:
+		return p.parseClusterCommand(arr)
+	case CommandDEBUG:
+		return p.parseDebugCommand(arr)
+	case CommandINFO:
+		return p.parseInfoCommand(arr)
+	case CommandMEMORY:
+		return p.parseMemoryCommand(arr)
+	case CommandCOMMAND:
+		return p.parseCommandCommand(arr)
 	case CommandHELLO:
 		return p.parseHelloCommand(arr)
 	case CommandCLIENT:
 		return p.parseClientCommand(arr)
 	case CommandPING:
 		return p.parsePingCommand(arr)
+	case CommandQUIT:
+		return p.parseQuitCommand(arr)
+	case CommandRESET:
+		return ResetCommand{}, nil
 	default:
-		return nil, fmt.Errorf("unknown command '%s'", cmdName)
+		// Not a built-in: it may be a command registered by embedding code (see registry.go)
+		return parseCustomCommand(arr)
 	}
 }
 
@@ -255,32 +767,37 @@ Formats:
 Validation:
   - Must have at least 3 arguments (SET, key, value)
   - If EX is present, must have exactly 5 arguments
-  - EX parameter must be followed by a valid integer
+  - EX parameter must be followed by a valid positive integer
+  - Any other trailing argument is a syntax error
 
 Examples:
   - ["SET", "name", "John"] -> SetCommand{key: "name", val: "John"}
   - ["SET", "temp", "data", "EX", "300"] -> SetCommand with 5-minute TTL
 */
-func (p *Peer) parseSetCommand(arr []resp.Value) (Command, error) {
-	if len(arr) < 3 {
-		return nil, fmt.Errorf("wrong number of arguments for 'SET' command")
-	}
-
+func (p *Peer) parseSetCommand(arr [][]byte) (Command, error) {
 	cmd := SetCommand{
-		key: arr[1].Bytes(),
-		val: arr[2].Bytes(),
+		key: arr[1],
+		val: arr[2],
 	}
 
 	/*
 		Parse optional EX parameter for TTL
 		Format: SET key value EX seconds
+		Anything else after the value is a syntax error, like in Redis
 	*/
-	if len(arr) >= 5 && strings.ToUpper(arr[3].String()) == "EX" {
-		seconds, err := strconv.Atoi(arr[4].String())
+	for i := 3; i < len(arr); i++ {
+		if strings.ToUpper(string(arr[i])) != "EX" || i+1 >= len(arr) || cmd.expiry > 0 {
+			return nil, errSyntax
+		}
+		seconds, err := strconv.Atoi(string(arr[i+1]))
 		if err != nil {
-			return nil, fmt.Errorf("invalid expire time")
+			return nil, errNotInteger
+		}
+		if seconds <= 0 {
+			return nil, errInvalidExpireTime(CommandSET)
 		}
 		cmd.expiry = time.Duration(seconds) * time.Second
+		i++
 	}
 
 	return cmd, nil
@@ -296,13 +813,9 @@ Validation:
 
 Example: ["GET", "name"] -> GetCommand{key: "name"}
 */
-func (p *Peer) parseGetCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'GET' command")
-	}
-
+func (p *Peer) parseGetCommand(arr [][]byte) (Command, error) {
 	return GetCommand{
-		key: arr[1].Bytes(),
+		key: arr[1],
 	}, nil
 }
 
@@ -319,15 +832,11 @@ Examples:
   - ["DEL", "key1"] -> delete one key
   - ["DEL", "key1", "key2", "key3"] -> delete three keys
 */
-func (p *Peer) parseDelCommand(arr []resp.Value) (Command, error) {
-	if len(arr) < 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'DEL' command")
-	}
-
+func (p *Peer) parseDelCommand(arr [][]byte) (Command, error) {
 	// Extract all keys (everything after the command name)
 	keys := make([][]byte, len(arr)-1)
 	for i := 1; i < len(arr); i++ {
-		keys[i-1] = arr[i].Bytes()
+		keys[i-1] = arr[i]
 	}
 
 	return DelCommand{keys: keys}, nil
@@ -346,14 +855,10 @@ Examples:
   - ["EXISTS", "key1"] -> check one key
   - ["EXISTS", "key1", "key2"] -> check two keys, return count
 */
-func (p *Peer) parseExistsCommand(arr []resp.Value) (Command, error) {
-	if len(arr) < 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'EXISTS' command")
-	}
-
+func (p *Peer) parseExistsCommand(arr [][]byte) (Command, error) {
 	keys := make([][]byte, len(arr)-1)
 	for i := 1; i < len(arr); i++ {
-		keys[i-1] = arr[i].Bytes()
+		keys[i-1] = arr[i]
 	}
 
 	return ExistsCommand{keys: keys}, nil
@@ -369,14 +874,10 @@ Validation:
 
 Example: ["APPEND", "greeting", " World"] -> append " World" to greeting
 */
-func (p *Peer) parseAppendCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 3 {
-		return nil, fmt.Errorf("wrong number of arguments for 'APPEND' command")
-	}
-
+func (p *Peer) parseAppendCommand(arr [][]byte) (Command, error) {
 	return AppendCommand{
-		key: arr[1].Bytes(),
-		val: arr[2].Bytes(),
+		key: arr[1],
+		val: arr[2],
 	}, nil
 }
 
@@ -390,13 +891,9 @@ Validation:
 
 Example: ["STRLEN", "name"] -> return length of value at "name"
 */
-func (p *Peer) parseStrlenCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'STRLEN' command")
-	}
-
+func (p *Peer) parseStrlenCommand(arr [][]byte) (Command, error) {
 	return StrlenCommand{
-		key: arr[1].Bytes(),
+		key: arr[1],
 	}, nil
 }
 
@@ -412,25 +909,21 @@ Validation:
 
 Example: ["GETRANGE", "name", "0", "2"] -> get characters 0-2 from "name"
 */
-func (p *Peer) parseGetRangeCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 4 {
-		return nil, fmt.Errorf("wrong number of arguments for 'GETRANGE' command")
-	}
-
+func (p *Peer) parseGetRangeCommand(arr [][]byte) (Command, error) {
 	// Parse start index
-	start, err := strconv.Atoi(arr[2].String())
+	start, err := strconv.Atoi(string(arr[2]))
 	if err != nil {
-		return nil, fmt.Errorf("invalid start index")
+		return nil, errNotInteger
 	}
 
 	// Parse end index
-	end, err := strconv.Atoi(arr[3].String())
+	end, err := strconv.Atoi(string(arr[3]))
 	if err != nil {
-		return nil, fmt.Errorf("invalid end index")
+		return nil, errNotInteger
 	}
 
 	return GetRangeCommand{
-		key:   arr[1].Bytes(),
+		key:   arr[1],
 		start: start,
 		end:   end,
 	}, nil
@@ -447,21 +940,22 @@ Validation:
 
 Example: ["SETRANGE", "name", "0", "Jane"] -> overwrite starting at position 0
 */
-func (p *Peer) parseSetRangeCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 4 {
-		return nil, fmt.Errorf("wrong number of arguments for 'SETRANGE' command")
-	}
-
+func (p *Peer) parseSetRangeCommand(arr [][]byte) (Command, error) {
 	// Parse offset position
-	offset, err := strconv.Atoi(arr[2].String())
+	offset, err := strconv.Atoi(string(arr[2]))
 	if err != nil {
-		return nil, fmt.Errorf("invalid offset")
+		return nil, errNotInteger
+	}
+
+	// A negative offset would index before the start of the string
+	if offset < 0 {
+		return nil, errOffsetOutOfRange
 	}
 
 	return SetRangeCommand{
-		key:    arr[1].Bytes(),
+		key:    arr[1],
 		offset: offset,
-		value:  arr[3].Bytes(),
+		value:  arr[3],
 	}, nil
 }
 
@@ -476,13 +970,9 @@ Validation:
 
 Example: ["INCR", "counter"] -> increment counter by 1
 */
-func (p *Peer) parseIncrCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'INCR' command")
-	}
-
+func (p *Peer) parseIncrCommand(arr [][]byte) (Command, error) {
 	return IncrCommand{
-		key: arr[1].Bytes(),
+		key: arr[1],
 	}, nil
 }
 
@@ -497,13 +987,9 @@ Validation:
 
 Example: ["DECR", "counter"] -> decrement counter by 1
 */
-func (p *Peer) parseDecrCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'DECR' command")
-	}
-
+func (p *Peer) parseDecrCommand(arr [][]byte) (Command, error) {
 	return DecrCommand{
-		key: arr[1].Bytes(),
+		key: arr[1],
 	}, nil
 }
 
@@ -518,18 +1004,14 @@ Validation:
 
 Example: ["INCRBY", "score", "10"] -> add 10 to score
 */
-func (p *Peer) parseIncrByCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 3 {
-		return nil, fmt.Errorf("wrong number of arguments for 'INCRBY' command")
-	}
-
-	increment, err := strconv.ParseInt(arr[2].String(), 10, 64)
+func (p *Peer) parseIncrByCommand(arr [][]byte) (Command, error) {
+	increment, err := strconv.ParseInt(string(arr[2]), 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("invalid increment value")
+		return nil, errNotInteger
 	}
 
 	return IncrByCommand{
-		key:       arr[1].Bytes(),
+		key:       arr[1],
 		increment: increment,
 	}, nil
 }
@@ -545,18 +1027,14 @@ Validation:
 
 Example: ["DECRBY", "score", "5"] -> subtract 5 from score
 */
-func (p *Peer) parseDecrByCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 3 {
-		return nil, fmt.Errorf("wrong number of arguments for 'DECRBY' command")
-	}
-
-	decrement, err := strconv.ParseInt(arr[2].String(), 10, 64)
+func (p *Peer) parseDecrByCommand(arr [][]byte) (Command, error) {
+	decrement, err := strconv.ParseInt(string(arr[2]), 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("invalid decrement value")
+		return nil, errNotInteger
 	}
 
 	return DecrByCommand{
-		key:       arr[1].Bytes(),
+		key:       arr[1],
 		decrement: decrement,
 	}, nil
 }
@@ -572,14 +1050,10 @@ Validation:
 
 Example: ["MGET", "name", "age", "city"] -> get values for all three keys
 */
-func (p *Peer) parseMGetCommand(arr []resp.Value) (Command, error) {
-	if len(arr) < 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'MGET' command")
-	}
-
+func (p *Peer) parseMGetCommand(arr [][]byte) (Command, error) {
 	keys := make([][]byte, len(arr)-1)
 	for i := 1; i < len(arr); i++ {
-		keys[i-1] = arr[i].Bytes()
+		keys[i-1] = arr[i]
 	}
 
 	return MGetCommand{keys: keys}, nil
@@ -597,16 +1071,16 @@ Validation:
 
 Example: ["MSET", "name", "John", "age", "25"] -> set two key-value pairs
 */
-func (p *Peer) parseMSetCommand(arr []resp.Value) (Command, error) {
+func (p *Peer) parseMSetCommand(arr [][]byte) (Command, error) {
 	// Must have odd number of arguments: MSET key1 value1 key2 value2...
-	if len(arr) < 3 || len(arr)%2 == 0 {
-		return nil, fmt.Errorf("wrong number of arguments for 'MSET' command")
+	if len(arr)%2 == 0 {
+		return nil, errWrongNumberOfArgs(CommandMSET)
 	}
 
 	pairs := make(map[string][]byte)
 	for i := 1; i < len(arr); i += 2 {
-		key := arr[i].String()
-		val := arr[i+1].Bytes()
+		key := string(arr[i])
+		val := arr[i+1]
 		pairs[key] = val
 	}
 
@@ -614,123 +1088,1514 @@ func (p *Peer) parseMSetCommand(arr []resp.Value) (Command, error) {
 }
 
 /*
-parseGetSetCommand parses GETSET command: GETSET key value
+parsePushCommand parses LPUSH and RPUSH commands: LPUSH key element [element ...]
 
-GETSET atomically sets a key and returns the old value.
+Validation:
+  - Must have at least 3 arguments (LPUSH, key, element1, ...)
 
-Validation: Must have exactly 3 arguments (GETSET, key, value)
+Example: ["RPUSH", "queue", "a", "b"] -> append a and b to queue
+*/
+func (p *Peer) parsePushCommand(arr [][]byte, head bool) (Command, error) {
+	return PushCommand{
+		key:    arr[1],
+		values: arr[2:],
+		head:   head,
+	}, nil
+}
 
-Example: ["GETSET", "counter", "0"] -> set counter to 0, return old value
+/*
+parsePopCommand parses LPOP and RPOP commands: LPOP key [count]
+
+Validation:
+  - Must have 2 or 3 arguments (LPOP, key, optional count)
+  - count must be a non-negative integer
+
+Examples:
+  - ["LPOP", "queue"] -> pop one element
+  - ["RPOP", "queue", "3"] -> pop up to three elements
 */
-func (p *Peer) parseGetSetCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 3 {
-		return nil, fmt.Errorf("wrong number of arguments for 'GETSET' command")
+func (p *Peer) parsePopCommand(arr [][]byte, head bool) (Command, error) {
+	if len(arr) > 3 {
+		return nil, errWrongNumberOfArgs(string(arr[0]))
 	}
 
-	return GetSetCommand{
-		key: arr[1].Bytes(),
-		val: arr[2].Bytes(),
-	}, nil
+	cmd := PopCommand{key: arr[1], head: head}
+	if len(arr) == 3 {
+		count, err := strconv.Atoi(string(arr[2]))
+		if err != nil || count < 0 {
+			return nil, errNotPositive
+		}
+		cmd.count = count
+		cmd.hasCount = true
+	}
+
+	return cmd, nil
 }
 
 /*
-parseKeysCommand parses KEYS command: KEYS pattern
-
-KEYS returns all keys matching a glob-style pattern.
+parseBlockingPopCommand parses BLPOP and BRPOP commands: BLPOP key [key ...] timeout
 
 Validation:
-  - Must have exactly 2 arguments (KEYS, pattern)
-  - Pattern supports * wildcard
+  - Must have at least 3 arguments (BLPOP, key, timeout)
+  - timeout must be a non-negative number of seconds, fractions allowed
 
-Example: ["KEYS", "user:*"] -> find all keys starting with "user:"
+Example: ["BLPOP", "jobs", "urgent", "0.5"] -> wait up to half a second
+on jobs and urgent
 */
-func (p *Peer) parseKeysCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 2 {
-		return nil, fmt.Errorf("wrong number of arguments for 'KEYS' command")
+func (p *Peer) parseBlockingPopCommand(arr [][]byte, head bool) (Command, error) {
+	timeout, err := parseBlockTimeout(arr[len(arr)-1])
+	if err != nil {
+		return nil, err
 	}
+	return BlockingPopCommand{keys: arr[1 : len(arr)-1], timeout: timeout, head: head}, nil
+}
 
-	return KeysCommand{
-		pattern: arr[1].String(),
-	}, nil
+/*
+parseBlockTimeout parses the timeout of a blocking command, in seconds, 0 to wait forever
+*/
+func parseBlockTimeout(arg []byte) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errTimeoutNotFloat
+	}
+	if seconds < 0 {
+		return 0, errTimeoutNegative
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
 }
 
 /*
-parseFlushAllCommand parses FLUSHALL command: FLUSHALL
+parseLLenCommand parses LLEN command: LLEN key
 
-FLUSHALL removes all keys from the database.
+Validation:
+  - Must have exactly 2 arguments (LLEN, key)
+*/
+func (p *Peer) parseLLenCommand(arr [][]byte) (Command, error) {
+	return LLenCommand{key: arr[1]}, nil
+}
+
+/*
+parseLRangeCommand parses LRANGE command: LRANGE key start stop
 
 Validation:
-  - Must have exactly 1 argument (just FLUSHALL)
-  - No parameters allowed
+  - Must have exactly 4 arguments (LRANGE, key, start, stop)
+  - start and stop must be valid integers (negative counts from the tail)
 
-Example: ["FLUSHALL"] -> delete everything
+Example: ["LRANGE", "queue", "0", "-1"] -> whole list
 */
-func (p *Peer) parseFlushAllCommand(arr []resp.Value) (Command, error) {
-	if len(arr) != 1 {
-		return nil, fmt.Errorf("wrong number of arguments for 'FLUSHALL' command")
+func (p *Peer) parseLRangeCommand(arr [][]byte) (Command, error) {
+	start, err := strconv.Atoi(string(arr[2]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+	stop, err := strconv.Atoi(string(arr[3]))
+	if err != nil {
+		return nil, errNotInteger
 	}
 
-	return FlushAllCommand{}, nil
+	return LRangeCommand{key: arr[1], start: start, stop: stop}, nil
 }
 
 /*
-parseHelloCommand parses HELLO command: HELLO [protover [AUTH username password] [SETNAME clientname]]
+parseLIndexCommand parses LINDEX command: LINDEX key index
 
-HELLO is used for protocol negotiation and client identification.
+Validation:
+  - Must have exactly 3 arguments (LINDEX, key, index)
+  - index must be a valid integer
+*/
+func (p *Peer) parseLIndexCommand(arr [][]byte) (Command, error) {
+	index, err := strconv.Atoi(string(arr[2]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+
+	return LIndexCommand{key: arr[1], index: index}, nil
+}
+
+/*
+parseLInsertCommand parses LINSERT command: LINSERT key BEFORE|AFTER pivot element
 
 Validation:
-  - Can have 1 or more arguments
-  - First optional argument is protocol version
+  - Must have exactly 5 arguments (LINSERT, key, where, pivot, element)
+  - where must be BEFORE or AFTER (case-insensitive), otherwise syntax error
 
-Example: ["HELLO", "3"] -> negotiate protocol version 3
+Example: ["LINSERT", "queue", "BEFORE", "b", "a"] -> insert a in front of b
 */
-func (p *Peer) parseHelloCommand(arr []resp.Value) (Command, error) {
-	value := "2"
-	if len(arr) > 1 {
-		value = arr[1].String()
+func (p *Peer) parseLInsertCommand(arr [][]byte) (Command, error) {
+	var before bool
+	switch strings.ToUpper(string(arr[2])) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return nil, errSyntax
 	}
 
-	return HelloCommand{value: value}, nil
+	return LInsertCommand{
+		key:    arr[1],
+		before: before,
+		pivot:  arr[3],
+		value:  arr[4],
+	}, nil
 }
 
 /*
-parseClientCommand parses CLIENT command: CLIENT subcommand [arg [arg ...]]
-
-CLIENT provides client connection management functionality.
+parseLSetCommand parses LSET command: LSET key index element
 
 Validation:
-  - Can have 1 or more arguments
-  - First optional argument is the subcommand
+  - Must have exactly 4 arguments (LSET, key, index, element)
+  - index must be a valid integer
+*/
+func (p *Peer) parseLSetCommand(arr [][]byte) (Command, error) {
+	index, err := strconv.Atoi(string(arr[2]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+
+	return LSetCommand{key: arr[1], index: index, value: arr[3]}, nil
+}
+
+/*
+parseLRemCommand parses LREM command: LREM key count element
 
-Example: ["CLIENT", "LIST"] -> list connected clients
+Validation:
+  - Must have exactly 4 arguments (LREM, key, count, element)
+  - count must be a valid integer (its sign picks the scan direction)
 */
-func (p *Peer) parseClientCommand(arr []resp.Value) (Command, error) {
-	value := ""
-	if len(arr) > 1 {
-		value = arr[1].String()
+func (p *Peer) parseLRemCommand(arr [][]byte) (Command, error) {
+	count, err := strconv.Atoi(string(arr[2]))
+	if err != nil {
+		return nil, errNotInteger
 	}
 
-	return ClientCommand{value: value}, nil
+	return LRemCommand{key: arr[1], count: count, value: arr[3]}, nil
 }
 
 /*
-parsePingCommand parses PING command: PING [message]
+parseLTrimCommand parses LTRIM command: LTRIM key start stop
 
-PING tests connection and optionally echoes a message.
+Validation:
+  - Must have exactly 4 arguments (LTRIM, key, start, stop)
+  - start and stop must be valid integers
+*/
+func (p *Peer) parseLTrimCommand(arr [][]byte) (Command, error) {
+	start, err := strconv.Atoi(string(arr[2]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+	stop, err := strconv.Atoi(string(arr[3]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+
+	return LTrimCommand{key: arr[1], start: start, stop: stop}, nil
+}
+
+/*
+parseSAddCommand parses SADD and SREM commands: SADD key member [member ...]
 
 Validation:
-  - Can have 1 or 2 arguments
-  - Optional second argument is message to echo
+  - Must have at least 3 arguments (SADD, key, member1, ...)
 
-Examples:
-  - ["PING"] -> returns "PONG"
-  - ["PING", "hello"] -> returns "hello"
+Example: ["SADD", "tags", "go", "redis"] -> add two members
 */
-func (p *Peer) parsePingCommand(arr []resp.Value) (Command, error) {
-	message := ""
-	if len(arr) > 1 {
-		message = arr[1].String()
+func (p *Peer) parseSAddCommand(arr [][]byte) (Command, error) {
+	if strings.ToUpper(string(arr[0])) == CommandSREM {
+		return SRemCommand{key: arr[1], members: arr[2:]}, nil
 	}
+	return SAddCommand{key: arr[1], members: arr[2:]}, nil
+}
 
-	return PingCommand{message: message}, nil
+/*
+parseSMembersCommand parses SMEMBERS command: SMEMBERS key
+
+Validation:
+  - Must have exactly 2 arguments (SMEMBERS, key)
+*/
+func (p *Peer) parseSMembersCommand(arr [][]byte) (Command, error) {
+	return SMembersCommand{key: arr[1]}, nil
+}
+
+/*
+parseSIsMemberCommand parses SISMEMBER command: SISMEMBER key member
+
+Validation:
+  - Must have exactly 3 arguments (SISMEMBER, key, member)
+*/
+func (p *Peer) parseSIsMemberCommand(arr [][]byte) (Command, error) {
+	return SIsMemberCommand{key: arr[1], member: arr[2]}, nil
+}
+
+/*
+parseSMIsMemberCommand parses SMISMEMBER command: SMISMEMBER key member [member ...]
+
+Validation:
+  - Must have at least 3 arguments (SMISMEMBER, key, member1, ...)
+*/
+func (p *Peer) parseSMIsMemberCommand(arr [][]byte) (Command, error) {
+	return SMIsMemberCommand{key: arr[1], members: arr[2:]}, nil
+}
+
+/*
+parseSCardCommand parses SCARD command: SCARD key
+
+Validation:
+  - Must have exactly 2 arguments (SCARD, key)
+*/
+func (p *Peer) parseSCardCommand(arr [][]byte) (Command, error) {
+	return SCardCommand{key: arr[1]}, nil
+}
+
+/*
+parseSMoveCommand parses SMOVE command: SMOVE source destination member
+
+Validation:
+  - Must have exactly 4 arguments (SMOVE, source, destination, member)
+
+Example: ["SMOVE", "todo", "done", "task42"] -> move task42 between sets
+*/
+func (p *Peer) parseSMoveCommand(arr [][]byte) (Command, error) {
+	return SMoveCommand{source: arr[1], destination: arr[2], member: arr[3]}, nil
+}
+
+/*
+parseSPopCommand parses SPOP command: SPOP key [count]
+
+Validation:
+  - Must have 2 or 3 arguments (SPOP, key, optional count)
+  - count must be a non-negative integer
+
+Example: ["SPOP", "raffle", "3"] -> remove and return three random members
+*/
+func (p *Peer) parseSPopCommand(arr [][]byte) (Command, error) {
+	if len(arr) > 3 {
+		return nil, errWrongNumberOfArgs(CommandSPOP)
+	}
+
+	cmd := SPopCommand{key: arr[1]}
+	if len(arr) == 3 {
+		count, err := strconv.Atoi(string(arr[2]))
+		if err != nil || count < 0 {
+			return nil, errNotPositive
+		}
+		cmd.count = count
+		cmd.hasCount = true
+	}
+
+	return cmd, nil
+}
+
+/*
+parseSRandMemberCommand parses SRANDMEMBER command: SRANDMEMBER key [count]
+
+Validation:
+  - Must have 2 or 3 arguments (SRANDMEMBER, key, optional count)
+  - count must be an integer; negative values allow repeated members
+
+Example: ["SRANDMEMBER", "deck", "-5"] -> five random members, with repeats
+*/
+func (p *Peer) parseSRandMemberCommand(arr [][]byte) (Command, error) {
+	if len(arr) > 3 {
+		return nil, errWrongNumberOfArgs(CommandSRANDMEMBER)
+	}
+
+	cmd := SRandMemberCommand{key: arr[1]}
+	if len(arr) == 3 {
+		count, err := strconv.Atoi(string(arr[2]))
+		if err != nil {
+			return nil, errNotInteger
+		}
+		// Same bound as Redis, so -count can't overflow
+		if count < -math.MaxInt64/2 {
+			return nil, errValueOutOfRange
+		}
+		cmd.count = count
+		cmd.hasCount = true
+	}
+
+	return cmd, nil
+}
+
+/*
+parseSetOpCommand parses SINTER, SUNION and SDIFF commands: SINTER key [key ...]
+
+Validation:
+  - Must have at least 2 arguments (SINTER, key1, ...)
+
+Example: ["SDIFF", "a", "b"] -> members of a that are not in b
+*/
+func (p *Peer) parseSetOpCommand(arr [][]byte, op setOperation) (Command, error) {
+	return SetOpCommand{op: op, keys: arr[1:]}, nil
+}
+
+/*
+parseSetOpStoreCommand parses SINTERSTORE, SUNIONSTORE and SDIFFSTORE commands
+
+Format: SINTERSTORE destination key [key ...]
+
+Validation:
+  - Must have at least 3 arguments (SINTERSTORE, destination, key1, ...)
+
+Example: ["SUNIONSTORE", "all", "a", "b"] -> store a ∪ b in all
+*/
+func (p *Peer) parseSetOpStoreCommand(arr [][]byte, op setOperation) (Command, error) {
+	return SetOpStoreCommand{op: op, destination: arr[1], keys: arr[2:]}, nil
+}
+
+/*
+parseHSetCommand parses HSET command: HSET key field value [field value ...]
+
+Validation:
+  - Must have at least 4 arguments (HSET, key, field1, value1, ...)
+  - Must have an even number of arguments (command and key + pairs)
+
+Example: ["HSET", "user:1", "name", "John", "age", "25"] -> set two fields
+*/
+func (p *Peer) parseHSetCommand(arr [][]byte) (Command, error) {
+	if len(arr)%2 != 0 {
+		return nil, errWrongNumberOfArgs(CommandHSET)
+	}
+
+	return HSetCommand{key: arr[1], pairs: arr[2:]}, nil
+}
+
+/*
+parseHSetNXCommand parses HSETNX command: HSETNX key field value
+
+Validation:
+  - Must have exactly 4 arguments (HSETNX, key, field, value)
+*/
+func (p *Peer) parseHSetNXCommand(arr [][]byte) (Command, error) {
+	return HSetNXCommand{key: arr[1], field: arr[2], value: arr[3]}, nil
+}
+
+/*
+parseHGetCommand parses HGET command: HGET key field
+
+Validation:
+  - Must have exactly 3 arguments (HGET, key, field)
+*/
+func (p *Peer) parseHGetCommand(arr [][]byte) (Command, error) {
+	return HGetCommand{key: arr[1], field: arr[2]}, nil
+}
+
+/*
+parseHMGetCommand parses HMGET command: HMGET key field [field ...]
+
+Validation:
+  - Must have at least 3 arguments (HMGET, key, field1, ...)
+*/
+func (p *Peer) parseHMGetCommand(arr [][]byte) (Command, error) {
+	return HMGetCommand{key: arr[1], fields: arr[2:]}, nil
+}
+
+/*
+parseHDelCommand parses HDEL command: HDEL key field [field ...]
+
+Validation:
+  - Must have at least 3 arguments (HDEL, key, field1, ...)
+*/
+func (p *Peer) parseHDelCommand(arr [][]byte) (Command, error) {
+	return HDelCommand{key: arr[1], fields: arr[2:]}, nil
+}
+
+/*
+parseHGetAllCommand parses HGETALL command: HGETALL key
+
+Validation:
+  - Must have exactly 2 arguments (HGETALL, key)
+*/
+func (p *Peer) parseHGetAllCommand(arr [][]byte) (Command, error) {
+	return HGetAllCommand{key: arr[1]}, nil
+}
+
+/*
+parseHLenCommand parses HLEN command: HLEN key
+
+Validation:
+  - Must have exactly 2 arguments (HLEN, key)
+*/
+func (p *Peer) parseHLenCommand(arr [][]byte) (Command, error) {
+	return HLenCommand{key: arr[1]}, nil
+}
+
+/*
+parseHExistsCommand parses HEXISTS command: HEXISTS key field
+
+Validation:
+  - Must have exactly 3 arguments (HEXISTS, key, field)
+*/
+func (p *Peer) parseHExistsCommand(arr [][]byte) (Command, error) {
+	return HExistsCommand{key: arr[1], field: arr[2]}, nil
+}
+
+/*
+parseHIncrByCommand parses HINCRBY command: HINCRBY key field increment
+
+Validation:
+  - Must have exactly 4 arguments (HINCRBY, key, field, increment)
+  - increment must be a valid 64-bit integer (can be negative)
+
+Example: ["HINCRBY", "article:7", "views", "1"] -> count one more view
+*/
+func (p *Peer) parseHIncrByCommand(arr [][]byte) (Command, error) {
+	increment, err := strconv.ParseInt(string(arr[3]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+
+	return HIncrByCommand{key: arr[1], field: arr[2], increment: increment}, nil
+}
+
+/*
+parseHExpireCommand parses HEXPIRE and HPEXPIRE commands:
+HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+
+Validation:
+  - The time must be an integer, not negative, and must not put the
+    expiration past what a Unix time in milliseconds can hold
+  - At most one of NX, XX, GT and LT, right before FIELDS
+  - FIELDS must be followed by numfields and exactly that many fields
+
+Example: ["HPEXPIRE", "cache", "1500", "NX", "FIELDS", "1", "a"] -> a expires in 1.5s unless it has a TTL
+*/
+func (p *Peer) parseHExpireCommand(arr [][]byte) (Command, error) {
+	command := strings.ToUpper(string(arr[0]))
+	amount, err := strconv.ParseInt(string(arr[2]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if amount < 0 {
+		return nil, errFieldExpireNegative
+	}
+	unit := int64(1)
+	if command == CommandHEXPIRE {
+		unit = 1000
+	}
+	if amount > (maxFieldExpireAt-time.Now().UnixMilli())/unit {
+		return nil, errInvalidExpireTime(command)
+	}
+
+	cmd := HExpireCommand{key: arr[1], ttl: time.Duration(amount*unit) * time.Millisecond}
+	i := 3
+	switch strings.ToUpper(string(arr[i])) {
+	case "NX":
+		cmd.cond = fieldExpireNX
+	case "XX":
+		cmd.cond = fieldExpireXX
+	case "GT":
+		cmd.cond = fieldExpireGT
+	case "LT":
+		cmd.cond = fieldExpireLT
+	}
+	if cmd.cond != fieldExpireAlways {
+		i++
+	}
+
+	cmd.fields, err = parseFieldsClause(arr, i)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+/*
+parseHTTLCommand parses HTTL and HPTTL commands: HTTL key FIELDS numfields field [field ...]
+
+Validation:
+  - FIELDS must be followed by numfields and exactly that many fields
+*/
+func (p *Peer) parseHTTLCommand(arr [][]byte) (Command, error) {
+	fields, err := parseFieldsClause(arr, 2)
+	if err != nil {
+		return nil, err
+	}
+	return HTTLCommand{key: arr[1], fields: fields, millis: strings.ToUpper(string(arr[0])) == CommandHPTTL}, nil
+}
+
+/*
+parseHPersistCommand parses HPERSIST command: HPERSIST key FIELDS numfields field [field ...]
+
+Validation:
+  - FIELDS must be followed by numfields and exactly that many fields
+*/
+func (p *Peer) parseHPersistCommand(arr [][]byte) (Command, error) {
+	fields, err := parseFieldsClause(arr, 2)
+	if err != nil {
+		return nil, err
+	}
+	return HPersistCommand{key: arr[1], fields: fields}, nil
+}
+
+/*
+parseFieldsClause parses the FIELDS numfields field [field ...] clause
+ending the hash field TTL commands, starting at arr[i]
+
+Returns: The fields
+*/
+func parseFieldsClause(arr [][]byte, i int) ([][]byte, error) {
+	if i+1 >= len(arr) || strings.ToUpper(string(arr[i])) != "FIELDS" {
+		return nil, errFieldsMissing
+	}
+	numFields, err := strconv.Atoi(string(arr[i+1]))
+	if err != nil || numFields <= 0 {
+		return nil, errNumFieldsNotPositive
+	}
+	if numFields != len(arr)-i-2 {
+		return nil, errNumFieldsMismatch
+	}
+	return arr[i+2:], nil
+}
+
+/*
+parseZAddCommand parses ZADD command: ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+
+Options come right after the key, in any order; the first argument that
+isn't an option starts the score/member pairs.
+
+Validation:
+  - Must have at least 4 arguments (ZADD, key, score1, member1, ...)
+  - Scores and members must come in pairs, otherwise syntax error
+  - NX can't be combined with XX, GT or LT, and GT can't be combined with LT
+  - INCR takes exactly one score/member pair
+  - Every score must be a valid float (inf and -inf allowed, NaN not)
+
+Example: ["ZADD", "leaderboard", "XX", "CH", "100", "alice"] -> update alice, reply 1 if her score changed
+*/
+func (p *Peer) parseZAddCommand(arr [][]byte) (Command, error) {
+	cmd := ZAddCommand{key: arr[1]}
+	i := 2
+options:
+	for ; i < len(arr); i++ {
+		switch strings.ToUpper(string(arr[i])) {
+		case "NX":
+			cmd.opts.nx = true
+		case "XX":
+			cmd.opts.xx = true
+		case "GT":
+			cmd.opts.gt = true
+		case "LT":
+			cmd.opts.lt = true
+		case "CH":
+			cmd.opts.ch = true
+		case "INCR":
+			cmd.opts.incr = true
+		default:
+			break options
+		}
+	}
+
+	pairs := arr[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, errSyntax
+	}
+	if cmd.opts.nx && cmd.opts.xx {
+		return nil, errZAddNXAndXX
+	}
+	if (cmd.opts.nx && (cmd.opts.gt || cmd.opts.lt)) || (cmd.opts.gt && cmd.opts.lt) {
+		return nil, errZAddGTLTNX
+	}
+	if cmd.opts.incr && len(pairs) > 2 {
+		return nil, errZAddIncrPair
+	}
+
+	cmd.items = make([]zsetItem, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := parseScore(pairs[j])
+		if err != nil {
+			return nil, err
+		}
+		cmd.items = append(cmd.items, zsetItem{member: string(pairs[j+1]), score: score})
+	}
+
+	return cmd, nil
+}
+
+/*
+parseZIncrByCommand parses ZINCRBY command: ZINCRBY key increment member
+
+Validation:
+  - Must have exactly 4 arguments (ZINCRBY, key, increment, member)
+  - increment must be a valid float
+*/
+func (p *Peer) parseZIncrByCommand(arr [][]byte) (Command, error) {
+	increment, err := parseScore(arr[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return ZIncrByCommand{key: arr[1], increment: increment, member: arr[3]}, nil
+}
+
+/*
+parseZScoreCommand parses ZSCORE command: ZSCORE key member
+
+Validation:
+  - Must have exactly 3 arguments (ZSCORE, key, member)
+*/
+func (p *Peer) parseZScoreCommand(arr [][]byte) (Command, error) {
+	return ZScoreCommand{key: arr[1], member: arr[2]}, nil
+}
+
+/*
+parseZRemCommand parses ZREM command: ZREM key member [member ...]
+
+Validation:
+  - Must have at least 3 arguments (ZREM, key, member1, ...)
+*/
+func (p *Peer) parseZRemCommand(arr [][]byte) (Command, error) {
+	return ZRemCommand{key: arr[1], members: arr[2:]}, nil
+}
+
+/*
+parseZRangeCommand parses ZRANGE, ZRANGEBYSCORE and ZRANGEBYLEX commands
+
+Formats:
+  - ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+  - ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+  - ZRANGEBYLEX key min max [LIMIT offset count]
+
+by is the range type the command starts with; only ZRANGE (which starts
+by rank) accepts BYSCORE, BYLEX and REV.
+
+Validation:
+  - Must have at least 4 arguments
+  - Unknown or repeated options are a syntax error
+  - LIMIT needs a score or lexicographic range, WITHSCORES can't be used with one
+  - Ranks, offset and count must be integers; score bounds floats with an
+    optional "("; lexicographic bounds "-", "+", "[member" or "(member"
+  - With REV, a score or lexicographic range is given as max then min
+
+Example: ["ZRANGEBYSCORE", "board", "(10", "+inf", "LIMIT", "0", "5"] -> five members above 10
+*/
+func (p *Peer) parseZRangeCommand(arr [][]byte, by zrangeBy) (Command, error) {
+	cmd := ZRangeCommand{key: arr[1], by: by, count: -1}
+	unified := by == zrangeByRank
+	limited := false
+	for i := 4; i < len(arr); i++ {
+		switch option := strings.ToUpper(string(arr[i])); {
+		case option == "WITHSCORES":
+			cmd.withScores = true
+		case option == "LIMIT" && i+2 < len(arr):
+			offset, err := strconv.Atoi(string(arr[i+1]))
+			if err != nil {
+				return nil, errNotInteger
+			}
+			count, err := strconv.Atoi(string(arr[i+2]))
+			if err != nil {
+				return nil, errNotInteger
+			}
+			cmd.offset, cmd.count = offset, count
+			limited = offset != 0 || count != -1
+			i += 2
+		case option == "REV" && unified && !cmd.rev:
+			cmd.rev = true
+		case option == "BYSCORE" && unified && cmd.by == zrangeByRank:
+			cmd.by = zrangeByScore
+		case option == "BYLEX" && unified && cmd.by == zrangeByRank:
+			cmd.by = zrangeByLex
+		default:
+			return nil, errSyntax
+		}
+	}
+
+	if limited && cmd.by == zrangeByRank {
+		return nil, errLimitWithoutBy
+	}
+	if cmd.withScores && cmd.by == zrangeByLex {
+		return nil, errWithScoresByLex
+	}
+
+	// A reversed score or lexicographic range is written from max to min
+	minArg, maxArg := arr[2], arr[3]
+	if cmd.rev && cmd.by != zrangeByRank {
+		minArg, maxArg = maxArg, minArg
+	}
+
+	var err error
+	switch cmd.by {
+	case zrangeByScore:
+		if cmd.scores.min, err = parseScoreBound(minArg); err != nil {
+			return nil, err
+		}
+		if cmd.scores.max, err = parseScoreBound(maxArg); err != nil {
+			return nil, err
+		}
+	case zrangeByLex:
+		if cmd.lex.min, err = parseLexBound(minArg); err != nil {
+			return nil, err
+		}
+		if cmd.lex.max, err = parseLexBound(maxArg); err != nil {
+			return nil, err
+		}
+	default:
+		if cmd.start, err = strconv.Atoi(string(arr[2])); err != nil {
+			return nil, errNotInteger
+		}
+		if cmd.stop, err = strconv.Atoi(string(arr[3])); err != nil {
+			return nil, errNotInteger
+		}
+	}
+
+	return cmd, nil
+}
+
+/*
+parseZCardCommand parses ZCARD command: ZCARD key
+
+Validation:
+  - Must have exactly 2 arguments (ZCARD, key)
+*/
+func (p *Peer) parseZCardCommand(arr [][]byte) (Command, error) {
+	return ZCardCommand{key: arr[1]}, nil
+}
+
+/*
+parseZCountCommand parses ZCOUNT command: ZCOUNT key min max
+
+Validation:
+  - Must have exactly 4 arguments (ZCOUNT, key, min, max)
+  - min and max must be floats, optionally prefixed with "(" to exclude them
+
+Example: ["ZCOUNT", "board", "(10", "+inf"] -> members scoring above 10
+*/
+func (p *Peer) parseZCountCommand(arr [][]byte) (Command, error) {
+	cmd := ZCountCommand{key: arr[1]}
+	var err error
+	if cmd.scores.min, err = parseScoreBound(arr[2]); err != nil {
+		return nil, err
+	}
+	if cmd.scores.max, err = parseScoreBound(arr[3]); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+/*
+parseZLexCountCommand parses ZLEXCOUNT command: ZLEXCOUNT key min max
+
+Validation:
+  - Must have exactly 4 arguments (ZLEXCOUNT, key, min, max)
+  - min and max must be "-", "+", "[member" or "(member"
+
+Example: ["ZLEXCOUNT", "words", "[b", "+"] -> members from b onwards
+*/
+func (p *Peer) parseZLexCountCommand(arr [][]byte) (Command, error) {
+	cmd := ZLexCountCommand{key: arr[1]}
+	var err error
+	if cmd.lex.min, err = parseLexBound(arr[2]); err != nil {
+		return nil, err
+	}
+	if cmd.lex.max, err = parseLexBound(arr[3]); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+/*
+parseZRandMemberCommand parses ZRANDMEMBER command: ZRANDMEMBER key [count [WITHSCORES]]
+
+Validation:
+  - Must have at least 2 arguments (ZRANDMEMBER, key); more than 4, or a
+    third option other than WITHSCORES, is a syntax error
+  - count must be an integer; negative values allow repeated members
+
+Example: ["ZRANDMEMBER", "board", "2", "WITHSCORES"] -> two distinct members with scores
+*/
+func (p *Peer) parseZRandMemberCommand(arr [][]byte) (Command, error) {
+	cmd := ZRandMemberCommand{key: arr[1]}
+	if len(arr) == 2 {
+		return cmd, nil
+	}
+
+	count, err := strconv.Atoi(string(arr[2]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if len(arr) > 4 || (len(arr) == 4 && strings.ToUpper(string(arr[3])) != "WITHSCORES") {
+		return nil, errSyntax
+	}
+	cmd.withScores = len(arr) == 4
+
+	// Same bound as Redis, so -count (doubled with scores) can't overflow
+	if count < -math.MaxInt64/2 || (cmd.withScores && count > math.MaxInt64/2) {
+		return nil, errValueOutOfRange
+	}
+	cmd.count = count
+	cmd.hasCount = true
+
+	return cmd, nil
+}
+
+/*
+parseSubscribeCommand parses SUBSCRIBE command: SUBSCRIBE channel [channel ...]
+
+Validation:
+  - Must have at least 2 arguments (SUBSCRIBE, channel1, ...)
+*/
+func (p *Peer) parseSubscribeCommand(arr [][]byte) (Command, error) {
+	return SubscribeCommand{channels: arr[1:]}, nil
+}
+
+/*
+parseUnsubscribeCommand parses UNSUBSCRIBE command: UNSUBSCRIBE [channel [channel ...]]
+
+Without channels, the client is unsubscribed from all of them.
+*/
+func (p *Peer) parseUnsubscribeCommand(arr [][]byte) (Command, error) {
+	return UnsubscribeCommand{channels: arr[1:]}, nil
+}
+
+/*
+parsePSubscribeCommand parses PSUBSCRIBE command: PSUBSCRIBE pattern [pattern ...]
+
+Validation:
+  - Must have at least 2 arguments (PSUBSCRIBE, pattern1, ...)
+*/
+func (p *Peer) parsePSubscribeCommand(arr [][]byte) (Command, error) {
+	return PSubscribeCommand{patterns: arr[1:]}, nil
+}
+
+/*
+parsePUnsubscribeCommand parses PUNSUBSCRIBE command: PUNSUBSCRIBE [pattern [pattern ...]]
+
+Without patterns, the client is unsubscribed from all of them.
+*/
+func (p *Peer) parsePUnsubscribeCommand(arr [][]byte) (Command, error) {
+	return PUnsubscribeCommand{patterns: arr[1:]}, nil
+}
+
+/*
+parsePublishCommand parses PUBLISH command: PUBLISH channel message
+
+Validation:
+  - Must have exactly 3 arguments (PUBLISH, channel, message)
+*/
+func (p *Peer) parsePublishCommand(arr [][]byte) (Command, error) {
+	return PublishCommand{channel: arr[1], message: arr[2]}, nil
+}
+
+/*
+parseSSubscribeCommand parses SSUBSCRIBE command: SSUBSCRIBE shardchannel [shardchannel ...]
+
+Validation:
+  - Must have at least 2 arguments (SSUBSCRIBE, shardchannel1, ...)
+*/
+func (p *Peer) parseSSubscribeCommand(arr [][]byte) (Command, error) {
+	return SSubscribeCommand{channels: arr[1:]}, nil
+}
+
+/*
+parseSUnsubscribeCommand parses SUNSUBSCRIBE command: SUNSUBSCRIBE [shardchannel [shardchannel ...]]
+
+Without shard channels, the client is unsubscribed from all of them.
+*/
+func (p *Peer) parseSUnsubscribeCommand(arr [][]byte) (Command, error) {
+	return SUnsubscribeCommand{channels: arr[1:]}, nil
+}
+
+/*
+parseSPublishCommand parses SPUBLISH command: SPUBLISH shardchannel message
+
+Validation:
+  - Must have exactly 3 arguments (SPUBLISH, shardchannel, message)
+*/
+func (p *Peer) parseSPublishCommand(arr [][]byte) (Command, error) {
+	return SPublishCommand{channel: arr[1], message: arr[2]}, nil
+}
+
+/*
+parseGetSetCommand parses GETSET command: GETSET key value
+
+GETSET atomically sets a key and returns the old value.
+
+Validation: Must have exactly 3 arguments (GETSET, key, value)
+
+Example: ["GETSET", "counter", "0"] -> set counter to 0, return old value
+*/
+func (p *Peer) parseGetSetCommand(arr [][]byte) (Command, error) {
+	return GetSetCommand{
+		key: arr[1],
+		val: arr[2],
+	}, nil
+}
+
+/*
+parseKeysCommand parses KEYS command: KEYS pattern
+
+KEYS returns all keys matching a glob-style pattern.
+
+Validation:
+  - Must have exactly 2 arguments (KEYS, pattern)
+  - Pattern supports * wildcard
+
+Example: ["KEYS", "user:*"] -> find all keys starting with "user:"
+*/
+func (p *Peer) parseKeysCommand(arr [][]byte) (Command, error) {
+	return KeysCommand{
+		pattern: string(arr[1]),
+	}, nil
+}
+
+/*
+parseScanCommand parses SCAN command: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+
+Validation:
+  - Must have at least 2 arguments (SCAN, cursor)
+  - The cursor must be an unsigned 64-bit integer
+  - Options come in name/value pairs, in any order; COUNT must be at least 1
+  - TYPE must name a data type the server knows
+
+Example: ["SCAN", "0", "COUNT", "100"] -> ScanCommand{cursor: 0, count: 100}
+*/
+func (p *Peer) parseScanCommand(arr [][]byte) (Command, error) {
+	cursor, err := strconv.ParseUint(string(arr[1]), 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	cmd := ScanCommand{cursor: cursor, count: scanDefaultCount}
+	for i := 2; i < len(arr); i += 2 {
+		if i+1 >= len(arr) {
+			return nil, errSyntax
+		}
+		value := string(arr[i+1])
+
+		switch strings.ToUpper(string(arr[i])) {
+		case "MATCH":
+			// "*" matches everything, so skip matching altogether
+			if value != "*" {
+				cmd.pattern = value
+			}
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errNotInteger
+			}
+			if count < 1 {
+				return nil, errSyntax
+			}
+			cmd.count = count
+		case "TYPE":
+			switch valueType := ValueType(strings.ToLower(value)); valueType {
+			case TypeString, TypeList, TypeSet, TypeZSet, TypeHash:
+				cmd.valueType = valueType
+			default:
+				return nil, errUnknownTypeName(value)
+			}
+		default:
+			return nil, errSyntax
+		}
+	}
+
+	return cmd, nil
+}
+
+/*
+parseFlushAllCommand parses FLUSHALL command: FLUSHALL
+
+FLUSHALL removes all keys from the database.
+
+Validation:
+  - Must have exactly 1 argument (just FLUSHALL)
+  - No parameters allowed
+
+Example: ["FLUSHALL"] -> delete everything
+*/
+func (p *Peer) parseFlushAllCommand(arr [][]byte) (Command, error) {
+	return FlushAllCommand{}, nil
+}
+
+/*
+parseImportCommand parses IMPORT command: IMPORT type key ttl count element [element ...] ...
+
+Validation:
+  - Records follow each other: type, key, TTL, element count, elements
+  - The type must be string, list, set, hash or zset
+  - The TTL is milliseconds, -1 for none; a record whose TTL is 0 has
+    expired already and is skipped
+  - The count must be positive and match the elements left
+  - Whether the elements fit the type is checked by Storage.Import
+
+Example: ["IMPORT", "list", "queue", "-1", "2", "a", "b"] -> the list [a, b]
+*/
+func (p *Peer) parseImportCommand(arr [][]byte) (Command, error) {
+	var records []ImportRecord
+	for i := 1; i < len(arr); {
+		if len(arr)-i < 5 {
+			return nil, errSyntax
+		}
+
+		valueType := ValueType(strings.ToLower(string(arr[i])))
+		switch valueType {
+		case TypeString, TypeList, TypeSet, TypeHash, TypeZSet:
+		default:
+			return nil, errSyntax
+		}
+
+		ttl, err := strconv.ParseInt(string(arr[i+2]), 10, 64)
+		if err != nil || ttl < -1 {
+			return nil, errNotInteger
+		}
+		count, err := strconv.Atoi(string(arr[i+3]))
+		if err != nil {
+			return nil, errNotInteger
+		}
+		if count < 1 || count > len(arr)-i-4 {
+			return nil, errSyntax
+		}
+
+		if ttl != 0 {
+			record := ImportRecord{Type: valueType, Key: arr[i+1], Elements: arr[i+4 : i+4+count]}
+			if ttl > 0 {
+				record.TTL = time.Duration(ttl) * time.Millisecond
+			}
+			records = append(records, record)
+		}
+		i += 4 + count
+	}
+
+	return ImportCommand{records: records}, nil
+}
+
+/*
+parseExportCommand parses EXPORT command: EXPORT cursor [COUNT count] [MATCH pattern]
+
+Validation:
+  - The cursor must be an unsigned integer
+  - COUNT must be a positive integer
+  - Options come in name/value pairs, in any order
+
+Example: ["EXPORT", "0", "COUNT", "500"] -> ExportCommand{cursor: 0, count: 500}
+*/
+func (p *Peer) parseExportCommand(arr [][]byte) (Command, error) {
+	cursor, err := strconv.ParseUint(string(arr[1]), 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	cmd := ExportCommand{cursor: cursor, count: exportDefaultCount}
+	for i := 2; i < len(arr); i += 2 {
+		if i+1 >= len(arr) {
+			return nil, errSyntax
+		}
+		value := string(arr[i+1])
+
+		switch strings.ToUpper(string(arr[i])) {
+		case "MATCH":
+			if value != "*" {
+				cmd.pattern = value
+			}
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errNotInteger
+			}
+			if count < 1 {
+				return nil, errSyntax
+			}
+			cmd.count = count
+		default:
+			return nil, errSyntax
+		}
+	}
+
+	return cmd, nil
+}
+
+/*
+parseTypeCommand parses TYPE command: TYPE key
+
+TYPE reports what kind of value is stored at a key.
+
+Validation:
+  - Must have exactly 2 arguments (TYPE, key)
+
+Example: ["TYPE", "name"] -> TypeCommand{key: "name"}
+*/
+func (p *Peer) parseTypeCommand(arr [][]byte) (Command, error) {
+	return TypeCommand{
+		key: arr[1],
+	}, nil
+}
+
+/*
+parseTTLCommand parses TTL and PTTL commands: TTL key, PTTL key
+
+Validation:
+  - Must have exactly 2 arguments (TTL or PTTL, key)
+
+Example: ["PTTL", "session"] -> TTLCommand{key: "session", milliseconds: true}
+*/
+func (p *Peer) parseTTLCommand(arr [][]byte) (Command, error) {
+	return TTLCommand{
+		key:          arr[1],
+		milliseconds: strings.EqualFold(string(arr[0]), CommandPTTL),
+	}, nil
+}
+
+/*
+parseExpireTimeCommand parses EXPIRETIME and PEXPIRETIME commands:
+EXPIRETIME key, PEXPIRETIME key
+
+Validation:
+  - Must have exactly 2 arguments (EXPIRETIME or PEXPIRETIME, key)
+
+Example: ["PEXPIRETIME", "session"] -> ExpireTimeCommand{key: "session", milliseconds: true}
+*/
+func (p *Peer) parseExpireTimeCommand(arr [][]byte) (Command, error) {
+	return ExpireTimeCommand{
+		key:          arr[1],
+		milliseconds: strings.EqualFold(string(arr[0]), CommandPEXPIRETIME),
+	}, nil
+}
+
+/*
+parseObjectCommand parses OBJECT command: OBJECT subcommand key
+
+OBJECT is a container command; the subcommand decides the arguments.
+Subcommand names and argument counts (and HELP) are checked against
+commandSpecs before this runs.
+
+Example: ["OBJECT", "ENCODING", "name"] -> ObjectCommand{subcommand: "ENCODING", key: "name"}
+*/
+func (p *Peer) parseObjectCommand(arr [][]byte) (Command, error) {
+	return ObjectCommand{subcommand: strings.ToUpper(string(arr[1])), key: arr[2]}, nil
+}
+
+/*
+parseClusterCommand parses CLUSTER command: CLUSTER KEYSLOT key
+
+KEYSLOT is the only subcommand besides HELP, and commandSpecs checks it.
+
+Example: ["CLUSTER", "KEYSLOT", "foo"] -> ClusterCommand{subcommand: "KEYSLOT", key: "foo"}
+*/
+func (p *Peer) parseClusterCommand(arr [][]byte) (Command, error) {
+	return ClusterCommand{subcommand: strings.ToUpper(string(arr[1])), key: arr[2]}, nil
+}
+
+/*
+parseCommandCommand parses COMMAND command: COMMAND GETKEYS command [arg ...]
+
+GETKEYS is the only subcommand besides HELP, and commandSpecs checks it.
+The keys of the given command are found at its key positions; IMPORT's
+move with its element counts, so it's parsed and asked for them.
+
+Validation:
+  - The command must exist and its argument count match its arity
+  - It must have at least one key
+
+Example: ["COMMAND", "GETKEYS", "SMOVE", "a", "b", "m"] -> CommandCommand{keys: ["a", "b"]}
+*/
+func (p *Peer) parseCommandCommand(arr [][]byte) (Command, error) {
+	args := arr[2:]
+	spec, err := commandKeySpec(args)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := spec.extract(args)
+	if spec.movable {
+		cmd, err := p.parseCommand(args)
+		if err != nil {
+			return nil, err
+		}
+		keys = cmd.(multiKeyCommand).commandKeys()
+	}
+	if len(keys) == 0 {
+		return nil, errNoKeyArguments
+	}
+	return CommandCommand{keys: keys}, nil
+}
+
+/*
+parseDebugCommand parses DEBUG command: DEBUG subcommand [arg]
+
+Subcommand names and argument counts are checked against commandSpecs
+before this runs; what's left is the argument values.
+
+Validation:
+  - OBJECT takes a key, TRACE a pattern or OFF, SLEEP a number of seconds (decimals allowed, negative
+    values sleep for no time), SET-ACTIVE-EXPIRE an integer (0 disables)
+
+Examples:
+  - ["DEBUG", "SLEEP", "0.5"] -> DebugCommand{subcommand: "SLEEP", sleep: 500ms}
+  - ["DEBUG", "SET-ACTIVE-EXPIRE", "0"] -> DebugCommand{subcommand: "SET-ACTIVE-EXPIRE", enabled: false}
+  - ["DEBUG", "TRACE", "OFF"] -> TraceCommand{pattern: ""}
+*/
+func (p *Peer) parseDebugCommand(arr [][]byte) (Command, error) {
+	subcommand := strings.ToUpper(string(arr[1]))
+	cmd := DebugCommand{subcommand: subcommand}
+	switch subcommand {
+	case "FAULT":
+		return p.parseDebugFaultCommand(arr)
+
+	case "DIAGNOSTICS":
+		return DiagnosticsCommand{}, nil
+
+	case "TRACE":
+		pattern := string(arr[2])
+		if strings.EqualFold(pattern, "OFF") {
+			pattern = ""
+		}
+		return TraceCommand{pattern: pattern}, nil
+
+	case "DIGEST-VALUE":
+		cmd.keys = arr[2:]
+
+	case "OBJECT":
+		cmd.key = arr[2]
+
+	case "SLEEP":
+		seconds, err := strconv.ParseFloat(string(arr[2]), 64)
+		if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return nil, errNotFloat
+		}
+		cmd.sleep = time.Duration(max(seconds, 0) * float64(time.Second))
+
+	case "SET-ACTIVE-EXPIRE":
+		enabled, err := strconv.Atoi(string(arr[2]))
+		if err != nil {
+			return nil, errNotInteger
+		}
+		cmd.enabled = enabled != 0
+	}
+
+	return cmd, nil
+}
+
+/*
+parseDebugFaultCommand parses DEBUG FAULT: DEBUG FAULT SET|CLEAR|LIST [...]
+
+Validation:
+  - SET takes a command name other than DEBUG and QUIT, and an action: DELAY with a
+    number of milliseconds, DROP, ERROR with a single-line message, or
+    PARTIAL; RATE optionally gives the percentage of calls affected (1-100)
+  - CLEAR takes an optional command name, LIST nothing
+
+Examples:
+  - ["DEBUG", "FAULT", "SET", "get", "DROP"] -> FaultCommand{verb: "SET", name: "GET", fault: drop at rate 100}
+  - ["DEBUG", "FAULT", "CLEAR"] -> FaultCommand{verb: "CLEAR"}
+*/
+func (p *Peer) parseDebugFaultCommand(arr [][]byte) (Command, error) {
+	verb := strings.ToUpper(string(arr[2]))
+	switch verb {
+	case "LIST":
+		if len(arr) != 3 {
+			return nil, errSyntax
+		}
+		return FaultCommand{verb: verb}, nil
+
+	case "CLEAR":
+		if len(arr) > 4 {
+			return nil, errSyntax
+		}
+		cmd := FaultCommand{verb: verb}
+		if len(arr) == 4 {
+			cmd.name = strings.ToUpper(string(arr[3]))
+		}
+		return cmd, nil
+
+	case "SET":
+		if len(arr) < 5 {
+			return nil, errSyntax
+		}
+
+	default:
+		return nil, errSyntax
+	}
+
+	cmd := FaultCommand{verb: verb, name: strings.ToUpper(string(arr[3])), fault: fault{rate: 100}}
+	if cmd.name == CommandDEBUG || cmd.name == CommandQUIT {
+		return nil, errFaultNotAllowed
+	}
+
+	// The action, with its argument for DELAY and ERROR
+	i := 5
+	switch strings.ToUpper(string(arr[4])) {
+	case "DELAY":
+		if len(arr) < 6 {
+			return nil, errSyntax
+		}
+		ms, err := strconv.Atoi(string(arr[5]))
+		if err != nil {
+			return nil, errNotInteger
+		}
+		// Checked before converting, so a huge count can't overflow the duration
+		if ms < 0 || ms > int(faultMaxDelay/time.Millisecond) {
+			return nil, errValueOutOfRange
+		}
+		cmd.fault.action = faultDelay
+		cmd.fault.delay = time.Duration(ms) * time.Millisecond
+		i = 6
+
+	case "DROP":
+		cmd.fault.action = faultDrop
+
+	case "ERROR":
+		// The message becomes an error reply, which can't span lines
+		if len(arr) < 6 || len(arr[5]) == 0 || strings.ContainsAny(string(arr[5]), "\r\n") {
+			return nil, errSyntax
+		}
+		cmd.fault.action = faultError
+		cmd.fault.message = string(arr[5])
+		i = 6
+
+	case "PARTIAL":
+		cmd.fault.action = faultPartial
+
+	default:
+		return nil, errSyntax
+	}
+
+	// Optional RATE percent
+	if i < len(arr) {
+		if len(arr) != i+2 || strings.ToUpper(string(arr[i])) != "RATE" {
+			return nil, errSyntax
+		}
+		rate, err := strconv.Atoi(string(arr[i+1]))
+		if err != nil {
+			return nil, errNotInteger
+		}
+		if rate < 1 || rate > 100 {
+			return nil, errValueOutOfRange
+		}
+		cmd.fault.rate = rate
+	}
+
+	return cmd, nil
+}
+
+/*
+parseInfoCommand parses INFO command: INFO [section [section ...]]
+
+Section names are case-insensitive.
+
+Example: ["INFO", "Stats"] -> report the stats section
+*/
+func (p *Peer) parseInfoCommand(arr [][]byte) (Command, error) {
+	sections := make([]string, 0, len(arr)-1)
+	for _, section := range arr[1:] {
+		sections = append(sections, strings.ToLower(string(section)))
+	}
+
+	return InfoCommand{sections: sections}, nil
+}
+
+/*
+parseMemoryCommand parses MEMORY command: MEMORY subcommand [arguments...]
+
+Validation:
+  - USAGE takes a key and an optional SAMPLES count (at least 0)
+
+Example: ["MEMORY", "USAGE", "name", "SAMPLES", "0"] -> estimate with every element
+*/
+func (p *Peer) parseMemoryCommand(arr [][]byte) (Command, error) {
+	cmd := MemoryCommand{subcommand: strings.ToUpper(string(arr[1])), samples: memoryUsageSamples}
+	if cmd.subcommand != "USAGE" {
+		return cmd, nil
+	}
+
+	cmd.key = arr[2]
+	switch {
+	case len(arr) == 3:
+	case len(arr) == 5 && strings.ToUpper(string(arr[3])) == "SAMPLES":
+		samples, err := strconv.Atoi(string(arr[4]))
+		if err != nil {
+			return nil, errNotInteger
+		}
+		if samples < 0 {
+			return nil, errSyntax
+		}
+		cmd.samples = samples
+	default:
+		return nil, errSyntax
+	}
+
+	return cmd, nil
+}
+
+/*
+parseHelloCommand parses HELLO command: HELLO [protover [AUTH username password] [SETNAME clientname]]
+
+HELLO is used for protocol negotiation and client identification.
+
+Validation:
+  - Can have 1 or more arguments
+  - First optional argument is protocol version, 2 or 3
+  - AUTH and SETNAME are accepted and ignored
+
+Examples:
+  - ["HELLO", "3"] -> negotiate protocol version 3
+  - ["HELLO"] -> keep the current version
+*/
+func (p *Peer) parseHelloCommand(arr [][]byte) (Command, error) {
+	if len(arr) == 1 {
+		return HelloCommand{}, nil
+	}
+
+	protocol, err := strconv.Atoi(string(arr[1]))
+	if err != nil {
+		return nil, errProtoVersion
+	}
+	if protocol != 2 && protocol != 3 {
+		return nil, errNoProto
+	}
+	return HelloCommand{protocol: protocol}, nil
+}
+
+/*
+parseClientCommand parses CLIENT command: CLIENT subcommand [arg [arg ...]]
+
+CLIENT provides client connection management functionality. Subcommand
+names and argument counts are checked against commandSpecs before this
+runs.
+
+Example: ["CLIENT", "SETNAME", "worker-1"] -> ClientCommand{subcommand: "SETNAME", args: ["worker-1"]}
+*/
+func (p *Peer) parseClientCommand(arr [][]byte) (Command, error) {
+	return ClientCommand{subcommand: strings.ToUpper(string(arr[1])), args: arr[2:]}, nil
+}
+
+/*
+parsePingCommand parses PING command: PING [message]
+
+PING tests connection and optionally echoes a message.
+
+Validation:
+  - Can have 1 or 2 arguments
+  - Optional second argument is message to echo
+
+Examples:
+  - ["PING"] -> returns "PONG"
+  - ["PING", "hello"] -> returns "hello"
+*/
+func (p *Peer) parsePingCommand(arr [][]byte) (Command, error) {
+	if len(arr) > 2 {
+		return nil, errWrongNumberOfArgs(CommandPING)
+	}
+
+	message := ""
+	if len(arr) > 1 {
+		message = string(arr[1])
+	}
+
+	return PingCommand{message: message}, nil
+}
+
+/*
+parseQuitCommand parses QUIT command: QUIT
+
+QUIT closes the connection after replying OK.
+
+Validation:
+  - Extra arguments are ignored, like in Redis
+
+Example: ["QUIT"] -> reply OK and disconnect
+*/
+func (p *Peer) parseQuitCommand(arr [][]byte) (Command, error) {
+	return QuitCommand{}, nil
 }
@@ -0,0 +1,265 @@
+package goredis
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/*
+Fuzz Tests for Redis Clone
+
+The RESP reader and the glob matcher both run on whatever a client sends,
+so they must cope with any input: no panics, no endless loops, and
+results that agree with the bytes they came from.
+
+Key concepts:
+- Seed Corpus: The seeds run as ordinary tests with go test; go test
+  -fuzz=FuzzReadCommand (or FuzzMatchPattern, FuzzPatternIndex) explores
+  from there
+- Differential: The pattern index must find exactly the patterns that
+  matchPattern, tried on each of them, would
+- Consumed Bytes: The reader's position in the input is the input read
+  from the source minus what's still buffered, so every command can be
+  checked against the exact bytes it was parsed from
+*/
+
+func FuzzReadCommand(f *testing.F) {
+	seeds := []string{
+		"*1\r\n$4\r\nPING\r\n",
+		"*3\r\n$3\r\nSET\r\n$4\r\nname\r\n$4\r\nJohn\r\n",
+		"*2\r\n$3\r\nGET\r\n$4\r\nname\r\n*1\r\n$4\r\nQUIT\r\n",
+		"*2\r\n$3\r\nGET\r\n$0\r\n\r\n",
+		"*1\n$4\nPING\r\n",
+		"*+1\r\n$04\r\nPING\r\n",
+		"PING\r\n",
+		"SET name John\nGET name\n",
+		"  \t\r\n\r\nPING\r\n",
+		"*0\r\n*-1\r\nPING\r\n",
+		"*1\r\n$-1\r\n",
+		"*1\r\n$3\r\nabcde\r\n",
+		"*1\r\nPING\r\n",
+		"*1\r\n\r\n",
+		"*2\r\n$3\r\nGET\r\n",
+		"*1048577\r\n",
+		"*x\r\n",
+		"*1\r\n$536870913\r\n",
+		"$3\r\nfoo\r\n",
+		"*1\r\n$3\r\n\x00\xff\n\r\n",
+		strings.Repeat("a", respReadBufferSize+10) + "\r\n",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	// One inline command per entry of the command table, so the fuzzer starts at every parser
+	names := slices.Sorted(maps.Keys(commandSpecs))
+	for _, name := range names {
+		f.Add([]byte(name + " key 0 -1 member 1.5 NX EX 10\r\n"))
+		for _, sub := range commandSpecs[name].subcommands {
+			f.Add([]byte(name + " " + sub.name + " key 0 1\r\n"))
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		source := bytes.NewReader(data)
+		reader := newRespReader(source)
+		consumed := func() int { return len(data) - source.Len() - reader.rd.Buffered() }
+
+		// Every command takes at least one byte, so there's at most one per byte
+		start := 0
+		for range len(data) + 1 {
+			args, err := reader.ReadCommand()
+			if err != nil {
+				return
+			}
+			end := consumed()
+			if end <= start {
+				t.Fatalf("command %q consumed no input at offset %d", args, start)
+			}
+			checkParsedCommand(t, args, data[start:end])
+			start = end
+
+			// The rest of the peer's parsing path must cope with any arguments too
+			var peer Peer
+			peer.parseCommand(args)
+		}
+		t.Fatalf("read more commands than %d bytes of input allow", len(data))
+	})
+}
+
+/*
+checkParsedCommand checks args against the bytes they were parsed from
+
+The bytes must hold at least the arguments and the separators between
+them, parse to the same command on their own (so nothing past them was
+needed), and the command must survive a round trip through multibulk.
+*/
+func checkParsedCommand(t *testing.T, args [][]byte, input []byte) {
+	t.Helper()
+
+	if len(args) == 0 || len(args) > respMaxMultibulkLength {
+		t.Fatalf("parsed %d arguments from %q", len(args), input)
+	}
+	size := len(args) - 1
+	for _, arg := range args {
+		size += len(arg)
+	}
+	if size > len(input) {
+		t.Fatalf("parsed %d arguments of %d bytes from %d bytes of input %q", len(args), size, len(input), input)
+	}
+
+	for _, encoded := range [][]byte{input, encodeMultibulk(args)} {
+		source := bytes.NewReader(encoded)
+		reader := newRespReader(source)
+		again, err := reader.ReadCommand()
+		if err != nil {
+			t.Fatalf("parsing %q again: %v", encoded, err)
+		}
+		if !equalArgs(again, args) {
+			t.Fatalf("%q parses to %q, want %q", encoded, again, args)
+		}
+		if rest := source.Len() + reader.rd.Buffered(); rest != 0 {
+			t.Fatalf("%q parses to %q with %d bytes left over", encoded, again, rest)
+		}
+	}
+}
+
+/*
+encodeMultibulk encodes args the way client libraries send them
+*/
+func encodeMultibulk(args [][]byte) []byte {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+func equalArgs(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzMatchPattern(f *testing.F) {
+	seeds := [][2]string{
+		{"hello", "*"},
+		{"hello", "h?llo"},
+		{"hello", "h[a-e]llo"},
+		{"hello", "h[^e]llo"},
+		{"hello", "h[e-a]llo"},
+		{"h*llo", "h\\*llo"},
+		{"a\\", "a\\"},
+		{"user:1", "user:[0-9]"},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaac", "*a*a*a*a*a*a*a*a*a*a*b"},
+		{"[", "["},
+		{"a", "[a"},
+		{"]", "[]]"},
+		{"-", "[a-]"},
+		{"x", "[\\"},
+		{"", ""},
+		{"", "**"},
+		{"abc", "[^"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, key, pattern string) {
+		matched := matchPattern(key, pattern)
+
+		if !matchPattern(key, escapePattern(key)) {
+			t.Errorf("%q doesn't match itself escaped, %q", key, escapePattern(key))
+		}
+		if !matchPattern(key, "*") {
+			t.Errorf("%q doesn't match *", key)
+		}
+		if matched && !matchPattern(key, "*"+pattern) {
+			t.Errorf("%q matches %q but not %q", key, pattern, "*"+pattern)
+		}
+		if !strings.ContainsAny(pattern, `*?[\`) && matched != (key == pattern) {
+			t.Errorf("plain pattern %q: matchPattern(%q) = %v", pattern, key, matched)
+		}
+	})
+}
+
+/*
+escapePattern returns a pattern that matches exactly s
+*/
+func escapePattern(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(`*?[]\`, s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func FuzzPatternIndex(f *testing.F) {
+	seeds := [][4]string{
+		{"news.tech", "news.*", "*", "news.tech"},
+		{"news.tech", "news.t*", "new?.*", "n*s.tech"},
+		{"a*b", "a\\*b*", "a\\*c", "a*"},
+		{"a\\", "a\\", "a\\*", "[a]\\"},
+		{"[x", "[x", "\\[x", "[[]x"},
+		{"user.1234.login", "user.1234.*", "user.123", "user.[0-9]*"},
+		{"", "", "*", "?"},
+		{"abc", "abc", "abc*", "ab"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1], seed[2], seed[3], uint8(0b010))
+	}
+
+	f.Fuzz(func(t *testing.T, channel, p1, p2, p3 string, removed uint8) {
+		var index patternIndex
+		indexed := make(map[string]bool)
+		for _, pattern := range []string{p1, p2, p3} {
+			if !indexed[pattern] {
+				index.add(pattern)
+				indexed[pattern] = true
+			}
+		}
+		for i, pattern := range []string{p1, p2, p3} {
+			if removed&(1<<i) != 0 && indexed[pattern] {
+				index.remove(pattern)
+				delete(indexed, pattern)
+			}
+		}
+
+		var got []string
+		index.match(channel, func(pattern string) { got = append(got, pattern) })
+		var want []string
+		for pattern := range indexed {
+			if matchPattern(channel, pattern) {
+				want = append(want, pattern)
+			}
+		}
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("channel %q: the index matched %q, matchPattern matches %q of %q", channel, got, want, slices.Sorted(maps.Keys(indexed)))
+		}
+
+		// Removing what's left prunes the trie back to an empty root
+		for pattern := range indexed {
+			index.remove(pattern)
+		}
+		if len(index.root.children) > 0 || len(index.root.patterns) > 0 {
+			t.Errorf("index not empty after every pattern was removed: %d children, patterns %q", len(index.root.children), index.root.patterns)
+		}
+	})
+}
@@ -0,0 +1,386 @@
+package goredis
+
+/*
+Pub/Sub for Redis Clone
+
+This file implements publish/subscribe messaging. Clients subscribe to
+channels by name (SUBSCRIBE) or by glob pattern (PSUBSCRIBE), and every
+PUBLISH to a channel is pushed to the matching subscribers. Shard channels
+(SSUBSCRIBE/SPUBLISH, from Redis 7) are a separate namespace meant for
+cluster deployments, where a shard channel lives on the node owning its
+slot; on a single node they behave like plain channels without patterns. Messages are
+fire-and-forget: they are never stored, and clients that aren't
+subscribed when a message is published never see it.
+
+Key concepts:
+- Subscriptions: Kept per channel (who receives a message) and in each
+  peer's session (what a client unsubscribes from, and what is dropped
+  when it leaves)
+- Subscribed Mode: Once a RESP2 client has subscriptions, it may only
+  manage them, PING or QUIT, like in Redis
+- RESP3: A client that switched to RESP3 with HELLO 3 gets confirmations
+  and messages as push frames (>), which it can tell apart from replies,
+  so it may run any command while subscribed
+- Patterns: Use the same glob syntax as KEYS (see matchPattern), and are
+  indexed by literal prefix so PUBLISH only tries the ones that can match
+  (see patternindex.go)
+- Single Goroutine: The hub is only used from the server loop, so it needs
+  no locking
+*/
+
+/*
+PubSub keeps track of channel and pattern subscriptions
+*/
+type PubSub struct {
+	channels map[string]map[*Peer]struct{} // channel -> subscribed peers
+	patterns map[string]map[*Peer]struct{} // pattern -> subscribed peers
+	shards   map[string]map[*Peer]struct{} // shard channel -> subscribed peers
+
+	patternIndex patternIndex // the keys of patterns, by literal prefix
+}
+
+/*
+subscriptionKind selects channels, patterns or shard channels
+*/
+type subscriptionKind int
+
+const (
+	subChannel subscriptionKind = iota
+	subPattern
+	subShard
+)
+
+/*
+peerSubscriptions is what a single peer is subscribed to
+
+It's part of the peer's session; the maps are created on the first
+subscription.
+*/
+type peerSubscriptions struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	shards   map[string]struct{}
+}
+
+/*
+count returns the number of subscriptions reported in replies for kind
+
+Like Redis, channels and patterns are counted together while shard
+channels are counted on their own.
+*/
+func (ps *peerSubscriptions) count(kind subscriptionKind) int {
+	if kind == subShard {
+		return len(ps.shards)
+	}
+	return len(ps.channels) + len(ps.patterns)
+}
+
+/*
+total returns the number of subscriptions of every kind
+*/
+func (ps *peerSubscriptions) total() int {
+	return len(ps.channels) + len(ps.patterns) + len(ps.shards)
+}
+
+/*
+NewPubSub creates an empty pub/sub hub
+*/
+func NewPubSub() *PubSub {
+	return &PubSub{
+		channels: make(map[string]map[*Peer]struct{}),
+		patterns: make(map[string]map[*Peer]struct{}),
+		shards:   make(map[string]map[*Peer]struct{}),
+	}
+}
+
+/*
+subscriptionsOf returns the subscriptions of peer, creating the maps when missing
+*/
+func (h *PubSub) subscriptionsOf(peer *Peer) *peerSubscriptions {
+	subs := &peer.session.subscriptions
+	if subs.channels == nil {
+		subs.channels = make(map[string]struct{})
+		subs.patterns = make(map[string]struct{})
+		subs.shards = make(map[string]struct{})
+	}
+	return subs
+}
+
+/*
+subscribed reports whether peer has any subscription, i.e. is in subscribed mode
+*/
+func (h *PubSub) subscribed(peer *Peer) bool {
+	return peer.session.subscriptions.total() > 0
+}
+
+/*
+sets returns the subscription index and the peer's own set for kind
+*/
+func (h *PubSub) sets(subs *peerSubscriptions, kind subscriptionKind) (map[string]map[*Peer]struct{}, map[string]struct{}) {
+	switch kind {
+	case subPattern:
+		return h.patterns, subs.patterns
+	case subShard:
+		return h.shards, subs.shards
+	}
+	return h.channels, subs.channels
+}
+
+/*
+subscribe adds peer to the subscribers of each name of the given kind
+
+Returns: One confirmation frame per name, concatenated
+*/
+func (h *PubSub) subscribe(peer *Peer, names [][]byte, kind subscriptionKind, frameName string) []byte {
+	subs := h.subscriptionsOf(peer)
+	index, own := h.sets(subs, kind)
+
+	var reply []byte
+	for _, name := range names {
+		nameStr := string(name)
+		if _, exists := own[nameStr]; !exists {
+			own[nameStr] = struct{}{}
+			if index[nameStr] == nil {
+				index[nameStr] = make(map[*Peer]struct{})
+				if kind == subPattern {
+					h.patternIndex.add(nameStr)
+				}
+			}
+			index[nameStr][peer] = struct{}{}
+		}
+		reply = append(reply, pubsubFrame(peer, frameName, name, subs.count(kind))...)
+	}
+	return reply
+}
+
+/*
+unsubscribe removes peer from the subscribers of each name of the given kind
+
+Without names, every subscription of that kind is removed. When there was
+nothing to remove, Redis still confirms with a single frame carrying a
+null name.
+
+Returns: One confirmation frame per name, concatenated
+*/
+func (h *PubSub) unsubscribe(peer *Peer, names [][]byte, kind subscriptionKind, frameName string) []byte {
+	subs := &peer.session.subscriptions
+	index, own := h.sets(subs, kind)
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, []byte(name))
+		}
+		if len(names) == 0 {
+			return pubsubFrame(peer, frameName, nil, subs.count(kind))
+		}
+	}
+
+	var reply []byte
+	for _, name := range names {
+		nameStr := string(name)
+		if _, exists := own[nameStr]; exists {
+			delete(own, nameStr)
+			delete(index[nameStr], peer)
+			if len(index[nameStr]) == 0 {
+				delete(index, nameStr)
+				if kind == subPattern {
+					h.patternIndex.remove(nameStr)
+				}
+			}
+		}
+		reply = append(reply, pubsubFrame(peer, frameName, name, subs.count(kind))...)
+	}
+	return reply
+}
+
+/*
+Subscribe subscribes peer to channels (SUBSCRIBE)
+*/
+func (h *PubSub) Subscribe(peer *Peer, channels [][]byte) []byte {
+	return h.subscribe(peer, channels, subChannel, "subscribe")
+}
+
+/*
+Unsubscribe unsubscribes peer from channels, or from all of them (UNSUBSCRIBE)
+*/
+func (h *PubSub) Unsubscribe(peer *Peer, channels [][]byte) []byte {
+	return h.unsubscribe(peer, channels, subChannel, "unsubscribe")
+}
+
+/*
+PSubscribe subscribes peer to channel patterns (PSUBSCRIBE)
+*/
+func (h *PubSub) PSubscribe(peer *Peer, patterns [][]byte) []byte {
+	return h.subscribe(peer, patterns, subPattern, "psubscribe")
+}
+
+/*
+PUnsubscribe unsubscribes peer from patterns, or from all of them (PUNSUBSCRIBE)
+*/
+func (h *PubSub) PUnsubscribe(peer *Peer, patterns [][]byte) []byte {
+	return h.unsubscribe(peer, patterns, subPattern, "punsubscribe")
+}
+
+/*
+SSubscribe subscribes peer to shard channels (SSUBSCRIBE)
+*/
+func (h *PubSub) SSubscribe(peer *Peer, channels [][]byte) []byte {
+	return h.subscribe(peer, channels, subShard, "ssubscribe")
+}
+
+/*
+SUnsubscribe unsubscribes peer from shard channels, or from all of them (SUNSUBSCRIBE)
+*/
+func (h *PubSub) SUnsubscribe(peer *Peer, channels [][]byte) []byte {
+	return h.unsubscribe(peer, channels, subShard, "sunsubscribe")
+}
+
+/*
+Publish delivers message to every subscriber of channel
+
+Channel subscribers get a "message" frame; subscribers of each matching
+pattern get a "pmessage" frame that also names the pattern. A client
+subscribed through several matching patterns gets the message once per
+pattern, like in Redis.
+
+Returns: The number of deliveries
+*/
+func (h *PubSub) Publish(channel, message []byte) int {
+	receivers := 0
+
+	if peers := h.channels[string(channel)]; len(peers) > 0 {
+		frames := messageFrames{elements: [][]byte{[]byte("message"), channel, message}}
+		for peer := range peers {
+			peer.Send(frames.frameFor(peer))
+			receivers++
+		}
+	}
+
+	h.patternIndex.match(string(channel), func(pattern string) {
+		frames := messageFrames{elements: [][]byte{[]byte("pmessage"), []byte(pattern), channel, message}}
+		for peer := range h.patterns[pattern] {
+			peer.Send(frames.frameFor(peer))
+			receivers++
+		}
+	})
+
+	return receivers
+}
+
+/*
+SPublish delivers message to every subscriber of a shard channel
+
+Shard channels don't match patterns; subscribers get an "smessage" frame.
+
+Returns: The number of deliveries
+*/
+func (h *PubSub) SPublish(channel, message []byte) int {
+	peers := h.shards[string(channel)]
+	if len(peers) == 0 {
+		return 0
+	}
+
+	frames := messageFrames{elements: [][]byte{[]byte("smessage"), channel, message}}
+	for peer := range peers {
+		peer.Send(frames.frameFor(peer))
+	}
+	return len(peers)
+}
+
+/*
+removePeer drops every subscription of a peer, on RESET or when it disconnects
+*/
+func (h *PubSub) removePeer(peer *Peer) {
+	if !h.subscribed(peer) {
+		return
+	}
+	h.unsubscribe(peer, nil, subChannel, "unsubscribe")
+	h.unsubscribe(peer, nil, subPattern, "punsubscribe")
+	h.unsubscribe(peer, nil, subShard, "sunsubscribe")
+}
+
+/*
+messageFrames builds the frame of a published message once per protocol
+in use among its receivers
+*/
+type messageFrames struct {
+	elements    [][]byte
+	array, push []byte
+}
+
+/*
+frameFor returns the frame for peer: an array for RESP2, a push frame for RESP3
+*/
+func (f *messageFrames) frameFor(peer *Peer) []byte {
+	if peer.session.protocol >= 3 {
+		if f.push == nil {
+			f.push = respWritePush(f.elements)
+		}
+		return f.push
+	}
+	if f.array == nil {
+		f.array = respWriteArray(f.elements)
+	}
+	return f.array
+}
+
+/*
+pubsubFrame builds a subscription confirmation for peer: kind, name (null if nil), count
+
+Like messages, it's a push frame for RESP3 clients.
+*/
+func pubsubFrame(peer *Peer, kind string, name []byte, count int) []byte {
+	protocol := peer.session.protocol
+	nameFrame := respNullFor(protocol)
+	if name != nil {
+		nameFrame = respWriteBulkString(name)
+	}
+	return respWritePushFrame(protocol, respWriteBulkString([]byte(kind)), nameFrame, respWriteInteger(int64(count)))
+}
+
+/*
+peerCommand is implemented by commands that work on the connection that sent
+them rather than on the keyspace, like the pub/sub commands
+
+handleMessage calls ExecutePeer instead of Execute for them.
+*/
+type peerCommand interface {
+	ExecutePeer(server *Server, peer *Peer) ([]byte, error)
+}
+
+/*
+peerOnly provides the Execute method of peer commands
+
+It's embedded in every peerCommand so it satisfies Command; since the
+handler always runs ExecutePeer, Execute is never called.
+*/
+type peerOnly struct{}
+
+func (peerOnly) Execute(storage *Storage) ([]byte, error) {
+	return nil, errNeedsConnection
+}
+
+/*
+subscribedModeReply returns the reply for a command sent in subscribed mode
+
+In subscribed mode a RESP2 client may only manage its subscriptions, PING,
+RESET or QUIT. PING answers with a ["pong", message] array instead of +PONG so
+it can't be confused with a published message. RESP3 clients get messages
+as push frames, so every command runs normally for them.
+
+Returns: The reply and true if the command must not run normally
+*/
+func (s *Server) subscribedModeReply(msg Message) ([]byte, bool) {
+	if msg.peer.session.protocol >= 3 || !s.pubsub.subscribed(msg.peer) {
+		return nil, false
+	}
+
+	switch cmd := msg.cmd.(type) {
+	case SubscribeCommand, UnsubscribeCommand, PSubscribeCommand, PUnsubscribeCommand,
+		SSubscribeCommand, SUnsubscribeCommand, QuitCommand, ResetCommand:
+		return nil, false
+	case PingCommand:
+		return respWriteArray([][]byte{[]byte("pong"), []byte(cmd.message)}), true
+	}
+
+	return respWriteError(errSubscribedMode(string(msg.args[0])).Error()), true
+}
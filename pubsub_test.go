@@ -0,0 +1,80 @@
+package goredis_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPushFramesUnderRESP3(t *testing.T) {
+	server := startServer(t, nil)
+	subscriber := dial(t, server)
+	publisher := dial(t, server)
+
+	subscriber.do("HELLO", "3")
+	subscriber.expect(">3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n", "SUBSCRIBE", "news")
+	subscriber.expect(">3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:2\r\n", "PSUBSCRIBE", "n*")
+
+	// Regular commands still run, and a message published meanwhile comes before their reply
+	subscriber.expect("+OK\r\n", "SET", "greeting", "hello")
+	publisher.expect(":2\r\n", "PUBLISH", "news", "extra")
+	subscriber.send("GET", "greeting")
+	for _, want := range []string{
+		">3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nextra\r\n",
+		">4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nextra\r\n",
+		"$5\r\nhello\r\n",
+	} {
+		if got := subscriber.read(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	// Under RESP2 the same connection could only manage its subscriptions
+	legacy := dial(t, server)
+	legacy.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n", "SUBSCRIBE", "news")
+	if got := legacy.do("GET", "greeting"); !strings.HasPrefix(got, "-ERR Can't execute 'get'") {
+		t.Errorf("GET while subscribed under RESP2: got %q, want an error", got)
+	}
+}
+
+func TestPushFramesInterleaveWithReplies(t *testing.T) {
+	server := startServer(t, nil)
+	subscriber := dial(t, server)
+	publisher := dial(t, server)
+	subscriber.do("HELLO", "3")
+	subscriber.do("SUBSCRIBE", "feed")
+
+	// Messages are published while the subscriber's own pipeline runs
+	const n = 2000
+	publishes := make([][]string, n)
+	increments := make([][]string, n)
+	for i := range n {
+		publishes[i] = []string{"PUBLISH", "feed", fmt.Sprint(i)}
+		increments[i] = []string{"INCR", "counter"}
+	}
+	subscriber.pipeline(increments...)
+	publisher.pipeline(publishes...)
+
+	// Every frame arrives whole, each stream in its own order
+	replies, messages := 0, 0
+	for replies < n || messages < n {
+		frame := subscriber.read()
+		if strings.HasPrefix(frame, ">") {
+			want := fmt.Sprintf(">3\r\n$7\r\nmessage\r\n$4\r\nfeed\r\n$%d\r\n%d\r\n", len(fmt.Sprint(messages)), messages)
+			if frame != want {
+				t.Fatalf("push %d: got %q, want %q", messages, frame, want)
+			}
+			messages++
+			continue
+		}
+		replies++
+		if want := fmt.Sprintf(":%d\r\n", replies); frame != want {
+			t.Fatalf("reply %d: got %q, want %q", replies, frame, want)
+		}
+	}
+	for i := range n {
+		if got := publisher.read(); got != ":1\r\n" {
+			t.Fatalf("PUBLISH %d: got %q, want one receiver", i, got)
+		}
+	}
+}
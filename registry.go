@@ -0,0 +1,207 @@
+package goredis
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Custom Command Registry for Redis Clone
+
+This file lets Go code add its own commands to the server without touching
+the parser: a CommandSpec names the command, describes its arguments the
+way Redis' COMMAND does, and provides the function that runs it.
+
+	goredis.RegisterCommand(goredis.CommandSpec{
+		Name:     "GETLEN",
+		Arity:    2,
+		Flags:    goredis.CommandFlagReadOnly,
+		FirstKey: 1, LastKey: 1, KeyStep: 1,
+		Execute: func(storage *goredis.Storage, args [][]byte) ([]byte, error) {
+			value, _, err := storage.Get(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return goredis.ReplyInteger(int64(len(value))), nil
+		},
+	})
+
+Key concepts:
+- Arity: Like in Redis, counting the command name; positive means exactly
+  that many arguments, negative means at least that many
+- Key Positions: FirstKey, LastKey and KeyStep locate the keys among the
+  arguments (the name is position 0), so cluster mode can check them for
+  CROSSSLOT and write commands can report them to change data capture
+- Storage Access: Execute runs on the server loop like every built-in
+  command, and every exported Storage method takes the storage lock itself
+- Built-ins First: Built-in commands can't be replaced; the registry is
+  only consulted for names the parser doesn't know
+- Replies: The Reply* functions build the RESP replies Execute returns
+*/
+
+/*
+CommandFlags describe how a custom command behaves
+*/
+type CommandFlags uint
+
+const (
+	CommandFlagWrite    CommandFlags = 1 << iota // the command may modify its keys
+	CommandFlagReadOnly                          // the command only reads data
+	CommandFlagFast                              // the command runs in constant or logarithmic time
+)
+
+/*
+CommandSpec describes a custom command
+*/
+type CommandSpec struct {
+	Name     string       // command name, case-insensitive
+	Arity    int          // argument count including the name; negative for a minimum
+	Flags    CommandFlags // how the command behaves
+	FirstKey int          // position of the first key, 0 if the command takes no keys
+	LastKey  int          // position of the last key; negative counts from the end (-1 is the last argument)
+	KeyStep  int          // distance between keys, e.g. 2 for key/value pairs
+
+	// Execute runs the command with the arguments following its name.
+	// It returns what Command.Execute returns: a complete RESP reply, nil
+	// for a null reply, or an error.
+	Execute func(storage *Storage, args [][]byte) ([]byte, error)
+}
+
+/*
+customCommands holds the registered custom commands by upper-case name
+*/
+var customCommands = make(map[string]*CommandSpec)
+
+/*
+RegisterCommand adds a custom command
+
+RegisterCommand must be called before the server starts, typically from an
+init function; the registry isn't safe to change while clients are
+connected.
+
+Returns: An error if the spec is incomplete, or if the name belongs to a
+built-in or an already registered command
+*/
+func RegisterCommand(spec CommandSpec) error {
+	name := strings.ToUpper(spec.Name)
+	switch {
+	case name == "":
+		return fmt.Errorf("custom command has no name")
+	case spec.Execute == nil:
+		return fmt.Errorf("custom command %s has no Execute function", name)
+	case spec.Arity == 0:
+		return fmt.Errorf("custom command %s has no arity", name)
+	case spec.FirstKey < 0 || (spec.FirstKey > 0 && spec.KeyStep <= 0):
+		return fmt.Errorf("custom command %s has invalid key positions", name)
+	case customCommands[name] != nil:
+		return fmt.Errorf("command %s is already registered", name)
+	case isBuiltinCommand(name):
+		return fmt.Errorf("command %s is built in", name)
+	}
+
+	spec.Name = name
+	customCommands[name] = &spec
+	return nil
+}
+
+/*
+isBuiltinCommand reports whether the parser handles name itself
+
+Every built-in command has an entry in commandSpecs.
+*/
+func isBuiltinCommand(name string) bool {
+	_, ok := commandSpecs[name]
+	return ok
+}
+
+/*
+parseCustomCommand parses a command registered with RegisterCommand
+
+Returns: errUnknownCommand if no custom command has that name, or
+errWrongNumberOfArgs if the arity doesn't match
+*/
+func parseCustomCommand(arr [][]byte) (Command, error) {
+	spec := customCommands[strings.ToUpper(string(arr[0]))]
+	if spec == nil {
+		args := make([]string, len(arr)-1)
+		for i := 1; i < len(arr); i++ {
+			args[i-1] = string(arr[i])
+		}
+		return nil, errUnknownCommand(string(arr[0]), args)
+	}
+
+	if !arityMatches(spec.Arity, len(arr)) {
+		return nil, errWrongNumberOfArgs(spec.Name)
+	}
+
+	return CustomCommand{spec: spec, args: arr}, nil
+}
+
+/*
+CustomCommand is a parsed invocation of a registered custom command
+*/
+type CustomCommand struct {
+	spec *CommandSpec
+	args [][]byte // the name followed by the arguments
+}
+
+func (c CustomCommand) Execute(storage *Storage) ([]byte, error) {
+	return c.spec.Execute(storage, c.args[1:])
+}
+
+/*
+commandKeys returns the keys found at the spec's key positions
+*/
+func (c CustomCommand) commandKeys() [][]byte {
+	return c.spec.keySpec().extract(c.args)
+}
+
+/*
+keySpec returns the spec's key positions in the form of the built-in table
+*/
+func (spec *CommandSpec) keySpec() keySpec {
+	return keySpec{first: spec.FirstKey, last: spec.LastKey, step: spec.KeyStep}
+}
+
+/*
+writtenKeys returns the keys of a write command, for change data capture
+*/
+func (c CustomCommand) writtenKeys() [][]byte {
+	if c.spec.Flags&CommandFlagWrite == 0 {
+		return nil
+	}
+	return c.commandKeys()
+}
+
+/*
+ReplySimpleString returns a simple string reply, e.g. +OK
+
+str must not contain CR or LF; use ReplyBulkString for arbitrary bytes.
+*/
+func ReplySimpleString(str string) []byte {
+	return respWriteSimpleString(str)
+}
+
+/*
+ReplyBulkString returns a bulk string reply holding data, which may be any bytes
+*/
+func ReplyBulkString(data []byte) []byte {
+	return respWriteBulkString(data)
+}
+
+/*
+ReplyInteger returns an integer reply
+
+The reply may be shared, so it must not be modified.
+*/
+func ReplyInteger(num int64) []byte {
+	return respWriteInteger(num)
+}
+
+/*
+ReplyArray returns an array reply of bulk strings, with a null for every
+nil element
+*/
+func ReplyArray(elements [][]byte) []byte {
+	return respWriteArray(elements)
+}
@@ -0,0 +1,96 @@
+package goredis_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+The registry is global, so the custom commands are registered once, the
+way RegisterCommand's doc recommends
+*/
+func init() {
+	specs := []goredis.CommandSpec{
+		{
+			Name:     "getlen",
+			Arity:    2,
+			Flags:    goredis.CommandFlagReadOnly | goredis.CommandFlagFast,
+			FirstKey: 1, LastKey: 1, KeyStep: 1,
+			Execute: func(storage *goredis.Storage, args [][]byte) ([]byte, error) {
+				value, exists, err := storage.Get(args[0])
+				if err != nil || !exists {
+					return nil, err
+				}
+				return goredis.ReplyInteger(int64(len(value))), nil
+			},
+		},
+		{
+			Name:     "UPPERSET",
+			Arity:    -3,
+			Flags:    goredis.CommandFlagWrite,
+			FirstKey: 1, LastKey: -1, KeyStep: 2,
+			Execute: func(storage *goredis.Storage, args [][]byte) ([]byte, error) {
+				for i := 0; i+1 < len(args); i += 2 {
+					if err := storage.Set(args[i], bytes.ToUpper(args[i+1])); err != nil {
+						return nil, err
+					}
+				}
+				return goredis.ReplySimpleString("OK"), nil
+			},
+		},
+		{
+			Name:  "ECHOALL",
+			Arity: -1,
+			Execute: func(storage *goredis.Storage, args [][]byte) ([]byte, error) {
+				return goredis.ReplyArray(append(args, nil)), nil
+			},
+		},
+	}
+	for _, spec := range specs {
+		if err := goredis.RegisterCommand(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	client.expect("+OK\r\n", "SET", "greeting", "hello")
+	client.expect(":5\r\n", "GETLEN", "greeting")
+	client.expect("$-1\r\n", "getlen", "missing")
+	client.expect("-ERR wrong number of arguments for 'getlen' command\r\n", "GETLEN")
+
+	client.expect("+OK\r\n", "UPPERSET", "a", "one", "b", "two")
+	client.expect("$3\r\nTWO\r\n", "GET", "b")
+	client.expect("*2\r\n$1\r\na\r\n$1\r\nb\r\n", "COMMAND", "GETKEYS", "UPPERSET", "a", "one", "b", "two")
+
+	client.expect("*3\r\n$1\r\nx\r\n$1\r\ny\r\n$-1\r\n", "ECHOALL", "x", "y")
+}
+
+func TestRegisterCommandRejectsInvalidSpecs(t *testing.T) {
+	execute := func(*goredis.Storage, [][]byte) ([]byte, error) { return nil, nil }
+
+	tests := []struct {
+		name string
+		spec goredis.CommandSpec
+	}{
+		{"no name", goredis.CommandSpec{Arity: 1, Execute: execute}},
+		{"no Execute", goredis.CommandSpec{Name: "NOEXEC", Arity: 1}},
+		{"no arity", goredis.CommandSpec{Name: "NOARITY", Execute: execute}},
+		{"negative first key", goredis.CommandSpec{Name: "BADKEYS", Arity: 2, FirstKey: -1, Execute: execute}},
+		{"keys without a step", goredis.CommandSpec{Name: "NOSTEP", Arity: 2, FirstKey: 1, LastKey: 1, Execute: execute}},
+		{"built in", goredis.CommandSpec{Name: "get", Arity: 2, Execute: execute}},
+		{"already registered", goredis.CommandSpec{Name: "GETLEN", Arity: 2, Execute: execute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := goredis.RegisterCommand(tt.spec); err == nil {
+				t.Errorf("RegisterCommand(%+v) succeeded, want an error", tt.spec)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package goredis
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+)
+
+/*
+Vectored Replies for Redis Clone
+
+Replies like MGET, KEYS or a SCAN page can be megabytes. Built in one
+bytes.Buffer, such a reply is copied every time the buffer doubles and
+once more when it's taken out of the pool, so the server briefly holds
+several copies of it. Instead, these commands build their replies as
+parts (net.Buffers) that are written with a single vectored write.
+
+Key concepts:
+- Chunks: Headers and small elements are packed into chunks of up to
+  64 KB, sized from an estimate of the reply, so most replies are one
+  exactly sized part
+- Large Elements: Elements of 16 KB or more get a part of their own, a
+  single copy of the stored value (the writer runs after the command, and
+  SETRANGE may change stored bytes in place meanwhile)
+- Vectored Writes: Each peer's writer gathers the replies queued for it
+  and writes all their parts with one writev (see Peer.writeLoop)
+- Middleware: Middleware may inspect or replace replies, so while any is
+  registered these commands return their replies in one piece (see dispatch)
+- Streams: LRANGE, SMEMBERS and HGETALL, whose replies can be far larger,
+  are formatted as they're written instead (see streaming.go)
+*/
+
+const (
+	replyChunkSize    = 64 << 10 // most bytes packed into one part
+	replyLargeElement = 16 << 10 // elements this large get a part of their own
+)
+
+/*
+partsCommand is implemented by commands whose replies can be large
+
+ExecuteParts does what Execute does, returning the reply as parts.
+*/
+type partsCommand interface {
+	Command
+	ExecuteParts(storage *Storage) (net.Buffers, error)
+}
+
+/*
+buffersWriter is implemented by connections that write net.Buffers
+themselves, so the parts still reach writev through a wrapper (see
+countingConn), and a WebSocket sends them as one message (see wsConn)
+
+more is set when the last buffer is the start of a streamed reply that
+the next writes finish; a WebSocket keeps them in the same message.
+*/
+type buffersWriter interface {
+	WriteBuffers(bufs *net.Buffers, more bool) (int64, error)
+}
+
+/*
+partsWriter builds a reply as parts
+*/
+type partsWriter struct {
+	parts    net.Buffers
+	chunk    []byte
+	estimate int // estimated bytes packed into chunks, to size them
+	written  int // bytes packed into chunks so far
+}
+
+/*
+newPartsWriter starts a reply expected to pack about estimate bytes into chunks
+*/
+func newPartsWriter(estimate int) *partsWriter {
+	return &partsWriter{estimate: estimate}
+}
+
+/*
+reserve makes room for n more bytes in the current chunk
+*/
+func (w *partsWriter) reserve(n int) {
+	if len(w.chunk)+n <= cap(w.chunk) {
+		return
+	}
+	w.flush()
+	w.chunk = make([]byte, 0, max(n, min(replyChunkSize, w.estimate-w.written)))
+}
+
+/*
+flush ends the current chunk
+*/
+func (w *partsWriter) flush() {
+	if len(w.chunk) > 0 {
+		w.parts = append(w.parts, w.chunk)
+		w.chunk = nil
+	}
+}
+
+/*
+writeString packs a piece of protocol, like an array header
+*/
+func (w *partsWriter) writeString(s string) {
+	w.reserve(len(s))
+	w.chunk = append(w.chunk, s...)
+	w.written += len(s)
+}
+
+/*
+writeBulk writes a bulk string, or the null bulk string for nil
+*/
+func (w *partsWriter) writeBulk(b []byte) {
+	if b == nil {
+		w.writeString("$-1\r\n")
+		return
+	}
+
+	// Room for the header, the element unless it's large, and the final CRLF
+	large := len(b) >= replyLargeElement
+	n := 16
+	if !large {
+		n += len(b)
+	}
+	w.reserve(n)
+	w.written += n
+
+	w.chunk = append(w.chunk, '$')
+	w.chunk = strconv.AppendInt(w.chunk, int64(len(b)), 10)
+	w.chunk = append(w.chunk, '\r', '\n')
+	if large {
+		w.flush()
+		w.parts = append(w.parts, ownBytes(b))
+		w.reserve(2)
+	} else {
+		w.chunk = append(w.chunk, b...)
+	}
+	w.chunk = append(w.chunk, '\r', '\n')
+}
+
+/*
+done returns the parts of the reply
+*/
+func (w *partsWriter) done() net.Buffers {
+	w.flush()
+	return w.parts
+}
+
+/*
+estimateArray estimates the bytes respArrayParts packs into chunks for arr
+*/
+func estimateArray(arr [][]byte) int {
+	size := 16
+	for _, item := range arr {
+		size += 16
+		if len(item) < replyLargeElement {
+			size += len(item)
+		}
+	}
+	return size
+}
+
+/*
+writeArray writes an array of bulk strings, as respWriteArray formats it
+*/
+func (w *partsWriter) writeArray(arr [][]byte) {
+	w.writeString("*" + strconv.Itoa(len(arr)) + "\r\n")
+	for _, item := range arr {
+		w.writeBulk(item)
+	}
+}
+
+/*
+respArrayParts writes an array of bulk strings as parts (see respWriteArray)
+*/
+func respArrayParts(arr [][]byte) net.Buffers {
+	w := newPartsWriter(estimateArray(arr))
+	w.writeArray(arr)
+	return w.done()
+}
+
+/*
+joinParts returns a reply built as parts in one piece, for Execute
+
+A reply that fits in one part isn't copied.
+*/
+func joinParts(parts net.Buffers, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return bytes.Join(parts, nil), nil
+}
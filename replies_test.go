@@ -0,0 +1,53 @@
+package goredis_test
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIntegerReplies(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	// Around both ends of the shared frames, and the extremes rendered on the fly
+	for _, n := range []int64{-3, -2, -1, 0, 1, 9999, 10000, 123456789, math.MaxInt64, math.MinInt64} {
+		key := "n" + strconv.FormatInt(n, 10)
+		client.expect("+OK\r\n", "SET", key, strconv.FormatInt(n, 10))
+		client.expect(fmt.Sprintf(":%d\r\n", n), "INCRBY", key, "0")
+	}
+}
+
+func TestIntegerRepliesAcrossClients(t *testing.T) {
+	server := startServer(t, nil)
+
+	// Clients counting at once share the frames of small integers, which must never change
+	const clients, count = 8, 12000
+	var wg sync.WaitGroup
+	for c := range clients {
+		client := dial(t, server)
+		key := fmt.Sprintf("counter:%d", c)
+		commands := make([][]string, count)
+		for i := range commands {
+			commands[i] = []string{"INCR", key}
+		}
+		client.pipeline(commands...)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+			for i := 1; i <= count; i++ {
+				got, err := readRawReply(client.reader)
+				if want := fmt.Sprintf(":%d\r\n", i); err != nil || string(got) != want {
+					t.Errorf("client %d, INCR %d: got %q, %v, want %q", c, i, got, err, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
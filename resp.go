@@ -0,0 +1,248 @@
+package goredis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+)
+
+/*
+RESP Reader for Redis Clone
+
+This file implements the request side of the RESP protocol: turning the
+byte stream a client sends into command argument lists. Replies are built
+by the respWrite* helpers in commands.go.
+
+Clients send commands in one of two forms:
+  - Multibulk: *<argc>\r\n followed by argc bulk strings ($<len>\r\n<data>\r\n)
+    This is what every Redis client library uses.
+  - Inline: a plain text line like "PING\r\n" or "SET name John\r\n"
+    This is what people type into telnet.
+
+Design notes:
+  - The reader is tuned for the server: it produces [][]byte arguments directly,
+    without building a generic value tree first.
+  - All arguments of a command share one backing allocation (an arena), so a
+    command costs two allocations no matter how many arguments it has.
+  - Arguments are NOT views into the network buffer yet. Storage copies every
+    value it keeps (see Storage), so a reader reusing its buffers would only
+    have to copy the arguments of what outlives a command, like the commands
+    queued by MULTI.
+*/
+
+const (
+	// respMaxMultibulkLength limits the number of arguments of a single command
+	respMaxMultibulkLength = 1024 * 1024
+
+	// respMaxBulkLength limits the size of a single argument (Redis' proto-max-bulk-len)
+	respMaxBulkLength = 512 * 1024 * 1024
+
+	// respMaxInlineLength limits the size of an inline command line
+	respMaxInlineLength = 64 * 1024
+
+	// respReadBufferSize is the size of the buffered reader wrapping the connection
+	respReadBufferSize = 16 * 1024
+
+	// respArenaSizeHint caps the initial arena allocation guessed from the first argument
+	respArenaSizeHint = 64 * 1024
+)
+
+var (
+	errInvalidMultibulkLength = errors.New("Protocol error: invalid multibulk length")
+	errInvalidBulkLength      = errors.New("Protocol error: invalid bulk length")
+	errTooBigInlineRequest    = errors.New("Protocol error: too big inline request")
+)
+
+/*
+respReader reads commands from a client connection
+
+It wraps the connection in a buffered reader and keeps a small scratch
+slice for argument offsets that is reused from one command to the next.
+*/
+type respReader struct {
+	rd      *bufio.Reader
+	offsets []int
+}
+
+/*
+newRespReader creates a reader for the given connection
+*/
+func newRespReader(r io.Reader) *respReader {
+	return &respReader{
+		rd: bufio.NewReaderSize(r, respReadBufferSize),
+	}
+}
+
+/*
+ReadCommand reads the next command and returns its arguments
+
+The first argument is the command name. Empty requests (a blank inline
+line or *0) are skipped, like Redis does.
+
+Returns: the argument list, or an error. io.EOF means the client closed
+the connection; protocol errors mean the stream can't be trusted anymore
+and the connection should be closed.
+*/
+func (r *respReader) ReadCommand() ([][]byte, error) {
+	for {
+		prefix, err := r.rd.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		var args [][]byte
+		if prefix[0] == '*' {
+			args, err = r.readMultibulk()
+		} else {
+			args, err = r.readInline()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(args) > 0 {
+			return args, nil
+		}
+	}
+}
+
+/*
+readMultibulk reads a command in multibulk form: *<argc>\r\n then argc bulk strings
+*/
+func (r *respReader) readMultibulk() ([][]byte, error) {
+	line, err := r.readLine(respMaxInlineLength)
+	if err != nil {
+		return nil, err
+	}
+
+	argc, err := strconv.Atoi(string(line[1:]))
+	if err != nil || argc > respMaxMultibulkLength {
+		return nil, errInvalidMultibulkLength
+	}
+	if argc <= 0 {
+		return nil, nil
+	}
+
+	/*
+		Copy every argument into one arena and remember where each one ends.
+		The slices are only cut at the end, because growing the arena moves it.
+	*/
+	var arena []byte
+	r.offsets = r.offsets[:0]
+
+	for i := 0; i < argc; i++ {
+		line, err := r.readLine(respMaxInlineLength)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			got := ""
+			if len(line) > 0 {
+				got = string(line[0])
+			}
+			return nil, errors.New("Protocol error: expected '$', got '" + got + "'")
+		}
+
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < 0 || n > respMaxBulkLength {
+			return nil, errInvalidBulkLength
+		}
+
+		// Size the arena for the whole command up front, within reason
+		if arena == nil {
+			arena = make([]byte, 0, min(n*argc, respArenaSizeHint))
+		}
+
+		arena, err = r.readBulk(arena, n+2)
+		if err != nil {
+			return nil, err
+		}
+		if arena[len(arena)-2] != '\r' || arena[len(arena)-1] != '\n' {
+			return nil, errInvalidBulkLength
+		}
+		arena = arena[:len(arena)-2]
+		r.offsets = append(r.offsets, len(arena))
+	}
+
+	args := make([][]byte, argc)
+	start := 0
+	for i, end := range r.offsets {
+		args[i] = arena[start:end:end]
+		start = end
+	}
+	return args, nil
+}
+
+/*
+readBulk appends the next n bytes of the stream to arena
+
+The arena grows with the bytes that actually arrive, doubling at most,
+rather than with the length the client announced: a header claiming a
+512MB argument costs no more memory than the bytes that were sent.
+*/
+func (r *respReader) readBulk(arena []byte, n int) ([]byte, error) {
+	for n > 0 {
+		chunk := min(n, max(cap(arena)-len(arena), len(arena), respArenaSizeHint))
+		start := len(arena)
+		arena = slices.Grow(arena, chunk)[:start+chunk]
+		if _, err := io.ReadFull(r.rd, arena[start:]); err != nil {
+			return nil, err
+		}
+		n -= chunk
+	}
+	return arena, nil
+}
+
+/*
+readInline reads a command in inline form: arguments separated by spaces on one line
+*/
+func (r *respReader) readInline() ([][]byte, error) {
+	line, err := r.readLine(respMaxInlineLength)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the line out of the read buffer before splitting it into arguments
+	fields := bytes.Fields(append([]byte(nil), line...))
+	return fields, nil
+}
+
+/*
+readLine reads one \r\n (or bare \n) terminated line without the terminator
+
+The returned slice points into the read buffer and is only valid until the
+next read. Lines longer than limit are rejected.
+*/
+func (r *respReader) readLine(limit int) ([]byte, error) {
+	line, err := r.rd.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return r.readLongLine(line, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+}
+
+/*
+readLongLine finishes reading a line that didn't fit in the read buffer
+*/
+func (r *respReader) readLongLine(first []byte, limit int) ([]byte, error) {
+	line := append([]byte(nil), first...)
+	for {
+		chunk, err := r.rd.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > limit {
+			return nil, errTooBigInlineRequest
+		}
+		if err == nil {
+			return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+}
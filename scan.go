@@ -0,0 +1,224 @@
+package goredis
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+/*
+Keyspace Iteration for Redis Clone
+
+SCAN walks the keyspace a page at a time, with a cursor the client passes
+back on every call. Redis guarantees that a key present for the whole
+iteration is returned at least once, however many keys are added or
+deleted in between; keys that come or go during it may or may not show up.
+
+Go maps can't resume an iteration, so the cursor can't be a position in
+the map. Instead the keyspace is walked in the order of a 64-bit hash of
+each key: the cursor is the hash to continue from, and a page holds the
+keys with the lowest hashes at or above it. A key's hash never changes, so
+a key present throughout is never skipped, whatever happened to the
+others. Keys sharing a hash always land in the same page, so a collision
+can't split them across a cursor.
+
+To find a page without sorting the keyspace, the storage keeps every key
+in a scanIndex as well: buckets by the top bits of the hash, in hash
+order, with a few keys each. A page starts at the cursor's bucket and
+sorts only the buckets it takes keys from.
+
+Key concepts:
+- Cursor: 0 starts an iteration, and a returned cursor of 0 ends it
+- COUNT: How many keys a page considers (10 by default); MATCH and TYPE
+  filter the page afterwards, so a page may come back short or even empty
+  before the iteration is over, exactly like in Redis
+- Cost: A page costs O(COUNT) on average, whatever the size of the
+  keyspace; the index doubles or halves its buckets as keys come and go,
+  so they hold between 1/2 and 4 keys each on average
+- Expired Keys: Keys whose TTL passed but that weren't removed yet are in
+  the index, and are skipped once they're in a page
+- Cursors are only meaningful for the server process that issued them
+*/
+
+/*
+scanDefaultCount is the page size used without COUNT, as in Redis
+*/
+const scanDefaultCount = 10
+
+/*
+scanItem is a key with its position in the scan order
+*/
+type scanItem struct {
+	hash uint64
+	key  string
+}
+
+/*
+Bounds of the number of buckets in a scanIndex, as a number of bits
+*/
+const (
+	scanIndexMinBits = 4
+	scanIndexMaxBits = 40
+)
+
+/*
+scanIndex holds every key of the storage ordered by hash, for SCAN
+
+The keys are spread over 2^bits buckets by the top bits of their hash,
+so bucket i holds hashes that all sort before those of bucket i+1. A
+bucket is a small unsorted slice; whoever reads one sorts what it took.
+*/
+type scanIndex struct {
+	bits    int
+	buckets [][]scanItem
+	length  int
+}
+
+/*
+bucket returns the index of the bucket holding hash
+*/
+func (x *scanIndex) bucket(hash uint64) int {
+	return int(hash >> (64 - x.bits))
+}
+
+/*
+add indexes item, whose key must not be in the index yet
+*/
+func (x *scanIndex) add(item scanItem) {
+	if x.buckets == nil {
+		x.resize(scanIndexMinBits)
+	}
+	b := x.bucket(item.hash)
+	x.buckets[b] = append(x.buckets[b], item)
+	x.length++
+	if x.length > 4<<x.bits && x.bits < scanIndexMaxBits {
+		x.resize(x.bits + 1)
+	}
+}
+
+/*
+remove takes item out of the index, if it's there
+*/
+func (x *scanIndex) remove(item scanItem) {
+	if x.buckets == nil {
+		return
+	}
+	b := x.bucket(item.hash)
+	bucket := x.buckets[b]
+	i := slices.Index(bucket, item)
+	if i < 0 {
+		return
+	}
+	bucket[i] = bucket[len(bucket)-1]
+	bucket[len(bucket)-1] = scanItem{}
+	x.buckets[b] = bucket[:len(bucket)-1]
+	x.length--
+	if x.length < len(x.buckets)/2 && x.bits > scanIndexMinBits {
+		x.resize(x.bits - 1)
+	}
+}
+
+/*
+resize spreads the keys over 2^bits buckets
+
+Growing and shrinking by a factor of two only when the load leaves
+[1/2, 4] keeps the cost O(1) amortized per key added or removed.
+*/
+func (x *scanIndex) resize(bits int) {
+	old := x.buckets
+	x.bits = bits
+	x.buckets = make([][]scanItem, 1<<bits)
+	for _, bucket := range old {
+		for _, item := range bucket {
+			b := x.bucket(item.hash)
+			x.buckets[b] = append(x.buckets[b], item)
+		}
+	}
+}
+
+/*
+from returns at least count keys with a hash of at least hash, in hash
+order, or all of them if there are fewer
+
+Whole buckets are taken, so keys sharing a hash are never split.
+
+Returns: The keys, and true if they include the last bucket
+*/
+func (x *scanIndex) from(hash uint64, count int) ([]scanItem, bool) {
+	if x.buckets == nil {
+		return nil, true
+	}
+	var items []scanItem
+	b := x.bucket(hash)
+	for ; b < len(x.buckets) && len(items) < count; b++ {
+		start := len(items)
+		for _, item := range x.buckets[b] {
+			if item.hash >= hash {
+				items = append(items, item)
+			}
+		}
+		sortByHash(items[start:])
+	}
+	return items, b == len(x.buckets)
+}
+
+/*
+sortByHash puts keys in scan order
+*/
+func sortByHash(items []scanItem) {
+	slices.SortFunc(items, func(a, b scanItem) int { return cmp.Compare(a.hash, b.hash) })
+}
+
+/*
+liveKeys returns every live key, in scan order
+
+Must be called with at least the read lock held.
+*/
+func (s *Storage) liveKeys() []scanItem {
+	now := time.Now().UnixNano()
+	items, _ := s.scanKeys.from(0, s.scanKeys.length)
+	return slices.DeleteFunc(items, func(item scanItem) bool { return s.entries[item.key].expired(now) })
+}
+
+/*
+Scan returns one page of keys starting at cursor, and the cursor of the next page
+
+Implements Redis SCAN. Expired keys are skipped. pattern filters the page
+by glob (empty matches everything) and valueType by type (empty matches
+every type).
+
+Returns: The next cursor (0 once the iteration is complete) and the keys
+*/
+func (s *Storage) Scan(cursor uint64, count int, pattern string, valueType ValueType) (uint64, []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates, last := s.scanKeys.from(cursor, count)
+
+	// Take count keys, plus any that share the last one's hash
+	page := min(count, len(candidates))
+	for page > 0 && page < len(candidates) && candidates[page].hash == candidates[page-1].hash {
+		page++
+	}
+
+	var next uint64
+	if page < len(candidates) || (page > 0 && !last) {
+		next = candidates[page-1].hash + 1
+	}
+
+	now := time.Now().UnixNano()
+	keys := make([]string, 0, page)
+	for _, item := range candidates[:page] {
+		if s.entries[item.key].expired(now) {
+			continue
+		}
+		if pattern != "" && !matchPattern(item.key, pattern) {
+			continue
+		}
+		if valueType != "" && s.entries[item.key].valueType() != valueType {
+			continue
+		}
+		keys = append(keys, item.key)
+	}
+	return next, keys
+}
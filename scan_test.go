@@ -0,0 +1,87 @@
+package goredis_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+func TestScanReturnsStableKeysAtLeastOnce(t *testing.T) {
+	storage := goredis.NewStorage()
+	for i := range 1000 {
+		storage.Set(fmt.Appendf(nil, "stable:%d", i), []byte("x"))
+		storage.Set(fmt.Appendf(nil, "gone:%d", i), []byte("x"))
+	}
+
+	seen := map[string]int{}
+	var cursor uint64
+	for page := 0; ; page++ {
+		var keys []string
+		cursor, keys = storage.Scan(cursor, 10, "", "")
+		for _, key := range keys {
+			seen[key]++
+		}
+
+		// Between pages the keyspace grows to many times its size, then shrinks
+		// back, so the index is resized under the iteration both ways
+		switch {
+		case page < 50:
+			for i := range 200 {
+				storage.Set(fmt.Appendf(nil, "added:%d:%d", page, i), []byte("x"))
+			}
+		case page < 100:
+			for i := range 200 {
+				storage.Delete(fmt.Appendf(nil, "added:%d:%d", page-50, i))
+			}
+			for i := range 20 {
+				storage.Delete(fmt.Appendf(nil, "gone:%d", (page-50)*20+i))
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+		if page > 100000 {
+			t.Fatal("the iteration doesn't end")
+		}
+	}
+
+	for i := range 1000 {
+		if key := fmt.Sprintf("stable:%d", i); seen[key] == 0 {
+			t.Errorf("%s was present throughout but not returned", key)
+		}
+	}
+	for key, n := range seen {
+		if n > 1 {
+			t.Errorf("%s returned %d times, want at most once while its hash stays put", key, n)
+		}
+	}
+}
+
+func TestScanPagesCoverTheKeyspace(t *testing.T) {
+	storage := goredis.NewStorage()
+	for i := range 5000 {
+		storage.Set(fmt.Appendf(nil, "key:%d", i), []byte("x"))
+	}
+
+	for _, count := range []int{1, 10, 1000, 10000} {
+		seen := map[string]bool{}
+		var cursor uint64
+		for {
+			var keys []string
+			cursor, keys = storage.Scan(cursor, count, "", "")
+			for _, key := range keys {
+				if seen[key] {
+					t.Fatalf("COUNT %d: %s returned twice", count, key)
+				}
+				seen[key] = true
+			}
+			if cursor == 0 {
+				break
+			}
+		}
+		if len(seen) != 5000 {
+			t.Errorf("COUNT %d: got %d keys, want 5000", count, len(seen))
+		}
+	}
+}
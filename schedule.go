@@ -0,0 +1,298 @@
+package goredis
+
+import (
+	"log/slog"
+	"runtime"
+	"sync"
+)
+
+/*
+Fair Scheduling for Redis Clone
+
+Every command runs on the server loop, one at a time. Peers used to hand
+their commands to the loop over one shared channel, and a client
+pipelining thousands of commands could keep it to itself: the Go
+scheduler runs the loop and that client's reader back to back, so the
+other readers barely got to hand in anything, and an interactive client
+next to a bulk loader waited for hundreds of its commands. Each peer now
+queues its commands in its own inbox, and the loop takes them in turns.
+
+Key concepts:
+- Inboxes: A peer's reader queues the commands it parses in the peer's
+  inbox, up to peerInboxSize; a full inbox stops the reader, so a client
+  can't get further ahead of the server than that
+- Parked Readers: The reader of a client blocked by BLPOP & co. doesn't
+  stop, since only reading tells it that the client sent QUIT or went
+  away; it queues up to parkedReadAhead bytes of commands, and a client
+  sending more is disconnected, like Redis does past its query buffer limit
+- Round Robin: Peers with queued commands wait in a ring; the loop runs one
+  command of each in turn, so a client waits for at most one command of
+  each busy client, however deep their pipelines
+- Yielding: Every few rounds the loop lets the readers run, so each busy
+  peer has commands queued when its turn comes
+- Other Events: After each round the loop goes back to its select, so
+  timers, disconnects and health probes interleave with commands
+- Blocked Clients: A client blocked by BLPOP & co. (see blocking.go) leaves
+  the ring until it's unblocked, or until it queues QUIT, which drops the
+  wait and lets the commands before it run
+- Disconnects: Commands a client queued before disconnecting still run, in
+  order, before its session is dropped
+*/
+
+/*
+peerInboxSize is how many parsed commands a peer can queue before its reader waits
+
+A few dozen are enough for the loop to always find work from a pipelining
+client, while keeping the inbox of each connection small.
+*/
+const peerInboxSize = 32
+
+/*
+parkedReadAhead is how many bytes of commands a blocked client may queue
+
+Its reader keeps reading to notice QUIT and disconnects, so this bounds
+what a client blocked for a long time can make the server hold.
+*/
+const parkedReadAhead = 16 << 20
+
+/*
+roundsPerYield is how many rounds the loop runs before letting other goroutines run
+
+The Go scheduler keeps running the loop while it has work, so readers
+that are ready to queue commands may not get to until it yields. Every
+round yielding halves the throughput of pipelines; every 16 keeps the
+turns fair, well before a busy peer's inbox is empty.
+*/
+const roundsPerYield = 16
+
+/*
+scheduler is the ring of peers with queued commands
+
+Readers add their peer when they queue a command; the server loop takes
+the ring a round at a time and puts back the peers with commands left.
+Peer.scheduled tells whether a peer is in the ring or in the round being
+run, so a peer is never in it twice. mu also guards the peers' inboxes.
+*/
+type scheduler struct {
+	mu    sync.Mutex
+	ready []*Peer       // peers with queued commands, in the order they get their turn
+	wake  chan struct{} // holds a token while ready isn't empty
+
+	rounds int // rounds run since the loop last yielded, only used by the loop
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{wake: make(chan struct{}, 1)}
+}
+
+/*
+push queues a command in the peer's inbox and gives the peer a turn
+
+Called by the peer's reader. While the inbox is full it waits for room,
+unless the client is blocked (see Parked Readers above).
+
+Returns: errPeerClosed if the peer was closed while waiting, or
+errParkedReadAhead if a blocked client queued too much
+*/
+func (sc *scheduler) push(peer *Peer, msg Message) error {
+	sc.mu.Lock()
+	for len(peer.inbox) >= peerInboxSize && !peer.parked {
+		sc.mu.Unlock()
+		select {
+		case <-peer.room:
+		case <-peer.closed:
+			return errPeerClosed
+		}
+		sc.mu.Lock()
+	}
+	defer sc.mu.Unlock()
+
+	size := 0
+	for _, arg := range msg.args {
+		size += len(arg)
+	}
+	if peer.parked && peer.inboxBytes+size > parkedReadAhead {
+		return errParkedReadAhead
+	}
+	peer.inbox = append(peer.inbox, msg)
+	peer.inboxBytes += size
+
+	if !peer.scheduled {
+		peer.scheduled = true
+		sc.ready = append(sc.ready, peer)
+		sc.signal()
+	}
+	return nil
+}
+
+/*
+pop takes the next command out of the peer's inbox, and lets a reader
+waiting for room go on
+*/
+func (sc *scheduler) pop(peer *Peer) (Message, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if len(peer.inbox) == 0 {
+		return Message{}, false
+	}
+	msg := peer.inbox[0]
+	peer.inbox[0] = Message{}
+	peer.inbox = peer.inbox[1:]
+	for _, arg := range msg.args {
+		peer.inboxBytes -= len(arg)
+	}
+	if len(peer.inbox) < peerInboxSize {
+		wakeReader(peer)
+	}
+	return msg, true
+}
+
+/*
+queued returns how many commands wait in the peer's inbox
+*/
+func (sc *scheduler) queued(peer *Peer) int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return len(peer.inbox)
+}
+
+/*
+park marks a peer as blocked by a blocking command, until resume
+
+A parked peer's reader doesn't wait for room in its inbox; one waiting
+already is woken up to read on.
+*/
+func (sc *scheduler) park(peer *Peer) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	peer.parked = true
+	wakeReader(peer)
+}
+
+/*
+wakeReader lets the peer's reader check its inbox again, if it's waiting
+
+Must be called with mu held.
+*/
+func wakeReader(peer *Peer) {
+	select {
+	case peer.room <- struct{}{}:
+	default:
+	}
+}
+
+/*
+take returns the peers whose turn it is, emptying the ring
+*/
+func (sc *scheduler) take() []*Peer {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	round := sc.ready
+	sc.ready = nil
+	return round
+}
+
+/*
+requeue puts a peer back at the end of the ring after its turn, if it can
+run and has commands left
+*/
+func (sc *scheduler) requeue(peer *Peer, runnable bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	// Checked under mu: a command queued after this check finds the peer out of the ring and adds it
+	if runnable && len(peer.inbox) > 0 {
+		sc.ready = append(sc.ready, peer)
+		sc.signal()
+		return
+	}
+	peer.scheduled = false
+}
+
+/*
+resume gives a peer that was left out of the ring (a blocked client) its
+turn back, if it has queued commands
+
+Its reader waits for room in its inbox again from now on.
+*/
+func (sc *scheduler) resume(peer *Peer) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	peer.parked = false
+	if !peer.scheduled && len(peer.inbox) > 0 {
+		peer.scheduled = true
+		sc.ready = append(sc.ready, peer)
+		sc.signal()
+	}
+}
+
+/*
+signal wakes the server loop, unless a wakeup is already pending
+
+Must be called with mu held.
+*/
+func (sc *scheduler) signal() {
+	select {
+	case sc.wake <- struct{}{}:
+	default:
+	}
+}
+
+/*
+runRound runs one queued command of every peer in the ring
+
+Called by the server loop when the scheduler wakes it.
+*/
+func (s *Server) runRound() {
+	for _, peer := range s.scheduler.take() {
+		if !s.held(peer) {
+			if msg, ok := s.scheduler.pop(peer); ok {
+				s.runMessage(msg)
+			}
+		}
+		// A queued QUIT drops the wait, whether it came before or after the command blocked
+		if s.blocking.isBlocked(peer) && peer.quitting.Load() {
+			s.removeBlocked(peer)
+		}
+		s.scheduler.requeue(peer, !s.held(peer))
+	}
+
+	// Let the readers queue more before the inboxes run dry, or a busy peer gets the loop to itself
+	s.scheduler.rounds++
+	if s.scheduler.rounds >= roundsPerYield {
+		s.scheduler.rounds = 0
+		runtime.Gosched()
+	}
+}
+
+/*
+drainInbox runs the commands a disconnected peer queued, in order
+
+A command that blocks the client drops the rest, since nothing will
+unblock it anymore; one that a fault delays runs the rest once it's done
+(see fault.go).
+*/
+func (s *Server) drainInbox(peer *Peer) {
+	for !s.held(peer) {
+		msg, ok := s.scheduler.pop(peer)
+		if !ok {
+			return
+		}
+		s.runMessage(msg)
+	}
+}
+
+/*
+runMessage handles one command, then serves the clients blocked on the
+keys it wrote (see blocking.go)
+*/
+func (s *Server) runMessage(msg Message) {
+	if err := s.handleMessage(msg); err != nil {
+		slog.Error("message handling error", "err", err)
+	}
+	s.serveBlocked()
+}
@@ -0,0 +1,59 @@
+package goredis_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulingIsFair(t *testing.T) {
+	server := startServer(t, nil)
+	bulk := dial(t, server)
+	interactive := dial(t, server)
+
+	// A bulk loader pipelines its commands, reading the replies as they come
+	const n = 100000
+	var pipeline strings.Builder
+	for range n {
+		pipeline.Write(encodeCommand([]string{"INCR", "loaded"}))
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := bulk.conn.Write([]byte(pipeline.String())); err != nil {
+			t.Errorf("writing the pipeline: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		bulk.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		for i := 1; i <= n; i++ {
+			reply, err := readRawReply(bulk.reader)
+			if want := fmt.Sprintf(":%d\r\n", i); err != nil || string(reply) != want {
+				t.Errorf("bulk reply %d: got %q, %v, want %q", i, reply, err, want)
+				return
+			}
+		}
+	}()
+	defer wg.Wait()
+
+	// Once it's started, an interactive client's commands take turns with it instead of waiting behind it
+	for interactive.do("GET", "loaded") == "$-1\r\n" {
+	}
+	var seen []int
+	for range 10 {
+		reply := interactive.do("GET", "loaded")
+		loaded, err := strconv.Atoi(strings.Split(reply, "\r\n")[1])
+		if err != nil {
+			t.Fatalf("GET loaded: %q", reply)
+		}
+		seen = append(seen, loaded)
+	}
+	if seen[0] >= n {
+		t.Errorf("the interactive client was served after the whole pipeline; it saw %v", seen)
+	}
+}
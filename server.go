@@ -0,0 +1,393 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+DefaultListenAddress is where the server listens when Config doesn't say
+*/
+const DefaultListenAddress = ":5555"
+
+/*
+Config holds the server configuration
+This struct contains all the settings needed to configure our Redis server;
+the zero value listens on DefaultListenAddress with every feature off
+*/
+type Config struct {
+	ListenAddress     string         // TCP address of the server, ":0" for any free port (see Server.Addr)
+	ClusterEnabled    bool           // enforce cluster key slot rules (CROSSSLOT), see cluster.go
+	WebSocketAddress  string         // also accept WebSocket clients on this address, see websocket.go
+	WebSocketOrigins  string         // comma-separated browser origins allowed besides the same origin
+	HealthAddress     string         // answer HTTP health checks on this address, see health.go
+	TracePattern      string         // log the bytes exchanged with clients whose address or name matches, see trace.go
+	MaxMemory         int64          // memory budget for the data in bytes, 0 for none, see maxmemory.go
+	MaxMemoryPolicy   EvictionPolicy // what to do when the budget is exceeded
+	MaxMemorySamples  int            // keys sampled per eviction, see eviction.go
+	CompressThreshold int64          // store string values this large compressed, 0 for never, see compression.go
+	Limits            Limits         // size limits enforced on writes, see limits.go
+}
+
+/*
+Message represents a command message from a client
+This is used to pass commands through channels between goroutines
+It contains both the command and which peer (client) sent it
+*/
+type Message struct {
+	cmd  Command
+	peer *Peer
+	args [][]byte // the command name and its arguments as the client sent them
+	err  error    // why the command couldn't be parsed, sent instead of running it
+}
+
+/*
+Server represents the main Redis server
+This is the core structure that manages all client connections,
+handles commands, and maintains the key-value storage
+*/
+type Server struct {
+	Config                           // Embedded config struct - contains server settings
+	peers             map[*Peer]bool // Map of all currently connected clients (peers), guarded by mu
+	ln                net.Listener   // TCP listener that accepts new connections, guarded by mu
+	addPeerChannel    chan *Peer     // Channel for notifying when a new client connects
+	deletePeerChannel chan *Peer     // Channel for notifying when a client disconnects
+	quitChannel       chan struct{}  // Channel for gracefully shutting down the server
+
+	// The key-value storage engine that holds our data
+	storage *Storage
+
+	// Channel and pattern subscriptions for pub/sub
+	pubsub *PubSub
+
+	// Peers with queued commands, taking turns on the loop (see schedule.go)
+	scheduler *scheduler
+
+	// Clients parked by blocking commands like BLPOP (see blocking.go)
+	blocking *blockingState
+
+	// Liveness probes from the health endpoint, closed by the loop (see health.go)
+	healthChannel chan chan struct{}
+
+	// Handlers receiving every change applied by write commands (see cdc.go)
+	changeHandlers []func(Change)
+
+	// Command middleware, and the chain it builds around dispatch (see middleware.go)
+	middleware []Middleware
+	handler    CommandHandler
+
+	// Faults injected with DEBUG FAULT, by command name (see fault.go)
+	faults map[string]fault
+
+	// Clients whose command a DELAY fault holds back, true once disconnected,
+	// and the channel their commands come back on (see fault.go)
+	delayed        map[*Peer]bool
+	delayedChannel chan Message
+
+	// Lifecycle state shared with Shutdown (see shutdown.go)
+	mu              sync.Mutex     // guards peers, ln, websocketServer, websocketAddr, healthServer, healthAddr, closing and tracePattern
+	closing         bool           // Shutdown was called; no new connections are served
+	connections     sync.WaitGroup // one count per connection being served
+	stopOnce        sync.Once      // quitChannel is closed once
+	websocketServer *http.Server   // the WebSocket bridge, when configured
+	websocketAddr   net.Addr       // where the bridge listens, once bound
+	healthServer    *http.Server   // the health endpoint, when configured
+	healthAddr      net.Addr       // where the health endpoint listens, once bound
+
+	// When Start was called, for uptime in INFO (see info.go)
+	startedAt time.Time
+
+	// Throughput counters and rates reported by INFO stats (see metrics.go)
+	stats serverStats
+
+	// State of the maxmemory controller (see maxmemory.go)
+	pressure memoryPressure
+}
+
+/*
+NewServer creates a new Redis server instance
+This is a constructor function that initializes all the server components
+*/
+func NewServer(cfg Config) *Server {
+	// If no listen address is provided, use the default
+	if len(cfg.ListenAddress) == 0 {
+		cfg.ListenAddress = DefaultListenAddress
+	}
+	if cfg.MaxMemorySamples == 0 {
+		cfg.MaxMemorySamples = DefaultEvictionSamples
+	}
+
+	s := &Server{
+		Config:            cfg,
+		peers:             make(map[*Peer]bool),
+		addPeerChannel:    make(chan *Peer),
+		deletePeerChannel: make(chan *Peer),
+		quitChannel:       make(chan struct{}),
+		healthChannel:     make(chan chan struct{}),
+		delayed:           make(map[*Peer]bool),
+		delayedChannel:    make(chan Message),
+		storage:           NewStorage(),
+		pubsub:            NewPubSub(),
+		scheduler:         newScheduler(),
+		blocking:          newBlockingState(),
+	}
+	s.handler = s.dispatch
+	s.storage.SetCompressThreshold(int(cfg.CompressThreshold))
+	s.storage.SetLimits(cfg.Limits)
+
+	return s
+}
+
+/*
+Storage returns the server's storage, for code embedding the server to
+register hooks, change settings or read and write keys directly
+
+Every exported Storage method takes the storage lock itself, so it's safe
+to call from any goroutine, including while clients are connected.
+*/
+func (s *Server) Storage() *Storage {
+	return s.storage
+}
+
+/*
+handleConnection handles a new connection by creating a peer and starting its read loop
+This function is called in a goroutine for each new client connection
+It creates a Peer object to represent the client and starts reading commands from them
+*/
+func (s *Server) handleConnection(connection net.Conn) {
+	/*
+		Create a new Peer object to represent this client connection
+		The peer will queue its commands with the scheduler and notify delPeerCh when it disconnects
+	*/
+	peer := NewPeer(countingConn{Conn: connection, stats: &s.stats}, s.scheduler, s.deletePeerChannel)
+
+	// Register the connection, unless the server is shutting down (see shutdown.go)
+	if !s.trackPeer(peer) {
+		connection.Close()
+		return
+	}
+	defer s.untrackPeer(peer)
+	s.stats.connectionsReceived.Add(1)
+
+	// Notify the main server loop that a new peer has connected
+	s.addPeerChannel <- peer
+
+	// Start the writer that owns all writes to this connection
+	writerDone := make(chan struct{})
+	go func() {
+		peer.writeLoop()
+		close(writerDone)
+	}()
+
+	// Start reading commands from this client. This blocks until the client disconnects or an error occurs
+	if err := peer.readLoop(); err != nil {
+		slog.Error("peer read error", "err", err, "remoteAddress", connection.RemoteAddr())
+	}
+
+	// Flush pending replies and release the socket once the client is gone, whatever the reason
+	peer.Close()
+	<-writerDone
+}
+
+/*
+loop is the main server event loop
+
+This is the heart of the server - it processes all events using Go channels
+It runs in its own goroutine and handles:
+  - Incoming commands from clients
+  - New client connections
+  - Client disconnections
+  - Server shutdown signals
+  - Liveness probes from the health endpoint
+  - Shrinking the peers' output buffers, which only it uses (see outputbuffer.go)
+*/
+func (s *Server) loop() {
+	shrinkTicker := time.NewTicker(outputBufferCheckInterval)
+	defer shrinkTicker.Stop()
+
+	for {
+		/* Use select to listen on multiple channels simultaneously
+		   This is Go's way of handling multiple concurrent events */
+		select {
+		case <-s.scheduler.wake:
+			// Clients queued commands - Run one of each, in turn (see schedule.go)
+			s.runRound()
+
+		case <-s.blocking.timer.C:
+			// Blocked clients whose timeout passed get their null reply
+			s.expireBlocked()
+
+		case msg := <-s.delayedChannel:
+			// A command held back by a DELAY fault runs now (see fault.go)
+			s.runDelayed(msg)
+
+		case <-s.quitChannel:
+			// Server shutdown signal received - Exit the loop and stop the server
+			slog.Info("quiting the messaging channel")
+			return
+
+		case peer := <-s.addPeerChannel:
+			// A new client has connected - Add them to our list of active clients
+			slog.Info("peer connected", "remoteAddress", peer.connect.RemoteAddr())
+
+		case peer := <-s.deletePeerChannel:
+			// A client has disconnected - Drop what the server kept for its connection
+			slog.Info("peer disconnected", "remoteAddress", peer.connect.RemoteAddr())
+			s.disconnected(peer)
+
+		case probe := <-s.healthChannel:
+			// The health endpoint checks that the loop still gets to its events
+			close(probe)
+
+		case <-shrinkTicker.C:
+			// Output buffers of peers that went quiet are shrunk or released
+			s.shrinkOutputBuffers()
+		}
+	}
+}
+
+/*
+acceptLoop accepts incoming connections
+
+This method runs in a loop, waiting for new TCP connections
+Each time a client connects, it creates a new goroutine to handle that client
+Failed accepts are retried with a backoff, and a broken listener is bound
+again (see listener.go)
+*/
+func (s *Server) acceptLoop() error {
+	var backoff acceptBackoff
+	for {
+		s.mu.Lock()
+		ln := s.ln
+		s.mu.Unlock()
+
+		// Accept blocks until a new connection arrives
+		connection, err := ln.Accept()
+		if err != nil {
+			// Shutdown closed the listener
+			if errors.Is(err, net.ErrClosed) {
+				return ErrServerClosed
+			}
+			s.stats.acceptErrors.Add(1)
+
+			// Out of file descriptors and the like: wait for it to pass instead of spinning
+			if temporaryAcceptError(err) {
+				delay := backoff.next()
+				slog.Error("accept error", "err", err, "retryIn", delay)
+				time.Sleep(delay)
+				continue
+			}
+
+			slog.Error("listener failed, binding it again", "err", err)
+			if err := s.rebindListener(ln); err != nil {
+				if !errors.Is(err, ErrServerClosed) {
+					// Without a listener the server is no use; let the connected clients finish
+					ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+					s.Shutdown(ctx)
+					cancel()
+				}
+				return err
+			}
+			continue
+		}
+		backoff.reset()
+
+		/* Handle each connection in a separate goroutine
+		   This allows the server to handle multiple clients simultaneously */
+		go s.handleConnection(connection)
+	}
+}
+
+/*
+Start starts the Redis server
+This method begins listening for connections and starts the main server loop
+*/
+func (s *Server) Start() error {
+	// Create a TCP listener on the specified address
+	ln, err := net.Listen("tcp", s.ListenAddress)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.ln = ln
+	if s.WebSocketAddress != "" {
+		s.websocketServer = &http.Server{
+			Addr:              s.WebSocketAddress,
+			Handler:           http.HandlerFunc(s.upgradeWebSocket),
+			ReadHeaderTimeout: websocketReadHeaderTimeout,
+		}
+	}
+	if s.HealthAddress != "" {
+		s.healthServer = &http.Server{
+			Addr:              s.HealthAddress,
+			Handler:           s.healthHandler(),
+			ReadHeaderTimeout: healthReadHeaderTimeout,
+		}
+	}
+	s.mu.Unlock()
+	s.startedAt = time.Now()
+
+	/* Start the main server loop in a goroutine
+	   This runs concurrently and handles all server events */
+	go s.loop()
+
+	// Remove expired keys nobody touches in the background (see expire.go)
+	go s.activeExpireLoop()
+
+	// Sample the throughput rates reported by INFO (see metrics.go)
+	go s.metricsLoop()
+
+	// Keep the data within -maxMemory, when set (see maxmemory.go)
+	s.configureMemoryLimit()
+	go s.memoryLoop()
+
+	slog.Info("Redis clone server running", "listenPortAddress", s.ListenAddress)
+
+	// Serve browser clients over WebSocket as well, when configured
+	if s.websocketServer != nil {
+		go func() {
+			if err := s.serveWebSocket(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("WebSocket bridge stopped", "err", err)
+			}
+		}()
+	}
+
+	// Answer HTTP health checks as well, when configured
+	if s.healthServer != nil {
+		go func() {
+			if err := s.serveHealth(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("health endpoint stopped", "err", err)
+			}
+		}()
+	}
+
+	// Start accepting connections (this blocks the main thread)
+	return s.acceptLoop()
+}
+
+/*
+Addr returns the address the server listens on, nil until Start has
+bound it
+
+With a ListenAddress of ":0" this is where to find the server.
+*/
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
@@ -0,0 +1,200 @@
+package goredis_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+Test Helpers for Redis Clone
+
+The tests in package goredis_test use the server the way a program
+embedding it would, through the exported API only, and talk to it over
+TCP like any client.
+
+Key concepts:
+- Free Ports: Every test starts its own server on 127.0.0.1:0 and finds
+  it with Server.Addr, so tests don't share state or fight over ports
+- Raw Replies: The test client returns replies as their exact RESP bytes,
+  so expectations read like the protocol
+*/
+
+/*
+startServer starts a server on a free port, after setup (which may be nil)
+has configured it, and closes it when the test ends
+*/
+func startServer(t *testing.T, setup func(server *goredis.Server)) *goredis.Server {
+	t.Helper()
+
+	server := goredis.NewServer(goredis.Config{ListenAddress: "127.0.0.1:0"})
+	if setup != nil {
+		setup(server)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; !errors.Is(err, goredis.ErrServerClosed) {
+			t.Errorf("Start returned %v, want ErrServerClosed", err)
+		}
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Addr() == nil {
+		select {
+		case err := <-done:
+			t.Fatalf("Start: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return server
+}
+
+/*
+testClient is a connection to a test server
+*/
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+/*
+dial connects to server, closing the connection when the test ends
+*/
+func dial(t *testing.T, server *goredis.Server) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+/*
+do sends a command and returns its reply
+*/
+func (c *testClient) do(args ...string) string {
+	c.t.Helper()
+
+	c.send(args...)
+	return c.read()
+}
+
+/*
+send sends a command without waiting for its reply
+*/
+func (c *testClient) send(args ...string) {
+	c.t.Helper()
+
+	if _, err := c.conn.Write(encodeCommand(args)); err != nil {
+		c.t.Fatalf("write %v: %v", args, err)
+	}
+}
+
+/*
+read reads the next reply
+*/
+func (c *testClient) read() string {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := readRawReply(c.reader)
+	if err != nil {
+		c.t.Fatalf("read reply: %v", err)
+	}
+	return string(reply)
+}
+
+/*
+expect sends a command and fails the test unless the reply is want
+*/
+func (c *testClient) expect(want string, args ...string) {
+	c.t.Helper()
+
+	if got := c.do(args...); got != want {
+		c.t.Errorf("%s: got %q, want %q", strings.Join(args, " "), got, want)
+	}
+}
+
+/*
+encodeCommand encodes arguments as a RESP array of bulk strings
+*/
+func encodeCommand(args []string) []byte {
+	var buf strings.Builder
+	buf.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	return []byte(buf.String())
+}
+
+/*
+readRawReply reads one complete RESP reply and returns its exact bytes
+
+Aggregates are read recursively so the returned slice covers the whole
+reply.
+*/
+func readRawReply(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("short reply line %q", line)
+	}
+
+	header := string(line[1 : len(line)-2])
+	switch line[0] {
+	case '+', '-', ':', '_', ',', '#':
+		return line, nil
+	case '$':
+		n, err := strconv.Atoi(header)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return line, nil
+		}
+		body := make([]byte, n+2)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+		return append(line, body...), nil
+	case '*', '%', '>':
+		n, err := strconv.Atoi(header)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregate length %q", line)
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		reply := line
+		for range n {
+			elem, err := readRawReply(r)
+			if err != nil {
+				return nil, err
+			}
+			reply = append(reply, elem...)
+		}
+		return reply, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", line[0])
+	}
+}
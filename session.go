@@ -0,0 +1,86 @@
+package goredis
+
+/*
+Client Sessions for Redis Clone
+
+Every connection carries state that outlives a single command: its name,
+the protocol version it negotiated, what it's subscribed to, and so on.
+This file gathers that state in one session struct per peer, with a single
+reset path used both by RESET and when the client disconnects, so a new
+connection-level feature only has to add a field here and everything that
+resets the connection resets it too.
+
+Key concepts:
+- Server Loop Only: A session is read and written only from the server
+  loop (commands run there), never from the peer's read or write goroutine,
+  so it needs no locking
+- Defaults: A new session uses database 0, the default user, RESP2, no
+  name, replies on, no transaction and no subscriptions
+- Reset: RESET restores the defaults but keeps the client name, like
+  Redis; a disconnect runs the same path, which also drops the
+  subscriptions from the pub/sub hub
+- Placeholders: There's a single database, no AUTH, no CLIENT REPLY and no
+  MULTI yet; their fields hold the defaults so those features have a place
+  to keep their state
+*/
+
+/*
+defaultUser is the user every connection is authenticated as
+*/
+const defaultUser = "default"
+
+/*
+replyMode says which replies a client wants, as set by CLIENT REPLY
+*/
+type replyMode int
+
+const (
+	replyOn   replyMode = iota // every reply is sent
+	replyOff                   // no reply is sent
+	replySkip                  // the reply to the next command is skipped
+)
+
+/*
+session is the connection-level state of a peer
+*/
+type session struct {
+	db            int               // selected logical database
+	user          string            // user the connection is authenticated as
+	name          string            // set by CLIENT SETNAME, empty if none
+	protocol      int               // RESP version negotiated with HELLO
+	replyMode     replyMode         // set by CLIENT REPLY
+	multi         []Message         // commands queued after MULTI, nil outside a transaction
+	subscriptions peerSubscriptions // pub/sub subscriptions (see pubsub.go)
+	export        *KeyspaceSnapshot // the snapshot EXPORT is reading, nil if none (see export.go)
+}
+
+/*
+newSession returns the state of a freshly connected client
+*/
+func newSession() session {
+	return session{
+		user:      defaultUser,
+		protocol:  2,
+		replyMode: replyOn,
+	}
+}
+
+/*
+resetSession restores a peer's session to the defaults
+
+Used by RESET and when the peer disconnects. Subscriptions are removed
+from the pub/sub hub, a blocked command is dropped with the commands
+queued behind it, an export's snapshot is closed, and a queued
+transaction is discarded; the client name is kept.
+*/
+func (s *Server) resetSession(peer *Peer) {
+	s.pubsub.removePeer(peer)
+	s.removeBlocked(peer)
+	if peer.session.export != nil {
+		peer.session.export.Close()
+	}
+
+	name := peer.session.name
+	peer.session = newSession()
+	peer.session.name = name
+}
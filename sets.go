@@ -0,0 +1,589 @@
+package goredis
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+/*
+Set Storage for Redis Clone
+
+This file implements the set type: an unordered collection of unique,
+binary-safe members stored under one key. It adds the set operations to
+Storage; the commands using them live in commands.go.
+
+Key concepts:
+- Unique Members: Adding a member that is already present does nothing
+- No Order: Members come back in no particular order
+- Random Access: SPOP and SRANDMEMBER pick members uniformly at random
+- No Empty Sets: A set that loses its last member is deleted, like in Redis
+*/
+
+/*
+setValue is the value of a set key
+
+Members are kept in a slice for O(1) random picks, with a map from member
+to its slice position for O(1) lookups. Removal swaps the last member into
+the freed slot, so both stay in sync without shifting.
+*/
+type setValue struct {
+	index   map[string]int
+	members []string
+}
+
+/*
+newSetValue creates an empty set
+*/
+func newSetValue() *setValue {
+	return &setValue{index: make(map[string]int)}
+}
+
+/*
+add inserts a member, returning false if it was already present
+*/
+func (v *setValue) add(member string) bool {
+	if _, exists := v.index[member]; exists {
+		return false
+	}
+	v.index[member] = len(v.members)
+	v.members = append(v.members, member)
+	return true
+}
+
+/*
+remove deletes a member, returning false if it wasn't present
+*/
+func (v *setValue) remove(member string) bool {
+	i, exists := v.index[member]
+	if !exists {
+		return false
+	}
+
+	last := len(v.members) - 1
+	v.members[i] = v.members[last]
+	v.index[v.members[i]] = i
+	v.members = v.members[:last]
+	delete(v.index, member)
+	return true
+}
+
+/*
+has reports whether member is in the set
+*/
+func (v *setValue) has(member string) bool {
+	_, exists := v.index[member]
+	return exists
+}
+
+/*
+random returns a uniformly chosen member; the set must not be empty
+*/
+func (v *setValue) random() string {
+	return v.members[rand.IntN(len(v.members))]
+}
+
+/*
+setOf returns the set held by an entry
+
+Returns: nil for a missing entry, ErrWrongType if the entry holds another type
+*/
+func setOf(e *entry) (*setValue, error) {
+	if e == nil {
+		return nil, nil
+	}
+	v, ok := e.value.(*setValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return v, nil
+}
+
+/*
+SAdd adds members to a set, creating it when missing
+
+Implements Redis SADD.
+
+Returns: The number of members that were not already in the set
+*/
+func (s *Storage) SAdd(key []byte, members [][]byte) (int, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, err
+	}
+	if err := s.checkElements(members...); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	if err := s.checkMembersAdded(keyStr, TypeSet, len(members), func(i int) string { return string(members[i]) }); err != nil {
+		return 0, err
+	}
+	e := s.lookupWrite(keyStr)
+	set, err := setOf(e)
+	if err != nil {
+		return 0, err
+	}
+	if set == nil {
+		set = newSetValue()
+		e = newEntry(set)
+		s.putEntry(keyStr, e)
+	}
+
+	added := 0
+	for _, member := range members {
+		if set.add(string(member)) {
+			added++
+		}
+	}
+
+	e.touch()
+	if added > 0 {
+		s.changed(keyStr)
+	}
+	return added, nil
+}
+
+/*
+SRem removes members from a set
+
+Implements Redis SREM. The key is deleted once the set is empty.
+
+Returns: The number of members that were removed
+*/
+func (s *Storage) SRem(key []byte, members [][]byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	set, err := setOf(e)
+	if err != nil || set == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if set.remove(string(member)) {
+			removed++
+		}
+	}
+
+	s.deleteIfEmptySet(keyStr, set)
+	e.touch()
+	if removed > 0 {
+		s.changed(keyStr)
+	}
+	return removed, nil
+}
+
+/*
+SMembers returns every member of a set
+
+Implements Redis SMEMBERS. Missing keys are empty sets.
+*/
+func (s *Storage) SMembers(key []byte) ([][]byte, error) {
+	names, err := s.setMembers(key)
+	members := make([][]byte, len(names))
+	for i, member := range names {
+		members[i] = []byte(member)
+	}
+	return members, err
+}
+
+/*
+setMembers is SMembers returning the members as the stored strings
+*/
+func (s *Storage) setMembers(key []byte) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	set, err := setOf(e)
+	if err != nil || set == nil {
+		return nil, err
+	}
+	e.touch()
+
+	return slices.Clone(set.members), nil
+}
+
+/*
+SIsMember reports whether member is in the set
+
+Implements Redis SISMEMBER.
+*/
+func (s *Storage) SIsMember(key, member []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	set, err := setOf(e)
+	if err != nil || set == nil {
+		return false, err
+	}
+	e.touch()
+
+	return set.has(string(member)), nil
+}
+
+/*
+SMIsMember reports for each member whether it is in the set
+
+Implements Redis SMISMEMBER. A missing key reports false for every member.
+*/
+func (s *Storage) SMIsMember(key []byte, members [][]byte) ([]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	set, err := setOf(e)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(members))
+	if set == nil {
+		return found, nil
+	}
+	e.touch()
+
+	for i, member := range members {
+		found[i] = set.has(string(member))
+	}
+	return found, nil
+}
+
+/*
+SMove moves member from the set at source to the set at destination
+
+Implements Redis SMOVE. The move is atomic: no other command sees the member
+in both sets or in neither. Both keys must hold sets (or be missing);
+the destination is created when needed and the source is deleted once empty.
+
+Returns: true if the member was moved, false if it wasn't in the source set
+*/
+func (s *Storage) SMove(source, destination, member []byte) (bool, error) {
+	if err := s.checkKey(destination); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	srcStr, destStr := string(source), string(destination)
+	srcEntry := s.lookupWrite(srcStr)
+	src, err := setOf(srcEntry)
+	if err != nil {
+		return false, err
+	}
+	destEntry := s.lookupWrite(destStr)
+	dest, err := setOf(destEntry)
+	if err != nil {
+		return false, err
+	}
+
+	memberStr := string(member)
+	if src == nil || !src.has(memberStr) {
+		return false, nil
+	}
+
+	// Moving within the same set only has to confirm the member exists
+	if srcStr == destStr {
+		return true, nil
+	}
+	if err := s.checkMembersAdded(destStr, TypeSet, 1, func(int) string { return memberStr }); err != nil {
+		return false, err
+	}
+
+	src.remove(memberStr)
+	s.deleteIfEmptySet(srcStr, src)
+	srcEntry.touch()
+
+	if dest == nil {
+		dest = newSetValue()
+		destEntry = newEntry(dest)
+		s.putEntry(destStr, destEntry)
+	}
+	dest.add(memberStr)
+	destEntry.touch()
+
+	s.changed(srcStr)
+	s.changed(destStr)
+
+	return true, nil
+}
+
+/*
+SCard returns the number of members in a set
+
+Implements Redis SCARD. Missing keys count as empty sets.
+*/
+func (s *Storage) SCard(key []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set, err := setOf(s.lookupRead(string(key)))
+	if err != nil || set == nil {
+		return 0, err
+	}
+	return len(set.members), nil
+}
+
+/*
+SPop removes and returns up to count random members
+
+Implements Redis SPOP. The key is deleted once the set is empty.
+
+Returns: The popped members, and false if the key doesn't exist
+*/
+func (s *Storage) SPop(key []byte, count int) ([][]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	set, err := setOf(e)
+	if err != nil || set == nil {
+		return nil, false, err
+	}
+
+	count = min(count, len(set.members))
+	popped := make([][]byte, count)
+	for i := range popped {
+		member := set.random()
+		set.remove(member)
+		popped[i] = []byte(member)
+	}
+
+	s.deleteIfEmptySet(keyStr, set)
+	e.touch()
+	if count > 0 {
+		s.changed(keyStr)
+	}
+	return popped, true, nil
+}
+
+/*
+SRandMember returns random members without removing them
+
+Implements Redis SRANDMEMBER with a count:
+  - count > 0: up to count distinct members (the whole set if it's smaller)
+  - count < 0: exactly |count| members, which may repeat
+
+Returns: The chosen members, and false if the key doesn't exist
+*/
+func (s *Storage) SRandMember(key []byte, count int) ([][]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	set, err := setOf(e)
+	if err != nil || set == nil {
+		return nil, false, err
+	}
+	e.touch()
+
+	// Negative count: independent picks, repetitions allowed
+	if count < 0 {
+		picked := make([][]byte, -count)
+		for i := range picked {
+			picked[i] = []byte(set.random())
+		}
+		return picked, true, nil
+	}
+
+	/*
+		Positive count: distinct members. A partial Fisher-Yates shuffle over
+		the positions picks them without touching the set itself.
+	*/
+	count = min(count, len(set.members))
+	positions := make([]int, len(set.members))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	picked := make([][]byte, count)
+	for i := range picked {
+		j := i + rand.IntN(len(positions)-i)
+		positions[i], positions[j] = positions[j], positions[i]
+		picked[i] = []byte(set.members[positions[i]])
+	}
+	return picked, true, nil
+}
+
+/*
+setOperation selects the set algebra operation for SINTER, SUNION and SDIFF
+*/
+type setOperation int
+
+const (
+	setOpUnion setOperation = iota
+	setOpInter
+	setOpDiff
+)
+
+/*
+SetOp computes the union, intersection or difference of the sets at keys
+
+Implements Redis SUNION, SINTER and SDIFF. Missing keys are empty sets;
+a key of another type fails the whole command with ErrWrongType.
+
+Returns: The members of the resulting set
+*/
+func (s *Storage) SetOp(op setOperation, keys [][]byte) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sets, err := s.collectSets(keys, s.lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	result := setAlgebra(op, sets)
+	members := make([][]byte, len(result.members))
+	for i, member := range result.members {
+		members[i] = []byte(member)
+	}
+	return members, nil
+}
+
+/*
+SetOpStore stores the union, intersection or difference of the sets at keys in destination
+
+Implements Redis SUNIONSTORE, SINTERSTORE and SDIFFSTORE. The computation and
+the write happen under one lock, so no other command sees a partial result.
+The destination is overwritten whatever its type, and deleted when the
+result is empty. The destination may also be one of the source keys.
+
+Returns: The number of members in the stored set
+*/
+func (s *Storage) SetOpStore(op setOperation, destination []byte, keys [][]byte) (int, error) {
+	if err := s.checkKey(destination); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sets, err := s.collectSets(keys, s.lookupWrite)
+	if err != nil {
+		return 0, err
+	}
+
+	result := setAlgebra(op, sets)
+	if err := s.checkLength(len(result.members)); err != nil {
+		return 0, err
+	}
+	destStr := string(destination)
+	s.preserve(destStr)
+	if len(result.members) == 0 {
+		if _, exists := s.entries[destStr]; exists {
+			s.deleteEntry(destStr)
+			s.changed(destStr)
+		}
+		return 0, nil
+	}
+
+	s.putEntry(destStr, newEntry(result))
+	s.changed(destStr)
+	return len(result.members), nil
+}
+
+/*
+collectSets looks up the sets at keys using the given lookup function
+
+Missing keys are returned as nil sets.
+*/
+func (s *Storage) collectSets(keys [][]byte, lookup func(string) *entry) ([]*setValue, error) {
+	sets := make([]*setValue, len(keys))
+	for i, key := range keys {
+		e := lookup(string(key))
+		set, err := setOf(e)
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			e.touch()
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+/*
+setAlgebra computes a new set from the input sets; nil inputs are empty sets
+
+The result never shares storage with the inputs, so it can be stored
+under a new key.
+*/
+func setAlgebra(op setOperation, sets []*setValue) *setValue {
+	result := newSetValue()
+
+	switch op {
+	case setOpUnion:
+		for _, set := range sets {
+			if set == nil {
+				continue
+			}
+			for _, member := range set.members {
+				result.add(member)
+			}
+		}
+
+	case setOpInter:
+		// Walk the smallest set and check membership in all the others
+		smallest := sets[0]
+		for _, set := range sets {
+			if set == nil {
+				return result
+			}
+			if len(set.members) < len(smallest.members) {
+				smallest = set
+			}
+		}
+		for _, member := range smallest.members {
+			inAll := true
+			for _, set := range sets {
+				if !set.has(member) {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result.add(member)
+			}
+		}
+
+	case setOpDiff:
+		if sets[0] == nil {
+			return result
+		}
+		for _, member := range sets[0].members {
+			inOther := false
+			for _, set := range sets[1:] {
+				if set != nil && set.has(member) {
+					inOther = true
+					break
+				}
+			}
+			if !inOther {
+				result.add(member)
+			}
+		}
+	}
+
+	return result
+}
+
+/*
+deleteIfEmptySet removes a set key once its last member is gone
+
+Must be called with the write lock held.
+*/
+func (s *Storage) deleteIfEmptySet(keyStr string, set *setValue) {
+	if len(set.members) == 0 {
+		s.deleteEntry(keyStr)
+	}
+}
@@ -0,0 +1,152 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+/*
+Server Lifecycle for Redis Clone
+
+This file lets the server be stopped cleanly, by the process on SIGINT or
+SIGTERM, or by code embedding it (and by tests, which shouldn't leak ports
+or goroutines). Shutdown stops taking new work and lets the work already
+taken finish: every command a client has sent is run and answered before
+its connection is closed.
+
+Key concepts:
+- Stop Accepting: The listener and the WebSocket bridge are closed first,
+  so Start returns ErrServerClosed; connections accepted from then on are
+  closed right away
+- Drain: Each connection stops reading (its read deadline is set to now);
+  commands already read still go through the server loop, and queued
+  replies are flushed before the socket is closed
+- Deadline: If the context expires first, the connections still open are
+  closed without waiting; the server loop stops once they're gone
+- Health: The health endpoint (see health.go) is closed last, so /readyz
+  reports the shutdown while connections drain
+- Final: A server that was shut down can't be started again
+*/
+
+/*
+ErrServerClosed is returned by Start once Shutdown or Close has been called
+*/
+var ErrServerClosed = errors.New("goredis: server closed")
+
+/*
+DefaultShutdownTimeout is how long clients get to drain when cmd/goredis
+gets SIGINT or SIGTERM, or the server loses its listener
+*/
+const DefaultShutdownTimeout = 10 * time.Second
+
+/*
+Shutdown gracefully stops the server
+
+It stops accepting connections, lets every connection finish the commands
+it has sent, then stops the server loop and the background jobs. It
+returns once that's done, or when ctx expires, in which case the
+remaining connections are closed immediately and ctx's error is returned.
+
+Shutdown may be called from any goroutine, more than once, and even
+before Start.
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	for peer := range s.peers {
+		// Unblock the reader; commands already read still run and get their replies
+		peer.connect.SetReadDeadline(time.Now())
+	}
+	websocketServer := s.websocketServer
+	healthServer := s.healthServer
+	s.mu.Unlock()
+
+	// Upgraded WebSocket clients are peers, so this only stops the HTTP side
+	if websocketServer != nil {
+		websocketServer.Shutdown(ctx)
+	}
+
+	// Health checks keep being answered, reporting the shutdown, until connections are drained
+	if healthServer != nil {
+		defer healthServer.Close()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		s.stop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for peer := range s.peers {
+			// Fail pending writes too, so nothing blocks on a stalled client
+			peer.connect.SetDeadline(time.Now())
+			peer.connect.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+/*
+Close stops the server immediately
+
+Like Shutdown with an expired context: connections are closed without
+waiting for their commands to finish.
+*/
+func (s *Server) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+/*
+stop ends the server loop and the background jobs, once
+*/
+func (s *Server) stop() {
+	s.stopOnce.Do(func() {
+		close(s.quitChannel)
+	})
+}
+
+/*
+trackPeer registers a new connection
+
+Returns: false if the server is shutting down, in which case the
+connection must be closed instead of served
+*/
+func (s *Server) trackPeer(peer *Peer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.peers[peer] = true
+	s.connections.Add(1)
+	peer.trace.Store(s.traceSelects(peer))
+	return true
+}
+
+/*
+untrackPeer unregisters a connection once it's fully closed
+*/
+func (s *Server) untrackPeer(peer *Peer) {
+	s.mu.Lock()
+	delete(s.peers, peer)
+	s.mu.Unlock()
+
+	s.connections.Done()
+}
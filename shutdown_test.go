@@ -0,0 +1,98 @@
+package goredis_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+func TestShutdownAnswersPendingCommands(t *testing.T) {
+	server := startServer(t, nil)
+	address := server.Addr().String()
+	client := dial(t, server)
+
+	// Both commands are read at once; the SET waits behind the sleep
+	pipeline := append(encodeCommand([]string{"DEBUG", "SLEEP", "0.2"}), encodeCommand([]string{"SET", "a", "1"})...)
+	if _, err := client.conn.Write(pipeline); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	for _, want := range []string{"+OK\r\n", "+OK\r\n"} {
+		if got := client.read(); got != want {
+			t.Errorf("pending reply: got %q, want %q", got, want)
+		}
+	}
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Errorf("after the pending replies: got %v, want EOF", err)
+	}
+	if conn, err := net.Dial("tcp", address); err == nil {
+		conn.Close()
+		t.Errorf("dial %s succeeded after Shutdown, want the port released", address)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+}
+
+func TestShutdownGivesUpWhenContextExpires(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+
+	client.send("DEBUG", "SLEEP", "1")
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown: got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Shutdown took %v, want it to return when ctx expires", elapsed)
+	}
+
+	// The connection was closed without waiting for the reply
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.reader.ReadByte(); err == nil {
+		t.Error("read a reply after the context expired, want the connection closed")
+	}
+}
+
+func TestClose(t *testing.T) {
+	server := startServer(t, nil)
+	client := dial(t, server)
+	client.expect("+PONG\r\n", "PING")
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.reader.ReadByte(); err == nil {
+		t.Error("connection still open after Close")
+	}
+	if err := server.Start(); !errors.Is(err, goredis.ErrServerClosed) {
+		t.Errorf("Start after Close: got %v, want ErrServerClosed", err)
+	}
+}
+
+func TestShutdownBeforeStart(t *testing.T) {
+	server := goredis.NewServer(goredis.Config{ListenAddress: "127.0.0.1:0"})
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := server.Start(); !errors.Is(err, goredis.ErrServerClosed) {
+		t.Errorf("Start after Shutdown: got %v, want ErrServerClosed", err)
+	}
+}
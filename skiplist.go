@@ -0,0 +1,227 @@
+package goredis
+
+import "math/rand/v2"
+
+/*
+Skiplist for Redis Clone
+
+This file implements the ordered side of a sorted set: a skiplist of
+(score, member) items, the structure Redis uses for large sorted sets.
+Inserts, removals and lookups by rank or by position in the order all
+take O(log n) expected time.
+
+Key concepts:
+- Levels: Every node is on level 0, a linked list of all the items in
+  order; each level above skips over about 3 of every 4 nodes of the one
+  below, so a search drops down from the sparse levels at the top
+- Spans: Each link records how many items it skips, so the rank of a node
+  is the sum of the spans followed to reach it, like Redis' zskiplist
+- Backward Links: Level 0 is also linked backwards, for reverse ranges
+*/
+
+/*
+skiplistMaxLevel caps the levels of a node; with a 1 in 4 chance to go up
+a level, 32 levels are enough for 2^64 items
+*/
+const skiplistMaxLevel = 32
+
+/*
+skiplistNode is one item of a skiplist
+*/
+type skiplistNode struct {
+	item     zsetItem
+	backward *skiplistNode // the previous node on level 0, nil for the first
+	levels   []skiplistLink
+}
+
+/*
+skiplistLink is a node's link on one level: the next node on that level,
+and how many items it skips to get there
+*/
+type skiplistLink struct {
+	forward *skiplistNode
+	span    int
+}
+
+/*
+next returns the node after n in the order, or nil
+*/
+func (n *skiplistNode) next() *skiplistNode {
+	return n.levels[0].forward
+}
+
+/*
+skiplist is an ordered collection of sorted set items
+*/
+type skiplist struct {
+	head   *skiplistNode // a sentinel holding no item, linked on every level
+	tail   *skiplistNode
+	length int
+	level  int // the number of levels in use
+}
+
+/*
+newSkiplist creates an empty skiplist
+*/
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skiplistNode{levels: make([]skiplistLink, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+/*
+randomLevel picks the number of levels of a new node: one, plus one more
+with a 1 in 4 chance each time
+*/
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.IntN(4) == 0 {
+		level++
+	}
+	return level
+}
+
+/*
+first returns the lowest node, or nil if the skiplist is empty
+*/
+func (l *skiplist) first() *skiplistNode {
+	return l.head.next()
+}
+
+/*
+insert adds item, which must not already be in the skiplist
+*/
+func (l *skiplist) insert(item zsetItem) {
+	// The last node before item on each level, and its rank
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.item.less(item) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	for i := l.level; i < level; i++ {
+		update[i] = l.head
+		update[i].levels[i].span = l.length
+	}
+	l.level = max(l.level, level)
+
+	x = &skiplistNode{item: item, levels: make([]skiplistLink, level)}
+	for i := range level {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	// The links above the new node now skip it too
+	for i := level; i < l.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != l.head {
+		x.backward = update[0]
+	}
+	if next := x.next(); next != nil {
+		next.backward = x
+	} else {
+		l.tail = x
+	}
+	l.length++
+}
+
+/*
+remove deletes item, returning false if it isn't in the skiplist
+*/
+func (l *skiplist) remove(item zsetItem) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.item.less(item) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+	x = x.next()
+	if x == nil || item.less(x.item) {
+		return false
+	}
+
+	for i := range l.level {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if next := x.next(); next != nil {
+		next.backward = x.backward
+	} else {
+		l.tail = x.backward
+	}
+	for l.level > 1 && l.head.levels[l.level-1].forward == nil {
+		l.level--
+	}
+	l.length--
+	return true
+}
+
+/*
+at returns the node with the given 0-based rank, or nil if it's out of range
+*/
+func (l *skiplist) at(rank int) *skiplistNode {
+	if rank < 0 || rank >= l.length {
+		return nil
+	}
+	// traversed is the 1-based rank of x
+	traversed := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank+1 {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+/*
+search returns the number of items before the first one for which pred
+is true, like sort.Search
+
+pred must be false for a prefix of the order and true for the rest.
+*/
+func (l *skiplist) search(pred func(zsetItem) bool) int {
+	rank := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !pred(x.levels[i].forward.item) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+	}
+	return rank
+}
+
+/*
+items returns every item in order
+*/
+func (l *skiplist) items() []zsetItem {
+	items := make([]zsetItem, 0, l.length)
+	for n := l.first(); n != nil; n = n.next() {
+		items = append(items, n.item)
+	}
+	return items
+}
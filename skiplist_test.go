@@ -0,0 +1,72 @@
+package goredis
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestSkiplistMatchesSortedSlice(t *testing.T) {
+	z := newZSetValue()
+	var want []zsetItem
+	rng := rand.New(rand.NewPCG(3, 4))
+
+	for i := range 3000 {
+		member := fmt.Sprintf("m%d", rng.IntN(300))
+		score := float64(rng.IntN(20))
+		if rng.IntN(3) == 0 {
+			z.remove(member)
+		} else {
+			z.set(member, score)
+		}
+
+		want = want[:0]
+		for member, score := range z.scores {
+			want = append(want, zsetItem{member: member, score: score})
+		}
+		slices.SortFunc(want, func(a, b zsetItem) int {
+			if a.less(b) {
+				return -1
+			}
+			if b.less(a) {
+				return 1
+			}
+			return 0
+		})
+
+		if got := z.sorted.items(); !slices.Equal(got, want) {
+			t.Fatalf("after %d operations: order %v, want %v", i+1, got, want)
+		}
+		if tail := z.sorted.tail; len(want) > 0 && tail.item != want[len(want)-1] {
+			t.Fatalf("after %d operations: tail %v, want %v", i+1, tail.item, want[len(want)-1])
+		}
+		rank := rng.IntN(len(want) + 1)
+		if node := z.sorted.at(rank); (node == nil) != (rank == len(want)) || (node != nil && node.item != want[rank]) {
+			t.Fatalf("after %d operations: at(%d) = %v, want %v", i+1, rank, node, want[rank:])
+		}
+		r := scoreRange{min: scoreBound{value: score}, max: scoreBound{value: score + 3, exclusive: true}}
+		lo, hi := z.scoreSpan(r)
+		wantLo := sort.Search(len(want), func(i int) bool { return r.gteMin(want[i].score) })
+		wantHi := sort.Search(len(want), func(i int) bool { return !r.lteMax(want[i].score) })
+		if lo != wantLo || hi != max(wantLo, wantHi) {
+			t.Fatalf("after %d operations: scoreSpan(%v) = %d, %d, want %d, %d", i+1, r, lo, hi, wantLo, wantHi)
+		}
+		if got := z.window(lo, hi, true, 1, 2); !slices.Equal(got, reversed(want[lo:hi], 1, 2)) {
+			t.Fatalf("after %d operations: reverse window %v, want %v", i+1, got, reversed(want[lo:hi], 1, 2))
+		}
+	}
+}
+
+/*
+reversed returns count items of items, highest first, after skipping offset
+*/
+func reversed(items []zsetItem, offset, count int) []zsetItem {
+	items = slices.Clone(items)
+	slices.Reverse(items)
+	if offset >= len(items) {
+		return nil
+	}
+	return items[offset:min(len(items), offset+count)]
+}
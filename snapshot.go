@@ -0,0 +1,213 @@
+package goredis
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+	"time"
+)
+
+/*
+Keyspace Snapshots for Redis Clone
+
+Walking every key (to save, export or digest the dataset) under the
+storage read lock stalls all writers for the whole walk, and walking it
+page by page under short locks sees some keys before a write and others
+after it. A KeyspaceSnapshot gives a point-in-time view without either:
+it holds the read lock once to list the keys, then reads their values a
+page at a time, while writers save the values it hasn't read yet before
+changing them.
+
+Key concepts:
+- Key List: Taking a snapshot lists the live keys under the read lock, in
+  the hash order SCAN uses, from the index SCAN pages through (see
+  scan.go); it costs a string header per key and no copy of the values
+- Pages: Next reads a page of values under a short read lock, copying
+  them, so writes never wait for more than one page
+- Copy Before Write: While a snapshot is open, the first write to a key it
+  hasn't read yet saves the key's value as of the snapshot (see preserve),
+  so the extra memory is bounded by the keys written during the walk
+- Expiry: Keys live when the snapshot was taken are part of it, even if
+  their TTL passes during the walk; ExpireAt tells the reader when
+- Closing: A snapshot stops costing writers anything once its last page
+  is read or Close is called
+- Readers: EXPORT reads a snapshot for its connection (see export.go);
+  KEYS lists keys the same way, without the copy before write, and SCAN
+  reads a page of the same index at a time
+*/
+
+/*
+SnapshotEntry is a key as a snapshot read it
+
+Value is a copy, in the shapes documented on Change.
+*/
+type SnapshotEntry struct {
+	Key      string
+	Type     ValueType
+	Value    any
+	ExpireAt time.Time // zero when the key has no TTL
+}
+
+/*
+KeyspaceSnapshot is a point-in-time view of the keyspace, read a page at a time
+
+Created by Storage.SnapshotKeyspace. Not safe for concurrent use.
+*/
+type KeyspaceSnapshot struct {
+	storage *Storage
+	keys    []scanItem // live keys when the snapshot was taken, in hash order
+	next    int        // index of the first key not read yet
+	closed  bool
+
+	// Hash of the first key not read yet, which writers compare keys with.
+	// Changed under the read lock, read under the write lock.
+	cursor uint64
+
+	// Values saved by writers before changing keys not read yet, nil for
+	// keys that didn't exist when the snapshot was taken. Guarded by the
+	// storage lock: written under the write lock, read under the read lock.
+	saved map[string]*SnapshotEntry
+}
+
+/*
+snapshotRegistry holds the open snapshots of a storage
+
+Snapshots are added under the read lock, by any number of goroutines at
+once, so adding takes mu too; writers and Close hold the write lock.
+*/
+type snapshotRegistry struct {
+	mu   sync.Mutex
+	open []*KeyspaceSnapshot
+}
+
+/*
+SnapshotKeyspace takes a point-in-time view of the keyspace
+
+The caller reads it with Next and should Close it if it stops before the
+end, since writers copy values for open snapshots.
+*/
+func (s *Storage) SnapshotKeyspace() *KeyspaceSnapshot {
+	s.mu.RLock()
+	sn := &KeyspaceSnapshot{
+		storage: s,
+		keys:    s.liveKeys(),
+		saved:   make(map[string]*SnapshotEntry),
+	}
+	s.snapshots.mu.Lock()
+	s.snapshots.open = append(s.snapshots.open, sn)
+	s.snapshots.mu.Unlock()
+	s.mu.RUnlock()
+	return sn
+}
+
+/*
+Next reads the next count keys of the snapshot
+
+Keys deleted since the snapshot was taken are still returned, with their
+values as of the snapshot.
+
+Returns: The entries read, empty once the snapshot is exhausted (which
+closes it)
+*/
+func (sn *KeyspaceSnapshot) Next(count int) []SnapshotEntry {
+	if sn.closed {
+		return nil
+	}
+	s := sn.storage
+	var entries []SnapshotEntry
+
+	// A page may hold only keys created after the snapshot, so read on until something is found
+	for len(entries) == 0 && sn.next < len(sn.keys) {
+		end := min(sn.next+count, len(sn.keys))
+
+		s.mu.RLock()
+		for _, item := range sn.keys[sn.next:end] {
+			if saved, isSaved := sn.saved[item.key]; isSaved {
+				if saved != nil {
+					entries = append(entries, *saved)
+				}
+				continue
+			}
+			if e := s.entries[item.key]; e != nil {
+				entries = append(entries, snapshotEntry(item.key, e))
+			}
+		}
+		sn.next = end
+		if end < len(sn.keys) {
+			sn.cursor = sn.keys[end].hash
+		}
+		s.mu.RUnlock()
+	}
+
+	if len(entries) == 0 {
+		sn.Close()
+	}
+	return entries
+}
+
+/*
+Len returns the number of keys in the snapshot
+*/
+func (sn *KeyspaceSnapshot) Len() int {
+	return len(sn.keys)
+}
+
+/*
+Close releases the snapshot, so writers stop saving values for it
+*/
+func (sn *KeyspaceSnapshot) Close() {
+	if sn.closed {
+		return
+	}
+	sn.closed = true
+
+	s := sn.storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots.open = slices.DeleteFunc(s.snapshots.open, func(open *KeyspaceSnapshot) bool { return open == sn })
+	sn.saved = nil
+}
+
+/*
+preserve saves the value of a key for every open snapshot that hasn't
+read it yet, before the key is written
+
+Must be called with the write lock held, before the entry (or its value)
+changes. Only the first write to a key is saved; later ones find the
+value already there.
+*/
+func (s *Storage) preserve(keyStr string) {
+	if len(s.snapshots.open) == 0 {
+		return
+	}
+
+	hash := maphash.String(s.scanSeed, keyStr)
+	var saved *SnapshotEntry
+	taken := false
+	for _, sn := range s.snapshots.open {
+		if sn.next == len(sn.keys) || hash < sn.cursor {
+			continue // read already, or not part of the snapshot
+		}
+		if _, isSaved := sn.saved[keyStr]; isSaved {
+			continue
+		}
+		if !taken {
+			if e, exists := s.entries[keyStr]; exists {
+				entry := snapshotEntry(keyStr, e)
+				saved = &entry
+			}
+			taken = true
+		}
+		sn.saved[keyStr] = saved
+	}
+}
+
+/*
+snapshotEntry copies a key into a SnapshotEntry
+
+Must be called with at least the read lock held.
+*/
+func snapshotEntry(keyStr string, e *entry) SnapshotEntry {
+	return SnapshotEntry{Key: keyStr, Type: e.valueType(), Value: e.copyValue(), ExpireAt: e.expireTime()}
+}
@@ -0,0 +1,96 @@
+package goredis_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+func TestSnapshotKeyspaceIsPointInTime(t *testing.T) {
+	storage := goredis.NewStorage()
+	for i := range 20 {
+		storage.Set(fmt.Appendf(nil, "key:%d", i), []byte("old"))
+	}
+
+	snapshot := storage.SnapshotKeyspace()
+	seen := map[string]string{}
+	read := func(count int) int {
+		entries := snapshot.Next(count)
+		for _, entry := range entries {
+			if _, dup := seen[entry.Key]; dup {
+				t.Errorf("%s read twice", entry.Key)
+			}
+			seen[entry.Key] = string(entry.Value.([]byte))
+		}
+		return len(entries)
+	}
+	read(5)
+
+	// Every key changes after the first page: overwritten, deleted or new
+	for i := range 20 {
+		if i%2 == 0 {
+			storage.Set(fmt.Appendf(nil, "key:%d", i), []byte("new"))
+		} else {
+			storage.Delete(fmt.Appendf(nil, "key:%d", i))
+		}
+		storage.Set(fmt.Appendf(nil, "added:%d", i), []byte("new"))
+	}
+	for read(5) > 0 {
+	}
+
+	if len(seen) != 20 {
+		t.Errorf("read %d keys, want the 20 present when the snapshot was taken", len(seen))
+	}
+	for key, value := range seen {
+		if !strings.HasPrefix(key, "key:") || value != "old" {
+			t.Errorf("read %s = %q, want only the keys and values of the snapshot", key, value)
+		}
+	}
+	if entries := snapshot.Next(5); len(entries) != 0 {
+		t.Errorf("Next after the end returned %d entries", len(entries))
+	}
+}
+
+func TestExport(t *testing.T) {
+	server := startServer(t, nil)
+	exporter := dial(t, server)
+	writer := dial(t, server)
+
+	writer.expect("+OK\r\n", "SET", "greeting", "hello")
+	writer.expect(":2\r\n", "RPUSH", "queue", "a", "b")
+	writer.expect(":1\r\n", "HSET", "user", "name", "ann")
+
+	// The first page holds one key; the writes after it don't change the rest
+	first := exporter.do("EXPORT", "0", "COUNT", "1")
+	writer.expect(":3\r\n", "DEL", "greeting", "queue", "user")
+	writer.expect("+OK\r\n", "SET", "later", "x")
+
+	cursor := strings.Split(first, "\r\n")[2]
+	if cursor == "0" {
+		t.Fatalf("first page %q ended the export", first)
+	}
+	writer.expect("-ERR invalid cursor\r\n", "EXPORT", cursor)
+	rest := exporter.do("EXPORT", cursor, "COUNT", "10")
+	if !strings.HasPrefix(rest, "*2\r\n$1\r\n0\r\n*") {
+		t.Errorf("second page %q, want cursor 0", rest)
+	}
+
+	records := first + rest
+	for _, want := range []string{
+		"$6\r\nstring\r\n$8\r\ngreeting\r\n:-1\r\n*1\r\n$5\r\nhello\r\n",
+		"$4\r\nlist\r\n$5\r\nqueue\r\n:-1\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		"$4\r\nhash\r\n$4\r\nuser\r\n:-1\r\n*2\r\n$4\r\nname\r\n$3\r\nann\r\n",
+	} {
+		if !strings.Contains(records, want) {
+			t.Errorf("export %q is missing record %q", records, want)
+		}
+	}
+	if strings.Contains(records, "later") {
+		t.Errorf("export %q holds a key written after the snapshot", records)
+	}
+
+	// Once done, only a new export can be read
+	exporter.expect("-ERR invalid cursor\r\n", "EXPORT", cursor)
+}
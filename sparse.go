@@ -0,0 +1,101 @@
+package goredis
+
+/*
+Sparse Strings for Redis Clone
+
+SETRANGE pads a string with zero bytes up to its offset, so SETRANGE key
+1000000000 x would allocate a gigabyte of zeros for one byte of data.
+Strings padded that much are stored sparse instead: in fixed-size pages,
+where pages that were never written are zeros and take no memory. Bitmap
+style workloads writing a few bytes far apart keep their memory
+proportional to what they wrote.
+
+Key concepts:
+- Pages: The string is split into 4 KB pages, allocated the first time a
+  write touches them
+- When: A SETRANGE padding the string with 1 MB of zeros or more makes it
+  sparse; smaller gaps are cheaper to store as they are
+- Back to Plain: Once its pages cover the whole string, a sparse string is
+  stored as a plain one again, since the pages no longer save anything
+- Writes: SETRANGE and APPEND write into the pages; other writes replace
+  the value like they would a plain string
+- Reads: STRLEN and GETRANGE read the pages directly; GET and the other
+  reads build the whole string, zeros included
+- Visibility: OBJECT ENCODING reports sparse strings as "sparse"
+*/
+
+const (
+	sparsePageSize = 4 << 10 // bytes per page
+	sparseMinGap   = 1 << 20 // zero padding that makes a string sparse
+)
+
+/*
+sparseString is a string value stored in pages, unwritten pages being zeros
+*/
+type sparseString struct {
+	size  int            // the length of the string
+	pages map[int][]byte // page number -> sparsePageSize bytes
+}
+
+/*
+newSparseString creates a sparse string holding val
+*/
+func newSparseString(val []byte) *sparseString {
+	sp := &sparseString{pages: make(map[int][]byte)}
+	sp.write(0, val)
+	return sp
+}
+
+/*
+write copies value into the string at offset, growing it if needed
+*/
+func (sp *sparseString) write(offset int, value []byte) {
+	for len(value) > 0 {
+		n, at := offset/sparsePageSize, offset%sparsePageSize
+		page := sp.pages[n]
+		if page == nil {
+			page = make([]byte, sparsePageSize)
+			sp.pages[n] = page
+		}
+		copied := copy(page[at:], value)
+		offset += copied
+		value = value[copied:]
+	}
+	sp.size = max(sp.size, offset)
+}
+
+/*
+full reports whether every page of the string is allocated
+*/
+func (sp *sparseString) full() bool {
+	return len(sp.pages)*sparsePageSize >= sp.size
+}
+
+/*
+slice returns a copy of the bytes from start to end (exclusive)
+*/
+func (sp *sparseString) slice(start, end int) []byte {
+	out := make([]byte, end-start)
+	for offset := start; offset < end; {
+		n, at := offset/sparsePageSize, offset%sparsePageSize
+		count := min(sparsePageSize-at, end-offset)
+		if page := sp.pages[n]; page != nil {
+			copy(out[offset-start:], page[at:at+count])
+		}
+		offset += count
+	}
+	return out
+}
+
+/*
+bytes returns the whole string in a new slice
+*/
+func (sp *sparseString) bytes() []byte {
+	out := make([]byte, sp.size)
+	for n, page := range sp.pages {
+		if offset := n * sparsePageSize; offset < sp.size {
+			copy(out[offset:], page)
+		}
+	}
+	return out
+}
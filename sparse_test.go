@@ -0,0 +1,94 @@
+package goredis_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+func TestSparseStrings(t *testing.T) {
+	storage := goredis.NewStorage()
+	key := []byte("bitmap")
+	const far = 100 << 20
+
+	// A write far past the end leaves the gap unallocated
+	storage.Set(key, []byte("head"))
+	if n, err := storage.SetRange(key, far, []byte("tail")); err != nil || n != far+4 {
+		t.Fatalf("SETRANGE = %d, %v, want %d", n, err, far+4)
+	}
+	if got, _ := storage.Encoding(key); got != "sparse" {
+		t.Errorf("OBJECT ENCODING = %q, want sparse", got)
+	}
+	if size, _ := storage.MemoryUsage(key, 0); size > 64<<10 {
+		t.Errorf("MEMORY USAGE = %d, want a few pages for the 8 bytes written", size)
+	}
+
+	// Ranges read the pages, zeros where nothing was written
+	for _, tt := range []struct {
+		start, end int
+		want       string
+	}{
+		{0, 5, "head\x00\x00"},
+		{far - 2, -1, "\x00\x00tail"},
+		{far + 2, far + 100, "il"},
+		{50 << 20, 50<<20 + 3, "\x00\x00\x00\x00"},
+	} {
+		if got, err := storage.GetRange(key, tt.start, tt.end); err != nil || string(got) != tt.want {
+			t.Errorf("GETRANGE %d %d = %q, %v, want %q", tt.start, tt.end, got, err, tt.want)
+		}
+	}
+
+	// Writes go into the pages, growing the string
+	if n, err := storage.Append(key, []byte("!")); err != nil || n != far+5 {
+		t.Errorf("APPEND = %d, %v, want %d", n, err, far+5)
+	}
+	storage.SetRange(key, 1000, []byte("mid"))
+	if n, err := storage.Strlen(key); err != nil || n != far+5 {
+		t.Errorf("STRLEN = %d, %v, want %d", n, err, far+5)
+	}
+	want := make([]byte, far+5)
+	copy(want, "head")
+	copy(want[1000:], "mid")
+	copy(want[far:], "tail!")
+	if got, ok, err := storage.Get(key); err != nil || !ok || !bytes.Equal(got, want) {
+		t.Errorf("GET: %d bytes, %v, %v; want the %d bytes written, zeros between", len(got), ok, err, len(want))
+	}
+	if got, _ := storage.Encoding(key); got != "sparse" {
+		t.Errorf("OBJECT ENCODING after the writes = %q, want sparse", got)
+	}
+
+	// Another write replaces it like any string
+	storage.Set(key, []byte("plain"))
+	if got, _ := storage.Encoding(key); got != "raw" {
+		t.Errorf("OBJECT ENCODING after SET = %q, want raw", got)
+	}
+}
+
+func TestSparseStringsBecomePlainWhenFull(t *testing.T) {
+	storage := goredis.NewStorage()
+	key := []byte("filled")
+	const gap = 1 << 20
+
+	// A gap just short of a megabyte is padded with zeros
+	storage.SetRange(key, gap-1, []byte("x"))
+	if got, _ := storage.Encoding(key); got != "raw" {
+		t.Errorf("OBJECT ENCODING with a %d byte gap = %q, want raw", gap-1, got)
+	}
+
+	storage.Delete(key)
+	storage.SetRange(key, gap, []byte("x"))
+	if got, _ := storage.Encoding(key); got != "sparse" {
+		t.Fatalf("OBJECT ENCODING with a %d byte gap = %q, want sparse", gap, got)
+	}
+
+	// Once every page is written, the pages save nothing
+	fill := bytes.Repeat([]byte("y"), gap)
+	storage.SetRange(key, 0, fill)
+	if got, _ := storage.Encoding(key); got != "raw" {
+		t.Errorf("OBJECT ENCODING once full = %q, want raw", got)
+	}
+	if got, _, _ := storage.Get(key); !bytes.Equal(got, append(fill, 'x')) {
+		t.Errorf("GET once full: %d bytes, want the %d written", len(got), gap+1)
+	}
+}
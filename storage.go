@@ -1,12 +1,199 @@
-package main
+package goredis
 
 import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/rand/v2"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+/*
+ValueType identifies the kind of value stored at a key
+
+Redis keys can hold different kinds of values (strings, lists, sets, ...).
+Commands only work on the type they were written for, so the storage reports
+the type of every key and commands reject keys of the wrong type.
+The string form of each type is exactly what the Redis TYPE command returns.
+*/
+type ValueType string
+
+const (
+	TypeNone   ValueType = "none"
+	TypeString ValueType = "string"
+	TypeList   ValueType = "list"
+	TypeSet    ValueType = "set"
+	TypeZSet   ValueType = "zset"
+	TypeHash   ValueType = "hash"
+)
+
+/*
+entry holds everything the storage knows about a single key
+
+Keeping value, expiry and access metadata together means each key string
+is stored once (as the map key) instead of once per bookkeeping map, and a
+single map lookup finds all of it.
+
+Value representations:
+  - []byte: a string value (raw encoding)
+  - int64: a string value holding a canonical 64-bit integer (int encoding)
+  - *compressedString: a large string value stored compressed (see compression.go)
+  - *sparseString: a string value mostly padded with zeros (see sparse.go)
+  - *listValue: a list (see lists.go)
+  - *setValue: a set (see sets.go)
+  - *hashValue: a hash (see hashes.go)
+  - *zsetValue: a sorted set (see zsets.go)
+
+Fields:
+  - expireAt: absolute expiry time in unix nanoseconds, 0 when the key has no TTL
+  - lastAccess: unix nanoseconds of the last read or write, for OBJECT IDLETIME
+    and eviction. It's atomic so reads can update it under the read lock.
+*/
+type entry struct {
+	value      any
+	expireAt   int64
+	lastAccess atomic.Int64
+}
+
+/*
+newEntry creates an entry for value, marking it as accessed now
+*/
+func newEntry(value any) *entry {
+	e := &entry{value: value}
+	e.touch()
+	return e
+}
+
+/*
+newStringEntry creates an entry for a string value, integer-encoding it when possible
+
+A value is only integer-encoded when formatting the parsed number gives back
+the exact same bytes, so strings like "007" or "+5" keep their original form.
+*/
+func newStringEntry(val []byte) *entry {
+	if len(val) > 0 && len(val) <= 20 {
+		if n, err := strconv.ParseInt(string(val), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(val) {
+			return newEntry(n)
+		}
+	}
+	return newEntry(ownBytes(val))
+}
+
+/*
+ownBytes returns a private copy of b for the storage to keep
+
+The copy is exactly sized, and never nil: an empty string is still a string.
+*/
+func ownBytes(b []byte) []byte {
+	owned := make([]byte, len(b))
+	copy(owned, b)
+	return owned
+}
+
+/*
+SetCopyOnRead makes reads return copies of the stored bytes (true) or the
+stored bytes themselves (false, the default)
+
+Embedding code that modifies what it reads, or keeps it while other
+goroutines write the same keys, should turn it on; see Storage.
+*/
+func (s *Storage) SetCopyOnRead(enabled bool) {
+	s.copyOnRead.Store(enabled)
+}
+
+/*
+readBytes returns stored bytes to a reader, copied if SetCopyOnRead is on
+
+Shared bytes are capped at their length, so appending to them can't
+write into a string's spare capacity (see Storage.Append).
+*/
+func (s *Storage) readBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	if !s.copyOnRead.Load() {
+		return b[:len(b):len(b)]
+	}
+	return ownBytes(b)
+}
+
+/*
+readSlices applies readBytes to every element of a freshly built result
+*/
+func (s *Storage) readSlices(items [][]byte) [][]byte {
+	for i, item := range items {
+		items[i] = s.readBytes(item)
+	}
+	return items
+}
+
+/*
+expired reports whether the entry's TTL has passed at time now (unix nanoseconds)
+*/
+func (e *entry) expired(now int64) bool {
+	return e.expireAt != 0 && now > e.expireAt
+}
+
+/*
+touch records an access to the entry
+*/
+func (e *entry) touch() {
+	e.lastAccess.Store(time.Now().UnixNano())
+}
+
+/*
+valueType returns the Redis type of the stored value
+*/
+func (e *entry) valueType() ValueType {
+	switch e.value.(type) {
+	case []byte, int64, *compressedString, *sparseString:
+		return TypeString
+	case *listValue:
+		return TypeList
+	case *setValue:
+		return TypeSet
+	case *hashValue:
+		return TypeHash
+	case *zsetValue:
+		return TypeZSet
+	}
+	return TypeNone
+}
+
+/*
+stringBytes returns the byte form of a string value
+
+Integer-encoded values are rendered on demand; small ones come from the
+shared integer table and don't allocate. Compressed and sparse values are
+built into a new slice. Returns nil for non-string values.
+*/
+func (e *entry) stringBytes() []byte {
+	switch v := e.value.(type) {
+	case []byte:
+		return v
+	case int64:
+		return integerBytes(v)
+	case *compressedString:
+		return v.bytes()
+	case *sparseString:
+		return v.bytes()
+	}
+	return nil
+}
+
+/*
+integerBytes renders an integer, using the shared table for small values
+*/
+func integerBytes(n int64) []byte {
+	if n >= 0 && n < sharedIntegersCount {
+		return sharedIntegers[n]
+	}
+	return []byte(strconv.FormatInt(n, 10))
+}
+
 /*
 Storage represents the key-value storage engine with thread-safe operations
 
@@ -18,28 +205,145 @@ Key features:
   - Thread-safe operations using sync.RWMutex
   - TTL (Time To Live) support for automatic key expiration
   - Support for string operations, counters, and pattern matching
-  - In-memory storage with maps for fast lookups
+  - One entry per key holding value, expiry and access metadata
+
+Expired keys are removed lazily: write operations drop them when they touch
+the key, and GET drops them when it finds one. Other read operations only
+treat them as missing, since they run under the read lock. The active
+expire cycle (see expire.go) removes the ones nobody touches.
+
+Value ownership:
+  - Writes copy: every value (or element) stored is a private copy, so the
+    caller may reuse or modify its buffers as soon as the call returns;
+    the server relies on this, its RESP reader doesn't have to keep
+    arguments alive once a command ran
+  - Reads share: byte slices returned by reads (Get, MGet, LRange, HGet,
+    ...) are the stored data itself. They must not be modified, and only
+    hold the value as of the read while the key isn't written again
+    (SETRANGE changes a string in place)
+  - Copy on read: SetCopyOnRead(true) makes reads return private copies
+    instead, which callers own, at the cost of one more copy per value
+  - Values removed by a call (popped elements, the old value of GETSET)
+    aren't referenced by the storage anymore and belong to the caller
 */
 type Storage struct {
-	mu       sync.RWMutex
-	data     map[string][]byte
-	expiry   map[string]time.Time
-	counters map[string]int64
+	mu      sync.RWMutex
+	entries map[string]*entry
+	hooks   []Hook // called on every change, see hooks.go
+
+	// Seed of the key hashes that order SCAN, and the keys in that order (see scan.go)
+	scanSeed maphash.Seed
+	scanKeys scanIndex
+
+	// Set by DEBUG SET-ACTIVE-EXPIRE 0 to pause the active expire cycle
+	activeExpireDisabled atomic.Bool
+
+	// Keys removed since startup because their TTL passed, or to free memory (see info.go)
+	expiredKeys int64
+	evictedKeys int64
+
+	// Hash fields removed since startup because their TTL passed, and the
+	// hashes that may have fields with a TTL, for the active expire cycle (see hashttl.go)
+	expiredFields int64
+	hashesWithTTL map[string]struct{}
+
+	// Candidates for eviction kept between picks (see eviction.go)
+	evictionPool evictionPool
+
+	// Set by SetCopyOnRead: reads return private copies of the stored bytes
+	copyOnRead atomic.Bool
+
+	// Set by SetCompressThreshold: string values this large are stored compressed, 0 for never
+	compressThreshold atomic.Int64
+
+	// Totals of the values stored compressed, kept by putEntry and deleteEntry (see compression.go)
+	compressed CompressionStats
+
+	// Set by SetLimits: size limits enforced on writes, nil for none (see limits.go)
+	limits atomic.Pointer[Limits]
+
+	// Open snapshots, which writers save values for (see snapshot.go)
+	snapshots snapshotRegistry
 }
 
+/*
+sharedIntegersCount is the number of pre-rendered small integers (0 to 9999)
+
+Same limit as Redis' OBJ_SHARED_INTEGERS.
+*/
+const sharedIntegersCount = 10000
+
+/*
+sharedRefCount is the reference count OBJECT REFCOUNT reports for shared integers
+
+Redis reports INT_MAX for shared objects since they're never freed.
+*/
+const sharedRefCount = math.MaxInt32
+
+/*
+sharedIntegers holds the byte form of the integers 0 to 9999
+
+Counter workloads mostly store small numbers, so every read of one of them
+returns the same read-only slice instead of rendering a new one.
+The slices are capped (len == cap) so an append always copies instead of
+writing into the shared backing array.
+*/
+var sharedIntegers = func() [][]byte {
+	shared := make([][]byte, sharedIntegersCount)
+	for i := range shared {
+		b := []byte(strconv.Itoa(i))
+		shared[i] = b[:len(b):len(b)]
+	}
+	return shared
+}()
+
 /*
 NewStorage creates a new storage instance
 
-This is the constructor function that initializes all the internal maps
+This is the constructor function that initializes the entry map
 and returns a ready-to-use Storage instance.
 */
 func NewStorage() *Storage {
 	return &Storage{
-		data:     make(map[string][]byte),
-		expiry:   make(map[string]time.Time),
-		counters: make(map[string]int64),
+		entries:       make(map[string]*entry),
+		scanSeed:      maphash.MakeSeed(),
+		hashesWithTTL: make(map[string]struct{}),
 	}
+}
 
+/*
+lookupRead returns the live entry for a key, or nil
+
+Must be called with at least the read lock held. Expired entries are
+reported as missing but left in place, since removing them needs the
+write lock.
+*/
+func (s *Storage) lookupRead(keyStr string) *entry {
+	e, exists := s.entries[keyStr]
+	if !exists || e.expired(time.Now().UnixNano()) {
+		return nil
+	}
+	return e
+}
+
+/*
+lookupWrite returns the live entry for a key, or nil
+
+Must be called with the write lock held. An expired entry is deleted on
+the spot, so the caller can treat the key as brand new. The caller is
+expected to write the key, so open snapshots save its value first.
+*/
+func (s *Storage) lookupWrite(keyStr string) *entry {
+	s.preserve(keyStr)
+	e, exists := s.entries[keyStr]
+	if !exists {
+		return nil
+	}
+	if e.expired(time.Now().UnixNano()) {
+		s.expire(keyStr)
+		return nil
+	}
+	return e
 }
 
 /*
@@ -53,15 +357,21 @@ params:
 - key: The key to store (as byte slice for efficiency)
 - val: The value to store (as byte slice to support binary data)
 
-returns: error (always nil in this implementation)
+returns: error (a size limit was exceeded, see limits.go)
 */
 func (s *Storage) Set(key, val []byte) error {
+	if err := s.checkStringWrite(key, len(val)); err != nil {
+		return err
+	}
+	e := s.stringEntry(val)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	keyStr := string(key)
-	s.data[keyStr] = val
-	delete(s.expiry, keyStr)
+	s.preserve(keyStr)
+	s.putEntry(keyStr, e)
+	s.changed(keyStr)
 
 	return nil
 }
@@ -78,14 +388,20 @@ Parameters:
 - expiry: How long the key should live (duration from now)
 */
 func (s *Storage) SetWithExpiry(key, val []byte, expiry time.Duration) error {
+	if err := s.checkStringWrite(key, len(val)); err != nil {
+		return err
+	}
+	e := s.stringEntry(val)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	keyStr := string(key)
-	s.data[keyStr] = val
-
 	// Calculate absolute expiration time by adding duration to current time
-	s.expiry[keyStr] = time.Now().Add(expiry)
+	e.expireAt = time.Now().Add(expiry).UnixNano()
+	keyStr := string(key)
+	s.preserve(keyStr)
+	s.putEntry(keyStr, e)
+	s.changed(keyStr)
 
 	return nil
 }
@@ -103,35 +419,54 @@ Parameters:
 Returns:
 - []byte: The value (nil if key doesn't exist)
 - bool: Whether the key exists and is not expired
+- error: ErrWrongType if the key holds another type
 */
-func (s *Storage) Get(key []byte) ([]byte, bool) {
+func (s *Storage) Get(key []byte) ([]byte, bool, error) {
+	keyStr := string(key)
+
 	s.mu.RLock()
+	e, exists := s.entries[keyStr]
+	if exists && e.expired(time.Now().UnixNano()) {
+		/*
+			Key has expired, remove it from storage
+			Maps can't be modified under the read lock, so release it
+			and delete the key under the write lock instead
+		*/
+		s.mu.RUnlock()
+		s.purgeExpired(keyStr)
+		return nil, false, nil
+	}
 	defer s.mu.RUnlock()
 
-	keyStr := string(key)
-
-	if expTime, exists := s.expiry[keyStr]; exists {
-		if time.Now().After(expTime) {
-			/*
-				Key has expired, remove it from storage
-				Note: We can't modify maps during RLock, but this is a cleanup operation
-				In production, you'd typically do lazy expiration or background cleanup
-			*/
-			delete(s.data, keyStr)
-			delete(s.expiry, keyStr)
-			return nil, false
-		}
+	if !exists {
+		return nil, false, nil
+	}
+	if e.valueType() != TypeString {
+		return nil, false, ErrWrongType
 	}
 
-	val, ok := s.data[keyStr]
-	return val, ok
+	e.touch()
+	return s.readBytes(e.stringBytes()), true, nil
+}
+
+/*
+purgeExpired deletes a key if it is (still) expired
+
+Takes the write lock itself. The expiry is checked again because another
+writer may have replaced the key between the caller's check and now.
+*/
+func (s *Storage) purgeExpired(keyStr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lookupWrite(keyStr)
 }
 
 /*
 Delete removes a key-value pair
 
-Implements Redis DEL command. Removes a key and its associated value,
-expiry time, and counter value if they exist.
+Implements Redis DEL command. Removes a key together with its value,
+expiry time and metadata.
 
 Returns: true if the key existed and was deleted, false if key didn't exist
 */
@@ -140,14 +475,13 @@ func (s *Storage) Delete(key []byte) bool {
 	defer s.mu.Unlock()
 
 	keyStr := string(key)
-	_, exists := s.data[keyStr]
-	if exists {
-		delete(s.data, keyStr)
-		delete(s.expiry, keyStr)
-		delete(s.counters, keyStr)
+	if s.lookupWrite(keyStr) == nil {
+		return false
 	}
 
-	return exists
+	s.deleteEntry(keyStr)
+	s.changed(keyStr)
+	return true
 }
 
 /*
@@ -160,16 +494,23 @@ func (s *Storage) Exists(key []byte) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	keyStr := string(key)
+	return s.lookupRead(string(key)) != nil
+}
 
-	if expTime, exists := s.expiry[keyStr]; exists {
-		if time.Now().After(expTime) {
-			return false
-		}
-	}
+/*
+Type returns the type of the value stored at key
+
+Implements Redis TYPE command. Expired and missing keys report TypeNone.
+*/
+func (s *Storage) Type(key []byte) ValueType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	_, exists := s.data[keyStr]
-	return exists
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return TypeNone
+	}
+	return e.valueType()
 }
 
 /*
@@ -177,48 +518,140 @@ Append appends a value to an existing key
 
 Implements Redis APPEND command. If the key exists, appends the value to the end.
 If the key doesn't exist, creates it with the given value.
+The key keeps its TTL, if any.
+
+Like Redis' SDS strings, an appended string keeps spare capacity (see
+appendCapacity), so building a large string one APPEND at a time copies
+it a logarithmic number of times instead of on every call.
 
-Returns: The new length of the string after append operation
+Returns: The new length of the string after append operation, or an
+error: ErrWrongType if the key holds another type, or a size limit (see
+limits.go) or the longest bulk string (proto-max-bulk-len) the result
+would exceed
 */
-func (s *Storage) Append(key, val []byte) int {
+func (s *Storage) Append(key, val []byte) (int, error) {
+	if err := s.checkStringWrite(key, len(val)); err != nil {
+		return 0, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	keyStr := string(key)
-	existing, exists := s.data[keyStr]
+	e := s.lookupWrite(keyStr)
 
-	if !exists {
-		s.data[keyStr] = val
-		return len(val)
+	if e == nil {
+		s.putEntry(keyStr, s.stringEntry(val))
+		s.changed(keyStr)
+		return len(val), nil
+	}
+	if e.valueType() != TypeString {
+		return 0, ErrWrongType
+	}
+	length := e.stringLen() + len(val)
+	if length > respMaxBulkLength {
+		return 0, errBulkTooLarge
+	}
+	if err := s.checkString(length); err != nil {
+		return 0, err
+	}
+
+	// Sparse strings grow page by page (see sparse.go)
+	if sp, ok := e.value.(*sparseString); ok {
+		sp.write(sp.size, val)
+		if sp.full() {
+			e.value = sp.bytes()
+		}
+		e.touch()
+		s.changed(keyStr)
+		return sp.size, nil
+	}
+
+	/*
+		Appending turns the value into a plain string, like Redis' raw encoding
+		It's written into the spare capacity when there's enough; readers only
+		ever see the stored bytes up to their length at the time they read
+		Shared integer slices are capped, so they always get a new buffer
+	*/
+	updated := e.stringBytes()
+	if cap(updated) < length {
+		grown := make([]byte, len(updated), s.appendCapacity(length))
+		copy(grown, updated)
+		updated = grown
+	}
+	updated = append(updated, val...)
+	s.countCompressed(e, -1)
+	e.value = updated
+	e.touch()
+	s.changed(keyStr)
+	return len(updated), nil
+}
+
+/*
+appendPreallocLimit is the length up to which APPEND doubles a string's
+capacity; longer strings grow by a quarter
+*/
+const appendPreallocLimit = 1 << 20
+
+/*
+appendCapacity returns the capacity to give a string APPEND grows to length
+
+Short strings get twice what they need, like Redis. Redis then adds a
+fixed megabyte, which makes building a huge string quadratic; growing by
+a quarter keeps it linear while wasting at most a fifth of the buffer.
+The capacity never exceeds the longest string a write may create.
+*/
+func (s *Storage) appendCapacity(length int) int {
+	capacity := length + length/4
+	if length < appendPreallocLimit {
+		capacity = length * 2
 	}
 
-	s.data[keyStr] = append(existing, val...)
-	return len(s.data[keyStr])
+	longest := respMaxBulkLength
+	if l := s.limits.Load(); l != nil && l.MaxStringSize > 0 {
+		longest = min(longest, l.MaxStringSize)
+	}
+	return max(length, min(capacity, longest))
 }
 
 /*
 Strlen returns the length of a string value
 
 Implements Redis STRLEN command. Returns the length of the value stored at key.
-Returns 0 if key doesn't exist or has expired.
+Returns 0 if key doesn't exist or has expired, and ErrWrongType if it
+holds another type.
 */
-func (s *Storage) Strlen(key []byte) int {
+func (s *Storage) Strlen(key []byte) (int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	keyStr := string(key)
-
-	if expTime, exists := s.expiry[keyStr]; exists {
-		if time.Now().After(expTime) {
-			return 0
-		}
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return 0, nil
 	}
-
-	if val, exists := s.data[keyStr]; exists {
-		return len(val)
+	if e.valueType() != TypeString {
+		return 0, ErrWrongType
 	}
+	e.touch()
+	return e.stringLen(), nil
+}
 
-	return 0
+/*
+stringLen returns the length of a string value, without rendering,
+decompressing or filling it in
+*/
+func (e *entry) stringLen() int {
+	switch v := e.value.(type) {
+	case int64:
+		// Count the digits of integer-encoded values without rendering them
+		var digits [20]byte
+		return len(strconv.AppendInt(digits[:0], v, 10))
+	case *compressedString:
+		return v.size
+	case *sparseString:
+		return v.size
+	}
+	return len(e.stringBytes())
 }
 
 /*
@@ -232,30 +665,27 @@ Parameters:
   - start: Starting index (inclusive)
   - end: Ending index (inclusive)
 
-Returns: The substring as byte slice
+Returns: The substring as byte slice, or ErrWrongType if the key holds
+another type
 */
-func (s *Storage) GetRange(key []byte, start, end int) []byte {
+func (s *Storage) GetRange(key []byte, start, end int) ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	keyStr := string(key)
-
-	if expTime, exists := s.expiry[keyStr]; exists {
-		if time.Now().After(expTime) {
-			return []byte{}
-		}
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return []byte{}, nil
+	}
+	if e.valueType() != TypeString {
+		return nil, ErrWrongType
 	}
+	e.touch()
 
 	/*
 		Handle negative indices - Redis supports counting from the end
 		Example: -1 means last character, -2 means second to last, etc.
 	*/
-	val, exists := s.data[keyStr]
-	if !exists {
-		return []byte{}
-	}
-
-	length := len(val)
+	length := e.stringLen()
 
 	if start < 0 {
 		start = length + start
@@ -272,11 +702,16 @@ func (s *Storage) GetRange(key []byte, start, end int) []byte {
 		end = length - 1
 	}
 	if start > end {
-		return []byte{}
+		return []byte{}, nil
+	}
+
+	// Sparse strings copy just the range out of their pages
+	if sp, ok := e.value.(*sparseString); ok {
+		return sp.slice(start, end+1), nil
 	}
 
 	// Return the substring - end+1 because slice is exclusive on the right
-	return val[start : end+1]
+	return s.readBytes(e.stringBytes()[start : end+1]), nil
 }
 
 /*
@@ -284,44 +719,107 @@ SetRange overwrites part of a string at offset
 
 Implements Redis SETRANGE command. Overwrites part of the string stored at key,
 starting at the specified offset, for the length of the value.
-If the key doesn't exist, creates it with padding if necessary.
+If the key doesn't exist, creates it with padding if necessary. Like Redis,
+an empty value changes nothing, and a string padded with a megabyte of
+zeros or more is stored sparse (see sparse.go).
 
 Parameters:
   - key: The key to modify
   - offset: Starting position to overwrite
   - value: The new value to write at that position
 
-Returns: The length of the string after modification
+Returns: The length of the string after modification, or an error:
+ErrWrongType if the key holds another type, or a size limit (see
+limits.go) or the longest bulk string (proto-max-bulk-len) the string
+written would exceed
 */
-func (s *Storage) SetRange(key []byte, offset int, value []byte) int {
+func (s *Storage) SetRange(key []byte, offset int, value []byte) (int, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, err
+	}
+	if len(value) > 0 {
+		// Written this way, huge offsets can't overflow
+		if offset > respMaxBulkLength-len(value) {
+			return 0, errBulkTooLarge
+		}
+		if err := s.checkString(offset + len(value)); err != nil {
+			return 0, err
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	keyStr := string(key)
-	existing, exists := s.data[keyStr]
+	e := s.lookupWrite(keyStr)
+	if e != nil && e.valueType() != TypeString {
+		return 0, ErrWrongType
+	}
+
+	// Nothing to write: report the length, without creating or padding the key
+	if len(value) == 0 {
+		if e == nil {
+			return 0, nil
+		}
+		return e.stringLen(), nil
+	}
+
+	var existing []byte
+	if e != nil {
+		// Sparse strings are written page by page, in place
+		if sp, ok := e.value.(*sparseString); ok {
+			sp.write(offset, value)
+			if sp.full() {
+				e.value = sp.bytes()
+			}
+			e.touch()
+			s.changed(keyStr)
+			return sp.size, nil
+		}
+
+		existing = e.stringBytes()
 
-	if !exists {
 		/*
-			Create new string with null padding if offset > 0
-			Redis pads with null bytes when setting at an offset beyond string length
+			Integer-encoded values may be backed by the shared integer table,
+			so take a private copy before overwriting anything in place
 		*/
-		if offset > 0 {
-			existing = make([]byte, offset)
+		if _, isInt := e.value.(int64); isInt {
+			existing = append([]byte(nil), existing...)
 		}
 	}
 
-	// Extend existing string if the new value would go beyond current length
-	requiredLength := offset + len(value)
-	if len(existing) < requiredLength {
-		newBytes := make([]byte, requiredLength)
-		copy(newBytes, existing)
-		existing = newBytes
+	var updated any
+	if offset-len(existing) >= sparseMinGap {
+		// Padding this long would be mostly zeros, so it's left unallocated
+		sp := newSparseString(existing)
+		sp.write(offset, value)
+		updated = sp
+	} else {
+		/*
+			Extend the string if the new value would go beyond its length
+			Redis pads with null bytes when setting at an offset beyond it
+		*/
+		requiredLength := offset + len(value)
+		if len(existing) < requiredLength {
+			newBytes := make([]byte, requiredLength)
+			copy(newBytes, existing)
+			existing = newBytes
+		}
+		copy(existing[offset:], value)
+		updated = existing
 	}
 
-	copy(existing[offset:], value)
-	s.data[keyStr] = existing
+	if e == nil {
+		e = newEntry(updated)
+		s.putEntry(keyStr, e)
+	} else {
+		s.countCompressed(e, -1)
+		e.value = updated
+		e.touch()
+	}
 
-	return len(existing)
+	s.changed(keyStr)
+	return e.stringLen(), nil
 }
 
 /*
@@ -349,8 +847,9 @@ func (s *Storage) Decr(key []byte) (int64, error) {
 IncrBy increments the integer value of a key by the given amount
 
 Implements Redis INCRBY command. This is the core increment operation.
-If the key exists, parses its value as integer and adds the increment.
+If the key exists, adds the increment to its integer value.
 If key doesn't exist, creates it with the increment value.
+The key keeps its TTL, if any.
 
 This operation is atomic - the read, modify, write sequence is protected by mutex.
 
@@ -358,27 +857,45 @@ Parameters:
   - key: The key to increment
   - increment: Amount to add (can be negative for decrement)
 
-Returns: The new value after increment, or error if existing value is not an integer
+Returns: The new value after increment, or error if the key holds another
+type, its value is not an integer or the result would overflow a 64-bit
+integer
 */
 func (s *Storage) IncrBy(key []byte, increment int64) (int64, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	keyStr := string(key)
 
-	if val, exists := s.data[keyStr]; exists {
-		intVal, err := strconv.ParseInt(string(val), 10, 64)
-		if err != nil {
-			return 0, err
+	if e := s.lookupWrite(keyStr); e != nil {
+		if e.valueType() != TypeString {
+			return 0, ErrWrongType
+		}
+
+		// Integer-encoded values are already parsed; anything else isn't a number
+		intVal, isInt := e.value.(int64)
+		if !isInt {
+			return 0, errNotInteger
+		}
+
+		// Refuse to wrap around instead of silently overflowing int64
+		if (increment > 0 && intVal > math.MaxInt64-increment) ||
+			(increment < 0 && intVal < math.MinInt64-increment) {
+			return 0, errOverflow
 		}
 		intVal += increment
-		s.data[keyStr] = []byte(strconv.FormatInt(intVal, 10))
-		s.counters[keyStr] = intVal
+		e.value = intVal
+		e.touch()
+		s.changed(keyStr)
 		return intVal, nil
 	}
 
-	s.data[keyStr] = []byte(strconv.FormatInt(increment, 10))
-	s.counters[keyStr] = increment
+	s.putEntry(keyStr, newEntry(increment))
+	s.changed(keyStr)
 	return increment, nil
 }
 
@@ -398,19 +915,35 @@ Implements Redis GETSET command. This is an atomic read-modify operation.
 It's useful for implementing counters, flags, or other patterns where you need
 the previous value while setting a new one.
 
-Returns: The old value and whether the key existed before the operation
+Returns: The old value and whether the key existed before the operation,
+or an error: ErrWrongType if the key holds another type (it's left
+as it is), or a size limit that was exceeded (see limits.go)
 */
-func (s *Storage) GetSet(key, val []byte) ([]byte, bool) {
+func (s *Storage) GetSet(key, val []byte) ([]byte, bool, error) {
+	if err := s.checkStringWrite(key, len(val)); err != nil {
+		return nil, false, err
+	}
+	e := s.stringEntry(val)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	keyStr := string(key)
-	oldVal, exists := s.data[keyStr]
-	s.data[keyStr] = val
 
-	delete(s.expiry, keyStr)
+	var oldVal []byte
+	old := s.lookupWrite(keyStr)
+	if old != nil {
+		if old.valueType() != TypeString {
+			return nil, false, ErrWrongType
+		}
+		oldVal = old.stringBytes()
+	}
+
+	s.putEntry(keyStr, e)
+	s.changed(keyStr)
 
-	return oldVal, exists
+	// Integer-encoded values may come from the shared table, which stays read-only
+	return s.readBytes(oldVal), old != nil, nil
 }
 
 /*
@@ -421,7 +954,8 @@ This is more efficient than multiple individual GET operations.
 
 Parameters: keys: Slice of keys to retrieve
 
-Returns: Slice of values in the same order as keys (nil for non-existent/expired keys)
+Returns: Slice of values in the same order as keys (nil for non-existent/expired
+keys and for keys holding a non-string value)
 */
 func (s *Storage) MGet(keys [][]byte) [][]byte {
 	s.mu.RLock()
@@ -429,23 +963,19 @@ func (s *Storage) MGet(keys [][]byte) [][]byte {
 
 	results := make([][]byte, len(keys))
 	for i, key := range keys {
-		keyStr := string(key)
-
-		if expTime, exists := s.expiry[keyStr]; exists {
-			if time.Now().After(expTime) {
-				results[i] = nil
-				continue
-			}
+		e := s.lookupRead(string(key))
+		if e == nil {
+			results[i] = nil
+			continue
 		}
 
-		if val, exists := s.data[keyStr]; exists {
-			results[i] = val
-		} else {
-			results[i] = nil
+		results[i] = e.stringBytes()
+		if results[i] != nil {
+			e.touch()
 		}
 	}
 
-	return results
+	return s.readSlices(results)
 }
 
 /*
@@ -458,29 +988,41 @@ all keys are set together or none at all.
 Parameters: pairs: Map of key-value pairs to set
 */
 func (s *Storage) MSet(pairs map[string][]byte) error {
+	entries := make(map[string]*entry, len(pairs))
+	for key, val := range pairs {
+		if err := s.checkStringWrite([]byte(key), len(val)); err != nil {
+			return err
+		}
+		entries[key] = s.stringEntry(val)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for key, val := range pairs {
-		s.data[key] = val
-		delete(s.expiry, key)
+	for key, e := range entries {
+		s.preserve(key)
+		s.putEntry(key, e)
+		s.changed(key)
 	}
 
 	return nil
 }
 
 /*
-Keys returns all keys matching a pattern (simple * wildcard support)
+Keys returns all keys matching a glob-style pattern
 
 Implements Redis KEYS command. Returns all keys that match the given pattern.
 WARNING: This operation scans all keys and can be slow with large datasets.
 In production Redis, this command is often disabled or discouraged.
 
-Pattern matching rules:
-  - "*" matches all keys
-  - "prefix*" matches keys starting with "prefix"
-  - "*suffix" matches keys ending with "suffix"
-  - "prefix*suffix" matches keys starting with "prefix" and ending with "suffix"
+Pattern matching rules (see matchPattern):
+  - "*" matches any sequence of characters, "?" any single character
+  - "[abc]", "[^abc]" and "[a-z]" match one character from a set
+  - "\" escapes the next character
+
+The keys are listed the way a snapshot lists them (see snapshot.go),
+with the read lock held only for that; the pattern is matched after it's
+released.
 
 Parameters: pattern: The pattern to match against
 
@@ -488,25 +1030,28 @@ Returns: Slice of matching key names
 */
 func (s *Storage) Keys(pattern string) []string {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var keys []string
-
-	for key := range s.data {
-		if expTime, exists := s.expiry[key]; exists {
-			if time.Now().After(expTime) {
-				continue
-			}
-		}
+	items := s.liveKeys()
+	s.mu.RUnlock()
 
-		if matchPattern(key, pattern) {
-			keys = append(keys, key)
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		if pattern == "*" || matchPattern(item.key, pattern) {
+			keys = append(keys, item.key)
 		}
 	}
-
 	return keys
 }
 
+/*
+Len returns the number of keys, including expired keys not removed yet
+*/
+func (s *Storage) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.entries)
+}
+
 /*
 FlushAll removes all keys
 
@@ -518,72 +1063,318 @@ func (s *Storage) FlushAll() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.data = make(map[string][]byte)
-	s.expiry = make(map[string]time.Time)
-	s.counters = make(map[string]int64)
+	if len(s.snapshots.open) > 0 {
+		for keyStr := range s.entries {
+			s.preserve(keyStr)
+		}
+	}
+	flushed := s.entries
+	s.entries = make(map[string]*entry)
+	s.scanKeys = scanIndex{}
+	s.compressed = CompressionStats{}
+	clear(s.hashesWithTTL)
+
+	if len(s.hooks) > 0 {
+		for keyStr := range flushed {
+			s.fire(HookDelete, keyStr)
+		}
+	}
+}
+
+/*
+Encoding returns the name of the internal representation of the value at key
+
+Implements Redis OBJECT ENCODING. Each type has a single representation
+whatever its size, so apart from strings the name only depends on the
+type; there are no compact encodings for small collections like Redis'
+listpack and intset:
+  - "int": strings holding a 64-bit integer, stored as an int64
+  - "raw": other strings, stored as a byte slice
+  - "compressed": strings stored compressed (see compression.go)
+  - "sparse": strings stored in pages (see sparse.go)
+  - "array": lists, a slice with spare room at both ends (see lists.go)
+  - "hashtable": sets and hashes, held in maps
+  - "skiplist": sorted sets, a map and a skiplist (see skiplist.go)
+
+Returns: The encoding name and whether the key exists
+*/
+func (s *Storage) Encoding(key []byte) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return "", false
+	}
+	return e.encoding(), true
 }
 
 /*
-matchPattern provides simple pattern matching with * wildcard
+encoding returns the name of the representation of the entry's value (see Storage.Encoding)
+*/
+func (e *entry) encoding() string {
+	switch e.value.(type) {
+	case int64:
+		return "int"
+	case *compressedString:
+		return "compressed"
+	case *sparseString:
+		return "sparse"
+	case *listValue:
+		return "array"
+	case *setValue, *hashValue:
+		return "hashtable"
+	case *zsetValue:
+		return "skiplist"
+	}
+	return "raw"
+}
 
-This is a helper function that implements basic glob-style pattern matching.
-It supports the * wildcard which matches any sequence of characters.
+/*
+RefCount returns the reference count of the value at key
 
-Algorithm:
-1. If pattern is "*", match everything
-2. If pattern has no wildcards, do exact match
-3. If pattern has wildcards, split by * and check each part exists in order
+Implements Redis OBJECT REFCOUNT. Integers served from the shared small
+integer table report sharedRefCount; every other value is owned by its
+key alone.
 
-Parameters:
-  - key: The string to test
-  - pattern: The pattern to match against
+Returns: The reference count and whether the key exists
+*/
+func (s *Storage) RefCount(key []byte) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-Returns: true if key matches pattern, false otherwise
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return 0, false
+	}
+	return e.refCount(), true
+}
 
-Examples:
-  - matchPattern("hello", "*") -> true
-  - matchPattern("hello", "hello") -> true
-  - matchPattern("hello", "h*o") -> true
-  - matchPattern("hello", "h*x") -> false
+/*
+refCount returns the reference count of the entry's value (see Storage.RefCount)
 */
-func matchPattern(key, pattern string) bool {
-	if pattern == "*" {
-		return true
+func (e *entry) refCount() int {
+	if n, isInt := e.value.(int64); isInt && n >= 0 && n < sharedIntegersCount {
+		return sharedRefCount
 	}
+	return 1
+}
 
-	// No wildcards: exact match
-	if !strings.Contains(pattern, "*") {
-		return key == pattern
+/*
+IdleTime returns how long ago the key was last read or written
+
+Implements Redis OBJECT IDLETIME. Introspection commands (EXISTS, TYPE, OBJECT)
+don't count as an access, so looking at a key doesn't reset its idle time.
+
+Returns: The idle duration and whether the key exists
+*/
+func (s *Storage) IdleTime(key []byte) (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return 0, false
 	}
 
-	// Split pattern by * and match each part in sequence
-	parts := strings.Split(pattern, "*")
-	keyIndex := 0
+	return time.Since(time.Unix(0, e.lastAccess.Load())), true
+}
 
-	for i, part := range parts {
-		if part == "" {
-			continue
+/*
+DebugObject describes the internals of the value at key
+
+Implements DEBUG OBJECT, in the format Redis uses:
+
+	Value at:0xc000010000 refcount:1 encoding:raw serializedlength:5 lru:1234567 lru_seconds_idle:3
+
+There's no RDB format here, so serializedlength is the size of the
+payload (string bytes, or the sum of the elements' sizes) rather than the
+size Redis would write to disk. lru is the last access in seconds, on a
+24-bit clock like Redis' LRU clock.
+
+Returns: The description and whether the key exists
+*/
+func (s *Storage) DebugObject(key []byte) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	if e == nil {
+		return "", false
+	}
+
+	lastAccess := time.Unix(0, e.lastAccess.Load())
+	return fmt.Sprintf("Value at:%p refcount:%d encoding:%s serializedlength:%d lru:%d lru_seconds_idle:%d",
+		e, e.refCount(), e.encoding(), payloadSize(e.value), lastAccess.Unix()&(1<<24-1),
+		int64(time.Since(lastAccess)/time.Second)), true
+}
+
+/*
+payloadSize returns the number of data bytes held by a value
+*/
+func payloadSize(value any) int {
+	size := 0
+	switch v := value.(type) {
+	case int64:
+		size = len(integerBytes(v))
+	case []byte:
+		size = len(v)
+	case *compressedString:
+		size = v.size
+	case *sparseString:
+		size = v.size
+	case *listValue:
+		for _, item := range v.items {
+			size += len(item)
+		}
+	case *setValue:
+		for _, member := range v.members {
+			size += len(member)
 		}
+	case *hashValue:
+		for field, value := range v.fields {
+			size += len(field) + len(value)
+		}
+	case *zsetValue:
+		// Members plus their scores, stored as 8-byte doubles
+		for n := v.sorted.first(); n != nil; n = n.next() {
+			size += len(n.item.member) + 8
+		}
+	}
+	return size
+}
 
-		// Find this part in the remaining portion of the key
-		index := strings.Index(key[keyIndex:], part)
-		if index == -1 {
-			return false
+/*
+matchPattern reports whether key matches a Redis glob-style pattern
+
+This is the matcher behind KEYS and pattern subscriptions (PSUBSCRIBE).
+It supports the same syntax as Redis:
+  - "*" matches any sequence of characters, including none
+  - "?" matches exactly one character
+  - "[abc]" matches one of the listed characters, "[^abc]" one that isn't
+    listed, and "[a-z]" one in the range
+  - "\" escapes the next character, so "\*" matches a literal "*"
+
+Matching works on bytes. The last "*" seen is remembered so a mismatch can
+retry with that star swallowing one more character; since every other
+token consumes exactly one character, that one backtrack point is enough
+and matching stays O(len(key) * len(pattern)) even for patterns like
+"*a*a*a*b".
+
+Examples:
+  - matchPattern("hello", "*") -> true
+  - matchPattern("hello", "h?llo") -> true
+  - matchPattern("hello", "h[a-e]llo") -> true
+  - matchPattern("hello", "h[^e]llo") -> false
+*/
+func matchPattern(key, pattern string) bool {
+	p, k := 0, 0
+	starP, starK := -1, 0
+
+	for k < len(key) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starK = p, k
+				p++
+				continue
+			case '?':
+				p++
+				k++
+				continue
+			case '[':
+				if next, ok := matchClass(pattern, p, key[k]); ok {
+					p = next
+					k++
+					continue
+				}
+			default:
+				// A trailing backslash has nothing to escape and matches itself
+				literal := p
+				if pattern[p] == '\\' && p+1 < len(pattern) {
+					literal++
+				}
+				if pattern[literal] == key[k] {
+					p = literal + 1
+					k++
+					continue
+				}
+			}
 		}
 
-		// First part must match from the beginning (unless pattern starts with *)
-		if i == 0 && index != 0 {
+		// Mismatch: let the last star swallow one more character, if there is one
+		if starP < 0 {
 			return false
 		}
+		starK++
+		p, k = starP+1, starK
+	}
 
-		keyIndex += index + len(part)
+	// The key is consumed; only stars may be left in the pattern
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
 	}
+	return p == len(pattern)
+}
+
+/*
+matchClass matches c against the character class that starts at pattern[p]
+
+Like Redis, a class without its closing "]" runs to the end of the pattern.
+
+Returns: The pattern position after the class, and whether c is in it
+*/
+func matchClass(pattern string, p int, c byte) (int, bool) {
+	i := p + 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	matched := false
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			matched = matched || pattern[i] == c
+		case i+2 < len(pattern) && pattern[i+1] == '-':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (c >= lo && c <= hi)
+			i += 2
+		default:
+			matched = matched || pattern[i] == c
+		}
+	}
+	if i < len(pattern) {
+		i++ // skip the closing ]
+	}
+
+	return i, matched != negate
+}
+
+/*
+fuzzMatchPattern runs matchPattern on random patterns and strings
+
+Implements DEBUG STRINGMATCH-LEN, Redis' fuzz tester for its glob matcher.
+The alphabet favors the characters with a special meaning, so unbalanced
+brackets, dangling escapes and long runs of stars all get exercised; a
+matcher bug shows up as a panic or a hang.
+*/
+func fuzzMatchPattern(rounds int) {
+	const alphabet = `*?[]^-\abc`
 
-	// If pattern ends with *, we're done (anything can follow)
-	if strings.HasSuffix(pattern, "*") {
-		return true
+	random := func(n int) string {
+		b := make([]byte, rand.IntN(n+1))
+		for i := range b {
+			b[i] = alphabet[rand.IntN(len(alphabet))]
+		}
+		return string(b)
 	}
 
-	// Otherwise, key must end exactly where we finished matching
-	return keyIndex == len(key)
+	for range rounds {
+		matchPattern(random(32), random(32))
+	}
 }
@@ -0,0 +1,180 @@
+package goredis_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/debarshee2004/goredis"
+)
+
+func TestStorageCopiesWrites(t *testing.T) {
+	storage := goredis.NewStorage()
+	value := []byte("hello")
+	storage.Set([]byte("greeting"), value)
+	copy(value, "HELLO")
+
+	if got, _, _ := storage.Get([]byte("greeting")); string(got) != "hello" {
+		t.Errorf("after modifying the written slice: got %q, want %q", got, "hello")
+	}
+}
+
+func TestStorageSharesReadsByDefault(t *testing.T) {
+	storage := goredis.NewStorage()
+	storage.Set([]byte("greeting"), []byte("hello"))
+
+	first, _, _ := storage.Get([]byte("greeting"))
+	second, _, _ := storage.Get([]byte("greeting"))
+	if &first[0] != &second[0] {
+		t.Error("two reads returned different copies, want the stored bytes shared")
+	}
+
+	// Shared bytes are capped, so appending to them copies
+	_ = append(first, " world"...)
+	if got, _, _ := storage.Get([]byte("greeting")); string(got) != "hello" {
+		t.Errorf("after appending to a read: got %q, want %q", got, "hello")
+	}
+}
+
+func TestSetCopyOnRead(t *testing.T) {
+	storage := goredis.NewStorage()
+	storage.SetCopyOnRead(true)
+
+	storage.Set([]byte("greeting"), []byte("hello"))
+	storage.Push([]byte("list"), [][]byte{[]byte("a"), []byte("b")}, false)
+	storage.HSet([]byte("user"), [][]byte{[]byte("name"), []byte("ann")})
+
+	tests := []struct {
+		name string
+		read func() [][]byte
+	}{
+		{"Get", func() [][]byte {
+			value, _, _ := storage.Get([]byte("greeting"))
+			return [][]byte{value}
+		}},
+		{"MGet", func() [][]byte { return storage.MGet([][]byte{[]byte("greeting")}) }},
+		{"LRange", func() [][]byte {
+			values, _ := storage.LRange([]byte("list"), 0, -1)
+			return values
+		}},
+		{"HGet", func() [][]byte {
+			value, _, _ := storage.HGet([]byte("user"), []byte("name"))
+			return [][]byte{value}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := bytes.Join(tt.read(), []byte(","))
+			for _, value := range tt.read() {
+				for i := range value {
+					value[i] = 'X'
+				}
+			}
+			if after := bytes.Join(tt.read(), []byte(",")); !bytes.Equal(after, before) {
+				t.Errorf("after modifying a read: got %q, want %q", after, before)
+			}
+		})
+	}
+
+	// Turning it off shares the stored bytes again
+	storage.SetCopyOnRead(false)
+	first, _, _ := storage.Get([]byte("greeting"))
+	second, _, _ := storage.Get([]byte("greeting"))
+	if &first[0] != &second[0] {
+		t.Error("SetCopyOnRead(false): reads returned copies, want the stored bytes shared")
+	}
+}
+
+func TestStorageStringOpsRejectOtherTypes(t *testing.T) {
+	storage := goredis.NewStorage()
+	key := []byte("list")
+	storage.Push(key, [][]byte{[]byte("a"), []byte("b")}, false)
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"Get", func() error { _, _, err := storage.Get(key); return err }},
+		{"Append", func() error { _, err := storage.Append(key, []byte("c")); return err }},
+		{"SetRange", func() error { _, err := storage.SetRange(key, 0, []byte("c")); return err }},
+		{"GetRange", func() error { _, err := storage.GetRange(key, 0, -1); return err }},
+		{"Strlen", func() error { _, err := storage.Strlen(key); return err }},
+		{"IncrBy", func() error { _, err := storage.IncrBy(key, 1); return err }},
+		{"GetSet", func() error { _, _, err := storage.GetSet(key, []byte("c")); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); !errors.Is(err, goredis.ErrWrongType) {
+				t.Errorf("got %v, want ErrWrongType", err)
+			}
+			values, err := storage.LRange(key, 0, -1)
+			if got := bytes.Join(values, []byte(",")); err != nil || string(got) != "a,b" {
+				t.Errorf("list after %s: got %q, %v, want \"a,b\"", tt.name, got, err)
+			}
+		})
+	}
+}
+
+func TestStorageListBothEnds(t *testing.T) {
+	storage := goredis.NewStorage()
+	key := []byte("queue")
+	var want []string
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for i := range 5000 {
+		value := fmt.Appendf(nil, "%d", i)
+		switch op := rng.IntN(10); {
+		case op < 3:
+			storage.Push(key, [][]byte{value, value}, true)
+			want = append([]string{string(value), string(value)}, want...)
+		case op < 5:
+			storage.Push(key, [][]byte{value}, false)
+			want = append(want, string(value))
+		case op < 7:
+			storage.Pop(key, 1, true)
+			want = want[min(1, len(want)):]
+		case op < 9:
+			storage.Pop(key, 1, false)
+			want = want[:max(0, len(want)-1)]
+		case len(want) > 0:
+			pivot := want[len(want)/2]
+			storage.LInsert(key, true, []byte(pivot), value)
+			i := slices.Index(want, pivot)
+			want = slices.Insert(want, i, string(value))
+		}
+
+		values, _ := storage.LRange(key, 0, -1)
+		got := make([]string, len(values))
+		for i, value := range values {
+			got[i] = string(value)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("after %d operations: got %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestStorageLPushIsAmortized(t *testing.T) {
+	storage := goredis.NewStorage()
+	key := []byte("queue")
+	values := [][]byte{[]byte("x")}
+	for range 100000 {
+		storage.Push(key, values, true)
+	}
+
+	// Copying the list on every push would allocate 100000 pointers each time
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for range 1000 {
+		storage.Push(key, values, true)
+		storage.Pop(key, 1, false)
+	}
+	runtime.ReadMemStats(&after)
+	if perOp := (after.TotalAlloc - before.TotalAlloc) / 1000; perOp > 4096 {
+		t.Errorf("LPUSH + RPOP on a long list allocates %d bytes, want the list array reused", perOp)
+	}
+}
@@ -0,0 +1,136 @@
+package goredis
+
+import (
+	"bytes"
+	"strconv"
+)
+
+/*
+Streamed Replies for Redis Clone
+
+LRANGE, SMEMBERS and HGETALL on collections of millions of elements make
+replies of hundreds of megabytes. Built in parts (see replies.go), such a
+reply holds a copy of every element until it's written. Instead, these
+commands take references to the elements under the read lock, and the
+peer's writer formats the reply a chunk at a time into one reused buffer
+while it writes it, so the extra memory is the references plus one chunk.
+
+Key concepts:
+- References: The elements of lists and hash values are never changed in
+  place (LSET and HSET store new slices), and set members and hash fields
+  are strings, so references taken under the lock keep the values of the
+  moment the command ran
+- Chunks: The writer asks the stream for up to 64 KB at a time; elements
+  of 16 KB or more are written straight from the reference
+- Small Replies: A stream that fits in one chunk is copied into the
+  writer's batch, so pipelined small LRANGEs still share one write
+- Ordering: A streamed reply is written after the replies queued before
+  it and before the ones queued after it (see Peer.writeLoop)
+- Middleware: Middleware sees replies whole, so while any is registered
+  these commands build their replies in one piece (see dispatch)
+*/
+
+/*
+replyStream is a reply produced a piece at a time as it's written
+*/
+type replyStream interface {
+	// next appends the next piece of the reply to buf, or returns nil once
+	// the reply is complete; a piece may also be an element itself, which
+	// must not be modified
+	next(buf []byte) []byte
+
+	// done reports whether every piece has been returned
+	done() bool
+}
+
+/*
+streamCommand is implemented by commands whose replies can be huge
+
+ExecuteStream does what Execute does, returning the reply as a stream.
+*/
+type streamCommand interface {
+	Command
+	ExecuteStream(storage *Storage) (replyStream, error)
+}
+
+/*
+arrayStream streams an array of bulk strings, element i being item(i)
+*/
+type arrayStream struct {
+	count  int
+	item   func(i int) []byte
+	index  int    // the next element to write, -1 before the header
+	large  []byte // an element to return as its own piece, after its header
+	closed bool   // the final CRLF of large is still due
+}
+
+/*
+newArrayStream streams count elements returned by item
+*/
+func newArrayStream(count int, item func(i int) []byte) *arrayStream {
+	return &arrayStream{count: count, item: item, index: -1}
+}
+
+/*
+next appends elements to buf until it holds a chunk
+*/
+func (a *arrayStream) next(buf []byte) []byte {
+	if a.large != nil {
+		large := a.large
+		a.large = nil
+		return large
+	}
+	if a.closed {
+		a.closed = false
+		buf = append(buf, '\r', '\n')
+	}
+	if a.index < 0 {
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(a.count), 10)
+		buf = append(buf, '\r', '\n')
+		a.index = 0
+	}
+
+	for a.index < a.count && len(buf) < replyChunkSize {
+		item := a.item(a.index)
+		a.index++
+
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(item)), 10)
+		buf = append(buf, '\r', '\n')
+		if len(item) >= replyLargeElement {
+			// Written from the reference, and followed by its CRLF in the next chunk
+			a.large, a.closed = item, true
+			return buf
+		}
+		buf = append(buf, item...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	if len(buf) == 0 {
+		return nil
+	}
+	return buf
+}
+
+/*
+done reports whether the whole array has been returned
+*/
+func (a *arrayStream) done() bool {
+	return a.index >= a.count && a.large == nil && !a.closed
+}
+
+/*
+joinStream returns a streamed reply in one piece, for Execute
+*/
+func joinStream(stream replyStream, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	var reply bytes.Buffer
+	buf := make([]byte, 0, replyChunkSize)
+	for piece := stream.next(buf[:0]); piece != nil; piece = stream.next(buf[:0]) {
+		reply.Write(piece)
+	}
+	return reply.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+package goredis_test
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+bulkElements splits an array reply of bulk strings into its elements
+*/
+func bulkElements(t *testing.T, reply string) []string {
+	t.Helper()
+
+	header, rest, _ := strings.Cut(reply, "\r\n")
+	n, err := strconv.Atoi(header[1:])
+	if err != nil || header[0] != '*' {
+		t.Fatalf("reply %.40q is not an array", reply)
+	}
+	elements := make([]string, 0, n)
+	for range n {
+		header, rest, _ = strings.Cut(rest, "\r\n")
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || header[0] != '$' || len(rest) < size+2 {
+			t.Fatalf("element %d of the reply is malformed: %.40q", len(elements), header)
+		}
+		elements = append(elements, rest[:size])
+		rest = rest[size+2:]
+	}
+	if rest != "" {
+		t.Fatalf("%d bytes after the last element", len(rest))
+	}
+	return elements
+}
+
+/*
+streamedElement returns element i of the collections the streaming tests
+build: mostly small, with some larger than a part of their own
+*/
+func streamedElement(i int) string {
+	if i%100 == 0 {
+		return strconv.Itoa(i) + strings.Repeat("x", 20<<10)
+	}
+	return fmt.Sprintf("element:%d", i)
+}
+
+func TestStreamedRepliesLargerThanTheOutputBuffer(t *testing.T) {
+	const n = 20000
+	var want []string
+	list := make([][]byte, n)
+	pairs := make([][]byte, 0, 2*n)
+	for i := range n {
+		element := streamedElement(i)
+		want = append(want, element)
+		list[i] = []byte(element)
+		pairs = append(pairs, []byte("field:"+element), []byte(element))
+	}
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().Push([]byte("list"), list, false)
+		server.Storage().SAdd([]byte("set"), list)
+		server.Storage().HSet([]byte("hash"), pairs)
+	})
+	client := dial(t, server)
+
+	// Each reply is several megabytes, many times the output buffer, and the PING behind it waits its turn
+	client.pipeline([]string{"LRANGE", "list", "0", "-1"}, []string{"PING"})
+	if got := bulkElements(t, client.read()); !slices.Equal(got, want) {
+		t.Errorf("LRANGE returned %d elements, not the %d of the list in order", len(got), n)
+	}
+	if got := client.read(); got != "+PONG\r\n" {
+		t.Errorf("PING pipelined behind LRANGE got %q", got)
+	}
+
+	members := bulkElements(t, client.do("SMEMBERS", "set"))
+	slices.Sort(members)
+	sorted := slices.Sorted(slices.Values(want))
+	if !slices.Equal(members, sorted) {
+		t.Errorf("SMEMBERS returned %d members, not the %d of the set", len(members), n)
+	}
+
+	fields := bulkElements(t, client.do("HGETALL", "hash"))
+	for i := 0; i < len(fields); i += 2 {
+		if fields[i] != "field:"+fields[i+1] {
+			t.Fatalf("HGETALL pairs field %.40q with value %.40q", fields[i], fields[i+1])
+		}
+	}
+	if len(fields) != 2*n {
+		t.Errorf("HGETALL returned %d fields, want %d", len(fields)/2, n)
+	}
+}
+
+func TestStreamedReplyIsPointInTime(t *testing.T) {
+	const n = 20000
+	list := make([][]byte, n)
+	var want []string
+	for i := range n {
+		list[i] = []byte(streamedElement(i))
+		want = append(want, streamedElement(i))
+	}
+	server := startServer(t, func(server *goredis.Server) {
+		server.Storage().Push([]byte("list"), list, false)
+	})
+	reader := dial(t, server)
+	writer := dial(t, server)
+
+	// The reply is streamed while the list changes: it's the list as it was when LRANGE ran
+	reader.send("LRANGE", "list", "0", "-1")
+	reader.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := reader.reader.Peek(1); err != nil {
+		t.Fatalf("waiting for the LRANGE reply to start: %v", err)
+	}
+	writer.expect("+OK\r\n", "LSET", "list", "0", "changed")
+	writer.expect("+OK\r\n", "LTRIM", "list", "0", "9")
+	writer.expect(":11\r\n", "RPUSH", "list", "new")
+	writer.expect(":1\r\n", "DEL", "list")
+	if got := bulkElements(t, reader.read()); !slices.Equal(got, want) {
+		t.Errorf("LRANGE returned %d elements, not the %d the list held when it ran", len(got), n)
+	}
+}
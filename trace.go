@@ -0,0 +1,106 @@
+package goredis
+
+import "log/slog"
+
+/*
+Protocol Tracing for Redis Clone
+
+When a client library and the server disagree, the quickest way to see
+why is to look at the bytes. Tracing logs everything read from and
+written to selected clients, exactly as it went over the wire, including
+requests the parser rejects.
+
+Key concepts:
+- Selection: Clients are traced when their address ("127.0.0.1:51234") or
+  name (CLIENT SETNAME) matches a glob pattern, given with -trace at start
+  or changed at runtime with DEBUG TRACE; "*" traces everyone
+- Byte Level: Reads are logged as they come off the socket, so a command
+  may be split over several entries or several commands share one;
+  replies are logged one write at a time; the log handler quotes the
+  data, so \r\n and binary data stay visible
+- Bounded: Each entry shows at most 4KB of data, along with the full size
+- Cheap When Off: A client that isn't traced pays one atomic load per
+  read and write
+*/
+
+/*
+traceMaxDump is how many bytes of a read or write a trace entry shows
+*/
+const traceMaxDump = 4096
+
+/*
+traceSelects reports whether the trace pattern selects peer
+
+Must be called with s.mu held, from the server loop or before the peer
+is served (the client name is read from its session).
+*/
+func (s *Server) traceSelects(peer *Peer) bool {
+	if s.TracePattern == "" {
+		return false
+	}
+	if matchPattern(peer.connect.RemoteAddr().String(), s.TracePattern) {
+		return true
+	}
+	return peer.session.name != "" && matchPattern(peer.session.name, s.TracePattern)
+}
+
+/*
+setTracePattern changes which clients are traced, "" for none
+
+Connected clients are selected again right away. Called from the server
+loop (DEBUG TRACE).
+
+Returns: How many connected clients are now traced
+*/
+func (s *Server) setTracePattern(pattern string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.TracePattern = pattern
+	traced := 0
+	for peer := range s.peers {
+		selected := s.traceSelects(peer)
+		peer.trace.Store(selected)
+		if selected {
+			traced++
+		}
+	}
+	return traced
+}
+
+/*
+retrace selects peer again after its name changed; called from the server loop
+*/
+func (s *Server) retrace(peer *Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	peer.trace.Store(s.traceSelects(peer))
+}
+
+/*
+traceReader logs what a traced peer's reader gets from the connection
+*/
+type traceReader struct {
+	peer *Peer
+}
+
+func (r traceReader) Read(p []byte) (int, error) {
+	n, err := r.peer.connect.Read(p)
+	if n > 0 && r.peer.trace.Load() {
+		r.peer.traceData("in", p[:n])
+	}
+	return n, err
+}
+
+/*
+traceData logs one read ("in") or write ("out") of a traced peer
+*/
+func (p *Peer) traceData(direction string, data []byte) {
+	size := len(data)
+	if size > traceMaxDump {
+		data = data[:traceMaxDump]
+	}
+	slog.Info("trace", "remoteAddress", p.connect.RemoteAddr(), "direction", direction,
+		"size", size, "data", string(data))
+}
@@ -0,0 +1,88 @@
+package goredis_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+traceEntry is how the log shows one read or write of a traced client
+*/
+func traceEntry(client *testClient, direction, data string) string {
+	return fmt.Sprintf("trace remoteAddress=%s direction=%s size=%d data=%q",
+		client.conn.LocalAddr(), direction, len(data), data)
+}
+
+/*
+waitForLog waits for the log to hold entry; writes are logged after
+they're sent, so the reply may come before its entry
+*/
+func waitForLog(t *testing.T, logged *logBuffer, entry string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logged.String(), entry) {
+		if time.Now().After(deadline) {
+			t.Fatalf("log lacks %q:\n%.2000s", entry, logged.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTraceSelectsClients(t *testing.T) {
+	logged := captureLog(t)
+	server := startServer(t, nil)
+	admin := dial(t, server)
+	traced := dial(t, server)
+	other := dial(t, server)
+
+	// By address: only the selected client's bytes are logged, both ways
+	admin.expect(":1\r\n", "DEBUG", "TRACE", traced.conn.LocalAddr().String())
+	traced.expect("+PONG\r\n", "PING")
+	other.expect("+OK\r\n", "SET", "untraced", "x")
+	waitForLog(t, logged, traceEntry(traced, "in", "*1\r\n$4\r\nPING\r\n"))
+	waitForLog(t, logged, traceEntry(traced, "out", "+PONG\r\n"))
+	if strings.Contains(logged.String(), "trace remoteAddress="+other.conn.LocalAddr().String()) {
+		t.Errorf("log holds the traffic of a client that isn't traced:\n%.2000s", logged.String())
+	}
+
+	// Requests the parser rejects are logged as they came
+	if _, err := traced.conn.Write([]byte("*x\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, logged, traceEntry(traced, "in", "*x\r\n"))
+
+	// By name, picked up when the name is set
+	admin.expect(":0\r\n", "DEBUG", "TRACE", "worker-*")
+	other.expect("+OK\r\n", "CLIENT", "SETNAME", "worker-1")
+	other.expect("$1\r\nx\r\n", "GET", "untraced")
+	waitForLog(t, logged, traceEntry(other, "out", "$1\r\nx\r\n"))
+
+	// Off for everyone
+	admin.expect(":0\r\n", "DEBUG", "TRACE", "OFF")
+	before := len(logged.String())
+	other.expect("+OK\r\n", "SET", "after", "off")
+	time.Sleep(50 * time.Millisecond)
+	if after := logged.String()[before:]; strings.Contains(after, "trace remoteAddress=") {
+		t.Errorf("log holds traffic after DEBUG TRACE OFF:\n%.2000s", after)
+	}
+}
+
+func TestTraceShowsAtMost4KB(t *testing.T) {
+	logged := captureLog(t)
+	value := strings.Repeat("v", 10000)
+	server := startServer(t, func(server *goredis.Server) {
+		server.TracePattern = "*"
+		server.Storage().Set([]byte("big"), []byte(value))
+	})
+	client := dial(t, server)
+
+	reply := fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	client.expect(reply, "GET", "big")
+	entry := fmt.Sprintf("direction=out size=%d data=%q\n", len(reply), reply[:4096])
+	waitForLog(t, logged, entry)
+}
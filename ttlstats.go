@@ -0,0 +1,119 @@
+package goredis
+
+import (
+	"strconv"
+	"time"
+)
+
+/*
+TTL Statistics for Redis Clone
+
+INFO keyspace tells how many keys have a TTL and their average, which
+hides when they expire: a million keys set with the same EX at startup
+average the same as keys spread over a day, but they all expire in the
+same second and keep the active expire cycle busy. TTLSTATS counts the
+keys with a TTL by how long they have left, so operators can see such
+storms coming.
+
+Key concepts:
+- Buckets: Remaining TTLs are counted in buckets growing roughly tenfold,
+  up to 1s, 10s, 1m, 10m, 1h, 6h, 1d and 7d, then longer; each key counts
+  in the first bucket its TTL fits in
+- Pending: Keys whose TTL passed but that weren't removed yet are counted
+  apart; many of them mean the active expire cycle is falling behind (or
+  was turned off with DEBUG SET-ACTIVE-EXPIRE 0)
+- Cost: Like INFO keyspace, it visits the whole keyspace under the read
+  lock, so it's meant for occasional checks, not for every scrape
+- Reply: A flat array of names, each followed by an integer, like MEMORY
+  STATS
+*/
+
+/*
+ttlBucketLimits are the upper bounds of the TTL buckets, and their names
+in TTLSTATS; a last bucket counts the longer TTLs
+*/
+var ttlBucketLimits = []struct {
+	limit time.Duration
+	name  string
+}{
+	{time.Second, "1s"},
+	{10 * time.Second, "10s"},
+	{time.Minute, "1m"},
+	{10 * time.Minute, "10m"},
+	{time.Hour, "1h"},
+	{6 * time.Hour, "6h"},
+	{24 * time.Hour, "1d"},
+	{7 * 24 * time.Hour, "7d"},
+}
+
+/*
+TTLStats counts the keys with a TTL by the time they have left
+*/
+type TTLStats struct {
+	Keys    int   // keys stored, including expired keys not removed yet
+	Expires int   // keys with a TTL, pending ones included
+	Pending int   // keys whose TTL passed that weren't removed yet
+	Buckets []int // keys by remaining TTL, one per ttlBucketLimits and one for longer TTLs
+}
+
+/*
+TTLStats returns how the remaining TTLs of the keys are distributed
+
+Implements TTLSTATS. Visits the whole keyspace under the read lock.
+*/
+func (s *Storage) TTLStats() TTLStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := TTLStats{
+		Keys:    len(s.entries),
+		Buckets: make([]int, len(ttlBucketLimits)+1),
+	}
+
+	now := time.Now().UnixNano()
+	for _, e := range s.entries {
+		if e.expireAt == 0 {
+			continue
+		}
+		stats.Expires++
+		if e.expireAt <= now {
+			stats.Pending++
+			continue
+		}
+
+		remaining := time.Duration(e.expireAt - now)
+		bucket := 0
+		for bucket < len(ttlBucketLimits) && remaining > ttlBucketLimits[bucket].limit {
+			bucket++
+		}
+		stats.Buckets[bucket]++
+	}
+	return stats
+}
+
+/*
+respWriteTTLStats writes TTLSTATS' reply
+
+Example: keys.count 3, keys.with-ttl 2, expired.pending 0,
+ttl.<=1s 0, ttl.<=10s 1, ..., ttl.>7d 1
+*/
+func respWriteTTLStats(stats TTLStats) []byte {
+	buf := getRespBuffer()
+	fields := 0
+	field := func(name string, value int) {
+		buf.WriteString("$" + strconv.Itoa(len(name)) + "\r\n" + name + "\r\n")
+		buf.WriteString(":" + strconv.Itoa(value) + "\r\n")
+		fields++
+	}
+
+	field("keys.count", stats.Keys)
+	field("keys.with-ttl", stats.Expires)
+	field("expired.pending", stats.Pending)
+	for i, bucket := range ttlBucketLimits {
+		field("ttl.<="+bucket.name, stats.Buckets[i])
+	}
+	field("ttl.>"+ttlBucketLimits[len(ttlBucketLimits)-1].name, stats.Buckets[len(ttlBucketLimits)])
+
+	reply := releaseRespBuffer(buf)
+	return append([]byte("*"+strconv.Itoa(fields*2)+"\r\n"), reply...)
+}
@@ -0,0 +1,434 @@
+package goredis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+WebSocket Bridge for Redis Clone
+
+This file lets browser code talk to the server directly: when started with
+-websocketAddress, the server also accepts WebSocket connections (RFC 6455)
+and treats each one like a TCP client. Every command works, including
+pub/sub, so a dashboard can SUBSCRIBE and get messages pushed as they're
+published.
+
+Key concepts:
+- RESP Inside: Messages from the browser carry RESP commands, or inline
+  commands like "SET name John" (a missing final newline is added);
+  messages to the browser are binary and hold one or more complete RESP
+  replies: a batch of replies is sent as one frame, and a streamed reply
+  as one message fragmented into several
+- Same Peer: A WebSocket connection is wrapped as a net.Conn, so it goes
+  through the same readLoop, writeLoop and server loop as a TCP client
+- Origins: Browsers let any page open a WebSocket to any address, so only
+  pages from the same origin are accepted unless -websocketOrigins allows
+  others ("*" allows every origin)
+- Handshake Timeout: A client has 10 seconds to send its handshake
+  request; one that doesn't is disconnected instead of holding a
+  connection open before it ever becomes a client
+*/
+
+/*
+websocketGUID is the key suffix RFC 6455 uses to compute Sec-WebSocket-Accept
+*/
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+/*
+websocketMaxFrame is the largest frame payload accepted from a client
+
+Same as Redis' default proto-max-bulk-len.
+*/
+const websocketMaxFrame = 512 << 20
+
+/*
+websocketReadHeaderTimeout is how long a client may take to send its
+handshake request, so a slow or idle one can't hold a connection open
+before it becomes a client
+*/
+const websocketReadHeaderTimeout = 10 * time.Second
+
+/*
+websocketMaxControlFrame is the largest payload of a ping, pong or close
+frame (RFC 6455 section 5.5)
+*/
+const websocketMaxControlFrame = 125
+
+/*
+WebSocket opcodes (RFC 6455 section 5.2)
+*/
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+var (
+	errWebSocketUnmasked = errors.New("websocket: client frame is not masked")
+	errWebSocketTooLarge = errors.New("websocket: frame too large")
+	errWebSocketOpcode   = errors.New("websocket: unknown opcode")
+	errWebSocketControl  = errors.New("websocket: control frame too large or fragmented")
+)
+
+/*
+serveWebSocket accepts WebSocket clients on the configured address
+
+It runs for the lifetime of the server, like acceptLoop, and returns
+http.ErrServerClosed after Shutdown.
+*/
+func (s *Server) serveWebSocket() error {
+	ln, err := net.Listen("tcp", s.WebSocketAddress)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.websocketAddr = ln.Addr()
+	s.mu.Unlock()
+
+	slog.Info("WebSocket bridge running", "websocketAddress", s.WebSocketAddress)
+	return s.websocketServer.Serve(ln)
+}
+
+/*
+WebSocketAddr returns the address the WebSocket bridge listens on, nil
+until it's bound or when the bridge isn't configured
+
+With a WebSocketAddress of ":0" this is where to find the bridge.
+*/
+func (s *Server) WebSocketAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.websocketAddr
+}
+
+/*
+upgradeWebSocket performs the opening handshake and hands the connection to the server
+
+Returns: 400 for requests that aren't a WebSocket handshake, 403 for an
+origin that isn't allowed
+*/
+func (s *Server) upgradeWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return
+	}
+	if !s.websocketOriginAllowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return
+	}
+	connection, rw, err := hijacker.Hijack()
+	if err != nil {
+		slog.Error("websocket hijack error", "err", err)
+		return
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		connection.Close()
+		return
+	}
+
+	// The handler's goroutine serves the client from here on, like acceptLoop's
+	s.handleConnection(&wsConn{Conn: connection, reader: rw.Reader})
+}
+
+/*
+websocketOriginAllowed checks the Origin header against -websocketOrigins
+
+Requests without an Origin header don't come from a browser page and are
+always allowed; otherwise the origin must match the host the request was
+sent to, or be listed.
+*/
+func (s *Server) websocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range strings.Split(s.WebSocketOrigins, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || (allowed != "" && strings.EqualFold(allowed, origin)) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+/*
+headerHasToken reports whether a comma-separated header contains token (case-insensitive)
+*/
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+wsConn adapts a WebSocket connection to net.Conn
+
+Read returns the payloads of the client's data messages as one byte
+stream, answering pings and close frames on the way. Write sends each call
+as one binary message, and WriteBuffers a whole batch of replies.
+*/
+type wsConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	// State of the frame being read (only used by the reading goroutine)
+	remaining int64   // payload bytes left in the current frame
+	mask      [4]byte // masking key of the current frame
+	maskPos   int     // position in the payload, for unmasking
+	text      bool    // the current message is a text message
+	final     bool    // the current frame ends its message
+	last      byte    // the last payload byte read
+	newline   bool    // a newline must be added before the next frame
+
+	writeMu   sync.Mutex // frames are written by the writer and the reader (pongs)
+	continued bool       // the last data frame written left its message open
+	closeOnce sync.Once
+}
+
+/*
+Read reads message payloads as a continuous stream
+*/
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		// An inline command sent in a text message may lack its newline
+		if c.newline {
+			c.newline = false
+			p[0] = '\n'
+			return 1, nil
+		}
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.reader.Read(p)
+	for i := range n {
+		p[i] ^= c.mask[c.maskPos%4]
+		c.maskPos++
+	}
+	c.remaining -= int64(n)
+
+	if n > 0 {
+		c.last = p[n-1]
+		if c.remaining == 0 && c.final && c.text && c.last != '\n' {
+			c.newline = true
+		}
+	}
+	return n, err
+}
+
+/*
+nextFrame reads frame headers until a data frame with a payload starts
+
+Control frames are handled on the spot: pings are answered with pongs and
+a close frame is echoed before reporting io.EOF.
+*/
+func (c *wsConn) nextFrame() error {
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return err
+		}
+		final := header[0]&0x80 != 0
+		opcode := header[0] & 0x0F
+		if header[1]&0x80 == 0 {
+			return errWebSocketUnmasked
+		}
+
+		length := int64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+				return err
+			}
+			length = int64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+				return err
+			}
+			length = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+		}
+		if length > websocketMaxFrame {
+			return errWebSocketTooLarge
+		}
+		// Control frames are at most 125 bytes and never fragmented; checked before their payload is allocated
+		if opcode&0x8 != 0 && (length > websocketMaxControlFrame || !final) {
+			return errWebSocketControl
+		}
+
+		var mask [4]byte
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return err
+		}
+
+		switch opcode {
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			if opcode != wsOpContinuation {
+				c.text = opcode == wsOpText
+			}
+			c.final = final
+			c.mask, c.maskPos, c.remaining = mask, 0, length
+			if length > 0 {
+				return nil
+			}
+			if final && c.text && c.last != '\n' {
+				c.newline = true
+				return nil
+			}
+
+		case wsOpPing, wsOpPong, wsOpClose:
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(c.reader, payload); err != nil {
+				return err
+			}
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+			switch opcode {
+			case wsOpPing:
+				if err := c.writeFrame(wsOpPong, payload); err != nil {
+					return err
+				}
+			case wsOpClose:
+				c.closeOnce.Do(func() { c.writeFrame(wsOpClose, payload) })
+				return io.EOF
+			}
+
+		default:
+			return errWebSocketOpcode
+		}
+	}
+}
+
+/*
+Write sends p as one binary message
+*/
+func (c *wsConn) Write(p []byte) (int, error) {
+	bufs := net.Buffers{p}
+	if _, err := c.WriteBuffers(&bufs, false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/*
+WriteBuffers sends bufs in one frame, so a batch of replies arrives as one
+message
+
+With more set, the message is left open and the next call continues it,
+so a streamed reply also arrives in a single message (see buffersWriter).
+
+Returns: The number of payload bytes written
+*/
+func (c *wsConn) WriteBuffers(bufs *net.Buffers, more bool) (int64, error) {
+	opcode := byte(wsOpBinary)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.continued {
+		opcode = wsOpContinuation
+	}
+	c.continued = more
+	return c.writeFrameLocked(opcode, !more, *bufs)
+}
+
+/*
+Close sends a close frame, unless one was exchanged already, and closes the connection
+*/
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() { c.writeFrame(wsOpClose, nil) })
+	return c.Conn.Close()
+}
+
+/*
+writeFrame writes a single unmasked, unfragmented frame
+*/
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err := c.writeFrameLocked(opcode, true, net.Buffers{payload})
+	return err
+}
+
+/*
+writeFrameLocked writes an unmasked frame holding payload, with one
+writev; final is cleared on all but the last frame of a message
+
+The caller holds writeMu.
+*/
+func (c *wsConn) writeFrameLocked(opcode byte, final bool, payload net.Buffers) (int64, error) {
+	length := 0
+	for _, buf := range payload {
+		length += len(buf)
+	}
+
+	header := make([]byte, 0, 10)
+	if final {
+		header = append(header, 0x80|opcode)
+	} else {
+		header = append(header, opcode)
+	}
+	switch {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	buffers := append(net.Buffers{header}, payload...)
+	n, err := buffers.WriteTo(c.Conn)
+	return max(n-int64(len(header)), 0), err
+}
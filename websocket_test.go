@@ -0,0 +1,333 @@
+package goredis_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debarshee2004/goredis"
+)
+
+/*
+startWebSocketServer starts a server with the WebSocket bridge on a free
+port, after setup (which may be nil) has configured it
+*/
+func startWebSocketServer(t *testing.T, setup func(server *goredis.Server)) *goredis.Server {
+	t.Helper()
+
+	server := startServer(t, func(server *goredis.Server) {
+		server.WebSocketAddress = "127.0.0.1:0"
+		if setup != nil {
+			setup(server)
+		}
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for server.WebSocketAddr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("WebSocket bridge did not start listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return server
+}
+
+/*
+wsClient is a WebSocket connection to a test server, speaking raw frames
+*/
+type wsClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+/*
+dialWebSocket opens a connection to the bridge and sends the opening
+handshake, with extra added to its headers
+
+Returns: The client and the handshake response, which the caller checks
+*/
+func dialWebSocket(t *testing.T, server *goredis.Server, extra string) (*wsClient, *http.Response) {
+	t.Helper()
+
+	addr := server.WebSocketAddr().String()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// The key and its accept value are the example of RFC 6455 section 1.3
+	request := "GET / HTTP/1.1\r\nHost: " + addr + "\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n" + extra + "\r\n"
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("handshake response: %v", err)
+	}
+	return &wsClient{t: t, conn: conn, reader: reader}, response
+}
+
+/*
+upgradeHeaders are the headers that make a request a WebSocket handshake
+*/
+const upgradeHeaders = "Upgrade: websocket\r\nConnection: Upgrade\r\n"
+
+/*
+dialUpgraded opens a connection to the bridge and checks the handshake succeeds
+*/
+func dialUpgraded(t *testing.T, server *goredis.Server) *wsClient {
+	t.Helper()
+
+	client, response := dialWebSocket(t, server, upgradeHeaders)
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake: got %s, want 101", response.Status)
+	}
+	return client
+}
+
+/*
+writeFrame sends a masked frame, as clients must
+*/
+func (c *wsClient) writeFrame(opcode byte, final bool, payload []byte) {
+	c.t.Helper()
+
+	header := []byte{opcode, 0x80}
+	if final {
+		header[0] |= 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		header[1] |= byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		header[1] |= 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header[1] |= 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame := append(header, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatalf("writing frame: %v", err)
+	}
+}
+
+/*
+wsFrame is a frame read from the server
+*/
+type wsFrame struct {
+	opcode  byte
+	final   bool
+	payload []byte
+}
+
+/*
+readFrame reads one frame, which the server never masks
+
+Returns: The frame, or an error if the connection ends first
+*/
+func (c *wsClient) readFrame() (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return wsFrame{}, err
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Fatal("server frame is masked")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return wsFrame{}, err
+	}
+	return wsFrame{opcode: header[0] & 0x0F, final: header[0]&0x80 != 0, payload: payload}, nil
+}
+
+/*
+expectFrame reads a frame and checks it's a final one with the given opcode and payload
+*/
+func (c *wsClient) expectFrame(opcode byte, payload string) {
+	c.t.Helper()
+
+	frame, err := c.readFrame()
+	if err != nil {
+		c.t.Fatalf("reading frame: %v", err)
+	}
+	if frame.opcode != opcode || !frame.final || string(frame.payload) != payload {
+		c.t.Fatalf("got frame %#x (final %v) %q, want final %#x %q", frame.opcode, frame.final, frame.payload, opcode, payload)
+	}
+}
+
+/*
+expectProtocolError checks the server answers a protocol error with the
+given message and ends the connection, with or without a close frame
+*/
+func (c *wsClient) expectProtocolError(message string) {
+	c.t.Helper()
+
+	c.expectFrame(0x2, "-ERR Protocol error: "+message+"\r\n")
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		if frame.opcode != 0x8 {
+			c.t.Fatalf("got frame %#x %q, want the connection closed", frame.opcode, frame.payload)
+		}
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	server := startWebSocketServer(t, nil)
+
+	client, response := dialWebSocket(t, server, upgradeHeaders)
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got %s, want 101", response.Status)
+	}
+	if got := response.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept %q, want the RFC 6455 example", got)
+	}
+
+	// An inline command in a text message doesn't need its newline
+	client.writeFrame(0x1, true, []byte("PING"))
+	client.expectFrame(0x2, "+PONG\r\n")
+	client.writeFrame(0x2, true, []byte("*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n"))
+	client.expectFrame(0x2, "$-1\r\n")
+
+	// A close frame is echoed before the server hangs up
+	client.writeFrame(0x8, true, []byte{0x03, 0xE8})
+	client.expectFrame(0x8, "\x03\xE8")
+}
+
+func TestWebSocketOrigins(t *testing.T) {
+	server := startWebSocketServer(t, func(server *goredis.Server) {
+		server.WebSocketOrigins = "https://app.example, https://admin.example"
+	})
+	addr := server.WebSocketAddr().String()
+
+	tests := []struct {
+		name    string
+		headers string
+		want    int
+	}{
+		{"no origin", upgradeHeaders, http.StatusSwitchingProtocols},
+		{"same origin", upgradeHeaders + "Origin: http://" + addr + "\r\n", http.StatusSwitchingProtocols},
+		{"listed origin", upgradeHeaders + "Origin: https://admin.example\r\n", http.StatusSwitchingProtocols},
+		{"other origin", upgradeHeaders + "Origin: https://evil.example\r\n", http.StatusForbidden},
+		{"not a handshake", "Origin: https://app.example\r\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, response := dialWebSocket(t, server, tt.headers)
+			if response.StatusCode != tt.want {
+				t.Errorf("got %s, want %d", response.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketFragmentedMessages(t *testing.T) {
+	server := startWebSocketServer(t, nil)
+	client := dialUpgraded(t, server)
+
+	// A ping between the fragments is answered at once, without ending the message
+	client.writeFrame(0x1, false, []byte("SET gree"))
+	client.writeFrame(0x9, true, []byte("are you there"))
+	client.expectFrame(0xA, "are you there")
+	client.writeFrame(0x0, false, []byte("ting hel"))
+	client.writeFrame(0x0, true, []byte("lo"))
+	client.expectFrame(0x2, "+OK\r\n")
+
+	// A RESP command may be split anywhere, and a pong from the client is ignored
+	command := []byte("*2\r\n$3\r\nGET\r\n$8\r\ngreeting\r\n")
+	client.writeFrame(0x2, false, command[:9])
+	client.writeFrame(0xA, true, nil)
+	client.writeFrame(0x0, true, command[9:])
+	client.expectFrame(0x2, "$5\r\nhello\r\n")
+}
+
+func TestWebSocketRejectsBadControlFrames(t *testing.T) {
+	server := startWebSocketServer(t, nil)
+
+	t.Run("oversized", func(t *testing.T) {
+		client := dialUpgraded(t, server)
+		client.writeFrame(0x9, true, bytes.Repeat([]byte("x"), 126))
+		client.expectProtocolError("websocket: control frame too large or fragmented")
+	})
+	t.Run("fragmented", func(t *testing.T) {
+		client := dialUpgraded(t, server)
+		client.writeFrame(0x9, false, []byte("x"))
+		client.expectProtocolError("websocket: control frame too large or fragmented")
+	})
+	t.Run("unmasked", func(t *testing.T) {
+		client := dialUpgraded(t, server)
+		client.conn.Write([]byte{0x81, 0x04, 'P', 'I', 'N', 'G'})
+		client.expectProtocolError("websocket: client frame is not masked")
+	})
+}
+
+func TestWebSocketBatchesReplies(t *testing.T) {
+	server := startWebSocketServer(t, nil)
+	element := bytes.Repeat([]byte("x"), 8<<10)
+	elements := make([][]byte, 1000)
+	for i := range elements {
+		elements[i] = element
+	}
+	server.Storage().Push([]byte("big"), elements, false)
+	client := dialUpgraded(t, server)
+
+	// The PINGs are answered while the writer is busy with the streamed
+	// LRANGE, which fills the socket since nothing reads it yet
+	client.writeFrame(0x2, true, []byte("LRANGE big 0 -1\r\nPING\r\nPING\r\nPING\r\n"))
+	time.Sleep(100 * time.Millisecond)
+
+	// The streamed reply is one message, in several frames
+	var reply []byte
+	frames := 0
+	for {
+		frame, err := client.readFrame()
+		if err != nil {
+			t.Fatalf("reading LRANGE reply: %v", err)
+		}
+		if wantOpcode := map[bool]byte{true: 0x2, false: 0x0}[frames == 0]; frame.opcode != wantOpcode {
+			t.Fatalf("frame %d of the LRANGE reply has opcode %#x, want %#x", frames, frame.opcode, wantOpcode)
+		}
+		reply = append(reply, frame.payload...)
+		frames++
+		if frame.final {
+			break
+		}
+	}
+	if frames < 2 || !strings.HasPrefix(string(reply), "*1000\r\n$8192\r\nxxx") || len(reply) < 1000*(8<<10) {
+		t.Fatalf("LRANGE reply: %d bytes in %d frames, want the whole list in several", len(reply), frames)
+	}
+
+	// The replies queued behind it go out as one batch, in one frame
+	client.expectFrame(0x2, "+PONG\r\n+PONG\r\n+PONG\r\n")
+}
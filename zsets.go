@@ -0,0 +1,748 @@
+package goredis
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+/*
+Sorted Set Storage for Redis Clone
+
+This file implements the sorted set (zset) type: a set of unique members,
+each with a floating point score, kept ordered by score. It adds the sorted
+set operations to Storage; the commands using them live in commands.go.
+
+Key concepts:
+- Ordering: Members are sorted by score, and members with equal scores are
+  sorted lexicographically (byte by byte), exactly like Redis
+- Ranks: A member's rank is its 0-based position in that order
+- Ranges: Members can be selected by rank, by score interval, or by
+  lexicographic interval (meant for members that all share one score)
+- Scores: 64-bit floats; -inf and +inf are valid scores, NaN never is
+- No Empty Sorted Sets: A sorted set that loses its last member is deleted
+*/
+
+/*
+zsetItem is a member together with its score
+*/
+type zsetItem struct {
+	member string
+	score  float64
+}
+
+/*
+less reports whether a sorts before b in sorted set order
+*/
+func (a zsetItem) less(b zsetItem) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.member < b.member
+}
+
+/*
+zsetValue is the value of a sorted set key
+
+The members are kept twice: in a map for O(1) score lookups, and in a
+skiplist ordered by (score, member) for ranks and ranges (see
+skiplist.go), so adding or removing a member takes O(log n).
+*/
+type zsetValue struct {
+	scores map[string]float64
+	sorted *skiplist
+}
+
+/*
+newZSetValue creates an empty sorted set
+*/
+func newZSetValue() *zsetValue {
+	return &zsetValue{scores: make(map[string]float64), sorted: newSkiplist()}
+}
+
+/*
+len returns the number of members
+*/
+func (z *zsetValue) len() int {
+	return z.sorted.length
+}
+
+/*
+set adds member with score, or moves an existing member to its new score
+
+Returns: true if the member was added, false if it already existed
+*/
+func (z *zsetValue) set(member string, score float64) bool {
+	old, exists := z.scores[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.sorted.remove(zsetItem{member: member, score: old})
+	}
+
+	z.scores[member] = score
+	z.sorted.insert(zsetItem{member: member, score: score})
+	return !exists
+}
+
+/*
+zaddOptions are the ZADD flags that control how a member is added or updated
+*/
+type zaddOptions struct {
+	nx, xx, gt, lt, ch, incr bool
+}
+
+/*
+zaddResult tells what add did with a member
+*/
+type zaddResult int
+
+const (
+	zaddNop       zaddResult = iota // the options prevented the change
+	zaddAdded                       // the member is new
+	zaddUpdated                     // the member existed and its score changed
+	zaddUnchanged                   // the member existed with that score already
+)
+
+/*
+add adds or updates member following the ZADD options
+
+With opts.incr, score is added to the current score instead of replacing it.
+
+Returns: The member's score after the call, what happened, and errScoreNaN
+if incrementing gives NaN
+*/
+func (z *zsetValue) add(member string, score float64, opts zaddOptions) (float64, zaddResult, error) {
+	old, exists := z.scores[member]
+	if (exists && opts.nx) || (!exists && opts.xx) {
+		return old, zaddNop, nil
+	}
+
+	if opts.incr {
+		score += old
+		if math.IsNaN(score) {
+			return 0, zaddNop, errScoreNaN
+		}
+	}
+
+	if !exists {
+		z.set(member, score)
+		return score, zaddAdded, nil
+	}
+	if (opts.gt && score <= old) || (opts.lt && score >= old) {
+		return old, zaddNop, nil
+	}
+	if score == old {
+		return score, zaddUnchanged, nil
+	}
+	z.set(member, score)
+	return score, zaddUpdated, nil
+}
+
+/*
+remove deletes member, returning false if it wasn't present
+*/
+func (z *zsetValue) remove(member string) bool {
+	score, exists := z.scores[member]
+	if !exists {
+		return false
+	}
+	delete(z.scores, member)
+	z.sorted.remove(zsetItem{member: member, score: score})
+	return true
+}
+
+/*
+zsetOf returns the sorted set held by an entry
+
+Returns: nil for a missing entry, ErrWrongType if the entry holds another type
+*/
+func zsetOf(e *entry) (*zsetValue, error) {
+	if e == nil {
+		return nil, nil
+	}
+	z, ok := e.value.(*zsetValue)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return z, nil
+}
+
+/*
+parseScore parses a score argument the way Redis does
+
+Accepts anything strconv.ParseFloat does, including "inf", "+inf" and
+"-inf", but rejects NaN.
+*/
+func parseScore(arg []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errNotFloat
+	}
+	return score, nil
+}
+
+/*
+formatScore renders a score the way Redis replies with it
+
+Scores use the shortest representation that parses back to the same
+value, so 1.5 is "1.5" and 10 is "10"; infinities are "inf" and "-inf".
+*/
+func formatScore(score float64) []byte {
+	switch {
+	case math.IsInf(score, 1):
+		return []byte("inf")
+	case math.IsInf(score, -1):
+		return []byte("-inf")
+	}
+	return []byte(strconv.FormatFloat(score, 'g', -1, 64))
+}
+
+/*
+zrangeBy selects what the start and stop of a ZRANGE are compared against
+*/
+type zrangeBy int
+
+const (
+	zrangeByRank zrangeBy = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+/*
+scoreBound is one end of a score interval, like 5 or (5 in ZRANGEBYSCORE
+*/
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+/*
+scoreRange is a score interval, inclusive unless a bound says otherwise
+*/
+type scoreRange struct {
+	min, max scoreBound
+}
+
+/*
+parseScoreBound parses a score interval bound
+
+A leading "(" makes the bound exclusive; "-inf" and "+inf" are unbounded.
+
+Returns: errMinMaxNotFloat if the rest isn't a valid float
+*/
+func parseScoreBound(arg []byte) (scoreBound, error) {
+	var bound scoreBound
+	if len(arg) > 0 && arg[0] == '(' {
+		bound.exclusive = true
+		arg = arg[1:]
+	}
+
+	value, err := parseScore(arg)
+	if err != nil {
+		return scoreBound{}, errMinMaxNotFloat
+	}
+	bound.value = value
+	return bound, nil
+}
+
+/*
+gteMin reports whether score is at or above the lower end of the range
+*/
+func (r scoreRange) gteMin(score float64) bool {
+	if r.min.exclusive {
+		return score > r.min.value
+	}
+	return score >= r.min.value
+}
+
+/*
+lteMax reports whether score is at or below the upper end of the range
+*/
+func (r scoreRange) lteMax(score float64) bool {
+	if r.max.exclusive {
+		return score < r.max.value
+	}
+	return score <= r.max.value
+}
+
+/*
+lexBound is one end of a lexicographic interval, like [a, (a, - or +
+
+infinite is -1 for "-" (before every member), 1 for "+" (after every
+member) and 0 for a bound with a value.
+*/
+type lexBound struct {
+	value     string
+	exclusive bool
+	infinite  int
+}
+
+/*
+lexRange is a lexicographic interval of members
+*/
+type lexRange struct {
+	min, max lexBound
+}
+
+/*
+parseLexBound parses a lexicographic interval bound
+
+Redis requires every bound to be "-", "+", or start with "[" (inclusive)
+or "(" (exclusive).
+
+Returns: errMinMaxNotLex for anything else
+*/
+func parseLexBound(arg []byte) (lexBound, error) {
+	if len(arg) == 0 {
+		return lexBound{}, errMinMaxNotLex
+	}
+
+	switch arg[0] {
+	case '-':
+		if len(arg) == 1 {
+			return lexBound{infinite: -1}, nil
+		}
+	case '+':
+		if len(arg) == 1 {
+			return lexBound{infinite: 1}, nil
+		}
+	case '[':
+		return lexBound{value: string(arg[1:])}, nil
+	case '(':
+		return lexBound{value: string(arg[1:]), exclusive: true}, nil
+	}
+	return lexBound{}, errMinMaxNotLex
+}
+
+/*
+compare orders member against the bound: -1 before it, 0 on it, 1 after it
+*/
+func (b lexBound) compare(member string) int {
+	if b.infinite != 0 {
+		return -b.infinite
+	}
+	return strings.Compare(member, b.value)
+}
+
+/*
+gteMin reports whether member is at or above the lower end of the range
+*/
+func (r lexRange) gteMin(member string) bool {
+	c := r.min.compare(member)
+	return c > 0 || (c == 0 && !r.min.exclusive)
+}
+
+/*
+lteMax reports whether member is at or below the upper end of the range
+*/
+func (r lexRange) lteMax(member string) bool {
+	c := r.max.compare(member)
+	return c < 0 || (c == 0 && !r.max.exclusive)
+}
+
+/*
+scoreSpan returns the bounds [lo, hi) of the members whose score is within r
+*/
+func (z *zsetValue) scoreSpan(r scoreRange) (int, int) {
+	lo := z.sorted.search(func(item zsetItem) bool { return r.gteMin(item.score) })
+	hi := z.sorted.search(func(item zsetItem) bool { return !r.lteMax(item.score) })
+	return lo, max(lo, hi)
+}
+
+/*
+lexSpan returns the bounds [lo, hi) of the members that are within r
+*/
+func (z *zsetValue) lexSpan(r lexRange) (int, int) {
+	lo := z.sorted.search(func(item zsetItem) bool { return r.gteMin(item.member) })
+	hi := z.sorted.search(func(item zsetItem) bool { return !r.lteMax(item.member) })
+	return lo, max(lo, hi)
+}
+
+/*
+window returns the members with ranks lo to hi-1, after applying direction and LIMIT
+
+When rev is set the members come highest first. offset skips that many
+members and count caps the result; a negative count means no cap and a
+negative offset gives nothing, like in Redis.
+*/
+func (z *zsetValue) window(lo, hi int, rev bool, offset, count int) []zsetItem {
+	if offset < 0 || lo >= hi {
+		return nil
+	}
+
+	n := hi - lo - offset
+	if n <= 0 {
+		return nil
+	}
+	if count >= 0 {
+		n = min(n, count)
+	}
+
+	// Find the first node once, then walk from it
+	items := make([]zsetItem, n)
+	if rev {
+		node := z.sorted.at(hi - 1 - offset)
+		for i := range items {
+			items[i] = node.item
+			node = node.backward
+		}
+	} else {
+		node := z.sorted.at(lo + offset)
+		for i := range items {
+			items[i] = node.item
+			node = node.next()
+		}
+	}
+	return items
+}
+
+/*
+writeZSet returns the sorted set at key for modification, creating it when missing
+
+Must be called with the write lock held.
+*/
+func (s *Storage) writeZSet(keyStr string) (*zsetValue, *entry, error) {
+	e := s.lookupWrite(keyStr)
+	z, err := zsetOf(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	if z == nil {
+		z = newZSetValue()
+		e = newEntry(z)
+		s.putEntry(keyStr, e)
+	}
+	e.touch()
+	return z, e, nil
+}
+
+/*
+ZAdd adds members with their scores, or updates the scores of existing members
+
+Implements Redis ZADD without INCR. The options restrict what happens:
+  - nx: only add new members, never update existing ones
+  - xx: only update existing members, never add new ones
+  - gt / lt: only update a member if its new score is greater / lower
+  - ch: count changed members as well as added ones
+
+A missing key is created, unless nothing ends up being added.
+
+Returns: The number of members that were added (and changed, with ch)
+*/
+func (s *Storage) ZAdd(key []byte, items []zsetItem, opts zaddOptions) (int, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		if err := s.checkElementSize(len(item.member)); err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	// With XX nothing is added
+	if !opts.xx {
+		if err := s.checkMembersAdded(keyStr, TypeZSet, len(items), func(i int) string { return items[i].member }); err != nil {
+			return 0, err
+		}
+	}
+	z, _, err := s.writeZSet(keyStr)
+	if err != nil {
+		return 0, err
+	}
+
+	count, modified := 0, false
+	for _, item := range items {
+		// Without INCR the score is used as is, so add can't fail
+		_, result, _ := z.add(item.member, item.score, opts)
+		if result == zaddAdded || (opts.ch && result == zaddUpdated) {
+			count++
+		}
+		if result == zaddAdded || result == zaddUpdated {
+			modified = true
+		}
+	}
+
+	s.deleteIfEmptyZSet(keyStr, z)
+	if modified {
+		s.changed(keyStr)
+	}
+	return count, nil
+}
+
+/*
+ZIncrBy adds increment to the score of member
+
+Implements Redis ZINCRBY and ZADD INCR, which takes the same options as
+ZAdd. A missing member is created with the increment as its score, and a
+missing key is created as well.
+
+Returns: The new score, false if the options prevented the update, or
+errScoreNaN if the result is not a number (for example +inf plus -inf)
+*/
+func (s *Storage) ZIncrBy(key []byte, increment float64, member []byte, opts zaddOptions) (float64, bool, error) {
+	if err := s.checkKey(key); err != nil {
+		return 0, false, err
+	}
+	if err := s.checkElements(member); err != nil {
+		return 0, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	if !opts.xx {
+		if err := s.checkMembersAdded(keyStr, TypeZSet, 1, func(int) string { return string(member) }); err != nil {
+			return 0, false, err
+		}
+	}
+	z, _, err := s.writeZSet(keyStr)
+	if err != nil {
+		return 0, false, err
+	}
+
+	opts.incr = true
+	score, result, err := z.add(string(member), increment, opts)
+	s.deleteIfEmptyZSet(keyStr, z)
+	if err != nil || result == zaddNop {
+		return 0, false, err
+	}
+	s.changed(keyStr)
+	return score, true, nil
+}
+
+/*
+ZScore returns the score of member
+
+Implements Redis ZSCORE.
+
+Returns: The score, and false if the key or the member doesn't exist
+*/
+func (s *Storage) ZScore(key, member []byte) (float64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	z, err := zsetOf(e)
+	if err != nil || z == nil {
+		return 0, false, err
+	}
+	e.touch()
+
+	score, exists := z.scores[string(member)]
+	return score, exists, nil
+}
+
+/*
+ZRem removes members from a sorted set
+
+Implements Redis ZREM. The key is deleted once the sorted set is empty.
+
+Returns: The number of members that were removed
+*/
+func (s *Storage) ZRem(key []byte, members [][]byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	e := s.lookupWrite(keyStr)
+	z, err := zsetOf(e)
+	if err != nil || z == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if z.remove(string(member)) {
+			removed++
+		}
+	}
+
+	s.deleteIfEmptyZSet(keyStr, z)
+	e.touch()
+	if removed > 0 {
+		s.changed(keyStr)
+	}
+	return removed, nil
+}
+
+/*
+ZRange returns the members with ranks between start and stop (both inclusive)
+
+Implements Redis ZRANGE by rank. Negative ranks count from the end; out of
+range ranks are clamped like in LRANGE. With rev, ranks are counted from
+the highest score and the members come highest first.
+*/
+func (s *Storage) ZRange(key []byte, start, stop int, rev bool) ([]zsetItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	z, err := zsetOf(e)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	e.touch()
+
+	length := z.len()
+	from, to, ok := normalizeRange(start, stop, length)
+	if !ok {
+		return nil, nil
+	}
+	if rev {
+		from, to = length-to, length-from
+	}
+	return z.window(from, to, rev, 0, -1), nil
+}
+
+/*
+ZRangeByScore returns the members whose score is within r
+
+Implements Redis ZRANGEBYSCORE and ZRANGE BYSCORE, including REV and
+LIMIT offset count.
+*/
+func (s *Storage) ZRangeByScore(key []byte, r scoreRange, rev bool, offset, count int) ([]zsetItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	z, err := zsetOf(e)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	e.touch()
+
+	lo, hi := z.scoreSpan(r)
+	return z.window(lo, hi, rev, offset, count), nil
+}
+
+/*
+ZRangeByLex returns the members that are within the lexicographic range r
+
+Implements Redis ZRANGEBYLEX and ZRANGE BYLEX, including REV and LIMIT
+offset count. Like in Redis, the result is only meaningful when every
+member has the same score.
+*/
+func (s *Storage) ZRangeByLex(key []byte, r lexRange, rev bool, offset, count int) ([]zsetItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	z, err := zsetOf(e)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	e.touch()
+
+	lo, hi := z.lexSpan(r)
+	return z.window(lo, hi, rev, offset, count), nil
+}
+
+/*
+ZCard returns the number of members in a sorted set
+
+Implements Redis ZCARD. Missing keys count as empty sorted sets.
+*/
+func (s *Storage) ZCard(key []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, err := zsetOf(s.lookupRead(string(key)))
+	if err != nil || z == nil {
+		return 0, err
+	}
+	return z.len(), nil
+}
+
+/*
+ZCount returns the number of members whose score is within r
+
+Implements Redis ZCOUNT.
+*/
+func (s *Storage) ZCount(key []byte, r scoreRange) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, err := zsetOf(s.lookupRead(string(key)))
+	if err != nil || z == nil {
+		return 0, err
+	}
+
+	lo, hi := z.scoreSpan(r)
+	return hi - lo, nil
+}
+
+/*
+ZLexCount returns the number of members within the lexicographic range r
+
+Implements Redis ZLEXCOUNT.
+*/
+func (s *Storage) ZLexCount(key []byte, r lexRange) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, err := zsetOf(s.lookupRead(string(key)))
+	if err != nil || z == nil {
+		return 0, err
+	}
+
+	lo, hi := z.lexSpan(r)
+	return hi - lo, nil
+}
+
+/*
+ZRandMember returns random members with their scores, without removing them
+
+Implements Redis ZRANDMEMBER with a count:
+  - count > 0: up to count distinct members (the whole sorted set if it's smaller)
+  - count < 0: exactly |count| members, which may repeat
+
+Returns: The chosen members, and false if the key doesn't exist
+*/
+func (s *Storage) ZRandMember(key []byte, count int) ([]zsetItem, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := s.lookupRead(string(key))
+	z, err := zsetOf(e)
+	if err != nil || z == nil {
+		return nil, false, err
+	}
+	e.touch()
+
+	// Negative count: independent picks, repetitions allowed
+	if count < 0 {
+		picked := make([]zsetItem, -count)
+		for i := range picked {
+			picked[i] = z.sorted.at(rand.IntN(z.len())).item
+		}
+		return picked, true, nil
+	}
+
+	// Positive count: distinct members, through a partial Fisher-Yates shuffle of a copy
+	count = min(count, z.len())
+	items := z.sorted.items()
+	for i := 0; i < count; i++ {
+		j := i + rand.IntN(len(items)-i)
+		items[i], items[j] = items[j], items[i]
+	}
+	return items[:count], true, nil
+}
+
+/*
+deleteIfEmptyZSet removes a sorted set key once its last member is gone
+
+Must be called with the write lock held.
+*/
+func (s *Storage) deleteIfEmptyZSet(keyStr string, z *zsetValue) {
+	if z.len() == 0 {
+		s.deleteEntry(keyStr)
+	}
+}